@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb"
+	"io"
+)
+
+// formats are the formats that dump writes, and load reads, by the name given to the -format flag
+var formats = map[string]scdb.Format{
+	"jsonl": scdb.FormatJSONLines,
+	"csv":   scdb.FormatCSV,
+}
+
+// runDump prints every live key-value pair of the store, along with its expiry, to `stdout`
+// in the format given by the -format flag
+func runDump(flags *flag.FlagSet, args []string, _ io.Reader, stdout io.Writer) error {
+	formatName := flags.String("format", "jsonl", "the format to print in: jsonl (JSON Lines) or csv")
+	path, _, err := parseArgs(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	format, err := parseFormat(flags, *formatName)
+	if err != nil {
+		return err
+	}
+
+	return withStore(path, readAccess, func(store *scdb.Store) error {
+		return store.Export(stdout, format)
+	})
+}
+
+// runLoad sets the key-value pairs read from `stdin`, in the format given by the -format flag,
+// creating the store if it does not exist. Key-value pairs that have already expired are skipped.
+func runLoad(flags *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error {
+	formatName := flags.String("format", "jsonl", "the format to read in: jsonl (JSON Lines) or csv")
+	path, _, err := parseArgs(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	format, err := parseFormat(flags, *formatName)
+	if err != nil {
+		return err
+	}
+
+	return withStore(path, createAccess, func(store *scdb.Store) error {
+		loaded, err := store.Import(stdin, format)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(stdout, "%d keys loaded\n", loaded)
+		return err
+	})
+}
+
+// parseFormat returns the format of the given name, printing the usage of the command if there is none
+func parseFormat(flags *flag.FlagSet, name string) (scdb.Format, error) {
+	format, ok := formats[name]
+	if !ok {
+		_, _ = fmt.Fprintf(flags.Output(), "unknown format %q\n", name)
+		flags.Usage()
+		return 0, errUsage
+	}
+
+	return format, nil
+}
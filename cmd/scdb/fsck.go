@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb"
+	"io"
+)
+
+// runFsck checks the files of the store for corruption, printing each problem found.
+// If the -repair flag is given, the store is rebuilt from whatever entries survive.
+//
+// It returns errProblemsFound if problems were found and not repaired.
+func runFsck(flags *flag.FlagSet, args []string, _ io.Reader, stdout io.Writer) error {
+	isRepair := flags.Bool("repair", false, "rebuild the store from whatever entries survive, if any problems are found")
+	path, _, err := parseArgs(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	var report *scdb.CheckReport
+	if *isRepair {
+		report, err = scdb.Repair(path)
+	} else {
+		report, err = scdb.Check(path)
+	}
+
+	if report != nil {
+		for _, problem := range report.Problems {
+			_, _ = fmt.Fprintln(stdout, problem)
+		}
+
+		_, _ = fmt.Fprintf(stdout, "%d problems, %d live keys, %d deleted keys, %d expired keys, %d entries\n",
+			len(report.Problems), report.LiveKeys, report.DeletedKeys, report.ExpiredKeys, report.Entries)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if report.IsRepaired {
+		_, _ = fmt.Fprintf(stdout, "repaired: %d keys recovered\n", report.RecoveredKeys)
+		return nil
+	}
+
+	if !report.IsOk() {
+		return errProblemsFound
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+// Command scdb works on the files of a store from the command line.
+//
+// Usage:
+//
+//	scdb <command> [flags] <store folder>
+//
+// The commands are:
+//
+//	compact  compacts the database file of the store, removing deleted, overwritten and expired entries
+//	del      deletes the given key from the store
+//	dump     prints every key-value pair of the store, with its expiry, as JSON Lines or CSV
+//	fsck     checks the files of the store for corruption, and repairs them if -repair is given
+//	get      prints the value of the given key
+//	keys     prints the keys of the store, one per line
+//	load     sets the key-value pairs read from the standard input, as printed by dump
+//	search   prints the key-value pairs whose keys start with the given term
+//	set      sets the given key to the given value
+//	stats    prints the number of live, deleted and expired keys, the dead bytes, the file sizes and the index load
+//
+// Run `scdb <command> -h` for the flags of a command.
+package main
+
+import (
+	goErrors "errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// errProblemsFound is returned by a command when it found problems in the store, which it has already printed
+var errProblemsFound = goErrors.New("problems found")
+
+// errKeyNotFound is returned by a command when the key it was given is not in the store
+var errKeyNotFound = goErrors.New("key not found")
+
+// errUsage is returned by a command when it is given the wrong arguments, after its usage is printed
+var errUsage = goErrors.New("wrong arguments")
+
+// command is a subcommand of the tool
+type command struct {
+	// usage is the synopsis of the command, after its name
+	usage string
+	// description is what the command does, in one line
+	description string
+	// run runs the command with the given arguments, which exclude the name of the command,
+	// reading any input from `stdin` and printing its output to `stdout`
+	run func(flags *flag.FlagSet, args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+// commands are the subcommands of the tool, by name
+var commands = map[string]*command{
+	"compact": {
+		usage:       "<store folder>",
+		description: "compacts the database file of the store, removing deleted, overwritten and expired entries",
+		run:         runCompact,
+	},
+	"del": {
+		usage:       "<store folder> <key>",
+		description: "deletes the given key from the store",
+		run:         runDel,
+	},
+	"dump": {
+		usage:       "[-format jsonl|csv] <store folder>",
+		description: "prints every key-value pair of the store, with its expiry, as JSON Lines or CSV",
+		run:         runDump,
+	},
+	"fsck": {
+		usage:       "[-repair] <store folder>",
+		description: "checks the files of the store for corruption, and repairs them if -repair is given",
+		run:         runFsck,
+	},
+	"get": {
+		usage:       "<store folder> <key>",
+		description: "prints the value of the given key",
+		run:         runGet,
+	},
+	"keys": {
+		usage:       "[-prefix prefix] <store folder>",
+		description: "prints the keys of the store, one per line",
+		run:         runKeys,
+	},
+	"load": {
+		usage:       "[-format jsonl|csv] <store folder> < dump.jsonl",
+		description: "sets the key-value pairs read from the standard input, as printed by dump",
+		run:         runLoad,
+	},
+	"search": {
+		usage:       "[-skip n] [-limit n] <store folder> <term>",
+		description: "prints the key-value pairs whose keys start with the given term",
+		run:         runSearch,
+	},
+	"set": {
+		usage:       "[-ttl duration] <store folder> <key> <value>",
+		description: "sets the given key to the given value",
+		run:         runSet,
+	},
+	"stats": {
+		usage:       "<store folder>",
+		description: "prints the number of live, deleted and expired keys, the dead bytes, the file sizes and the index load",
+		run:         runStats,
+	},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command named by the first of the given arguments, returning the exit code of the tool:
+// 0 on success, 1 if the command failed or found problems, and 2 if it was not used properly
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return 2
+	}
+
+	name := args[0]
+	cmd, ok := commands[name]
+	if !ok {
+		_, _ = fmt.Fprintf(stderr, "scdb: unknown command %q\n", name)
+		printUsage(stderr)
+		return 2
+	}
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "usage: scdb %s %s\n\n%s\n", name, cmd.usage, cmd.description)
+		flags.PrintDefaults()
+	}
+
+	err := cmd.run(flags, args[1:], stdin, stdout)
+	switch {
+	case err == nil:
+		return 0
+	case err == flag.ErrHelp:
+		return 0
+	case goErrors.Is(err, errProblemsFound):
+		return 1
+	case goErrors.Is(err, errUsage):
+		return 2
+	default:
+		_, _ = fmt.Fprintf(stderr, "scdb %s: %s\n", name, err)
+		return 1
+	}
+}
+
+// printUsage prints the usage of the tool, with a summary of each command
+func printUsage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	_, _ = fmt.Fprintf(w, "usage: scdb <command> [flags] <store folder>\n\ncommands:\n")
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "  %-9s %s\n", name, commands[name].description)
+	}
+}
+
+// parseArgs parses the flags in `args`, returning the path of the store folder that follows them
+// along with the other positional arguments. Exactly `numOfArgs` positional arguments must follow the folder.
+//
+// The usage of the command is printed if the arguments are wrong.
+func parseArgs(flags *flag.FlagSet, args []string, numOfArgs int) (string, []string, error) {
+	err := flags.Parse(args)
+	if err == flag.ErrHelp {
+		return "", nil, err
+	}
+	if err != nil {
+		// the flag set has printed the usage already
+		return "", nil, errUsage
+	}
+
+	if flags.NArg() != numOfArgs+1 {
+		flags.Usage()
+		return "", nil, errUsage
+	}
+
+	return flags.Arg(0), flags.Args()[1:], nil
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"github.com/sopherapps/go-scdb/scdb"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	dbPath := "testdb_cmd"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("RunWithoutAKnownCommandPrintsUsageAndReturns2", func(t *testing.T) {
+		for _, args := range [][]string{{}, {"foo", dbPath}} {
+			code, _, stderr := runTool(args...)
+			assert.Equal(t, 2, code)
+			assert.Contains(t, stderr, "usage: scdb <command>")
+		}
+	})
+
+	t.Run("RunWithWrongArgumentsPrintsTheUsageOfTheCommandAndReturns2", func(t *testing.T) {
+		for _, args := range [][]string{{"fsck"}, {"fsck", "-foo", dbPath}, {"fsck", dbPath, "extra"}} {
+			code, _, stderr := runTool(args...)
+			assert.Equal(t, 2, code)
+			assert.Contains(t, stderr, "usage: scdb fsck")
+		}
+	})
+
+	t.Run("FsckReturns0ForAnIntactStore", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar", "hey": "English"})
+
+		code, stdout, _ := runTool("fsck", dbPath)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "0 problems, 2 live keys, 0 deleted keys, 0 expired keys, 2 entries\n", stdout)
+	})
+
+	t.Run("FsckPrintsTheProblemsFoundAndReturns1", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar", "hey": "English"})
+		corruptFile(t, filepath.Join(dbPath, "dump.scdb"), []byte("English"))
+
+		code, stdout, _ := runTool("fsck", dbPath)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stdout, "dump.scdb at offset")
+		assert.Contains(t, stdout, "2 problems, 1 live keys")
+	})
+
+	t.Run("FsckWithRepairRebuildsTheStoreAndReturns0", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar", "hey": "English"})
+		corruptFile(t, filepath.Join(dbPath, "dump.scdb"), []byte("English"))
+
+		code, stdout, _ := runTool("fsck", "-repair", dbPath)
+		assert.Equal(t, 0, code)
+		assert.Contains(t, stdout, "repaired: 1 keys recovered\n")
+
+		code, _, _ = runTool("fsck", dbPath)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("FsckOfAFolderWithNoStorePrintsTheErrorAndReturns1", func(t *testing.T) {
+		code, _, stderr := runTool("fsck", dbPath)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr, "scdb fsck:")
+	})
+
+	t.Run("SetThenGetPrintsTheValue", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+
+		code, _, _ := runTool("set", dbPath, "foo", "bar")
+		assert.Equal(t, 0, code)
+
+		code, stdout, _ := runTool("get", dbPath, "foo")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "bar\n", stdout)
+	})
+
+	t.Run("SetWithTTLSetsAKeyThatExpires", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+
+		code, _, _ := runTool("set", "-ttl", "1s", dbPath, "foo", "bar")
+		assert.Equal(t, 0, code)
+		time.Sleep(1200 * time.Millisecond)
+
+		code, _, stderr := runTool("get", dbPath, "foo")
+		assert.Equal(t, 1, code)
+		assert.Equal(t, "scdb get: key not found\n", stderr)
+	})
+
+	t.Run("GetOfAMissingKeyPrintsKeyNotFoundAndReturns1", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar"})
+
+		code, stdout, stderr := runTool("get", dbPath, "hey")
+		assert.Equal(t, 1, code)
+		assert.Equal(t, "", stdout)
+		assert.Equal(t, "scdb get: key not found\n", stderr)
+	})
+
+	t.Run("DelDeletesTheKey", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar", "hey": "English"})
+
+		code, _, _ := runTool("del", dbPath, "foo")
+		assert.Equal(t, 0, code)
+
+		code, stdout, _ := runTool("keys", dbPath)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "hey\n", stdout)
+
+		code, _, stderr := runTool("del", dbPath, "foo")
+		assert.Equal(t, 1, code)
+		assert.Equal(t, "scdb del: key not found\n", stderr)
+	})
+
+	t.Run("WritesToAFolderWithNoStoreDoNotCreateIt", func(t *testing.T) {
+		for _, args := range [][]string{{"del", dbPath, "foo"}, {"compact", dbPath}} {
+			code, _, _ := runTool(args...)
+			assert.Equal(t, 1, code)
+			_, err := os.Stat(dbPath)
+			assert.True(t, os.IsNotExist(err))
+		}
+	})
+
+	t.Run("KeysWithPrefixPrintsOnlyTheKeysWithThatPrefix", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar", "hey": "English", "hi": "English"}, scdb.WithOrderedIndex())
+
+		code, stdout, _ := runTool("keys", "-prefix", "h", dbPath)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "hey\nhi\n", stdout)
+	})
+
+	t.Run("SearchPrintsTheMatchingKeyValuePairs", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar", "hey": "English"}, scdb.WithSearch())
+
+		code, stdout, _ := runTool("search", dbPath, "he")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "hey\tEnglish\n", stdout)
+
+		code, stdout, _ = runTool("search", "-skip", "1", dbPath, "he")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "", stdout)
+	})
+
+	t.Run("SetOnAStoreWithASearchIndexUpdatesTheIndex", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar"}, scdb.WithSearch())
+
+		code, _, _ := runTool("set", dbPath, "hey", "English")
+		assert.Equal(t, 0, code)
+
+		code, stdout, _ := runTool("search", dbPath, "h")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "hey\tEnglish\n", stdout)
+	})
+
+	t.Run("SearchOfAStoreWithNoSearchIndexPrintsTheErrorAndReturns1", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar"})
+
+		code, _, stderr := runTool("search", dbPath, "f")
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr, "scdb search:")
+	})
+
+	t.Run("StatsAndCompactReportTheGarbageInTheDatabaseFile", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar", "hey": "English"})
+		code, _, _ := runTool("set", dbPath, "foo", "baz")
+		assert.Equal(t, 0, code)
+
+		code, stdout, _ := runTool("stats", dbPath)
+		assert.Equal(t, 0, code)
+		assert.Contains(t, stdout, "live keys: 2\ndeleted keys: 0\nexpired keys: 0\n")
+		assert.NotContains(t, stdout, "dead bytes: 0\n")
+		assert.Contains(t, stdout, "dump.scdb: ")
+		assert.Contains(t, stdout, "index block load factor: min 0.0000, mean 0.0000, max 0.0")
+		assert.NotContains(t, stdout, "index.iscdb")
+
+		code, stdout, _ = runTool("compact", dbPath)
+		assert.Equal(t, 0, code)
+		assert.Contains(t, stdout, "compacted in ")
+		assert.NotContains(t, stdout, ": 0 bytes reclaimed")
+
+		code, stdout, _ = runTool("stats", dbPath)
+		assert.Equal(t, 0, code)
+		assert.Contains(t, stdout, "dead bytes: 0\n")
+	})
+
+	t.Run("DumpThenLoadCopiesTheKeyValuePairsToAnotherStore", func(t *testing.T) {
+		copyPath := "testdb_cmd_copy"
+		defer func() {
+			removeStore(t, dbPath)
+			removeStore(t, copyPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar", "hey": "English"})
+		code, _, _ := runTool("set", "-ttl", "1h", dbPath, "hi", "English")
+		assert.Equal(t, 0, code)
+
+		code, dump, _ := runTool("dump", dbPath)
+		assert.Equal(t, 0, code)
+		assert.Len(t, strings.Split(strings.TrimSpace(dump), "\n"), 3)
+
+		code, stdout, _ := runToolWithInput(dump, "load", copyPath)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "3 keys loaded\n", stdout)
+
+		for k, v := range map[string]string{"foo": "bar", "hey": "English", "hi": "English"} {
+			code, stdout, _ = runTool("get", copyPath, k)
+			assert.Equal(t, 0, code)
+			assert.Equal(t, v+"\n", stdout)
+		}
+
+		store, err := scdb.Open(copyPath, scdb.ReadOnly)
+		if err != nil {
+			t.Fatalf("error opening store: %s", err)
+		}
+		defer func() {
+			_ = store.Close()
+		}()
+		ttl, err := store.TTL([]byte("hi"))
+		if err != nil {
+			t.Fatalf("error getting ttl: %s", err)
+		}
+		assert.InDelta(t, time.Hour, *ttl, float64(time.Minute))
+	})
+
+	t.Run("DumpAndLoadWithTheCSVFormatUseCSV", func(t *testing.T) {
+		copyPath := "testdb_cmd_copy"
+		defer func() {
+			removeStore(t, dbPath)
+			removeStore(t, copyPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar"})
+
+		code, dump, _ := runTool("dump", "-format", "csv", dbPath)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "key,value,expiry\nZm9v,YmFy,0\n", dump)
+
+		code, stdout, _ := runToolWithInput(dump, "load", "-format", "csv", copyPath)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "1 keys loaded\n", stdout)
+
+		code, stdout, _ = runTool("get", copyPath, "foo")
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "bar\n", stdout)
+	})
+
+	t.Run("DumpOrLoadWithAnUnknownFormatPrintsTheUsageAndReturns2", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		createStore(t, dbPath, map[string]string{"foo": "bar"})
+
+		for _, name := range []string{"dump", "load"} {
+			code, _, stderr := runTool(name, "-format", "xml", dbPath)
+			assert.Equal(t, 2, code)
+			assert.Contains(t, stderr, "unknown format \"xml\"\nusage: scdb "+name)
+		}
+	})
+
+	t.Run("LoadOfInvalidInputPrintsTheErrorAndReturns1", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+
+		code, _, stderr := runToolWithInput("{\"key\":\"Zm9v\"}\nfoo\n", "load", dbPath)
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr, "scdb load: Invalid Record Error: record 2")
+
+		code, stdout, _ := runTool("keys", dbPath)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, "", stdout)
+	})
+}
+
+// runTool runs the tool with the given arguments, returning its exit code and what it printed
+// to the standard output and the standard error
+func runTool(args ...string) (int, string, string) {
+	return runToolWithInput("", args...)
+}
+
+// runToolWithInput runs the tool with the given arguments and the given standard input, returning its exit code
+// and what it printed to the standard output and the standard error
+func runToolWithInput(stdin string, args ...string) (int, string, string) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// createStore creates a store at the given path with the given key-value pairs and options, and closes it
+func createStore(t *testing.T, path string, records map[string]string, opts ...scdb.Option) {
+	store, err := scdb.Open(path, scdb.ReadWrite, opts...)
+	if err != nil {
+		t.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	for k, v := range records {
+		err = store.Set([]byte(k), []byte(v), nil)
+		if err != nil {
+			t.Fatalf("error setting key value: %s", err)
+		}
+	}
+}
+
+// removeStore is a utility to remove the old store just before a given test is run
+func removeStore(t *testing.T, path string) {
+	err := os.RemoveAll(path)
+	if err != nil {
+		t.Fatalf("error removing store: %s", err)
+	}
+}
+
+// corruptFile flips the last byte of the first occurrence of the given data in the file at the given path
+func corruptFile(t *testing.T, filePath string, data []byte) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("error reading file: %s", err)
+	}
+
+	idx := bytes.Index(content, data)
+	if idx < 0 {
+		t.Fatalf("%s not found in file", data)
+	}
+
+	addr := idx + len(data) - 1
+	content[addr] = ^content[addr]
+	err = os.WriteFile(filePath, content, 0666)
+	if err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+}
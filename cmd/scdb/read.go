@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb"
+	"io"
+	"math"
+	"strings"
+)
+
+// runGet prints the value of the given key, followed by a newline.
+//
+// It returns errKeyNotFound if the key is not in the store.
+func runGet(flags *flag.FlagSet, args []string, _ io.Reader, stdout io.Writer) error {
+	path, rest, err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return withStore(path, readAccess, func(store *scdb.Store) error {
+		value, err := store.Get([]byte(rest[0]))
+		if err != nil {
+			return err
+		}
+
+		if value == nil {
+			return errKeyNotFound
+		}
+
+		_, err = fmt.Fprintf(stdout, "%s\n", value)
+		return err
+	})
+}
+
+// runSearch prints the key-value pairs whose keys start with the given term, one tab-separated pair per line.
+// The store must have a search index.
+func runSearch(flags *flag.FlagSet, args []string, _ io.Reader, stdout io.Writer) error {
+	skip := flags.Uint64("skip", 0, "the number of results to skip")
+	limit := flags.Uint64("limit", 0, "the maximum number of results to print, or 0 for all of them")
+	path, rest, err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return withStore(path, readAccess, func(store *scdb.Store) error {
+		results, err := store.Search([]byte(rest[0]), *skip, *limit)
+		if err != nil {
+			return err
+		}
+
+		for _, kv := range results {
+			_, err = fmt.Fprintf(stdout, "%s\t%s\n", kv.K, kv.V)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// runKeys prints the keys of the store that start with the given prefix, one per line.
+// They are in sorted order if the store has an ordered index.
+func runKeys(flags *flag.FlagSet, args []string, _ io.Reader, stdout io.Writer) error {
+	prefix := flags.String("prefix", "", "print only the keys that start with this prefix")
+	path, _, err := parseArgs(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	return withStore(path, readAccess, func(store *scdb.Store) error {
+		keys, err := store.Keys([]byte(*prefix))
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			_, err = fmt.Fprintf(stdout, "%s\n", k)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// runStats prints the number of live, deleted and expired keys in the store, the size of the dead entries in its
+// database file, the sizes of its files, and the least, mean and most fraction of a block of its index that is filled
+func runStats(flags *flag.FlagSet, args []string, _ io.Reader, stdout io.Writer) error {
+	path, _, err := parseArgs(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	return withStore(path, readAccess, func(store *scdb.Store) error {
+		stats, err := store.Stats()
+		if err != nil {
+			return err
+		}
+
+		out := &strings.Builder{}
+		_, _ = fmt.Fprintf(out, "live keys: %d\ndeleted keys: %d\nexpired keys: %d\ndead bytes: %d\n",
+			stats.LiveKeys, stats.DeletedKeys, stats.ExpiredKeys, stats.DeadBytes)
+		_, _ = fmt.Fprintf(out, "%s: %d bytes\n", scdb.DbFileName, stats.DbFileSize)
+		if stats.SearchIndexFileSize > 0 {
+			_, _ = fmt.Fprintf(out, "%s: %d bytes\n", scdb.SearchIndexFileName, stats.SearchIndexFileSize)
+		}
+		if stats.OrderedIndexFileSize > 0 {
+			_, _ = fmt.Fprintf(out, "%s: %d bytes\n", scdb.OrderedIndexFileName, stats.OrderedIndexFileSize)
+		}
+
+		// an index can have thousands of blocks, so only a summary of their load factors is printed
+		minLoad, maxLoad, sumLoad := 1.0, 0.0, 0.0
+		for _, loadFactor := range stats.BlockLoadFactors {
+			minLoad = math.Min(minLoad, loadFactor)
+			maxLoad = math.Max(maxLoad, loadFactor)
+			sumLoad += loadFactor
+		}
+		_, _ = fmt.Fprintf(out, "index blocks: %d\nindex block load factor: min %.4f, mean %.4f, max %.4f\n",
+			len(stats.BlockLoadFactors), minLoad, sumLoad/float64(len(stats.BlockLoadFactors)), maxLoad)
+
+		_, err = io.WriteString(stdout, out.String())
+		return err
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/sopherapps/go-scdb/scdb"
+	"os"
+	"path/filepath"
+)
+
+// access is the way in which a command uses the store
+type access uint8
+
+const (
+	// readAccess opens an existing store for reading only
+	readAccess access = iota
+	// writeAccess opens an existing store for reading and writing
+	writeAccess
+	// createAccess opens the store for reading and writing, creating it if it does not exist
+	createAccess
+)
+
+// withStore opens the store at the given path, calls `fn` with it, and then closes it.
+//
+// The search index, the ordered index and the write-ahead log are enabled if the store already has their files,
+// so that the writes of the command keep them up to date.
+func withStore(path string, a access, fn func(store *scdb.Store) error) (err error) {
+	if a != createAccess {
+		// opening an existing store for writing would otherwise create it, if the path was mistyped
+		_, err = os.Stat(filepath.Join(path, scdb.DbFileName))
+		if err != nil {
+			return err
+		}
+	}
+
+	opts := make([]scdb.Option, 0, 3)
+	if pathExists(filepath.Join(path, scdb.SearchIndexFileName)) {
+		opts = append(opts, scdb.WithSearch())
+	}
+	if pathExists(filepath.Join(path, scdb.OrderedIndexFileName)) {
+		opts = append(opts, scdb.WithOrderedIndex())
+	}
+
+	mode := scdb.ReadWrite
+	if a == readAccess {
+		mode = scdb.ReadOnly
+	} else if pathExists(filepath.Join(path, scdb.WalFileName)) {
+		opts = append(opts, scdb.WithWAL())
+	}
+
+	store, err := scdb.Open(path, mode, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := store.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	return fn(store)
+}
+
+// pathExists returns true if there is a file or folder at the given path
+func pathExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
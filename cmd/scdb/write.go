@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb"
+	"io"
+	"time"
+)
+
+// runSet sets the given key to the given value, creating the store if it does not exist.
+// If the -ttl flag is given, the key expires after that time.
+func runSet(flags *flag.FlagSet, args []string, _ io.Reader, _ io.Writer) error {
+	ttl := flags.Duration("ttl", 0, "the time after which the key expires e.g. 1h30m, or 0 for never")
+	path, rest, err := parseArgs(flags, args, 2)
+	if err != nil {
+		return err
+	}
+
+	var ttlPtr *time.Duration
+	if *ttl > 0 {
+		ttlPtr = ttl
+	}
+
+	return withStore(path, createAccess, func(store *scdb.Store) error {
+		return store.Set([]byte(rest[0]), []byte(rest[1]), ttlPtr)
+	})
+}
+
+// runDel deletes the given key from the store.
+//
+// It returns errKeyNotFound if the key is not in the store.
+func runDel(flags *flag.FlagSet, args []string, _ io.Reader, _ io.Writer) error {
+	path, rest, err := parseArgs(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return withStore(path, writeAccess, func(store *scdb.Store) error {
+		k := []byte(rest[0])
+		isFound, err := store.Exists(k)
+		if err != nil {
+			return err
+		}
+
+		if !isFound {
+			return errKeyNotFound
+		}
+
+		return store.Delete(k)
+	})
+}
+
+// runCompact compacts the database file of the store, printing how long it took and the bytes it reclaimed
+func runCompact(flags *flag.FlagSet, args []string, _ io.Reader, stdout io.Writer) error {
+	path, _, err := parseArgs(flags, args, 0)
+	if err != nil {
+		return err
+	}
+
+	return withStore(path, writeAccess, func(store *scdb.Store) error {
+		err := store.Compact()
+		if err != nil {
+			return err
+		}
+
+		stats := store.CompactionStats()
+		_, err = fmt.Fprintf(stdout, "compacted in %s: %d bytes reclaimed\n", stats.LastDuration, stats.LastReclaimedBytes)
+		return err
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/sopherapps/go-scdb/scdb"
 	"log"
+	"time"
 )
 
 func main() {
@@ -45,7 +46,7 @@ func main() {
 	}
 
 	// inserting with ttl of 5 seconds
-	var ttl uint64 = 5
+	ttl := 5 * time.Second
 	for k, v := range records {
 		err := store.Set([]byte(k), v, &ttl)
 		if err != nil {
@@ -0,0 +1,170 @@
+package scdb
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// CompareAndSwap sets the given key to the value `new` only if its current value is `old`.
+// It returns true if the value was swapped.
+//
+// A nil `old` means that the key must not be in the store. `ttl` is the time-to-live of the new value,
+// to the nearest millisecond. If it is nil, the key-value pair never expires.
+//
+// The comparison and the swap happen under one lock of the store so no other write can come in between.
+func (s *Store) CompareAndSwap(k []byte, old []byte, new []byte, ttl *time.Duration) (bool, error) {
+	if s.isReadOnly {
+		return false, errors.NewErrReadOnly("compare-and-swap")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failure != nil {
+		return false, s.failure
+	}
+
+	current, err := s.get(k)
+	if err != nil {
+		return false, err
+	}
+
+	if (current == nil) != (old == nil) || !bytes.Equal(current, old) {
+		return false, nil
+	}
+
+	expiry := expiryFromTTL(uint64(time.Now().UnixMilli()), ttl)
+	return true, s.logAndSet(k, new, expiry)
+}
+
+// SetIfNotExists sets the given key value only if the key is not in the store, or has expired.
+// It returns true if the key-value pair was set.
+//
+// `ttl` is the time-to-live, to the nearest millisecond. If it is nil, the key-value pair never expires.
+func (s *Store) SetIfNotExists(k []byte, v []byte, ttl *time.Duration) (bool, error) {
+	if s.isReadOnly {
+		return false, errors.NewErrReadOnly("set")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failure != nil {
+		return false, s.failure
+	}
+
+	isFound, err := s.exists(k)
+	if err != nil || isFound {
+		return false, err
+	}
+
+	expiry := expiryFromTTL(uint64(time.Now().UnixMilli()), ttl)
+	return true, s.logAndSet(k, v, expiry)
+}
+
+// GetAndSet sets the given key value, returning the value the key had before, or nil if it was not in the store.
+//
+// `ttl` is the time-to-live, to the nearest millisecond. If it is nil, the key-value pair never expires.
+func (s *Store) GetAndSet(k []byte, v []byte, ttl *time.Duration) ([]byte, error) {
+	if s.isReadOnly {
+		return nil, errors.NewErrReadOnly("set")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	old, err := s.get(k)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := expiryFromTTL(uint64(time.Now().UnixMilli()), ttl)
+	err = s.logAndSet(k, v, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return old, nil
+}
+
+// GetAndDelete removes the key-value for the given key, returning the value it had,
+// or nil if it was not in the store.
+func (s *Store) GetAndDelete(k []byte) ([]byte, error) {
+	if s.isReadOnly {
+		return nil, errors.NewErrReadOnly("delete")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	old, err := s.get(k)
+	if err != nil || old == nil {
+		return nil, err
+	}
+
+	err = s.logAndDelete(k)
+	if err != nil {
+		return nil, err
+	}
+
+	return old, nil
+}
+
+// Increment adds `delta`, which may be negative, to the integer value of the given key and returns the result.
+//
+// The value is kept as a decimal string e.g. "42". A key that is not in the store is taken to be 0,
+// while a key that is in the store keeps its time-to-live.
+//
+// If the value is not an integer, an errors.ErrNotAnInteger is returned.
+// If the result would overflow an int64, an errors.ErrOutOfBounds is returned.
+func (s *Store) Increment(k []byte, delta int64) (int64, error) {
+	if s.isReadOnly {
+		return 0, errors.NewErrReadOnly("increment")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failure != nil {
+		return 0, s.failure
+	}
+
+	entry, err := s.getEntry(k)
+	if err != nil {
+		return 0, err
+	}
+
+	value := int64(0)
+	expiry := uint64(0)
+	if entry != nil {
+		value, err = strconv.ParseInt(string(entry.Value), 10, 64)
+		if err != nil {
+			return 0, errors.NewErrNotAnInteger(k)
+		}
+		expiry = entry.Expiry
+	}
+
+	if (delta > 0 && value > math.MaxInt64-delta) || (delta < 0 && value < math.MinInt64-delta) {
+		return 0, errors.NewErrOutOfBounds(fmt.Sprintf("incrementing %d by %d overflows int64", value, delta))
+	}
+
+	value += delta
+	err = s.logAndSet(k, []byte(strconv.FormatInt(value, 10)), expiry)
+	if err != nil {
+		return 0, err
+	}
+
+	return value, nil
+}
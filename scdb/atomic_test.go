@@ -0,0 +1,356 @@
+package scdb
+
+import (
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStore_CompareAndSwap(t *testing.T) {
+	dbPath := "testdb_cas"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("CompareAndSwapSetsTheNewValueOnlyIfTheCurrentValueMatches", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		type testParams struct {
+			key      []byte
+			old      []byte
+			new      []byte
+			expected bool
+		}
+		table := []testParams{
+			{Records[0].k, Records[0].v, []byte("Jane"), true},
+			{Records[1].k, []byte("French"), []byte("Jean"), false},
+			{Records[2].k, nil, []byte("Jean"), false},
+			{[]byte("non-existent"), []byte(""), []byte("foo"), false},
+			{[]byte("new"), nil, []byte("foo"), true},
+		}
+
+		for _, rec := range table {
+			got, err := store.CompareAndSwap(rec.key, rec.old, rec.new, nil)
+			if err != nil {
+				t.Fatalf("error comparing and swapping: %s", err)
+			}
+			assert.Equal(t, rec.expected, got, "%s", rec.key)
+		}
+
+		assertStoreContains(t, store, []testRecord{
+			{Records[0].k, []byte("Jane")},
+			Records[1],
+			Records[2],
+			{[]byte("new"), []byte("foo")},
+		})
+		assertKeysDontExist(t, store, [][]byte{[]byte("non-existent")})
+	})
+
+	t.Run("CompareAndSwapSetsTheGivenTTL", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:1], nil)
+
+		ttl := time.Hour
+		_, err := store.CompareAndSwap(Records[0].k, Records[0].v, []byte("Jane"), &ttl)
+		if err != nil {
+			t.Fatalf("error comparing and swapping: %s", err)
+		}
+
+		got := getTTL(t, store, Records[0].k)
+		if assert.NotNil(t, got) {
+			assert.InDelta(t, time.Hour, *got, float64(time.Second))
+		}
+	})
+
+	t.Run("ConcurrentCompareAndSwapsLetOnlyOneWin", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		var wg sync.WaitGroup
+		wins := make(chan int, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				isSwapped, err := store.CompareAndSwap([]byte("leader"), nil, []byte(strconv.Itoa(i)), nil)
+				if err != nil {
+					t.Errorf("error comparing and swapping: %s", err)
+				}
+				if isSwapped {
+					wins <- i
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(wins)
+
+		winners := make([]int, 0)
+		for i := range wins {
+			winners = append(winners, i)
+		}
+		if assert.Equal(t, 1, len(winners)) {
+			assertStoreContains(t, store, []testRecord{{[]byte("leader"), []byte(strconv.Itoa(winners[0]))}})
+		}
+	})
+}
+
+func TestStore_SetIfNotExists(t *testing.T) {
+	dbPath := "testdb_set_if_not_exists"
+	removeStore(t, dbPath)
+	store := createStore(t, dbPath, nil, false)
+	defer func() {
+		_ = store.Close()
+		removeStore(t, dbPath)
+	}()
+	insertRecords(t, store, Records[:3], nil)
+	deleteRecords(t, store, [][]byte{Records[0].k})
+
+	type testParams struct {
+		record   testRecord
+		expected bool
+	}
+	table := []testParams{
+		{testRecord{Records[0].k, []byte("Jane")}, true},
+		{testRecord{Records[1].k, []byte("Jean")}, false},
+		{Records[3], true},
+		{testRecord{Records[3].k, []byte("Jean")}, false},
+	}
+
+	for _, rec := range table {
+		got, err := store.SetIfNotExists(rec.record.k, rec.record.v, nil)
+		if err != nil {
+			t.Fatalf("error setting if not exists: %s", err)
+		}
+		assert.Equal(t, rec.expected, got, "%s", rec.record.k)
+	}
+
+	assertStoreContains(t, store, []testRecord{{Records[0].k, []byte("Jane")}, Records[1], Records[2], Records[3]})
+}
+
+func TestStore_GetAndSet(t *testing.T) {
+	dbPath := "testdb_get_and_set"
+	removeStore(t, dbPath)
+	store := createStore(t, dbPath, nil, false)
+	defer func() {
+		_ = store.Close()
+		removeStore(t, dbPath)
+	}()
+	insertRecords(t, store, Records[:1], nil)
+
+	type testParams struct {
+		record   testRecord
+		expected []byte
+	}
+	table := []testParams{
+		{testRecord{Records[0].k, []byte("Jane")}, Records[0].v},
+		{testRecord{Records[0].k, []byte("Jean")}, []byte("Jane")},
+		{Records[1], nil},
+	}
+
+	for _, rec := range table {
+		got, err := store.GetAndSet(rec.record.k, rec.record.v, nil)
+		if err != nil {
+			t.Fatalf("error getting and setting: %s", err)
+		}
+		assert.Equal(t, rec.expected, got, "%s", rec.record.k)
+	}
+
+	assertStoreContains(t, store, []testRecord{{Records[0].k, []byte("Jean")}, Records[1]})
+}
+
+func TestStore_GetAndDelete(t *testing.T) {
+	dbPath := "testdb_get_and_delete"
+	removeStore(t, dbPath)
+	store := createStore(t, dbPath, nil, false)
+	defer func() {
+		_ = store.Close()
+		removeStore(t, dbPath)
+	}()
+	insertRecords(t, store, Records[:3], nil)
+
+	type testParams struct {
+		key      []byte
+		expected []byte
+	}
+	table := []testParams{
+		{Records[0].k, Records[0].v},
+		{Records[0].k, nil},
+		{[]byte("non-existent"), nil},
+	}
+
+	for _, rec := range table {
+		got, err := store.GetAndDelete(rec.key)
+		if err != nil {
+			t.Fatalf("error getting and deleting: %s", err)
+		}
+		assert.Equal(t, rec.expected, got, "%s", rec.key)
+	}
+
+	assertStoreContains(t, store, Records[1:3])
+	assertKeysDontExist(t, store, [][]byte{Records[0].k})
+	assert.Equal(t, uint64(2), store.Len())
+}
+
+func TestStore_Increment(t *testing.T) {
+	dbPath := "testdb_increment"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("IncrementAddsDeltaToTheIntegerValue", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, []testRecord{{[]byte("count"), []byte("40")}}, nil)
+
+		type testParams struct {
+			key      []byte
+			delta    int64
+			expected int64
+		}
+		table := []testParams{
+			{[]byte("count"), 2, 42},
+			{[]byte("count"), -50, -8},
+			{[]byte("new"), 5, 5},
+			{[]byte("new"), 0, 5},
+		}
+
+		for _, rec := range table {
+			got, err := store.Increment(rec.key, rec.delta)
+			if err != nil {
+				t.Fatalf("error incrementing: %s", err)
+			}
+			assert.Equal(t, rec.expected, got, "%s", rec.key)
+		}
+
+		assertStoreContains(t, store, []testRecord{{[]byte("count"), []byte("-8")}, {[]byte("new"), []byte("5")}})
+	})
+
+	t.Run("IncrementKeepsTheTTLOfTheKey", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		ttl := time.Hour
+		insertRecords(t, store, []testRecord{{[]byte("count"), []byte("1")}}, &ttl)
+
+		_, err := store.Increment([]byte("count"), 1)
+		if err != nil {
+			t.Fatalf("error incrementing: %s", err)
+		}
+
+		got := getTTL(t, store, []byte("count"))
+		if assert.NotNil(t, got) {
+			assert.InDelta(t, time.Hour, *got, float64(time.Second))
+		}
+	})
+
+	t.Run("IncrementOfNonIntegerOrOverflowingValueReturnsAnError", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:1], nil)
+		insertRecords(t, store, []testRecord{{[]byte("max"), []byte(strconv.FormatInt(math.MaxInt64, 10))}}, nil)
+
+		_, err := store.Increment(Records[0].k, 1)
+		assert.Equal(t, errors.NewErrNotAnInteger(Records[0].k), err)
+
+		_, err = store.Increment([]byte("max"), 1)
+		assert.IsType(t, &errors.ErrOutOfBounds{}, err)
+
+		assertStoreContains(t, store, []testRecord{Records[0], {[]byte("max"), []byte(strconv.FormatInt(math.MaxInt64, 10))}})
+	})
+
+	t.Run("ConcurrentIncrementsAreNotLost", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 20; j++ {
+					_, err := store.Increment([]byte("count"), 1)
+					if err != nil {
+						t.Errorf("error incrementing: %s", err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		assertStoreContains(t, store, []testRecord{{[]byte("count"), []byte("200")}})
+	})
+}
+
+func ExampleStore_Increment() {
+	// the count must start from nothing, whatever an earlier run left behind
+	_ = os.RemoveAll("testdb_increment_example")
+	store, err := New("testdb_increment_example", nil, nil, nil, nil, false)
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+		_ = os.RemoveAll("testdb_increment_example")
+	}()
+
+	for i := 0; i < 3; i++ {
+		_, err = store.Increment([]byte("visits"), 1)
+		if err != nil {
+			log.Fatalf("error incrementing: %s", err)
+		}
+	}
+
+	count, err := store.Increment([]byte("visits"), 2)
+	if err != nil {
+		log.Fatalf("error incrementing: %s", err)
+	}
+
+	fmt.Println(count)
+	// Output: 5
+}
@@ -0,0 +1,322 @@
+package scdb
+
+import (
+	"archive/tar"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/buffers"
+	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
+	"github.com/sopherapps/go-scdb/scdb/internal/ordered_index"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// partialFilePrefix is put before the name of each file of a store being backed up or restored,
+// until all of them are written
+const partialFilePrefix string = "tmp__partial."
+
+// backupFiles are the names of the files of a store that are backed up, in the order they are put in a backup
+var backupFiles = []string{DbFileName, SearchIndexFileName, OrderedIndexFileName}
+
+// Backup writes a copy of the store, as it is now, to `w` as a tar archive that Restore can load.
+//
+// It works just like BackupTo, to which it hands over the copying, so reads and writes go on while it runs.
+// The files are copied into a temporary folder first, since the archive needs the size of each file upfront.
+func (s *Store) Backup(w io.Writer, isCompacted bool) error {
+	tmpDir, err := os.MkdirTemp("", "scdb-backup-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	err = s.BackupTo(tmpDir, isCompacted)
+	if err != nil {
+		return err
+	}
+
+	return writeArchive(w, tmpDir)
+}
+
+// BackupTo copies the store, as it is now, into the folder at the given path, which is created if it does not exist.
+// The folder can then be opened as a store in its own right.
+//
+// The copy is made from a Snapshot, so reads and writes, and even compaction, go on while it runs.
+// If `isCompacted` is true, only the live key-value pairs are copied, just like in Compact. Otherwise, the database
+// file is copied as it is. The search and ordered indices are rebuilt in the copy, if they are enabled on the store.
+//
+// The files are only moved into place once all of them are written, so a failed backup leaves no store behind.
+// An error satisfying os.IsExist is returned if there is a store in the folder already.
+func (s *Store) BackupTo(path string, isCompacted bool) error {
+	err := ensureNoStoreAt(path, "backup")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(path, 0755)
+	if err != nil {
+		return err
+	}
+	defer removePartialFiles(path)
+
+	snapshot, searchIndex, orderedIndex, err := s.startBackup(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = snapshot.Close()
+		if searchIndex != nil {
+			_ = searchIndex.Close()
+		}
+		if orderedIndex != nil {
+			_ = orderedIndex.Close()
+		}
+	}()
+
+	err = snapshot.CopyTo(filepath.Join(path, partialFilePrefix+DbFileName), isCompacted, searchIndex, orderedIndex)
+	if err != nil {
+		return err
+	}
+
+	if searchIndex != nil {
+		err = searchIndex.File.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	if orderedIndex != nil {
+		err = orderedIndex.File.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	return movePartialFilesIntoPlace(path)
+}
+
+// Restore loads the backup written by Store.Backup from `r` into the folder at the given path,
+// which is created if it does not exist. The store can then be opened from that folder.
+//
+// The files are only moved into place once all of them are read, so a failed restore leaves no store behind.
+// An error satisfying os.IsExist is returned if there is a store in the folder already.
+func Restore(r io.Reader, path string) error {
+	err := ensureNoStoreAt(path, "restore")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(path, 0755)
+	if err != nil {
+		return err
+	}
+
+	defer removePartialFiles(path)
+
+	hasDbFile := false
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if !isBackupFile(header.Name) || header.Typeflag != tar.TypeReg {
+			return errors.NewErrNotSupported(fmt.Sprintf("restoring of %s", header.Name))
+		}
+
+		hasDbFile = hasDbFile || header.Name == DbFileName
+		err = writeFile(filepath.Join(path, partialFilePrefix+header.Name), archive)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !hasDbFile {
+		return errors.NewErrNotSupported("restoring of a backup without a database file")
+	}
+
+	return movePartialFilesIntoPlace(path)
+}
+
+// startBackup takes a snapshot of the store, along with new empty search and ordered indices in the folder
+// at the given path if the store has them enabled
+func (s *Store) startBackup(path string) (*buffers.Snapshot, *inverted_index.InvertedIndex, *ordered_index.OrderedIndex, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.isClosed {
+		return nil, nil, nil, errors.NewErrNotSupported("use of a closed store")
+	}
+
+	if s.failure != nil {
+		return nil, nil, nil, s.failure
+	}
+
+	var searchIndex *inverted_index.InvertedIndex
+	var orderedIndex *ordered_index.OrderedIndex
+	var err error
+	isStarted := false
+	defer func() {
+		if isStarted {
+			return
+		}
+		if searchIndex != nil {
+			_ = searchIndex.Close()
+		}
+		if orderedIndex != nil {
+			_ = orderedIndex.Close()
+		}
+	}()
+
+	if s.searchIndex != nil {
+		searchIndexFilePath := filepath.Join(path, partialFilePrefix+SearchIndexFileName)
+		searchIndex, err = s.searchIndex.NewEmptyCopy(searchIndexFilePath, s.searchIndex.MaxKeys())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if s.orderedIndex != nil {
+		orderedIndex, err = ordered_index.NewOrderedIndex(filepath.Join(path, partialFilePrefix+OrderedIndexFileName))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	snapshot, err := s.bufferPool.NewSnapshot()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	isStarted = true
+	return snapshot, searchIndex, orderedIndex, nil
+}
+
+// ensureNoStoreAt returns an error satisfying os.IsExist if there is a database file in the folder at the given path
+func ensureNoStoreAt(path string, op string) error {
+	dbFilePath := filepath.Join(path, DbFileName)
+	exists, err := internal.PathExists(dbFilePath)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return &os.PathError{Op: op, Path: dbFilePath, Err: os.ErrExist}
+	}
+
+	return nil
+}
+
+// movePartialFilesIntoPlace renames the partial files of the store in the folder at the given path
+// to their proper names. The database file is moved last so that the store is never seen without its indices.
+func movePartialFilesIntoPlace(path string) error {
+	for i := len(backupFiles) - 1; i >= 0; i-- {
+		partialFilePath := filepath.Join(path, partialFilePrefix+backupFiles[i])
+		exists, err := internal.PathExists(partialFilePath)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			continue
+		}
+
+		err = os.Rename(partialFilePath, filepath.Join(path, backupFiles[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return internal.SyncDir(path)
+}
+
+// removePartialFiles removes any partial files left in the folder at the given path by a failed backup or restore
+func removePartialFiles(path string) {
+	for _, name := range backupFiles {
+		_ = os.Remove(filepath.Join(path, partialFilePrefix+name))
+	}
+}
+
+// writeArchive writes the files of the store in the folder at the given path to `w` as a tar archive
+func writeArchive(w io.Writer, path string) error {
+	archive := tar.NewWriter(w)
+	for _, name := range backupFiles {
+		filePath := filepath.Join(path, name)
+		info, err := os.Stat(filePath)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = archive.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     info.Size(),
+			Mode:     0644,
+			ModTime:  time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = copyFile(archive, filePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// copyFile copies the contents of the file at the given path to `w`
+func copyFile(w io.Writer, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// writeFile writes the contents of `r` to the file at the given path, flushing them to disk
+func writeFile(filePath string, r io.Reader) error {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	_, err = io.Copy(file, r)
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// isBackupFile returns true if the given name is that of one of the files of a store that are backed up
+func isBackupFile(name string) bool {
+	for _, backupFile := range backupFiles {
+		if name == backupFile {
+			return true
+		}
+	}
+
+	return false
+}
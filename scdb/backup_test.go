@@ -0,0 +1,330 @@
+package scdb
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStore_BackupTo(t *testing.T) {
+	dbPath := "testdb_backup"
+	backupPath := "testdb_backup_copy"
+	removeStore(t, dbPath)
+	removeStore(t, backupPath)
+	defer func() {
+		removeStore(t, dbPath)
+		removeStore(t, backupPath)
+	}()
+
+	t.Run("BackupToCopiesTheStoreAsItIsNowWithItsIndices", func(t *testing.T) {
+		for _, isCompacted := range []bool{false, true} {
+			func() {
+				defer func() {
+					removeStore(t, dbPath)
+					removeStore(t, backupPath)
+				}()
+				store := createStore(t, dbPath, nil, true, WithOrderedIndex())
+				defer func() {
+					_ = store.Close()
+				}()
+				insertRecords(t, store, Records, nil)
+				deleteRecords(t, store, [][]byte{Records[0].k})
+
+				err := store.BackupTo(backupPath, isCompacted)
+				if err != nil {
+					t.Fatalf("error backing up store: %s", err)
+				}
+				deleteRecords(t, store, [][]byte{Records[1].k})
+
+				backup := createStore(t, backupPath, nil, true, WithOrderedIndex())
+				defer func() {
+					_ = backup.Close()
+				}()
+				assertStoreContains(t, backup, Records[1:])
+				assertKeysDontExist(t, backup, [][]byte{Records[0].k})
+				assert.Equal(t, uint64(len(Records)-1), backup.Len())
+				assertSearchResults(t, backup, []byte("h"), []testRecord{Records[1], Records[4]})
+				assertRangeResults(t, backup, nil, nil, 0, false, []testRecord{Records[3], Records[1], Records[4], Records[6], Records[5], Records[2]})
+
+				if isCompacted {
+					assert.Less(t, getFileSize(t, backupPath), getFileSize(t, dbPath))
+				} else {
+					assert.Equal(t, getFileSize(t, dbPath), getFileSize(t, backupPath))
+				}
+			}()
+		}
+	})
+
+	t.Run("BackupToIsConsistentWhileWritesAndCompactionGoOn", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+			removeStore(t, backupPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				batch := NewWriteBatch()
+				for _, record := range Records {
+					batch.Set(record.k, []byte(fmt.Sprintf("%d", i)), nil)
+				}
+
+				err := store.Batch(batch)
+				if err == nil {
+					err = store.Compact()
+				}
+				if err != nil {
+					t.Errorf("error writing to store: %s", err)
+					return
+				}
+			}
+		}()
+
+		err := store.BackupTo(backupPath, false)
+		wg.Wait()
+		if err != nil {
+			t.Fatalf("error backing up store: %s", err)
+		}
+
+		backup := createStore(t, backupPath, nil, false)
+		defer func() {
+			_ = backup.Close()
+		}()
+		first, err := backup.Get(Records[0].k)
+		if err != nil {
+			t.Fatalf("error getting key: %s", err)
+		}
+
+		// all the keys come from the same batch, or none at all
+		expected := make([]testRecord, 0, len(Records))
+		for _, record := range Records {
+			v := first
+			if bytes.Equal(first, Records[0].v) {
+				v = record.v
+			}
+			expected = append(expected, testRecord{record.k, v})
+		}
+		assertStoreContains(t, backup, expected)
+	})
+
+	t.Run("BackupToAFolderWithAStoreReturnsErrExist", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+			removeStore(t, backupPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		err := store.BackupTo(dbPath, false)
+		assert.True(t, os.IsExist(err))
+
+		err = store.BackupTo(backupPath, false)
+		if err != nil {
+			t.Fatalf("error backing up store: %s", err)
+		}
+		err = store.BackupTo(backupPath, true)
+		assert.True(t, os.IsExist(err))
+	})
+
+	t.Run("BackupToOfClosedStoreReturnsErrNotSupportedAndLeavesNoStore", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+			removeStore(t, backupPath)
+		}()
+		store := createStore(t, dbPath, nil, true)
+		err := store.Close()
+		if err != nil {
+			t.Fatalf("error closing store: %s", err)
+		}
+
+		err = store.BackupTo(backupPath, false)
+		assert.Equal(t, errors.NewErrNotSupported("use of a closed store"), err)
+		assertFolderIsEmpty(t, backupPath)
+	})
+}
+
+func TestStore_Backup(t *testing.T) {
+	dbPath := "testdb_backup"
+	restorePath := "testdb_backup_restored"
+	removeStore(t, dbPath)
+	removeStore(t, restorePath)
+	defer func() {
+		removeStore(t, dbPath)
+		removeStore(t, restorePath)
+	}()
+
+	t.Run("BackupWritesAnArchiveThatRestoreLoads", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+			removeStore(t, restorePath)
+		}()
+		store := createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		buf := bytes.Buffer{}
+		err := store.Backup(&buf, true)
+		if err != nil {
+			t.Fatalf("error backing up store: %s", err)
+		}
+
+		err = Restore(&buf, restorePath)
+		if err != nil {
+			t.Fatalf("error restoring store: %s", err)
+		}
+
+		restored := createStore(t, restorePath, nil, true)
+		defer func() {
+			_ = restored.Close()
+		}()
+		assertStoreContains(t, restored, Records)
+		assertSearchResults(t, restored, []byte("h"), []testRecord{Records[0], Records[1], Records[4]})
+	})
+
+	t.Run("RestoreIntoAFolderWithAStoreReturnsErrExist", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		buf := bytes.Buffer{}
+		err := store.Backup(&buf, false)
+		if err != nil {
+			t.Fatalf("error backing up store: %s", err)
+		}
+
+		err = Restore(&buf, dbPath)
+		assert.True(t, os.IsExist(err))
+		assertStoreContains(t, store, Records)
+	})
+
+	t.Run("RestoreOfAnArchiveThatIsNotABackupReturnsErrNotSupportedAndLeavesNoStore", func(t *testing.T) {
+		defer func() {
+			removeStore(t, restorePath)
+		}()
+
+		archives := map[string][]string{
+			"OtherFile":  {DbFileName, filepath.Join("..", DbFileName)},
+			"NoDatabase": {SearchIndexFileName},
+		}
+
+		for name, fileNames := range archives {
+			err := Restore(writeTestArchive(t, fileNames), restorePath)
+			assert.IsType(t, &errors.ErrNotSupported{}, err, name)
+			assertFolderIsEmpty(t, restorePath)
+		}
+	})
+}
+
+func ExampleStore_Backup() {
+	store, err := New("testdb", nil, nil, nil, nil, false)
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	err = store.Set([]byte("foo"), []byte("bar"), nil)
+	if err != nil {
+		log.Fatalf("error setting key value: %s", err)
+	}
+
+	buf := bytes.Buffer{}
+	err = store.Backup(&buf, true)
+	if err != nil {
+		log.Fatalf("error backing up store: %s", err)
+	}
+
+	err = Restore(&buf, "testdb_restored")
+	if err != nil {
+		log.Fatalf("error restoring store: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll("testdb_restored")
+	}()
+
+	restored, err := New("testdb_restored", nil, nil, nil, nil, false)
+	if err != nil {
+		log.Fatalf("error opening restored store: %s", err)
+	}
+	defer func() {
+		_ = restored.Close()
+	}()
+
+	value, err := restored.Get([]byte("foo"))
+	if err != nil {
+		log.Fatalf("error getting key: %s", err)
+	}
+
+	fmt.Printf("%s", value)
+	// Output: bar
+}
+
+// writeTestArchive writes a tar archive with a file of the given name, with some made up contents, for each name
+func writeTestArchive(t *testing.T, fileNames []string) *bytes.Buffer {
+	buf := bytes.Buffer{}
+	archive := tar.NewWriter(&buf)
+	for _, name := range fileNames {
+		data := []byte(strings.Repeat("data", 10))
+		err := archive.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: int64(len(data)), Mode: 0644})
+		if err != nil {
+			t.Fatalf("error writing archive header: %s", err)
+		}
+
+		_, err = archive.Write(data)
+		if err != nil {
+			t.Fatalf("error writing to archive: %s", err)
+		}
+	}
+
+	err := archive.Close()
+	if err != nil {
+		t.Fatalf("error closing archive: %s", err)
+	}
+
+	return &buf
+}
+
+// assertFolderIsEmpty asserts that the folder at the given path has no files, if it exists
+func assertFolderIsEmpty(t *testing.T, path string) {
+	exists, err := internal.PathExists(path)
+	if err != nil {
+		t.Fatalf("error checking folder: %s", err)
+	}
+
+	if !exists {
+		return
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		t.Fatalf("error reading folder: %s", err)
+	}
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,173 @@
+package scdb
+
+import (
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal/wal"
+	"os"
+	"time"
+)
+
+// batchOp is a single write in a WriteBatch
+type batchOp struct {
+	kind  wal.OpKind
+	key   []byte
+	value []byte
+	ttl   *time.Duration
+}
+
+// WriteBatch is a group of sets and deletes that are applied to the store as a single atomic unit
+// by Store.Batch.
+//
+// Either all of its writes are applied or none of them is, even if the process crashes in the middle
+// of applying them. Other users of the store never see only a part of them applied.
+type WriteBatch struct {
+	ops []batchOp
+}
+
+// NewWriteBatch creates a new empty WriteBatch
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{ops: make([]batchOp, 0)}
+}
+
+// Set adds the setting of the given key value to the batch.
+// `ttl` is the time-to-live, to the nearest millisecond, counted from when the batch is applied.
+// If it is nil, the key-value pair never expires.
+func (b *WriteBatch) Set(k []byte, v []byte, ttl *time.Duration) {
+	b.ops = append(b.ops, batchOp{kind: wal.OpSet, key: k, value: v, ttl: ttl})
+}
+
+// Delete adds the removal of the key-value for the given key to the batch
+func (b *WriteBatch) Delete(k []byte) {
+	b.ops = append(b.ops, batchOp{kind: wal.OpDelete, key: k})
+}
+
+// Len returns the number of writes in the batch
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Reset removes all writes from the batch so that it can be reused
+func (b *WriteBatch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// toWalOps converts the writes in the batch into write-ahead log operations,
+// with expiry timestamps computed basing on the given current timestamp (in milliseconds from unix epoch)
+func (b *WriteBatch) toWalOps(now uint64) []wal.Op {
+	ops := make([]wal.Op, 0, len(b.ops))
+	for _, op := range b.ops {
+		expiry := expiryFromTTL(now, op.ttl)
+		ops = append(ops, wal.Op{Kind: op.kind, Key: op.key, Value: op.value, Expiry: expiry})
+	}
+
+	return ops
+}
+
+// Batch applies all the writes in the given WriteBatch to the store as a single atomic unit.
+//
+// The writes are first recorded, and flushed to disk, as one record in the write-ahead log.
+// If the write-ahead log is not enabled, a temporary one is used for the batch alone.
+// Thus, if the process crashes in the middle of the batch, the rest of it is applied the next time
+// the store is opened.
+//
+// If applying the writes fails partway e.g. on a disk error, an errors.ErrStoreFailed is returned, and so is it
+// by all operations on the store but Close from then on, so that only a part of the batch is never seen.
+// Closing and reopening the store applies the rest of the batch.
+func (s *Store) Batch(b *WriteBatch) error {
+	s.ops.batches.Add(1)
+
+	if s.isReadOnly {
+		return errors.NewErrReadOnly("batch")
+	}
+
+	if b.Len() == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failure != nil {
+		return s.failure
+	}
+
+	return s.applyAtomically(b.toWalOps(uint64(time.Now().UnixMilli())))
+}
+
+// applyAtomically applies the given operations as a single atomic unit, without acquiring the store's lock.
+//
+// The operations are first recorded, and flushed to disk, as one record in the write-ahead log, or in a temporary
+// log if the write-ahead log is not enabled.
+func (s *Store) applyAtomically(ops []wal.Op) error {
+	if s.wal != nil {
+		err := s.log(ops...)
+		if err != nil {
+			return err
+		}
+
+		err = s.wal.Sync()
+		if err != nil {
+			return err
+		}
+
+		err = s.replay(ops)
+		if err != nil {
+			return s.fail(err)
+		}
+
+		return s.persist()
+	}
+
+	return s.applyJournaled(ops)
+}
+
+// fail puts the store in a failed state after the operations of an atomic unit failed partway with the given error,
+// returning the errors.ErrStoreFailed that all operations but Close return from then on.
+// The log of the operations is kept so that they are completed the next time the store is opened.
+func (s *Store) fail(err error) error {
+	s.failure = errors.NewErrStoreFailed(err)
+	// the compaction would otherwise empty the log when it finishes
+	_ = s.abortCompaction()
+	return s.failure
+}
+
+// applyJournaled applies the given operations atomically, using a temporary write-ahead log.
+// The log is removed once the database files are flushed to disk.
+func (s *Store) applyJournaled(ops []wal.Op) error {
+	journal, err := wal.NewLog(s.walFilePath)
+	if err != nil {
+		return err
+	}
+
+	err = journal.Append(ops...)
+	if err != nil {
+		_ = journal.Close()
+		return err
+	}
+
+	err = journal.Sync()
+	if err != nil {
+		_ = journal.Close()
+		return err
+	}
+
+	err = s.replay(ops)
+	if err != nil {
+		// the journal is left in place so that the batch is completed the next time the store is opened
+		_ = journal.Close()
+		return s.fail(err)
+	}
+
+	err = s.syncFiles()
+	if err != nil {
+		_ = journal.Close()
+		return err
+	}
+
+	err = journal.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(s.walFilePath)
+}
@@ -0,0 +1,255 @@
+package scdb
+
+import (
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/buffers"
+	"github.com/sopherapps/go-scdb/scdb/internal/wal"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestWriteBatch(t *testing.T) {
+	ttl := 5 * time.Second
+	batch := NewWriteBatch()
+	assert.Equal(t, 0, batch.Len())
+
+	batch.Set(Records[0].k, Records[0].v, nil)
+	batch.Set(Records[1].k, Records[1].v, &ttl)
+	batch.Delete(Records[2].k)
+	assert.Equal(t, 3, batch.Len())
+
+	now := uint64(time.Now().UnixMilli())
+	expected := []wal.Op{
+		{Kind: wal.OpSet, Key: Records[0].k, Value: Records[0].v, Expiry: 0},
+		{Kind: wal.OpSet, Key: Records[1].k, Value: Records[1].v, Expiry: now + 5_000},
+		{Kind: wal.OpDelete, Key: Records[2].k},
+	}
+	assert.Equal(t, expected, batch.toWalOps(now))
+
+	batch.Reset()
+	assert.Equal(t, 0, batch.Len())
+}
+
+func TestStore_Batch(t *testing.T) {
+	dbPath := "testdb_batch"
+	walPath := path.Join(dbPath, "dump.wal")
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("BatchAppliesAllSetsAndDeletes", func(t *testing.T) {
+		for _, opts := range [][]Option{{}, {WithWAL()}} {
+			func() {
+				defer func() {
+					removeStore(t, dbPath)
+				}()
+				store := createStore(t, dbPath, nil, true, opts...)
+				defer func() {
+					_ = store.Close()
+				}()
+				insertRecords(t, store, Records[:2], nil)
+
+				batch := NewWriteBatch()
+				for _, record := range SearchRecords {
+					batch.Set(record.k, record.v, nil)
+				}
+				batch.Delete(Records[0].k)
+				batch.Delete(SearchRecords[0].k)
+
+				err := store.Batch(batch)
+				if err != nil {
+					t.Fatalf("error applying batch: %s", err)
+				}
+
+				assertStoreContains(t, store, Records[1:2])
+				assertStoreContains(t, store, SearchRecords[1:])
+				assertKeysDontExist(t, store, [][]byte{Records[0].k, SearchRecords[0].k})
+
+				got, err := store.Search([]byte("fo"), 0, 0)
+				if err != nil {
+					t.Fatalf("error searching: %s", err)
+				}
+				assert.ElementsMatch(t, []buffers.KeyValuePair{
+					{K: SearchRecords[1].k, V: SearchRecords[1].v},
+					{K: SearchRecords[2].k, V: SearchRecords[2].v},
+				}, got)
+			}()
+		}
+	})
+
+	t.Run("BatchWithTTLInsertsKeyValuesThatExpireAfterTTLSeconds", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		ttl := 500 * time.Millisecond
+		batch := NewWriteBatch()
+		batch.Set(Records[0].k, Records[0].v, nil)
+		batch.Set(Records[1].k, Records[1].v, &ttl)
+		err := store.Batch(batch)
+		if err != nil {
+			t.Fatalf("error applying batch: %s", err)
+		}
+
+		assertStoreContains(t, store, Records[:2])
+		time.Sleep(time.Second)
+		assertStoreContains(t, store, Records[:1])
+		assertKeysDontExist(t, store, [][]byte{Records[1].k})
+	})
+
+	t.Run("BatchWithoutWALLeavesNoLogBehind", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		batch := NewWriteBatch()
+		for _, record := range Records {
+			batch.Set(record.k, record.v, nil)
+		}
+		err := store.Batch(batch)
+		if err != nil {
+			t.Fatalf("error applying batch: %s", err)
+		}
+
+		exists, _ := internal.PathExists(walPath)
+		assert.False(t, exists)
+		assertStoreContains(t, store, Records)
+	})
+
+	t.Run("BatchInterruptedByACrashIsCompletedOnOpen", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, true)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records[:1], nil)
+		}()
+
+		// simulate a crash after the batch was recorded in the log but before it was applied
+		batch := NewWriteBatch()
+		batch.Delete(Records[0].k)
+		for _, record := range Records[1:] {
+			batch.Set(record.k, record.v, nil)
+		}
+		writeToWal(t, walPath, batch.toWalOps(uint64(time.Now().UnixMilli()))...)
+
+		store := createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+		assertStoreContains(t, store, Records[1:])
+		assertKeysDontExist(t, store, [][]byte{Records[0].k})
+	})
+
+	t.Run("BatchThatFailsPartwayLeavesTheStoreFailedUntilItIsReopened", func(t *testing.T) {
+		for _, opts := range [][]Option{nil, {WithWAL()}} {
+			func() {
+				defer func() {
+					removeStore(t, dbPath)
+				}()
+				store := createStore(t, dbPath, nil, true, opts...)
+				defer func() {
+					_ = store.Close()
+				}()
+				restoreSearchIndexFile := makeSearchIndexReadOnly(t, store)
+
+				batch := NewWriteBatch()
+				for _, record := range Records {
+					batch.Set(record.k, record.v, nil)
+				}
+				err := store.Batch(batch)
+				failedErr, ok := err.(*errors.ErrStoreFailed)
+				if !ok {
+					t.Fatalf("expected an ErrStoreFailed, got %v", err)
+				}
+
+				// the records in the database file are not visible
+				_, err = store.Get(Records[0].k)
+				assert.Equal(t, failedErr, err)
+				_, err = store.Search(Records[0].k, 0, 0)
+				assert.Equal(t, failedErr, err)
+				err = store.Set(Records[0].k, Records[0].v, nil)
+				assert.Equal(t, failedErr, err)
+
+				restoreSearchIndexFile()
+				err = store.Close()
+				if err != nil {
+					t.Fatalf("error closing store: %s", err)
+				}
+
+				store = createStore(t, dbPath, nil, true, opts...)
+				assertStoreContains(t, store, Records)
+				assertSearchResults(t, store, []byte("h"), []testRecord{Records[0], Records[1], Records[4]})
+			}()
+		}
+	})
+
+	t.Run("BatchWithNoWritesDoesNothing", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		initialFileSize := getFileSize(t, dbPath)
+
+		err := store.Batch(NewWriteBatch())
+		assert.Nil(t, err)
+		assert.Equal(t, initialFileSize, getFileSize(t, dbPath))
+	})
+}
+
+func ExampleStore_Batch() {
+	store, err := New("testdb", nil, nil, nil, nil, false)
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	ttl := time.Hour
+	batch := NewWriteBatch()
+	batch.Set([]byte("foo"), []byte("bar"), nil)
+	batch.Set([]byte("fake"), []byte("bear"), &ttl)
+	batch.Delete([]byte("hey"))
+
+	err = store.Batch(batch)
+	if err != nil {
+		log.Fatalf("error applying batch: %s", err)
+	}
+}
+
+// makeSearchIndexReadOnly swaps the file of the store's search index for a read-only one so that
+// any write to the search index fails. It returns a function that swaps the original file back.
+func makeSearchIndexReadOnly(t *testing.T, store *Store) func() {
+	file, err := os.Open(store.searchIndex.File.Name())
+	if err != nil {
+		t.Fatalf("error opening search index file: %s", err)
+	}
+
+	original := store.searchIndex.File
+	store.searchIndex.File = file
+	return func() {
+		_ = file.Close()
+		store.searchIndex.File = original
+	}
+}
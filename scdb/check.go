@@ -0,0 +1,148 @@
+package scdb
+
+import (
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/buffers"
+	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
+	"os"
+	"path/filepath"
+)
+
+// CheckProblem is a problem found in one of the files of a store by Check or Repair
+type CheckProblem struct {
+	// File is the name of the file, in the folder of the store, that has the problem e.g. dump.scdb
+	File string
+	// Offset is the position in the file at which the problem is
+	Offset uint64
+	// Description describes the problem
+	Description string
+}
+
+func (p CheckProblem) String() string {
+	return fmt.Sprintf("%s at offset %d: %s", p.File, p.Offset, p.Description)
+}
+
+// CheckReport is what Check or Repair found in the files of a store
+type CheckReport struct {
+	// Problems are the problems found, in the order they were found
+	Problems []CheckProblem
+	// LiveKeys is the number of keys in the index of the database file that are neither deleted nor expired
+	LiveKeys uint64
+	// DeletedKeys is the number of keys in the index of the database file that are deleted
+	DeletedKeys uint64
+	// ExpiredKeys is the number of keys in the index of the database file that are expired
+	ExpiredKeys uint64
+	// Entries is the number of key-value entries in the database file, including older versions of keys
+	Entries uint64
+	// IsRepaired is true if Repair rebuilt the files of the store
+	IsRepaired bool
+	// RecoveredKeys is the number of keys that Repair kept in the rebuilt files
+	RecoveredKeys uint64
+}
+
+// IsOk returns true if no problems were found
+func (r *CheckReport) IsOk() bool {
+	return len(r.Problems) == 0
+}
+
+// Check checks the files of the store at the given path for corruption, without changing them.
+//
+// It reads the header, every index slot and every key-value entry of the database file, and every list in the
+// search index, if any. It reports dangling index pointers, entries that overflow the file, entries whose Size does
+// not fit their KeySize, entries whose checksum does not match their contents, broken NextOffset and PreviousOffset
+// chains in the search index, and keys in index slots that their hash does not lead to.
+//
+// The store must not be open for writing, or else an errors.ErrStoreLocked is returned.
+// An error is only returned if the files can't be read at all; problems in them are in the report.
+func Check(path string) (*CheckReport, error) {
+	// stores created before the lock file was added have none, and it can't be created here
+	fileLock, err := internal.LockFile(filepath.Join(path, LockFileName), true)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	defer func() {
+		_ = fileLock.Unlock()
+	}()
+
+	return check(path)
+}
+
+// Repair checks the files of the store at the given path just like Check does, and if any problems are found,
+// rebuilds the store from whatever key-value entries survive.
+//
+// For each key, the entry its index slot points to is kept, if it is intact. Otherwise, the latest intact entry of
+// the key in the database file is kept. Deleted and expired keys are dropped. The search and ordered indices are
+// rebuilt from the kept entries, if the store has them. The write-ahead log, if any, is left as it is, so that
+// it is replayed when the store is next opened.
+//
+// The rebuilt files are swapped in just like in Compact, so a crash during a repair leaves the store as it was
+// before or after it. The problems found are returned in the report even if the repair then fails.
+// An errors.ErrNotSupported is returned if the header of the database file is too corrupted to rebuild it.
+//
+// The store must not be open, or else an errors.ErrStoreLocked is returned.
+func Repair(path string) (*CheckReport, error) {
+	fileLock, err := internal.LockFile(filepath.Join(path, LockFileName), false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = fileLock.Unlock()
+	}()
+
+	dbFilePath := filepath.Join(path, DbFileName)
+	searchIndexFilePath := filepath.Join(path, SearchIndexFileName)
+	orderedIndexFilePath := filepath.Join(path, OrderedIndexFileName)
+	// finish or undo any compaction cut short by a crash, so that the right files are checked
+	err = buffers.RecoverCompaction(dbFilePath, searchIndexFilePath, orderedIndexFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := check(path)
+	if err != nil || report.IsOk() {
+		return report, err
+	}
+
+	report.RecoveredKeys, err = buffers.RepairFile(dbFilePath, searchIndexFilePath, orderedIndexFilePath)
+	if err != nil {
+		return report, err
+	}
+
+	report.IsRepaired = true
+	return report, nil
+}
+
+// check checks the files of the store at the given path, without taking the lock on it
+func check(path string) (*CheckReport, error) {
+	report := &CheckReport{Problems: make([]CheckProblem, 0)}
+	reportFor := func(fileName string) func(offset uint64, description string) {
+		return func(offset uint64, description string) {
+			report.Problems = append(report.Problems, CheckProblem{File: fileName, Offset: offset, Description: description})
+		}
+	}
+
+	result, err := buffers.CheckFile(filepath.Join(path, DbFileName), reportFor(DbFileName))
+	if err != nil {
+		return nil, err
+	}
+	report.LiveKeys = result.LiveKeys
+	report.DeletedKeys = result.DeletedKeys
+	report.ExpiredKeys = result.ExpiredKeys
+	report.Entries = result.Entries
+
+	searchIndexFilePath := filepath.Join(path, SearchIndexFileName)
+	hasSearchIndex, err := internal.PathExists(searchIndexFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasSearchIndex {
+		err = inverted_index.CheckFile(searchIndexFilePath, reportFor(SearchIndexFileName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,210 @@
+package scdb
+
+import (
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	dbPath := "testdb_check"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("CheckOfAnIntactStoreReportsNoProblems", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true, WithOrderedIndex())
+		insertRecords(t, store, Records, nil)
+		deleteRecords(t, store, [][]byte{Records[0].k})
+		_ = store.Close()
+
+		report := checkStore(t, dbPath)
+		assert.True(t, report.IsOk())
+		assert.Equal(t, &CheckReport{
+			Problems:    []CheckProblem{},
+			LiveKeys:    uint64(len(Records) - 1),
+			DeletedKeys: 1,
+			Entries:     uint64(len(Records)),
+		}, report)
+	})
+
+	t.Run("CheckReportsCorruptedEntriesInTheDatabaseFileAndSearchIndex", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true)
+		insertRecords(t, store, Records, nil)
+		_ = store.Close()
+
+		corruptFile(t, filepath.Join(dbPath, DbFileName), Records[6].v)
+		corruptFile(t, filepath.Join(dbPath, SearchIndexFileName), Records[5].k)
+
+		report := checkStore(t, dbPath)
+		assert.False(t, report.IsOk())
+		assert.Equal(t, []string{DbFileName, DbFileName, SearchIndexFileName}, problemFiles(report))
+		assert.Equal(t, uint64(len(Records)-1), report.LiveKeys)
+	})
+
+	t.Run("CheckOfAStoreOpenForWritingReturnsErrStoreLocked", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		_, err := Check(dbPath)
+		assert.Equal(t, errors.NewErrStoreLocked(dbPath), err)
+	})
+
+	t.Run("CheckOfAFolderWithNoStoreReturnsErrNotExist", func(t *testing.T) {
+		_, err := Check(dbPath)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestRepair(t *testing.T) {
+	dbPath := "testdb_repair"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("RepairRebuildsTheStoreFromTheEntriesThatSurvive", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true, WithOrderedIndex())
+		insertRecords(t, store, Records, nil)
+		_ = store.Close()
+
+		corruptFile(t, filepath.Join(dbPath, DbFileName), Records[6].v)
+		corruptFile(t, filepath.Join(dbPath, SearchIndexFileName), Records[5].k)
+
+		report, err := Repair(dbPath)
+		if err != nil {
+			t.Fatalf("error repairing store: %s", err)
+		}
+		assert.True(t, report.IsRepaired)
+		assert.Equal(t, uint64(len(Records)-1), report.RecoveredKeys)
+		assert.Len(t, report.Problems, 3)
+		assert.True(t, checkStore(t, dbPath).IsOk())
+
+		store = createStore(t, dbPath, nil, true, WithOrderedIndex())
+		defer func() {
+			_ = store.Close()
+		}()
+		assertStoreContains(t, store, Records[:6])
+		assertKeysDontExist(t, store, [][]byte{Records[6].k})
+		assert.Equal(t, uint64(len(Records)-1), store.Len())
+		assertSearchResults(t, store, []byte("o"), []testRecord{Records[5]})
+		assertRangeResults(t, store, nil, nil, 0, false, []testRecord{Records[3], Records[0], Records[1], Records[4], Records[5], Records[2]})
+	})
+
+	t.Run("RepairOfAnIntactStoreChangesNothing", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		insertRecords(t, store, Records, nil)
+		deleteRecords(t, store, [][]byte{Records[0].k})
+		_ = store.Close()
+		initialFileSize := getFileSize(t, dbPath)
+
+		report, err := Repair(dbPath)
+		if err != nil {
+			t.Fatalf("error repairing store: %s", err)
+		}
+		assert.True(t, report.IsOk())
+		assert.False(t, report.IsRepaired)
+		assert.Equal(t, initialFileSize, getFileSize(t, dbPath))
+	})
+
+	t.Run("RepairOfAStoreWhoseHeaderIsCorruptedReturnsErrNotSupported", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		insertRecords(t, store, Records, nil)
+		_ = store.Close()
+		truncateFile(t, filepath.Join(dbPath, DbFileName), getFileSize(t, dbPath)-50)
+
+		report, err := Repair(dbPath)
+		assert.Equal(t, errors.NewErrNotSupported("repair of a database file whose header is corrupted"), err)
+		assert.Equal(t, []string{DbFileName}, problemFiles(report))
+	})
+
+	t.Run("RepairOfAStoreThatIsOpenReturnsErrStoreLocked", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		_, err := Repair(dbPath)
+		assert.Equal(t, errors.NewErrStoreLocked(dbPath), err)
+	})
+}
+
+func ExampleRepair() {
+	store, err := New("testdb_repaired", nil, nil, nil, nil, false)
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll("testdb_repaired")
+	}()
+
+	err = store.Set([]byte("foo"), []byte("bar"), nil)
+	if err != nil {
+		log.Fatalf("error setting key value: %s", err)
+	}
+
+	// the store must be closed first
+	err = store.Close()
+	if err != nil {
+		log.Fatalf("error closing store: %s", err)
+	}
+
+	report, err := Repair("testdb_repaired")
+	if err != nil {
+		log.Fatalf("error repairing store: %s", err)
+	}
+
+	for _, problem := range report.Problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("ok: %t, live keys: %d", report.IsOk(), report.LiveKeys)
+	// Output: ok: true, live keys: 1
+}
+
+// checkStore checks the store at the given path, failing the test if it can't
+func checkStore(t *testing.T, dbPath string) *CheckReport {
+	report, err := Check(dbPath)
+	if err != nil {
+		t.Fatalf("error checking store: %s", err)
+	}
+
+	return report
+}
+
+// problemFiles returns the names of the files in which each of the problems in the report was found
+func problemFiles(report *CheckReport) []string {
+	files := make([]string, 0, len(report.Problems))
+	for _, problem := range report.Problems {
+		files = append(files, problem.File)
+	}
+
+	return files
+}
@@ -0,0 +1,167 @@
+package scdb
+
+import (
+	"bytes"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/buffers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+)
+
+// Cursor walks through all the live key-value pairs of a Store, skipping the deleted and expired ones.
+//
+// The pairs come in the order of their keys' slots in the index, which is the same each time the store
+// is walked through, but is not the sorted order of the keys.
+//
+// The store is only locked for the duration of each call to Next or Seek so other reads and writes can go on
+// in between them. Pairs set or deleted while the cursor is open may or may not be returned by it.
+type Cursor struct {
+	store *Store
+	// nextIndexAddr is the address of the index slot from which the next key-value pair is looked for
+	nextIndexAddr uint64
+	isClosed      bool
+}
+
+// Cursor creates a new Cursor that starts at the first key-value pair of the store
+func (s *Store) Cursor() *Cursor {
+	return &Cursor{store: s, nextIndexAddr: headers.HeaderSizeInBytes}
+}
+
+// Iterate calls `fn` for each live key-value pair in the store, in the order of the pairs' slots in the index.
+//
+// It stops at the first error returned by `fn`, returning that error. Like with a Cursor, the store is not locked
+// for the whole iteration, so `fn` may itself read from, and write to, the store.
+func (s *Store) Iterate(fn func(k []byte, v []byte) error) error {
+	cursor := s.Cursor()
+	defer cursor.Close()
+
+	for {
+		kv, err := cursor.Next()
+		if err != nil {
+			return err
+		}
+
+		if kv == nil {
+			return nil
+		}
+
+		err = fn(kv.K, kv.V)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Next returns the next live key-value pair, moving the cursor past it.
+// It returns nil when there are no more key-value pairs.
+func (c *Cursor) Next() (*buffers.KeyValuePair, error) {
+	if c.isClosed {
+		return nil, errors.NewErrNotSupported("use of a closed cursor")
+	}
+
+	s := c.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.isClosed {
+		return nil, errors.NewErrNotSupported("use of a closed store")
+	}
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	// the index may have grown since the last call
+	indexEnd := headers.HeaderSizeInBytes + s.header.NumberOfIndexBlocks*s.header.NetBlockSize
+	for ; c.nextIndexAddr < indexEnd; c.nextIndexAddr += headers.IndexEntrySizeInBytes {
+		kvOffsetInBytes, err := s.bufferPool.ReadIndex(c.nextIndexAddr)
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.Equal(kvOffsetInBytes, zeroU64) {
+			continue
+		}
+
+		kvOffset, err := internal.Uint64FromByteArray(kvOffsetInBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		kv, err := s.bufferPool.GetKeyValue(kvOffset)
+		if err != nil {
+			return nil, err
+		}
+
+		if kv != nil {
+			c.nextIndexAddr += headers.IndexEntrySizeInBytes
+			return kv, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Seek moves the cursor to the given key so that Next returns the key-value pair of that key, if it is live,
+// followed by those after it.
+//
+// If the key is not in the store, the cursor is moved to where the key would be in the index,
+// such that Next returns the key-value pairs that would come after it.
+func (c *Cursor) Seek(k []byte) error {
+	if c.isClosed {
+		return errors.NewErrNotSupported("use of a closed cursor")
+	}
+
+	s := c.store
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.isClosed {
+		return errors.NewErrNotSupported("use of a closed store")
+	}
+
+	if s.failure != nil {
+		return s.failure
+	}
+
+	initialIdxOffset := headers.GetIndexOffset(s.header, k)
+	for idxBlock := uint64(0); idxBlock < s.header.NumberOfIndexBlocks; idxBlock++ {
+		indexOffset, err := headers.GetIndexOffsetInNthBlock(s.header, initialIdxOffset, idxBlock)
+		if err != nil {
+			return err
+		}
+
+		kvOffsetInBytes, err := s.bufferPool.ReadIndex(indexOffset)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(kvOffsetInBytes, zeroU64) {
+			continue
+		}
+
+		kvOffset, err := internal.Uint64FromByteArray(kvOffsetInBytes)
+		if err != nil {
+			return err
+		}
+
+		isOffsetForKey, err := s.bufferPool.AddrBelongsToKey(kvOffset, k)
+		if err != nil {
+			return err
+		}
+
+		if isOffsetForKey {
+			c.nextIndexAddr = indexOffset
+			return nil
+		}
+	}
+
+	c.nextIndexAddr = initialIdxOffset
+	return nil
+}
+
+// Close frees up the cursor. It is unusable after this.
+func (c *Cursor) Close() error {
+	c.isClosed = true
+	return nil
+}
@@ -0,0 +1,269 @@
+package scdb
+
+import (
+	goErrors "errors"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestStore_Iterate(t *testing.T) {
+	dbPath := "testdb_iterate"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("IterateVisitsAllLiveKeyValuePairsSkippingDeletedAndExpiredOnes", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		ttl := 500 * time.Millisecond
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:5], nil)
+		insertRecords(t, store, Records[5:], &ttl)
+		deleteRecords(t, store, [][]byte{Records[0].k})
+		time.Sleep(time.Second)
+
+		got := make([]testRecord, 0)
+		err := store.Iterate(func(k []byte, v []byte) error {
+			got = append(got, testRecord{k, v})
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("error iterating store: %s", err)
+		}
+
+		assert.ElementsMatch(t, Records[1:5], got)
+	})
+
+	t.Run("IterateStopsAtTheFirstErrorReturnedByFn", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		expectedErr := goErrors.New("some error")
+		calls := 0
+		err := store.Iterate(func(k []byte, v []byte) error {
+			calls++
+			return expectedErr
+		})
+
+		assert.Equal(t, expectedErr, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("IterateLetsFnWriteToTheStore", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		err := store.Iterate(func(k []byte, v []byte) error {
+			return store.Delete(k)
+		})
+		if err != nil {
+			t.Fatalf("error iterating store: %s", err)
+		}
+
+		assertKeysDontExist(t, store, extractKeysFromRecords(Records))
+	})
+}
+
+func TestCursor(t *testing.T) {
+	dbPath := "testdb_cursor"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("NextReturnsNilOnceAllKeyValuePairsAreReturned", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		cursor := store.Cursor()
+		defer func() {
+			_ = cursor.Close()
+		}()
+		got := collectFromCursor(t, cursor)
+		assert.ElementsMatch(t, Records, got)
+
+		for i := 0; i < 2; i++ {
+			kv, err := cursor.Next()
+			assert.Nil(t, err)
+			assert.Nil(t, kv)
+		}
+	})
+
+	t.Run("SeekMovesTheCursorToTheGivenKey", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		all := collectFromCursor(t, store.Cursor())
+
+		cursor := store.Cursor()
+		defer func() {
+			_ = cursor.Close()
+		}()
+		err := cursor.Seek(all[3].k)
+		if err != nil {
+			t.Fatalf("error seeking: %s", err)
+		}
+
+		assert.Equal(t, all[3:], collectFromCursor(t, cursor))
+	})
+
+	t.Run("SeekForMissingKeyMovesTheCursorToWhereTheKeyWouldBe", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		all := collectFromCursor(t, store.Cursor())
+		deleteRecords(t, store, [][]byte{all[3].k})
+
+		cursor := store.Cursor()
+		defer func() {
+			_ = cursor.Close()
+		}()
+		err := cursor.Seek(all[3].k)
+		if err != nil {
+			t.Fatalf("error seeking: %s", err)
+		}
+
+		assert.Equal(t, all[4:], collectFromCursor(t, cursor))
+	})
+
+	t.Run("CursorReturnsEachKeyOnceEvenIfTheIndexGrowsInBetween", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStoreWithMaxKeys(t, dbPath, 10, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		cursor := store.Cursor()
+		defer func() {
+			_ = cursor.Close()
+		}()
+		first, err := cursor.Next()
+		if err != nil {
+			t.Fatalf("error getting next key-value pair: %s", err)
+		}
+
+		newRecords := make([]testRecord, 0, 50)
+		for i := 0; i < 50; i++ {
+			newRecords = append(newRecords, testRecord{[]byte(fmt.Sprintf("new-%d", i)), []byte("v")})
+		}
+		insertRecords(t, store, newRecords, nil)
+
+		got := append([]testRecord{{first.K, first.V}}, collectFromCursor(t, cursor)...)
+		seen := make(map[string]bool, len(got))
+		for _, record := range got {
+			assert.False(t, seen[string(record.k)], "%s returned twice", record.k)
+			seen[string(record.k)] = true
+		}
+		for _, record := range Records {
+			assert.True(t, seen[string(record.k)], "%s not returned", record.k)
+		}
+	})
+
+	t.Run("UseOfAClosedCursorReturnsErrNotSupported", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		cursor := store.Cursor()
+		err := cursor.Close()
+		if err != nil {
+			t.Fatalf("error closing cursor: %s", err)
+		}
+
+		expectedErr := errors.NewErrNotSupported("use of a closed cursor")
+		kv, err := cursor.Next()
+		assert.Nil(t, kv)
+		assert.Equal(t, expectedErr, err)
+		assert.Equal(t, expectedErr, cursor.Seek(Records[0].k))
+	})
+}
+
+func ExampleStore_Cursor() {
+	store, err := New("testdb", nil, nil, nil, nil, false)
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	cursor := store.Cursor()
+	defer func() {
+		_ = cursor.Close()
+	}()
+
+	for {
+		kv, err := cursor.Next()
+		if err != nil {
+			log.Fatalf("error getting next key-value pair: %s", err)
+		}
+
+		if kv == nil {
+			break
+		}
+
+		fmt.Printf("%s: %s\n", kv.K, kv.V)
+	}
+}
+
+// collectFromCursor returns all the key-value pairs that are left for the given cursor to return
+func collectFromCursor(t *testing.T, cursor *Cursor) []testRecord {
+	records := make([]testRecord, 0)
+	for {
+		kv, err := cursor.Next()
+		if err != nil {
+			t.Fatalf("error getting next key-value pair: %s", err)
+		}
+
+		if kv == nil {
+			return records
+		}
+
+		records = append(records, testRecord{kv.K, kv.V})
+	}
+}
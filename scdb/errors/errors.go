@@ -46,3 +46,118 @@ func (ens *ErrNotSupported) Error() string {
 func NewErrNotSupported(op string) *ErrNotSupported {
 	return &ErrNotSupported{op}
 }
+
+// ErrCorruptedEntry is the error when an entry read from file is not what was written to it
+// e.g. its checksum does not match its contents or its size overflows the file
+type ErrCorruptedEntry struct {
+	Offset uint64
+	Key    []byte
+}
+
+func (ece *ErrCorruptedEntry) Error() string {
+	return fmt.Sprintf("Corrupted Entry Error: entry at offset %d for key %s is corrupted", ece.Offset, ece.Key)
+}
+
+// NewErrCorruptedEntry creates a new ErrCorruptedEntry for the entry at the given file offset
+// that was being read for the given key
+func NewErrCorruptedEntry(offset uint64, key []byte) *ErrCorruptedEntry {
+	return &ErrCorruptedEntry{Offset: offset, Key: key}
+}
+
+// ErrNotAnInteger is the error when the value of a key is used as an integer e.g. by Store.Increment,
+// but it is not the decimal form of a 64-bit integer
+type ErrNotAnInteger struct {
+	Key []byte
+}
+
+func (eni *ErrNotAnInteger) Error() string {
+	return fmt.Sprintf("Not An Integer Error: value of key %s is not an integer", eni.Key)
+}
+
+// NewErrNotAnInteger creates a new ErrNotAnInteger for the given key
+func NewErrNotAnInteger(key []byte) *ErrNotAnInteger {
+	return &ErrNotAnInteger{Key: key}
+}
+
+// ErrStoreLocked is the error when a store is opened while another Store, in this or another process,
+// has it open in a way that conflicts e.g. two Stores opened for writing at the same path
+type ErrStoreLocked struct {
+	Path string
+}
+
+func (esl *ErrStoreLocked) Error() string {
+	return fmt.Sprintf("Store Locked Error: store at %s is already open elsewhere", esl.Path)
+}
+
+// NewErrStoreLocked creates a new ErrStoreLocked for the store at the given path
+func NewErrStoreLocked(path string) *ErrStoreLocked {
+	return &ErrStoreLocked{Path: path}
+}
+
+// ErrReadOnly is the error when there is an attempt to change a store that was opened read-only
+type ErrReadOnly struct {
+	op string
+}
+
+func (ero *ErrReadOnly) Error() string {
+	return fmt.Sprintf("Read Only Error: %s not allowed on a read-only store", ero.op)
+}
+
+// NewErrReadOnly creates a new ErrReadOnly for the given operation
+func NewErrReadOnly(op string) *ErrReadOnly {
+	return &ErrReadOnly{op}
+}
+
+// ErrInvalidRecord is the error when a record read by Store.Import is not a valid key-value pair
+// in the format it is read in
+type ErrInvalidRecord struct {
+	// Number is the position of the record in the input, counting from 1, or 0 for the header row of a CSV
+	Number uint64
+	Reason string
+}
+
+func (eir *ErrInvalidRecord) Error() string {
+	return fmt.Sprintf("Invalid Record Error: record %d is invalid: %s", eir.Number, eir.Reason)
+}
+
+// NewErrInvalidRecord creates a new ErrInvalidRecord for the record at the given position in the input
+func NewErrInvalidRecord(number uint64, reason string) *ErrInvalidRecord {
+	return &ErrInvalidRecord{Number: number, Reason: reason}
+}
+
+// ErrUnsupportedFormat is the error when a file's header has a title that is not of any known format version
+// e.g. the file was written by a newer version of scdb, or is not a scdb file at all
+type ErrUnsupportedFormat struct {
+	Title []byte
+}
+
+func (euf *ErrUnsupportedFormat) Error() string {
+	return fmt.Sprintf("Unsupported Format Error: file title %q is not of any known format version", euf.Title)
+}
+
+// NewErrUnsupportedFormat creates a new ErrUnsupportedFormat for the given title
+func NewErrUnsupportedFormat(title []byte) *ErrUnsupportedFormat {
+	return &ErrUnsupportedFormat{Title: title}
+}
+
+// ErrStoreFailed is the error when a store is used after an atomic unit of writes e.g. a Store.Batch,
+// failed partway through being applied. The store has to be closed and reopened to complete the writes
+// from the log they were recorded in.
+type ErrStoreFailed struct {
+	// Cause is the error with which the writes failed
+	Cause error
+}
+
+func (esf *ErrStoreFailed) Error() string {
+	return fmt.Sprintf("Store Failed Error: writes were only partly applied (%s); reopen the store to complete them", esf.Cause)
+}
+
+// Unwrap returns the error with which the writes failed
+func (esf *ErrStoreFailed) Unwrap() error {
+	return esf.Cause
+}
+
+// NewErrStoreFailed creates a new ErrStoreFailed for writes that failed with the given error
+func NewErrStoreFailed(cause error) *ErrStoreFailed {
+	return &ErrStoreFailed{Cause: cause}
+}
@@ -0,0 +1,291 @@
+package scdb
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/sopherapps/go-scdb/scdb/internal/wal"
+	"io"
+	"strconv"
+	"time"
+)
+
+// importBatchSize is the maximum number of key-value pairs that Import applies in one atomic batch
+const importBatchSize int = 1000
+
+// csvHeader is the first row of an export in the CSV format
+var csvHeader = []string{"key", "value", "expiry"}
+
+// Format is the format in which Export writes, and Import reads, key-value pairs.
+//
+// In every format, each key-value pair is a record of its key, its value and its expiry. The key and value are
+// base64 encoded, since they can have any bytes. The expiry is the time at which the key expires,
+// in milliseconds from unix epoch, or 0 if it never expires.
+type Format uint8
+
+const (
+	// FormatJSONLines has each record as a JSON object on its own line
+	// e.g. {"key":"Zm9v","value":"YmFy","expiry":0}
+	FormatJSONLines Format = iota
+
+	// FormatCSV has each record as a row of a CSV file, after a header row of "key,value,expiry"
+	FormatCSV
+)
+
+// record is a key-value pair as it is exported and imported
+type record struct {
+	Key    []byte `json:"key"`
+	Value  []byte `json:"value"`
+	Expiry uint64 `json:"expiry"`
+}
+
+// recordWriter writes records in a given format
+type recordWriter interface {
+	// write writes the given record
+	write(r *record) error
+	// flush writes any buffered records to the underlying writer
+	flush() error
+}
+
+// recordReader reads records in a given format
+type recordReader interface {
+	// read reads the next record, whose position in the input is `number`.
+	// It returns io.EOF when there are no more records.
+	read(number uint64) (*record, error)
+}
+
+// Export writes every live key-value pair of the store, as it is now, to `w` in the given format,
+// along with the time at which each expires.
+//
+// The key-value pairs are read from a Snapshot, so reads and writes go on while it runs.
+// An errors.ErrNotSupported is returned if the format is unknown.
+func (s *Store) Export(w io.Writer, format Format) error {
+	writer, err := newRecordWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = snapshot.Close()
+	}()
+
+	err = snapshot.iterateEntries(func(entry *values.KeyValueEntry) error {
+		return writer.write(&record{Key: entry.Key, Value: entry.Value, Expiry: entry.Expiry})
+	})
+	if err != nil {
+		return err
+	}
+
+	return writer.flush()
+}
+
+// Import sets the key-value pairs read from `r` in the given format, as written by Export, keeping the expiry of each.
+// Key-value pairs that have expired already are skipped. It returns the number of key-value pairs set.
+//
+// The key-value pairs are set in atomic batches, just like in Store.Batch, of up to 1000 each. Thus, if a record
+// can't be read, the batches before it will have been applied, and an errors.ErrInvalidRecord is returned.
+// An errors.ErrNotSupported is returned if the format is unknown.
+func (s *Store) Import(r io.Reader, format Format) (uint64, error) {
+	if s.isReadOnly {
+		return 0, errors.NewErrReadOnly("import")
+	}
+
+	reader, err := newRecordReader(r, format)
+	if err != nil {
+		return 0, err
+	}
+
+	imported := uint64(0)
+	ops := make([]wal.Op, 0, importBatchSize)
+	now := uint64(time.Now().UnixMilli())
+	for number := uint64(1); ; number++ {
+		rec, err := reader.read(number)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, err
+		}
+
+		if rec.Expiry != 0 && rec.Expiry <= now {
+			continue
+		}
+
+		ops = append(ops, wal.Op{Kind: wal.OpSet, Key: rec.Key, Value: rec.Value, Expiry: rec.Expiry})
+		if len(ops) == importBatchSize {
+			err = s.applyImported(ops)
+			if err != nil {
+				return imported, err
+			}
+
+			imported += uint64(len(ops))
+			ops = make([]wal.Op, 0, importBatchSize)
+		}
+	}
+
+	if len(ops) == 0 {
+		return imported, nil
+	}
+
+	err = s.applyImported(ops)
+	if err != nil {
+		return imported, err
+	}
+
+	return imported + uint64(len(ops)), nil
+}
+
+// applyImported applies the given set operations of Import as a single atomic unit
+func (s *Store) applyImported(ops []wal.Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failure != nil {
+		return s.failure
+	}
+
+	return s.applyAtomically(ops)
+}
+
+// newRecordWriter creates a recordWriter that writes to `w` in the given format
+func newRecordWriter(w io.Writer, format Format) (recordWriter, error) {
+	switch format {
+	case FormatJSONLines:
+		buf := bufio.NewWriter(w)
+		return &jsonRecordWriter{buf: buf, encoder: json.NewEncoder(buf)}, nil
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		err := writer.Write(csvHeader)
+		if err != nil {
+			return nil, err
+		}
+
+		return &csvRecordWriter{writer: writer}, nil
+	default:
+		return nil, errors.NewErrNotSupported(fmt.Sprintf("format %d", format))
+	}
+}
+
+// newRecordReader creates a recordReader that reads from `r` in the given format
+func newRecordReader(r io.Reader, format Format) (recordReader, error) {
+	switch format {
+	case FormatJSONLines:
+		return &jsonRecordReader{decoder: json.NewDecoder(r)}, nil
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = len(csvHeader)
+		return &csvRecordReader{reader: reader}, nil
+	default:
+		return nil, errors.NewErrNotSupported(fmt.Sprintf("format %d", format))
+	}
+}
+
+// jsonRecordWriter writes records in the FormatJSONLines format
+type jsonRecordWriter struct {
+	buf     *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (jw *jsonRecordWriter) write(r *record) error {
+	return jw.encoder.Encode(r)
+}
+
+func (jw *jsonRecordWriter) flush() error {
+	return jw.buf.Flush()
+}
+
+// jsonRecordReader reads records in the FormatJSONLines format
+type jsonRecordReader struct {
+	decoder *json.Decoder
+}
+
+func (jr *jsonRecordReader) read(number uint64) (*record, error) {
+	var r record
+	err := jr.decoder.Decode(&r)
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.NewErrInvalidRecord(number, err.Error())
+	}
+
+	if r.Key == nil {
+		return nil, errors.NewErrInvalidRecord(number, "it has no key")
+	}
+
+	return &r, nil
+}
+
+// csvRecordWriter writes records in the FormatCSV format, after the header row
+type csvRecordWriter struct {
+	writer *csv.Writer
+}
+
+func (cw *csvRecordWriter) write(r *record) error {
+	return cw.writer.Write([]string{
+		base64.StdEncoding.EncodeToString(r.Key),
+		base64.StdEncoding.EncodeToString(r.Value),
+		strconv.FormatUint(r.Expiry, 10),
+	})
+}
+
+func (cw *csvRecordWriter) flush() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+// csvRecordReader reads records in the FormatCSV format
+type csvRecordReader struct {
+	reader       *csv.Reader
+	isHeaderRead bool
+}
+
+func (cr *csvRecordReader) read(number uint64) (*record, error) {
+	if !cr.isHeaderRead {
+		row, err := cr.reader.Read()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			return nil, errors.NewErrInvalidRecord(0, err.Error())
+		}
+
+		if row[0] != csvHeader[0] || row[1] != csvHeader[1] || row[2] != csvHeader[2] {
+			return nil, errors.NewErrInvalidRecord(0, "the header row is not key,value,expiry")
+		}
+		cr.isHeaderRead = true
+	}
+
+	row, err := cr.reader.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.NewErrInvalidRecord(number, err.Error())
+	}
+
+	key, err := base64.StdEncoding.DecodeString(row[0])
+	if err != nil {
+		return nil, errors.NewErrInvalidRecord(number, fmt.Sprintf("its key is not base64: %s", err))
+	}
+
+	value, err := base64.StdEncoding.DecodeString(row[1])
+	if err != nil {
+		return nil, errors.NewErrInvalidRecord(number, fmt.Sprintf("its value is not base64: %s", err))
+	}
+
+	expiry, err := strconv.ParseUint(row[2], 10, 64)
+	if err != nil {
+		return nil, errors.NewErrInvalidRecord(number, fmt.Sprintf("its expiry is not a timestamp: %s", err))
+	}
+
+	return &record{Key: key, Value: value, Expiry: expiry}, nil
+}
@@ -0,0 +1,247 @@
+package scdb
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore_Export(t *testing.T) {
+	dbPath := "testdb_export"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("ExportWritesEveryLiveKeyValuePairWithItsExpiryAsJSONLines", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:2], nil)
+		err := store.Set([]byte("foo"), []byte{0, 255}, nil)
+		if err != nil {
+			t.Fatalf("error setting key value: %s", err)
+		}
+		_, err = store.ExpireAt([]byte("foo"), time.UnixMilli(4102444800000))
+		if err != nil {
+			t.Fatalf("error setting expiry: %s", err)
+		}
+		deleteRecords(t, store, [][]byte{Records[0].k})
+
+		lines := exportLines(t, store, FormatJSONLines)
+		assert.Equal(t, []string{
+			`{"key":"Zm9v","value":"AP8=","expiry":4102444800000}`,
+			`{"key":"aGk=","value":"RW5nbGlzaA==","expiry":0}`,
+		}, lines)
+	})
+
+	t.Run("ExportWritesEveryLiveKeyValuePairWithItsExpiryAsCSV", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:1], nil)
+
+		assert.Equal(t, []string{"aGV5,RW5nbGlzaA==,0", "key,value,expiry"}, exportLines(t, store, FormatCSV))
+	})
+
+	t.Run("ExportOfAnEmptyStoreWritesOnlyTheCSVHeader", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		assert.Equal(t, []string{"key,value,expiry"}, exportLines(t, store, FormatCSV))
+		assert.Equal(t, []string{}, exportLines(t, store, FormatJSONLines))
+	})
+
+	t.Run("ExportInAnUnknownFormatReturnsErrNotSupported", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		err := store.Export(&bytes.Buffer{}, Format(7))
+		assert.Equal(t, errors.NewErrNotSupported("format 7"), err)
+	})
+}
+
+func TestStore_Import(t *testing.T) {
+	dbPath := "testdb_import"
+	copyPath := "testdb_import_copy"
+	removeStore(t, dbPath)
+	removeStore(t, copyPath)
+	defer func() {
+		removeStore(t, dbPath)
+		removeStore(t, copyPath)
+	}()
+
+	t.Run("ImportLoadsWhatExportWroteKeepingTheExpiriesAndIndices", func(t *testing.T) {
+		for _, format := range []Format{FormatJSONLines, FormatCSV} {
+			func() {
+				defer func() {
+					removeStore(t, dbPath)
+					removeStore(t, copyPath)
+				}()
+				store := createStore(t, dbPath, nil, false)
+				defer func() {
+					_ = store.Close()
+				}()
+				insertRecords(t, store, Records[:4], nil)
+				ttl := time.Hour
+				insertRecords(t, store, Records[4:], &ttl)
+
+				buf := bytes.Buffer{}
+				err := store.Export(&buf, format)
+				if err != nil {
+					t.Fatalf("error exporting store: %s", err)
+				}
+
+				copied := createStore(t, copyPath, nil, true, WithOrderedIndex())
+				defer func() {
+					_ = copied.Close()
+				}()
+				imported, err := copied.Import(&buf, format)
+				if err != nil {
+					t.Fatalf("error importing: %s", err)
+				}
+
+				assert.Equal(t, uint64(len(Records)), imported)
+				assertStoreContains(t, copied, Records)
+				assert.Nil(t, getTTL(t, copied, Records[0].k))
+				assert.Equal(t, getTTL(t, store, Records[4].k).Round(time.Minute), getTTL(t, copied, Records[4].k).Round(time.Minute))
+				assertSearchResults(t, copied, []byte("h"), []testRecord{Records[0], Records[1], Records[4]})
+				assertRangeResults(t, copied, nil, nil, 0, false, []testRecord{Records[3], Records[0], Records[1], Records[4], Records[6], Records[5], Records[2]})
+			}()
+		}
+	})
+
+	t.Run("ImportSkipsKeyValuePairsThatHaveExpired", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		input := fmt.Sprintf("key,value,expiry\nZm9v,YmFy,%d\naGV5,YmFy,0\n", time.Now().Add(-time.Hour).UnixMilli())
+
+		imported, err := store.Import(strings.NewReader(input), FormatCSV)
+		if err != nil {
+			t.Fatalf("error importing: %s", err)
+		}
+
+		assert.Equal(t, uint64(1), imported)
+		assertStoreContains(t, store, []testRecord{{k: []byte("hey"), v: []byte("bar")}})
+		assertKeysDontExist(t, store, [][]byte{[]byte("foo")})
+	})
+
+	t.Run("ImportOfAnInvalidRecordReturnsErrInvalidRecord", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		type testData struct {
+			input  string
+			format Format
+			err    *errors.ErrInvalidRecord
+		}
+		dataTable := []testData{
+			{"{\"key\":\"Zm9v\"}\n{\"value\":\"YmFy\"}\n", FormatJSONLines, errors.NewErrInvalidRecord(2, "it has no key")},
+			{"{\"key\":\"Zm9v\"}\nfoo\n", FormatJSONLines, nil},
+			{"foo,bar,expiry\n", FormatCSV, errors.NewErrInvalidRecord(0, "the header row is not key,value,expiry")},
+			{"key,value,expiry\nZm9v,*,0\n", FormatCSV, nil},
+			{"key,value,expiry\nZm9v,YmFy,soon\n", FormatCSV, nil},
+		}
+
+		for _, tc := range dataTable {
+			imported, err := store.Import(strings.NewReader(tc.input), tc.format)
+			assert.Equal(t, uint64(0), imported)
+			assert.IsType(t, &errors.ErrInvalidRecord{}, err)
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+			}
+		}
+		// a batch is only applied once it is full, or at the end of the input
+		assertKeysDontExist(t, store, [][]byte{[]byte("foo")})
+	})
+
+	t.Run("ImportOnAReadOnlyStoreReturnsErrReadOnly", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		_ = store.Close()
+		store = openStore(t, dbPath, ReadOnly)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		_, err := store.Import(strings.NewReader("key,value,expiry\n"), FormatCSV)
+		assert.Equal(t, errors.NewErrReadOnly("import"), err)
+	})
+}
+
+func ExampleStore_Export() {
+	store, err := New("testdb_export_example", nil, nil, nil, nil, false)
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+		_ = os.RemoveAll("testdb_export_example")
+	}()
+
+	err = store.Set([]byte("foo"), []byte("bar"), nil)
+	if err != nil {
+		log.Fatalf("error setting key value: %s", err)
+	}
+
+	err = store.Export(os.Stdout, FormatJSONLines)
+	if err != nil {
+		log.Fatalf("error exporting store: %s", err)
+	}
+	// Output: {"key":"Zm9v","value":"YmFy","expiry":0}
+}
+
+// exportLines exports the store in the given format, returning the lines written in sorted order
+func exportLines(t *testing.T, store *Store, format Format) []string {
+	buf := bytes.Buffer{}
+	err := store.Export(&buf, format)
+	if err != nil {
+		t.Fatalf("error exporting store: %s", err)
+	}
+
+	lines := make([]string, 0)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+
+	return lines
+}
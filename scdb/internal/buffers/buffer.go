@@ -2,6 +2,7 @@ package buffers
 
 import (
 	"bytes"
+	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
 	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
 	"math"
@@ -45,6 +46,22 @@ func (b *Buffer) Contains(addr uint64) bool {
 	return b.LeftOffset <= addr && addr < b.RightOffset
 }
 
+// ContainsEntry checks if the whole key-value entry at the given address is in this buffer
+// It returns false if even the size of the entry is not in the buffer
+func (b *Buffer) ContainsEntry(addr uint64) bool {
+	sizeBytes, err := b.ReadAt(addr, 4)
+	if err != nil {
+		return false
+	}
+
+	size, err := internal.Uint32FromByteArray(sizeBytes)
+	if err != nil {
+		return false
+	}
+
+	return addr+uint64(size) <= b.RightOffset
+}
+
 // Append appends the data to the end of the array
 // It returns the address (or offset) where the data was appended
 //
@@ -76,9 +93,11 @@ func (b *Buffer) Replace(addr uint64, data []byte) error {
 
 // GetValue returns the *entries.KeyValueEntry at the given address if the key there corresponds to the given key
 // Otherwise, it returns nil. This is to handle hash collisions.
-func (b *Buffer) GetValue(addr uint64, key []byte) (*values.KeyValueEntry, error) {
-	offset := addr - b.LeftOffset
-	entry, err := values.ExtractKeyValueEntryFromByteArray(b.Data, offset)
+//
+// `version` is the format version of the entries in the file. If the entry's checksum does not match
+// its contents, an ErrCorruptedEntry is returned.
+func (b *Buffer) GetValue(addr uint64, key []byte, version uint16) (*values.KeyValueEntry, error) {
+	entry, err := b.GetEntry(addr, key, version)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +108,30 @@ func (b *Buffer) GetValue(addr uint64, key []byte) (*values.KeyValueEntry, error
 	return nil, nil
 }
 
+// GetEntry returns the *entries.KeyValueEntry at the given address whatever its key, and even if it is
+// deleted or expired.
+//
+// `version` is the format version of the entries in the file. If the entry's checksum does not match
+// its contents, an ErrCorruptedEntry is returned. `key` is the key the entry is being read for, and is only used
+// in that error.
+func (b *Buffer) GetEntry(addr uint64, key []byte, version uint16) (*values.KeyValueEntry, error) {
+	if !b.Contains(addr) {
+		return nil, errors.NewErrOutOfBounds("address out of bounds")
+	}
+
+	offset := addr - b.LeftOffset
+	entry, err := values.ExtractKeyValueEntryFromByteArray(b.Data, offset, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if !entry.HasValidChecksum() {
+		return nil, errors.NewErrCorruptedEntry(addr, key)
+	}
+
+	return entry, nil
+}
+
 // ReadAt reads an arbitrary array at the given address and of given size and returns it
 func (b *Buffer) ReadAt(addr uint64, size uint64) ([]byte, error) {
 	err := internal.ValidateBounds(addr, addr+size, b.LeftOffset, b.RightOffset, "address out of bounds")
@@ -134,6 +177,28 @@ func (b *Buffer) TryDeleteKvEntry(addr uint64, key []byte) (bool, error) {
 	return false, nil
 }
 
+// TrySetExpiry tries to set the expiry of the kv entry at the given address
+// It returns false if the kv entry at the given address is not for the given key
+func (b *Buffer) TrySetExpiry(addr uint64, key []byte, expiry uint64) (bool, error) {
+	keySize := uint64(len(key))
+	// the key is followed by the isDeleted flag and then the expiry
+	err := internal.ValidateBounds(addr, addr+values.OffsetForKeyInKVArray+keySize+9, b.LeftOffset, b.RightOffset, "address out of bounds")
+	if err != nil {
+		return false, err
+	}
+
+	keyOffset := addr - b.LeftOffset + values.OffsetForKeyInKVArray
+	keyInData := b.Data[keyOffset : keyOffset+keySize]
+
+	if bytes.Equal(keyInData, key) {
+		expiryIdx := keyOffset + keySize + 1
+		copy(b.Data[expiryIdx:expiryIdx+8], internal.Uint64ToByteArray(expiry))
+		return true, nil
+	}
+
+	return false, nil
+}
+
 // Eq checks to see if two buffers are equal
 func (b *Buffer) Eq(other *Buffer) bool {
 	return b.LeftOffset == other.LeftOffset &&
@@ -1,18 +1,20 @@
 package buffers
 
 import (
+	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
 var KvDataArray = []byte{
-	/* size: 22u32*/ 0, 0, 0, 23,
+	/* size: 31u32*/ 0, 0, 0, 31,
 	/* key size: 3u32*/ 0, 0, 0, 3,
 	/* key */ 102, 111, 111,
 	/* is_deleted */ 0,
 	/* expiry 0u64 */ 0, 0, 0, 0, 0, 0, 0, 0,
 	/* value */ 98, 97, 114,
+	/* checksum */ 120, 178, 77, 154, 162, 169, 239, 175,
 }
 
 const CAPACITY uint64 = 4098
@@ -125,7 +127,7 @@ func TestBuffer_GetValue(t *testing.T) {
 		}
 
 		for _, record := range testData {
-			v, err := buf.GetValue(record.addr, record.key)
+			v, err := buf.GetValue(record.addr, record.key, values.CurrentFormat)
 			if err != nil {
 				t.Fatalf("error getting value: %s", err)
 			}
@@ -133,6 +135,18 @@ func TestBuffer_GetValue(t *testing.T) {
 		}
 	})
 
+	t.Run("Buffer.GetValueReturnsErrCorruptedEntryIfChecksumDoesNotMatch", func(t *testing.T) {
+		data := make([]byte, len(KvDataArray))
+		copy(data, KvDataArray)
+		// change the value from "bar" to "baz"
+		data[22] = 122
+
+		buf := NewBuffer(79, data, CAPACITY)
+		v, err := buf.GetValue(79, []byte("foo"), values.CurrentFormat)
+		assert.Equal(t, errors.NewErrCorruptedEntry(79, []byte("foo")), err)
+		assert.Nil(t, v)
+	})
+
 	t.Run("Buffer.GetValueReturnsErrorIfAddrIsOutOfBoundsForBuffer", func(t *testing.T) {
 		type testRecord struct {
 			addr uint64
@@ -145,13 +159,35 @@ func TestBuffer_GetValue(t *testing.T) {
 		}
 
 		for _, record := range testData {
-			v, err := buf.GetValue(record.addr, record.key)
+			v, err := buf.GetValue(record.addr, record.key, values.CurrentFormat)
 			assert.NotNil(t, err)
 			assert.Nil(t, v)
 		}
 	})
 }
 
+func TestBuffer_ContainsEntry(t *testing.T) {
+	type testRecord struct {
+		data     []byte
+		addr     uint64
+		expected bool
+	}
+
+	testData := []testRecord{
+		{KvDataArray, 79, true},
+		{append([]byte{1, 2}, KvDataArray...), 81, true},
+		{KvDataArray[:30], 79, false},
+		{KvDataArray[:3], 79, false},
+		{KvDataArray, 78, false},
+		{KvDataArray, 110, false},
+	}
+
+	for _, record := range testData {
+		buf := NewBuffer(79, record.data, CAPACITY)
+		assert.Equal(t, record.expected, buf.ContainsEntry(record.addr))
+	}
+}
+
 func TestBuffer_ReadAt(t *testing.T) {
 	t.Run("Buffer.ReadAtReturnsByteArrayOfGivenSizeStartingAtTheGivenAddress", func(t *testing.T) {
 		buf := NewBuffer(79, []byte{72, 97, 108, 108, 101, 108, 117, 106, 97, 104}, CAPACITY)
@@ -286,3 +322,57 @@ func TestBuffer_TryDeleteKvEntry(t *testing.T) {
 		}
 	})
 }
+
+func TestBuffer_TrySetExpiry(t *testing.T) {
+	t.Run("Buffer.TrySetExpiryDoesThatForGivenAddressIfAddressIsForGivenKeyReturningTrueIfSo", func(t *testing.T) {
+		type testRecord struct {
+			addr               uint64
+			key                []byte
+			expectedValue      bool
+			expectedFinalArray []byte
+		}
+
+		postUpdateData := make([]byte, len(KvDataArray))
+		copy(postUpdateData, KvDataArray)
+		// expiry 1666023836u64
+		copy(postUpdateData[12:20], []byte{0, 0, 0, 0, 99, 77, 129, 156})
+
+		testData := []testRecord{
+			{79, []byte("foo"), true, postUpdateData},
+			{79, []byte("bar"), false, KvDataArray},
+		}
+
+		for _, record := range testData {
+			data := make([]byte, len(KvDataArray))
+			copy(data, KvDataArray)
+			buf := NewBuffer(79, data, CAPACITY)
+			v, err := buf.TrySetExpiry(record.addr, record.key, 1666023836)
+			if err != nil {
+				t.Fatalf("error trying to set expiry: %s", err)
+			}
+
+			assert.Equal(t, record.expectedValue, v)
+			assert.Equal(t, record.expectedFinalArray, buf.Data)
+		}
+	})
+
+	t.Run("Buffer.TrySetExpiryReturnsErrorIfAddressIsOutOfBoundsOrExpiryWouldSpillOutOfBounds", func(t *testing.T) {
+		type testRecord struct {
+			addr uint64
+			key  []byte
+		}
+		buf := NewBuffer(79, KvDataArray, CAPACITY)
+		testData := []testRecord{
+			{790, []byte("foo")},
+			{78, []byte("foo")},
+			{80, []byte("foo.......................................")}, // long key
+			{100, []byte("foo")},
+		}
+
+		for _, record := range testData {
+			v, err := buf.TrySetExpiry(record.addr, record.key, 1666023836)
+			assert.NotNil(t, err)
+			assert.False(t, v)
+		}
+	})
+}
@@ -0,0 +1,587 @@
+package buffers
+
+import (
+	"errors"
+	"fmt"
+	scdbErrs "github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
+	"github.com/sopherapps/go-scdb/scdb/internal/ordered_index"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// CheckResult is what CheckFile counted in a database file, besides the problems it reported
+type CheckResult struct {
+	// LiveKeys is the number of keys in the index whose entries are neither deleted nor expired
+	LiveKeys uint64
+	// DeletedKeys is the number of keys in the index whose entries are deleted
+	DeletedKeys uint64
+	// ExpiredKeys is the number of keys in the index whose entries are expired
+	ExpiredKeys uint64
+	// Entries is the number of key-value entries in the file, including older versions of keys
+	Entries uint64
+}
+
+// CheckFile checks the database file at the given path for corruption, calling `report` with the offset
+// and a description of each problem found. The file is only read.
+//
+// It looks for a header that can't be read, index slots that point outside the key-value entries or to corrupted
+// entries, keys in index slots that their hash does not lead to, entries whose Size is too small for their KeySize,
+// entries that overflow the file, entries whose checksum does not match their contents, and a key count in the
+// header that does not match the index.
+//
+// An error is only returned if the file can't be read at all.
+func CheckFile(filePath string, report func(offset uint64, problem string)) (*CheckResult, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	result := &CheckResult{}
+	header, fileSize, ok, err := checkHeader(file, report)
+	if err != nil || !ok {
+		return result, err
+	}
+
+	// the keys whose entries can't be read could be live
+	unreadableKeys := uint64(0)
+	err = walkIndex(file, header, func(slotAddr uint64, kvAddr uint64) error {
+		kv, problem, err := readEntryToCheck(file, kvAddr, header, fileSize)
+		if err != nil {
+			return err
+		}
+
+		if problem != "" {
+			report(slotAddr, fmt.Sprintf("index slot points to %d where there is no valid entry: %s", kvAddr, problem))
+			unreadableKeys++
+			return nil
+		}
+
+		if !isInItsSlot(header, slotAddr, kv.Key) {
+			report(slotAddr, fmt.Sprintf("key %q is in an index slot its hash does not lead to", kv.Key))
+		}
+
+		switch {
+		case kv.IsDeleted:
+			result.DeletedKeys++
+		case values.IsExpired(kv):
+			result.ExpiredKeys++
+		default:
+			result.LiveKeys++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = walkEntries(file, header, fileSize, func(_ uint64, _ *values.KeyValueEntry) {
+		result.Entries++
+	}, report)
+	if err != nil {
+		return result, err
+	}
+
+	// files written before the number of keys was kept in the header have a count of 0.
+	// Keys that expired but have not been read since are still counted.
+	maxKeyCount := result.LiveKeys + result.ExpiredKeys + unreadableKeys
+	if header.KeyCount != 0 && (header.KeyCount < result.LiveKeys || header.KeyCount > maxKeyCount) {
+		report(headers.KeyCountOffset, fmt.Sprintf("key count %d does not match the %d live keys in the index", header.KeyCount, result.LiveKeys))
+	}
+
+	return result, nil
+}
+
+// RepairFile rebuilds the database file at the given path from the entries in it that are intact,
+// returning the number of keys kept.
+//
+// For each key, the entry its index slot points to is kept, if it is intact. Otherwise, the intact entry found last
+// when reading the file from start to end is kept, as it is the latest version of the key. Deleted and expired
+// entries are then dropped. The search index at `searchIndexFilePath` and the ordered index at `orderedIndexFilePath`
+// are rebuilt too, if they exist.
+//
+// The new files are written and swapped in just like in a Compaction, so that RecoverCompaction can clean up after
+// a crash. The header of the file must be readable, or else an errors.ErrNotSupported is returned.
+func RepairFile(filePath string, searchIndexFilePath string, orderedIndexFilePath string) (uint64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	header, fileSize, ok, err := checkHeader(file, func(uint64, string) {})
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, scdbErrs.NewErrNotSupported("repair of a database file whose header is corrupted")
+	}
+
+	entries, err := salvageEntries(file, header, fileSize)
+	if err != nil {
+		return 0, err
+	}
+	// the file is renamed over later on, which some platforms don't allow for open files
+	_ = file.Close()
+
+	folder := filepath.Dir(filePath)
+	newFilePath := filepath.Join(folder, compactionFileName)
+	isSwapped := false
+	defer func() {
+		if !isSwapped {
+			_ = os.Remove(newFilePath)
+			_ = os.Remove(filepath.Join(folder, searchIndexCompactionFileName))
+			_ = os.Remove(filepath.Join(folder, orderedIndexCompactionFileName))
+		}
+	}()
+
+	maxKeys := header.MaxKeys
+	for {
+		err = writeRepairedFile(newFilePath, header, maxKeys, entries)
+		if err == nil {
+			break
+		}
+
+		if _, ok := err.(*scdbErrs.ErrCollisionSaturation); !ok {
+			return 0, err
+		}
+		maxKeys *= 2
+	}
+
+	searchIndex, orderedIndex, err := newRepairedIndices(folder, searchIndexFilePath, orderedIndexFilePath, header, maxKeys)
+	defer func() {
+		if searchIndex != nil {
+			_ = searchIndex.Close()
+		}
+		if orderedIndex != nil {
+			_ = orderedIndex.Close()
+		}
+	}()
+	if err != nil {
+		return 0, err
+	}
+
+	err = indexRepairedFile(newFilePath, searchIndex, orderedIndex)
+	if err != nil {
+		return 0, err
+	}
+
+	// the new database file goes first, just like in Compaction.swap
+	err = os.Rename(newFilePath, filePath)
+	if err != nil {
+		return 0, err
+	}
+	isSwapped = true
+
+	err = internal.SyncDir(folder)
+	if err != nil {
+		return 0, err
+	}
+
+	if searchIndex != nil {
+		err = os.Rename(searchIndex.FilePath, searchIndexFilePath)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if orderedIndex != nil {
+		err = os.Rename(orderedIndex.FilePath, orderedIndexFilePath)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return uint64(len(entries)), internal.SyncDir(folder)
+}
+
+// checkHeader reads the header of the database file, reporting it if it is corrupted.
+// It returns false if the rest of the file can't be checked as a result.
+func checkHeader(file *os.File, report func(offset uint64, problem string)) (*headers.DbFileHeader, uint64, bool, error) {
+	fileSize, err := internal.GetFileSize(file)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	header, err := headers.ExtractDbFileHeaderFromFile(file)
+	if err != nil {
+		report(0, fmt.Sprintf("header can't be read: %s", err))
+		return nil, fileSize, false, nil
+	}
+
+	if header.BlockSize < uint32(headers.IndexEntrySizeInBytes) || header.MaxKeys == 0 {
+		report(0, fmt.Sprintf("header has a block size of %d and max keys of %d", header.BlockSize, header.MaxKeys))
+		return nil, fileSize, false, nil
+	}
+
+	if header.KeyValuesStartPoint > fileSize {
+		report(0, fmt.Sprintf("file of %d bytes is too small for its index, which ends at %d", fileSize, header.KeyValuesStartPoint))
+		return nil, fileSize, false, nil
+	}
+
+	return header, fileSize, true, nil
+}
+
+// walkIndex calls `fn` with the address of each filled index slot and the address it holds
+func walkIndex(file *os.File, header *headers.DbFileHeader, fn func(slotAddr uint64, kvAddr uint64) error) error {
+	buf := make([]byte, header.NetBlockSize)
+	for i := uint64(0); i < header.NumberOfIndexBlocks; i++ {
+		blockAddr := headers.HeaderSizeInBytes + i*header.NetBlockSize
+		_, err := file.ReadAt(buf, int64(blockAddr))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		for j := uint64(0); j < header.NetBlockSize; j += headers.IndexEntrySizeInBytes {
+			kvAddr, _ := internal.Uint64FromByteArray(buf[j : j+headers.IndexEntrySizeInBytes])
+			if kvAddr == 0 {
+				continue
+			}
+
+			err = fn(blockAddr+j, kvAddr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// walkEntries reads the key-value entries one after the other from the start of the entries to the end of the file,
+// calling `fn` with the address of each intact entry and reporting the rest.
+//
+// Reading stops at an entry whose size can't be trusted, since the start of the next entry is then unknown.
+func walkEntries(file *os.File, header *headers.DbFileHeader, fileSize uint64, fn func(kvAddr uint64, kv *values.KeyValueEntry), report func(offset uint64, problem string)) error {
+	addr := header.KeyValuesStartPoint
+	for addr < fileSize {
+		size, problem, err := readEntrySize(file, addr, header, fileSize)
+		if err != nil {
+			return err
+		}
+		if problem != "" {
+			report(addr, fmt.Sprintf("%s, so the entries after it can't be read", problem))
+			return nil
+		}
+
+		kv, problem, err := readEntryToCheck(file, addr, header, fileSize)
+		if err != nil {
+			return err
+		}
+
+		if problem != "" {
+			report(addr, problem)
+		} else {
+			fn(addr, kv)
+		}
+		addr += size
+	}
+
+	return nil
+}
+
+// readEntryToCheck reads the key-value entry at the given address, returning a description of the problem with it
+// instead if it is not intact
+func readEntryToCheck(file *os.File, kvAddr uint64, header *headers.DbFileHeader, fileSize uint64) (*values.KeyValueEntry, string, error) {
+	if kvAddr < header.KeyValuesStartPoint || kvAddr >= fileSize {
+		return nil, fmt.Sprintf("address is outside the entries, which are from %d to %d", header.KeyValuesStartPoint, fileSize), nil
+	}
+
+	size, problem, err := readEntrySize(file, kvAddr, header, fileSize)
+	if err != nil || problem != "" {
+		return nil, problem, err
+	}
+
+	data := make([]byte, size)
+	_, err = file.ReadAt(data, int64(kvAddr))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", err
+	}
+
+	kv, err := values.ExtractKeyValueEntryFromByteArray(data, 0, header.FormatVersion)
+	if err != nil {
+		return nil, fmt.Sprintf("entry can't be read: %s", err), nil
+	}
+
+	if !kv.HasValidChecksum() {
+		return nil, fmt.Sprintf("checksum of the entry for key %q does not match its contents", kv.Key), nil
+	}
+
+	return kv, "", nil
+}
+
+// readEntrySize reads the Size of the key-value entry at the given address, returning a description of the problem
+// with it instead if it is too small for the KeySize of the entry or the entry overflows the file
+func readEntrySize(file *os.File, kvAddr uint64, header *headers.DbFileHeader, fileSize uint64) (uint64, string, error) {
+	if kvAddr+values.OffsetForKeyInKVArray > fileSize {
+		return 0, fmt.Sprintf("entry overflows the file of %d bytes", fileSize), nil
+	}
+
+	buf := make([]byte, values.OffsetForKeyInKVArray)
+	_, err := file.ReadAt(buf, int64(kvAddr))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, "", err
+	}
+
+	size, _ := internal.Uint32FromByteArray(buf[:4])
+	keySize, _ := internal.Uint32FromByteArray(buf[4:])
+	minSize := uint64(keySize) + uint64(getKeyValueMinSize(header.FormatVersion))
+	if uint64(size) < minSize {
+		return 0, fmt.Sprintf("entry Size %d is less than the minimum %d for its KeySize %d", size, minSize, keySize), nil
+	}
+
+	if kvAddr+uint64(size) > fileSize {
+		return 0, fmt.Sprintf("entry of %d bytes overflows the file of %d bytes", size, fileSize), nil
+	}
+
+	return uint64(size), "", nil
+}
+
+// isInItsSlot returns true if the hash of the key leads to the index slot at the given address, in any index block
+func isInItsSlot(header *headers.DbFileHeader, slotAddr uint64, key []byte) bool {
+	initialOffset := headers.GetIndexOffset(header, key)
+	return (slotAddr-headers.HeaderSizeInBytes)%header.NetBlockSize == initialOffset-headers.HeaderSizeInBytes
+}
+
+// salvageEntries returns the live key-value entries of the file that are intact, in the order they are in the file.
+// See RepairFile for how the entry of each key is picked.
+func salvageEntries(file *os.File, header *headers.DbFileHeader, fileSize uint64) ([]*values.KeyValueEntry, error) {
+	type salvagedEntry struct {
+		addr      uint64
+		kv        *values.KeyValueEntry
+		isIndexed bool
+	}
+	entries := make(map[string]*salvagedEntry)
+
+	err := walkIndex(file, header, func(slotAddr uint64, kvAddr uint64) error {
+		kv, problem, err := readEntryToCheck(file, kvAddr, header, fileSize)
+		if err != nil || problem != "" {
+			return err
+		}
+
+		entries[string(kv.Key)] = &salvagedEntry{addr: kvAddr, kv: kv, isIndexed: true}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = walkEntries(file, header, fileSize, func(kvAddr uint64, kv *values.KeyValueEntry) {
+		entry, ok := entries[string(kv.Key)]
+		if !ok || (!entry.isIndexed && entry.addr < kvAddr) {
+			entries[string(kv.Key)] = &salvagedEntry{addr: kvAddr, kv: kv}
+		}
+	}, func(uint64, string) {})
+	if err != nil {
+		return nil, err
+	}
+
+	salvaged := make([]*salvagedEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.kv.IsDeleted && !values.IsExpired(entry.kv) {
+			salvaged = append(salvaged, entry)
+		}
+	}
+	sort.Slice(salvaged, func(i, j int) bool {
+		return salvaged[i].addr < salvaged[j].addr
+	})
+
+	kvs := make([]*values.KeyValueEntry, 0, len(salvaged))
+	for _, entry := range salvaged {
+		kvs = append(kvs, entry.kv)
+	}
+
+	return kvs, nil
+}
+
+// writeRepairedFile writes the given key-value entries to a new database file at the given path,
+// whose index holds `maxKeys` keys. An errors.ErrCollisionSaturation is returned if they don't all fit in the index.
+func writeRepairedFile(filePath string, header *headers.DbFileHeader, maxKeys uint64, entries []*values.KeyValueEntry) error {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	newHeader := headers.NewDbFileHeader(&maxKeys, &header.RedundantBlocks, &header.BlockSize)
+	fileSize, err := headers.InitializeFile(file, newHeader)
+	if err != nil {
+		return err
+	}
+
+	newFileSize := uint64(fileSize)
+	for _, kv := range entries {
+		slotAddr, err := findEmptySlot(file, newHeader, kv.Key)
+		if err != nil {
+			return err
+		}
+
+		kvByteArray := values.NewKeyValueEntry(kv.Key, kv.Value, kv.Expiry).AsBytes()
+		_, err = file.WriteAt(kvByteArray, int64(newFileSize))
+		if err != nil {
+			return err
+		}
+
+		_, err = file.WriteAt(internal.Uint64ToByteArray(newFileSize), int64(slotAddr))
+		if err != nil {
+			return err
+		}
+
+		newFileSize += uint64(len(kvByteArray))
+	}
+
+	_, err = file.WriteAt(internal.Uint64ToByteArray(uint64(len(entries))), int64(headers.KeyCountOffset))
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// findEmptySlot returns the address of the first empty index slot that the hash of the key leads to
+func findEmptySlot(file *os.File, header *headers.DbFileHeader, key []byte) (uint64, error) {
+	initialOffset := headers.GetIndexOffset(header, key)
+	buf := make([]byte, headers.IndexEntrySizeInBytes)
+	for i := uint64(0); i < header.NumberOfIndexBlocks; i++ {
+		slotAddr, err := headers.GetIndexOffsetInNthBlock(header, initialOffset, i)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = file.ReadAt(buf, int64(slotAddr))
+		if err != nil {
+			return 0, err
+		}
+
+		kvAddr, _ := internal.Uint64FromByteArray(buf)
+		if kvAddr == 0 {
+			return slotAddr, nil
+		}
+	}
+
+	return 0, scdbErrs.NewErrCollisionSaturation(key)
+}
+
+// newRepairedIndices creates new empty search and ordered indices in the folder, under the names used by
+// a Compaction, for those of the indices at the given paths that exist.
+//
+// The new search index is made like the old one if its header can be read, or else like that of a new store.
+func newRepairedIndices(folder string, searchIndexFilePath string, orderedIndexFilePath string, header *headers.DbFileHeader, maxKeys uint64) (*inverted_index.InvertedIndex, *ordered_index.OrderedIndex, error) {
+	var searchIndex *inverted_index.InvertedIndex
+	var orderedIndex *ordered_index.OrderedIndex
+
+	hasSearchIndex, err := internal.PathExists(searchIndexFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if hasSearchIndex {
+		newSearchIndexFilePath := filepath.Join(folder, searchIndexCompactionFileName)
+		_ = os.Remove(newSearchIndexFilePath)
+
+		oldSearchIndex, err := inverted_index.NewReadOnlyInvertedIndex(searchIndexFilePath)
+		if err == nil {
+			// the search index grows in proportion to the database index, just like in a Compaction
+			searchIndexMaxKeys := oldSearchIndex.MaxKeys()
+			if maxKeys != header.MaxKeys {
+				searchIndexMaxKeys = uint64(math.Ceil(float64(searchIndexMaxKeys) * float64(maxKeys) / float64(header.MaxKeys)))
+			}
+			searchIndex, err = oldSearchIndex.NewEmptyCopy(newSearchIndexFilePath, searchIndexMaxKeys)
+			_ = oldSearchIndex.Close()
+		} else {
+			searchIndex, err = inverted_index.NewInvertedIndex(newSearchIndexFilePath, nil, &maxKeys, &header.RedundantBlocks)
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	hasOrderedIndex, err := internal.PathExists(orderedIndexFilePath)
+	if err != nil {
+		return searchIndex, nil, err
+	}
+
+	if hasOrderedIndex {
+		newOrderedIndexFilePath := filepath.Join(folder, orderedIndexCompactionFileName)
+		_ = os.Remove(newOrderedIndexFilePath)
+
+		orderedIndex, err = ordered_index.NewOrderedIndex(newOrderedIndexFilePath)
+		if err != nil {
+			return searchIndex, nil, err
+		}
+	}
+
+	return searchIndex, orderedIndex, nil
+}
+
+// indexRepairedFile adds the entries of the new database file at the given path to the new search and ordered
+// indices, if any, syncing them to disk
+func indexRepairedFile(filePath string, searchIndex *inverted_index.InvertedIndex, orderedIndex *ordered_index.OrderedIndex) error {
+	if searchIndex == nil && orderedIndex == nil {
+		return nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	header, fileSize, _, err := checkHeader(file, func(uint64, string) {})
+	if err != nil {
+		return err
+	}
+
+	err = walkIndex(file, header, func(_ uint64, kvAddr uint64) error {
+		kv, problem, err := readEntryToCheck(file, kvAddr, header, fileSize)
+		if err != nil {
+			return err
+		}
+		if problem != "" {
+			return scdbErrs.NewErrCorruptedEntry(kvAddr, nil)
+		}
+
+		return addToIndices(kv, kvAddr, searchIndex, orderedIndex)
+	})
+	if err != nil {
+		return err
+	}
+
+	if searchIndex != nil {
+		err = searchIndex.File.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	if orderedIndex != nil {
+		return orderedIndex.File.Sync()
+	}
+
+	return nil
+}
+
+// getKeyValueMinSize returns the size of a key-value entry of the given format, excluding its key and value
+func getKeyValueMinSize(version uint16) uint32 {
+	if version == values.LegacyFormat {
+		return values.LegacyKeyValueMinSizeInBytes
+	}
+	return values.KeyValueMinSizeInBytes
+}
@@ -0,0 +1,281 @@
+package buffers
+
+import (
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
+	"github.com/sopherapps/go-scdb/scdb/internal/ordered_index"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+// checkProblem is a problem reported by CheckFile
+type checkProblem struct {
+	offset  uint64
+	problem string
+}
+
+func TestCheckFile(t *testing.T) {
+	fileName := "testdb_check.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	foo := values.NewKeyValueEntry([]byte("foo"), []byte("bar"), 0)
+	hey := values.NewKeyValueEntry([]byte("hey"), []byte("English"), 0)
+	hi := values.NewKeyValueEntry([]byte("hi"), []byte("English"), 0)
+
+	t.Run("CheckFileReportsNoProblemsInAnIntactFile", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		expired := values.NewKeyValueEntry([]byte("old"), []byte("news"), 1)
+		pool, header := createPoolWithEntries(t, fileName, foo, hey, hi, expired)
+		_, err := pool.TryDeleteKvEntry(getKvAddress(t, pool, header, hi), hi.Key)
+		if err != nil {
+			t.Fatalf("error deleting key-value entry: %s", err)
+		}
+		_ = pool.Close()
+
+		problems, result := checkTestFile(t, fileName)
+		assert.Empty(t, problems)
+		assert.Equal(t, &CheckResult{LiveKeys: 2, DeletedKeys: 1, ExpiredKeys: 1, Entries: 4}, result)
+	})
+
+	t.Run("CheckFileReportsEntriesWhoseChecksumDoesNotMatch", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		pool, header := createPoolWithEntries(t, fileName, foo, hey)
+		heyAddr := getKvAddress(t, pool, header, hey)
+		_ = pool.Close()
+		writeToFile(t, fileName, int64(heyAddr+values.OffsetForKeyInKVArray), []byte("Hey"))
+
+		problems, result := checkTestFile(t, fileName)
+		assert.Equal(t, []uint64{headers.GetIndexOffset(header, hey.Key), heyAddr}, problemOffsets(problems))
+		assert.Equal(t, uint64(1), result.LiveKeys)
+	})
+
+	t.Run("CheckFileReportsDanglingIndexPointers", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		pool, header := createPoolWithEntries(t, fileName, foo)
+		fileSize := pool.FileSize
+		_ = pool.Close()
+		fooSlot := headers.GetIndexOffset(header, foo.Key)
+		otherSlot := fooSlot + header.NetBlockSize
+		writeToFile(t, fileName, int64(otherSlot), internal.Uint64ToByteArray(fileSize+10))
+
+		problems, _ := checkTestFile(t, fileName)
+		assert.Equal(t, []uint64{otherSlot}, problemOffsets(problems))
+	})
+
+	t.Run("CheckFileReportsKeysInSlotsTheirHashDoesNotLeadTo", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		pool, header := createPoolWithEntries(t, fileName, foo)
+		fooAddr := getKvAddress(t, pool, header, foo)
+		_ = pool.Close()
+		fooSlot := headers.GetIndexOffset(header, foo.Key)
+		otherSlot := headers.HeaderSizeInBytes + (fooSlot-headers.HeaderSizeInBytes+headers.IndexEntrySizeInBytes)%header.NetBlockSize
+		writeToFile(t, fileName, int64(fooSlot), internal.Uint64ToByteArray(0))
+		writeToFile(t, fileName, int64(otherSlot), internal.Uint64ToByteArray(fooAddr))
+
+		problems, _ := checkTestFile(t, fileName)
+		assert.Equal(t, []uint64{otherSlot}, problemOffsets(problems))
+	})
+
+	t.Run("CheckFileReportsEntriesThatOverflowTheFileOrWhoseSizeDoesNotFitTheirKeySize", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		pool, header := createPoolWithEntries(t, fileName, foo, hey)
+		fooAddr := getKvAddress(t, pool, header, foo)
+		heyAddr := getKvAddress(t, pool, header, hey)
+		fileSize := pool.FileSize
+		_ = pool.Close()
+
+		err := os.Truncate(fileName, int64(fileSize-3))
+		if err != nil {
+			t.Fatalf("error truncating file: %s", err)
+		}
+
+		problems, _ := checkTestFile(t, fileName)
+		assert.Equal(t, []uint64{headers.GetIndexOffset(header, hey.Key), heyAddr}, problemOffsets(problems))
+		assert.Contains(t, problems[1].problem, "overflows the file")
+
+		writeToFile(t, fileName, int64(fooAddr), internal.Uint32ToByteArray(foo.KeySize))
+		problems, _ = checkTestFile(t, fileName)
+		assert.Equal(t, []uint64{
+			headers.GetIndexOffset(header, foo.Key),
+			headers.GetIndexOffset(header, hey.Key),
+			fooAddr,
+		}, problemOffsets(problems))
+		assert.Contains(t, problems[2].problem, "is less than the minimum")
+	})
+
+	t.Run("CheckFileReportsAKeyCountThatDoesNotMatchTheIndex", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		pool, _ := createPoolWithEntries(t, fileName, foo, hey)
+		_ = pool.Close()
+		writeToFile(t, fileName, int64(headers.KeyCountOffset), internal.Uint64ToByteArray(7))
+
+		problems, _ := checkTestFile(t, fileName)
+		assert.Equal(t, []uint64{headers.KeyCountOffset}, problemOffsets(problems))
+	})
+
+	t.Run("CheckFileReportsAHeaderThatCantBeRead", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		pool, _ := createPoolWithEntries(t, fileName, foo)
+		_ = pool.Close()
+		err := os.Truncate(fileName, 50)
+		if err != nil {
+			t.Fatalf("error truncating file: %s", err)
+		}
+
+		problems, result := checkTestFile(t, fileName)
+		assert.Equal(t, []uint64{0}, problemOffsets(problems))
+		assert.Equal(t, &CheckResult{}, result)
+	})
+}
+
+func TestRepairFile(t *testing.T) {
+	fileName := "testdb_repair.scdb"
+	indexFileName := "testdb_repair.iscdb"
+	orderedIndexFileName := "testdb_repair.oscdb"
+	removeFiles := func() {
+		for _, filePath := range []string{fileName, indexFileName, orderedIndexFileName} {
+			_ = os.Remove(filePath)
+		}
+	}
+	defer removeFiles()
+
+	foo := values.NewKeyValueEntry([]byte("foo"), []byte("bar"), 0)
+	newFoo := values.NewKeyValueEntry([]byte("foo"), []byte("baz"), 0)
+	hey := values.NewKeyValueEntry([]byte("hey"), []byte("English"), 0)
+	hi := values.NewKeyValueEntry([]byte("hi"), []byte("English"), 0)
+
+	t.Run("RepairFileKeepsTheLatestIntactEntryOfEachLiveKey", func(t *testing.T) {
+		removeFiles()
+		pool, header := createPoolWithEntries(t, fileName, foo, hey, hi, newFoo)
+		_, err := pool.TryDeleteKvEntry(getKvAddress(t, pool, header, hi), hi.Key)
+		if err != nil {
+			t.Fatalf("error deleting key-value entry: %s", err)
+		}
+		newFooAddr := getKvAddress(t, pool, header, newFoo)
+		heySlot := headers.GetIndexOffset(header, hey.Key)
+		_ = pool.Close()
+
+		// the latest foo is corrupted, and hey is no longer in the index
+		writeToFile(t, fileName, int64(newFooAddr+values.OffsetForKeyInKVArray), []byte("Foo"))
+		writeToFile(t, fileName, int64(heySlot), internal.Uint64ToByteArray(0))
+
+		count, err := RepairFile(fileName, indexFileName, orderedIndexFileName)
+		if err != nil {
+			t.Fatalf("error repairing file: %s", err)
+		}
+		assert.Equal(t, uint64(2), count)
+
+		problems, result := checkTestFile(t, fileName)
+		assert.Empty(t, problems)
+		assert.Equal(t, &CheckResult{LiveKeys: 2, Entries: 2}, result)
+
+		pool, header = createPoolWithEntries(t, fileName)
+		defer func() {
+			_ = pool.Close()
+		}()
+		assert.Equal(t, uint64(2), pool.KeyCount())
+		for _, kv := range []*values.KeyValueEntry{foo, hey} {
+			got, err := pool.GetValue(getKvAddress(t, pool, header, kv), kv.Key)
+			if err != nil {
+				t.Fatalf("error getting value: %s", err)
+			}
+			assert.Equal(t, kv.Value, got.Value)
+		}
+		assert.Equal(t, uint64(0), getKvAddress(t, pool, header, hi))
+		assertFilesDontExist(t, indexFileName, orderedIndexFileName, compactionFileName)
+	})
+
+	t.Run("RepairFileRebuildsTheSearchAndOrderedIndices", func(t *testing.T) {
+		removeFiles()
+		pool, searchIndex, header := createPoolAndSearchIndex(t, fileName, indexFileName)
+		orderedIndex, err := ordered_index.NewOrderedIndex(orderedIndexFileName)
+		if err != nil {
+			t.Fatalf("error creating an ordered index: %s", err)
+		}
+		insertKeyValueEntry(t, pool, header, foo)
+		insertKeyValueEntry(t, pool, header, hey)
+		heyAddr := getKvAddress(t, pool, header, hey)
+		_ = pool.Close()
+		_ = searchIndex.Close()
+		_ = orderedIndex.Close()
+
+		writeToFile(t, fileName, int64(heyAddr+values.OffsetForKeyInKVArray), []byte("Hey"))
+		writeToFile(t, indexFileName, int64(headers.HeaderSizeInBytes), []byte("corrupted index"))
+
+		count, err := RepairFile(fileName, indexFileName, orderedIndexFileName)
+		if err != nil {
+			t.Fatalf("error repairing file: %s", err)
+		}
+		assert.Equal(t, uint64(1), count)
+
+		searchIndex, err = inverted_index.NewInvertedIndex(indexFileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error opening search index: %s", err)
+		}
+		defer func() {
+			_ = searchIndex.Close()
+		}()
+		orderedIndex, err = ordered_index.NewOrderedIndex(orderedIndexFileName)
+		if err != nil {
+			t.Fatalf("error opening ordered index: %s", err)
+		}
+		defer func() {
+			_ = orderedIndex.Close()
+		}()
+
+		addrs, err := searchIndex.Search([]byte("f"), 0, 0)
+		assert.Nil(t, err)
+		assert.Len(t, addrs, 1)
+		addrs, err = searchIndex.Search([]byte("h"), 0, 0)
+		assert.Nil(t, err)
+		assert.Empty(t, addrs)
+
+		keys := make([][]byte, 0)
+		err = orderedIndex.Walk(nil, nil, false, func(key []byte) (bool, error) {
+			keys = append(keys, key)
+			return true, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{foo.Key}, keys)
+		assertFilesDontExist(t, compactionFileName, searchIndexCompactionFileName, orderedIndexCompactionFileName)
+	})
+
+	t.Run("RepairFileOfAFileWhoseHeaderCantBeReadReturnsErrNotSupported", func(t *testing.T) {
+		removeFiles()
+		pool, _ := createPoolWithEntries(t, fileName, foo)
+		_ = pool.Close()
+		writeToFile(t, fileName, 16, internal.Uint32ToByteArray(0))
+
+		_, err := RepairFile(fileName, indexFileName, orderedIndexFileName)
+		assert.Equal(t, errors.NewErrNotSupported("repair of a database file whose header is corrupted"), err)
+	})
+}
+
+// checkTestFile checks the database file at the given path, returning the problems reported
+func checkTestFile(t *testing.T, filePath string) ([]checkProblem, *CheckResult) {
+	problems := make([]checkProblem, 0)
+	result, err := CheckFile(filePath, func(offset uint64, problem string) {
+		problems = append(problems, checkProblem{offset, problem})
+	})
+	if err != nil {
+		t.Fatalf("error checking file: %s", err)
+	}
+
+	return problems, result
+}
+
+// problemOffsets returns the offsets of the given problems
+func problemOffsets(problems []checkProblem) []uint64 {
+	offsets := make([]uint64, 0, len(problems))
+	for _, p := range problems {
+		offsets = append(offsets, p.offset)
+	}
+
+	return offsets
+}
@@ -0,0 +1,521 @@
+package buffers
+
+import (
+	"bytes"
+	"errors"
+	scdbErrs "github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
+	"github.com/sopherapps/go-scdb/scdb/internal/ordered_index"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// compactionFileName is the name of the file into which the database file is compacted
+const compactionFileName string = "tmp__compact.scdb"
+
+// searchIndexCompactionFileName is the name of the file in which the search index is rebuilt during compaction
+const searchIndexCompactionFileName string = "tmp__compact.iscdb"
+
+// orderedIndexCompactionFileName is the name of the file in which the ordered index is rebuilt during compaction
+const orderedIndexCompactionFileName string = "tmp__compact.oscdb"
+
+// Compaction is a compaction of the file of a BufferPool that is done in steps, so that other reads and writes
+// can go on in between the steps.
+//
+// Each step copies the entries of one index block that are neither deleted nor expired into a new file,
+// and adds them to a new search index and a new ordered index, if any.
+// The index slots written to in the pool while the compaction is running must be reported to it via MarkDirty
+// so that their entries are copied afresh when it is finished.
+type Compaction struct {
+	pool            *BufferPool
+	header          *headers.DbFileHeader
+	newHeader       *headers.DbFileHeader
+	newFile         *os.File
+	newFilePath     string
+	newFileSize     uint64
+	searchIndex     *inverted_index.InvertedIndex
+	newSearchIndex  *inverted_index.InvertedIndex
+	orderedIndex    *ordered_index.OrderedIndex
+	newOrderedIndex *ordered_index.OrderedIndex
+	nextBlock       uint64
+	dirtySlots      map[uint64]struct{}
+	isSwapped       bool
+	// deadBytes is the total size of the deleted and expired entries copied when catching up,
+	// and of the copied entries that catching up replaced
+	deadBytes    uint64
+	expiredAddrs map[uint64]struct{}
+	// keyCount is the number of live entries in the new file
+	keyCount uint64
+	// hasExpiringEntries is true if any of the live entries copied has an expiry
+	hasExpiringEntries bool
+}
+
+// NewCompaction starts a compaction of the pool's file into a new file whose index holds `maxKeys` keys.
+// If `searchIndex` is not nil, it is rebuilt in a new file, growing in proportion to the database index.
+// If `orderedIndex` is not nil, it is rebuilt in a new file too.
+func (bp *BufferPool) NewCompaction(maxKeys uint64, searchIndex *inverted_index.InvertedIndex, orderedIndex *ordered_index.OrderedIndex) (*Compaction, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	header, err := headers.ExtractDbFileHeaderFromFile(bp.File)
+	if err != nil {
+		return nil, err
+	}
+
+	folder := filepath.Dir(bp.FilePath)
+	newFilePath := filepath.Join(folder, compactionFileName)
+	newFile, err := os.OpenFile(newFilePath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add headers to new file, in the current format, making room for the whole index
+	newHeader := headers.NewDbFileHeader(&maxKeys, &header.RedundantBlocks, &header.BlockSize)
+	newHeader.Generation = header.Generation
+	newFileSize, err := headers.InitializeFile(newFile, newHeader)
+	if err != nil {
+		_ = newFile.Close()
+		return nil, err
+	}
+
+	c := &Compaction{
+		pool:         bp,
+		header:       header,
+		newHeader:    newHeader,
+		newFile:      newFile,
+		newFilePath:  newFilePath,
+		newFileSize:  uint64(newFileSize),
+		searchIndex:  searchIndex,
+		orderedIndex: orderedIndex,
+		dirtySlots:   make(map[uint64]struct{}),
+		expiredAddrs: make(map[uint64]struct{}),
+	}
+
+	if searchIndex != nil {
+		// the search index grows in proportion to the database index
+		searchIndexMaxKeys := searchIndex.MaxKeys()
+		if maxKeys != header.MaxKeys && header.MaxKeys > 0 {
+			searchIndexMaxKeys = uint64(math.Ceil(float64(searchIndexMaxKeys) * float64(maxKeys) / float64(header.MaxKeys)))
+		}
+
+		searchIndexFilePath := filepath.Join(folder, searchIndexCompactionFileName)
+		c.newSearchIndex, err = searchIndex.NewEmptyCopy(searchIndexFilePath, searchIndexMaxKeys)
+		if err != nil {
+			_ = c.Abort()
+			return nil, err
+		}
+	}
+
+	if orderedIndex != nil {
+		orderedIndexFilePath := filepath.Join(folder, orderedIndexCompactionFileName)
+		c.newOrderedIndex, err = orderedIndex.NewEmptyCopy(orderedIndexFilePath)
+		if err != nil {
+			_ = c.Abort()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Step copies the entries of the next index block into the new file.
+// It returns true if there are no more index blocks to copy.
+//
+// No writes must happen to the pool while a step runs, though reads can.
+func (c *Compaction) Step() (bool, error) {
+	if c.isDone() {
+		return true, nil
+	}
+
+	blockSize := c.header.NetBlockSize
+	indexBlock, err := c.pool.readIndexBlock(int64(c.nextBlock), int64(blockSize))
+	if err != nil {
+		return false, err
+	}
+
+	// write index block into new file; the entries' addresses in it are then replaced one by one
+	idxOffset := headers.HeaderSizeInBytes + (c.nextBlock * blockSize)
+	_, err = c.newFile.WriteAt(indexBlock, int64(idxOffset))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	zero := make([]byte, headers.IndexEntrySizeInBytes)
+	idxBlockLength := uint64(len(indexBlock))
+	for lwr := uint64(0); lwr < idxBlockLength; lwr += headers.IndexEntrySizeInBytes {
+		upr := lwr + headers.IndexEntrySizeInBytes
+		// empty slots are already copied along with the index block
+		if bytes.Equal(indexBlock[lwr:upr], zero) {
+			continue
+		}
+
+		err = c.copyEntry(idxOffset+lwr, indexBlock[lwr:upr], true)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	c.nextBlock++
+	return c.isDone(), nil
+}
+
+// MarkDirty reports that the index slot at the given address was written to after the compaction started.
+// Its entry is copied afresh when the compaction is finished.
+func (c *Compaction) MarkDirty(indexAddr uint64) {
+	c.dirtySlots[indexAddr] = struct{}{}
+}
+
+// Finish runs any remaining steps, copies the entries of the index slots marked dirty afresh,
+// and then replaces the pool's file, and the search and ordered indices, with the compacted ones.
+//
+// No other reads or writes must happen while it runs.
+func (c *Compaction) Finish() error {
+	for !c.isDone() {
+		_, err := c.Step()
+		if err != nil {
+			return err
+		}
+	}
+
+	// catch up with the writes made while the compaction was running
+	zero := make([]byte, headers.IndexEntrySizeInBytes)
+	for indexAddr := range c.dirtySlots {
+		// any entry copied into this slot by a step was live, and is about to be replaced, leaving it dead
+		copiedAddrBytes := make([]byte, headers.IndexEntrySizeInBytes)
+		_, err := c.newFile.ReadAt(copiedAddrBytes, int64(indexAddr))
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(copiedAddrBytes, zero) {
+			copiedKvByteArray, err := getKvByteArray(c.newFile, copiedAddrBytes)
+			if err != nil {
+				return err
+			}
+
+			c.keyCount--
+			c.deadBytes += uint64(len(copiedKvByteArray))
+		}
+
+		addrBytes := make([]byte, headers.IndexEntrySizeInBytes)
+		_, err = c.pool.File.ReadAt(addrBytes, int64(indexAddr))
+		if err != nil {
+			return err
+		}
+
+		// deleted and expired entries are copied too so that they replace any older live version already copied
+		err = c.copyEntry(indexAddr, addrBytes, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.swap()
+}
+
+// Abort stops the compaction, removing the new files it created.
+// It does nothing if the compaction has already replaced the pool's file.
+func (c *Compaction) Abort() error {
+	if c.isSwapped {
+		return nil
+	}
+
+	// the new index files are removed first since, without the new database file,
+	// RecoverCompaction would take them for a swap cut short
+	if c.newOrderedIndex != nil {
+		err := c.newOrderedIndex.Close()
+		if err != nil && !errors.Is(err, os.ErrClosed) {
+			return err
+		}
+
+		err = os.Remove(c.newOrderedIndex.FilePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if c.newSearchIndex != nil {
+		err := c.newSearchIndex.Close()
+		if err != nil && !errors.Is(err, os.ErrClosed) {
+			return err
+		}
+
+		err = os.Remove(c.newSearchIndex.FilePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	err := c.newFile.Close()
+	if err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+
+	err = os.Remove(c.newFilePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// RecoverCompaction cleans up after any compaction of the database file at `filePath` that was cut short by a crash.
+//
+// If the new database file is still there, the crash happened before it replaced the old one. It is thus removed,
+// along with the new search and ordered index files, if any. Otherwise, if any new index file is there, the crash
+// happened after the database file was replaced, so the new search index file is moved to `searchIndexFilePath`
+// and the new ordered index file to `orderedIndexFilePath` to finish the swap.
+func RecoverCompaction(filePath string, searchIndexFilePath string, orderedIndexFilePath string) error {
+	folder := filepath.Dir(filePath)
+	newFilePath := filepath.Join(folder, compactionFileName)
+	// the new index files, mapped to the paths they are moved to
+	newIndexFilePaths := [][2]string{
+		{filepath.Join(folder, searchIndexCompactionFileName), searchIndexFilePath},
+		{filepath.Join(folder, orderedIndexCompactionFileName), orderedIndexFilePath},
+	}
+
+	hasNewFile, err := internal.PathExists(newFilePath)
+	if err != nil {
+		return err
+	}
+
+	isChanged := hasNewFile
+	for _, paths := range newIndexFilePaths {
+		hasNewIndex, err := internal.PathExists(paths[0])
+		if err != nil {
+			return err
+		}
+
+		if !hasNewIndex {
+			continue
+		}
+		isChanged = true
+
+		// the index files go first, just like in Compaction.Abort
+		if hasNewFile {
+			err = os.Remove(paths[0])
+		} else {
+			err = os.Rename(paths[0], paths[1])
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if !isChanged {
+		return nil
+	}
+
+	if hasNewFile {
+		err = os.Remove(newFilePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return internal.SyncDir(folder)
+}
+
+// IsCompactionInterrupted returns true if a compaction of the database file in the given folder was cut short
+// by a crash, leaving files behind that RecoverCompaction has to clean up
+func IsCompactionInterrupted(folder string) (bool, error) {
+	for _, name := range []string{compactionFileName, searchIndexCompactionFileName, orderedIndexCompactionFileName} {
+		exists, err := internal.PathExists(filepath.Join(folder, name))
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+
+	return false, nil
+}
+
+// HasExpiringEntries returns true if any of the live entries copied so far has an expiry
+func (c *Compaction) HasExpiringEntries() bool {
+	return c.hasExpiringEntries
+}
+
+// isDone returns true if all the index blocks have been copied
+func (c *Compaction) isDone() bool {
+	return c.nextBlock >= c.header.NumberOfIndexBlocks
+}
+
+// copyEntry copies the key-value entry whose address in the pool's file is `addrBytes` to the end of the new file,
+// and points the index slot at `indexAddr` in the new file to it.
+//
+// The position of a key in the index depends only on the number of items per index block, which does not change,
+// and on the index block it landed in. Thus every key keeps its index slot in the new file.
+//
+// If `isLiveOnly` is true, deleted and expired entries are not copied and their index slot is emptied.
+func (c *Compaction) copyEntry(indexAddr uint64, addrBytes []byte, isLiveOnly bool) error {
+	zero := make([]byte, headers.IndexEntrySizeInBytes)
+	if bytes.Equal(addrBytes, zero) {
+		_, err := c.newFile.WriteAt(zero, int64(indexAddr))
+		return err
+	}
+
+	kvByteArray, err := getKvByteArray(c.pool.File, addrBytes)
+	if err != nil {
+		return err
+	}
+
+	kvAddr, _ := internal.Uint64FromByteArray(addrBytes)
+	kv, err := values.ExtractKeyValueEntryFromByteArray(kvByteArray, 0, c.pool.formatVersion)
+	if err != nil || !kv.HasValidChecksum() {
+		return scdbErrs.NewErrCorruptedEntry(kvAddr, nil)
+	}
+
+	if isLiveOnly && (values.IsExpired(kv) || kv.IsDeleted) {
+		// if expired or deleted, update index to zero
+		_, err = c.newFile.WriteAt(zero, int64(indexAddr))
+		return err
+	}
+
+	if c.pool.formatVersion != values.CurrentFormat {
+		newKv := values.NewKeyValueEntry(kv.Key, kv.Value, kv.Expiry)
+		newKv.IsDeleted = kv.IsDeleted
+		kvByteArray = newKv.AsBytes()
+	}
+
+	// insert key value at the bottom of the new file
+	newKvAddr := c.newFileSize
+	_, err = c.newFile.WriteAt(kvByteArray, int64(newKvAddr))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	// update index to have the index of the newly added key-value entry
+	_, err = c.newFile.WriteAt(internal.Uint64ToByteArray(newKvAddr), int64(indexAddr))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	c.newFileSize += uint64(len(kvByteArray))
+
+	switch {
+	case kv.IsDeleted:
+		c.deadBytes += uint64(len(kvByteArray))
+	case values.IsExpired(kv):
+		c.deadBytes += uint64(len(kvByteArray))
+		c.expiredAddrs[newKvAddr] = struct{}{}
+	default:
+		c.keyCount++
+		if kv.Expiry != 0 {
+			c.hasExpiringEntries = true
+		}
+	}
+
+	if c.newOrderedIndex != nil {
+		// deleted and expired entries are only copied when catching up, to replace older live versions
+		if kv.IsDeleted || values.IsExpired(kv) {
+			err = c.newOrderedIndex.Remove(kv.Key)
+		} else {
+			err = c.newOrderedIndex.Add(kv.Key)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.newSearchIndex != nil {
+		return c.newSearchIndex.Add(kv.Key, newKvAddr, kv.Expiry)
+	}
+
+	return nil
+}
+
+// swap replaces the pool's file, and the search and ordered indices, with the compacted ones.
+//
+// The new files are synced to disk first. The new database file is then renamed over the old one,
+// which is atomic, so that a crash leaves either the old or the new file in place. The new search and ordered
+// indices are moved into place only after that, so that RecoverCompaction can tell how far the swap got.
+func (c *Compaction) swap() error {
+	_, err := c.newFile.WriteAt(internal.Uint64ToByteArray(c.keyCount), int64(headers.KeyCountOffset))
+	if err != nil {
+		return err
+	}
+
+	err = c.newFile.Sync()
+	if err != nil {
+		return err
+	}
+
+	if c.newSearchIndex != nil {
+		err = c.newSearchIndex.File.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.newOrderedIndex != nil {
+		err = c.newOrderedIndex.File.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	bp := c.pool
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	folder := filepath.Dir(bp.FilePath)
+	err = os.Rename(c.newFilePath, bp.FilePath)
+	if err != nil {
+		return err
+	}
+	c.isSwapped = true
+
+	err = internal.SyncDir(folder)
+	if err != nil {
+		return err
+	}
+
+	err = bp.File.Close()
+	if err != nil {
+		return err
+	}
+
+	// clean up the buffers and update metadata
+	// the snapshots keep the old file, which is no longer written to
+	bp.snapshots = make(map[*Snapshot]struct{})
+	bp.kvBuffers = bp.kvBuffers[:0]
+	bp.File = c.newFile
+	bp.FileSize = c.newFileSize
+	bp.formatVersion = c.newHeader.FormatVersion
+	bp.deadBytes = c.deadBytes
+	bp.expiredAddrs = c.expiredAddrs
+	bp.keyCount = c.keyCount
+	bp.maxKeys = c.newHeader.MaxKeys
+	bp.keyValuesStartPoint = c.newHeader.KeyValuesStartPoint
+
+	totalCap := bp.kvCapacity + bp.indexCapacity
+	bp.indexCapacity = getIndexCapacity(c.newHeader.NumberOfIndexBlocks, totalCap)
+	bp.kvCapacity = totalCap - bp.indexCapacity
+	bp.indexBuffers = make(map[uint64]*Buffer, bp.indexCapacity)
+
+	if c.searchIndex != nil {
+		err = c.searchIndex.Replace(c.newSearchIndex)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.orderedIndex != nil {
+		err = c.orderedIndex.Replace(c.newOrderedIndex)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.searchIndex != nil || c.orderedIndex != nil {
+		return internal.SyncDir(folder)
+	}
+
+	return nil
+}
@@ -0,0 +1,355 @@
+package buffers
+
+import (
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
+	"github.com/sopherapps/go-scdb/scdb/internal/ordered_index"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestCompaction(t *testing.T) {
+	fileName := "testdb_pool.scdb"
+	indexFileName := "testdb_pool.iscdb"
+	orderedIndexFileName := "testdb_pool.oscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+		_ = os.Remove(indexFileName)
+		_ = os.Remove(orderedIndexFileName)
+	}()
+
+	t.Run("CompactionInStepsCatchesUpWithTheWritesMarkedDirty", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		_ = os.Remove(indexFileName)
+		_ = os.Remove(orderedIndexFileName)
+
+		kept := values.NewKeyValueEntry([]byte("kept"), []byte("bar"), 0)
+		deleted := values.NewKeyValueEntry([]byte("deleted"), []byte("bok"), 0)
+		added := values.NewKeyValueEntry([]byte("added"), []byte("foo"), 0)
+
+		pool, searchIndex, header := createPoolAndSearchIndex(t, fileName, indexFileName)
+		orderedIndex, err := ordered_index.NewOrderedIndex(orderedIndexFileName)
+		if err != nil {
+			t.Fatalf("error creating an ordered index: %s", err)
+		}
+		defer func() {
+			_ = pool.Close()
+			_ = searchIndex.Close()
+			_ = orderedIndex.Close()
+		}()
+		insertKeyValueEntry(t, pool, header, kept)
+		insertKeyValueEntry(t, pool, header, deleted)
+
+		c, err := pool.NewCompaction(header.MaxKeys, searchIndex, orderedIndex)
+		if err != nil {
+			t.Fatalf("error starting compaction: %s", err)
+		}
+
+		isDone, err := c.Step()
+		if err != nil {
+			t.Fatalf("error running compaction step: %s", err)
+		}
+		assert.False(t, isDone)
+
+		// writes in between the steps
+		insertKeyValueEntry(t, pool, header, added)
+		c.MarkDirty(headers.GetIndexOffset(header, added.Key))
+		_, err = pool.TryDeleteKvEntry(getKvAddress(t, pool, header, deleted), deleted.Key)
+		if err != nil {
+			t.Fatalf("error deleting key-value entry: %s", err)
+		}
+		c.MarkDirty(headers.GetIndexOffset(header, deleted.Key))
+
+		err = c.Finish()
+		if err != nil {
+			t.Fatalf("error finishing compaction: %s", err)
+		}
+
+		for _, kv := range []*values.KeyValueEntry{kept, added} {
+			got, err := pool.GetValue(getKvAddress(t, pool, header, kv), kv.Key)
+			if err != nil {
+				t.Fatalf("error getting value: %s", err)
+			}
+			assert.Equal(t, kv.Value, got.Value)
+		}
+
+		got, err := pool.GetValue(getKvAddress(t, pool, header, deleted), deleted.Key)
+		assert.Nil(t, err)
+		assert.Nil(t, got)
+		assert.Equal(t, uint64(2), pool.KeyCount())
+
+		addrs, err := searchIndex.Search([]byte("a"), 0, 0)
+		if err != nil {
+			t.Fatalf("error searching index: %s", err)
+		}
+		assert.Equal(t, []uint64{getKvAddress(t, pool, header, added)}, addrs)
+
+		keys := make([][]byte, 0)
+		err = orderedIndex.Walk(nil, nil, false, func(key []byte) (bool, error) {
+			keys = append(keys, key)
+			return true, nil
+		})
+		if err != nil {
+			t.Fatalf("error walking ordered index: %s", err)
+		}
+		assert.Equal(t, [][]byte{added.Key, kept.Key}, keys)
+
+		assertFilesDontExist(t, compactionFileName, searchIndexCompactionFileName, orderedIndexCompactionFileName)
+	})
+
+	t.Run("CompactionCountsTheCopiedEntriesReplacedWhenCatchingUpAsDead", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		_ = os.Remove(indexFileName)
+
+		kept := values.NewKeyValueEntry([]byte("kept"), []byte("bar"), 0)
+		old := values.NewKeyValueEntry([]byte("foo"), []byte("old"), 0)
+		updated := values.NewKeyValueEntry([]byte("foo"), []byte("new value"), 0)
+
+		pool, searchIndex, header := createPoolAndSearchIndex(t, fileName, indexFileName)
+		defer func() {
+			_ = pool.Close()
+			_ = searchIndex.Close()
+		}()
+		insertKeyValueEntry(t, pool, header, kept)
+		insertKeyValueEntry(t, pool, header, old)
+
+		c, err := pool.NewCompaction(header.MaxKeys, nil, nil)
+		if err != nil {
+			t.Fatalf("error starting compaction: %s", err)
+		}
+
+		_, err = c.Step()
+		if err != nil {
+			t.Fatalf("error running compaction step: %s", err)
+		}
+
+		// overwrite a key that the step has already copied
+		insertKeyValueEntry(t, pool, header, updated)
+		c.MarkDirty(headers.GetIndexOffset(header, updated.Key))
+
+		err = c.Finish()
+		if err != nil {
+			t.Fatalf("error finishing compaction: %s", err)
+		}
+
+		got, err := pool.GetValue(getKvAddress(t, pool, header, updated), updated.Key)
+		if err != nil {
+			t.Fatalf("error getting value: %s", err)
+		}
+		assert.Equal(t, updated.Value, got.Value)
+		assert.Equal(t, uint64(2), pool.KeyCount())
+		assert.Equal(t, uint64(old.Size), pool.DeadBytes())
+	})
+
+	t.Run("AbortRemovesTheNewFilesAndLeavesThePoolAsIs", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		_ = os.Remove(indexFileName)
+
+		kv := values.NewKeyValueEntry([]byte("kv"), []byte("bar"), 0)
+
+		pool, searchIndex, header := createPoolAndSearchIndex(t, fileName, indexFileName)
+		defer func() {
+			_ = pool.Close()
+			_ = searchIndex.Close()
+		}()
+		insertKeyValueEntry(t, pool, header, kv)
+		initialFileSize := pool.FileSize
+
+		c, err := pool.NewCompaction(header.MaxKeys, searchIndex, nil)
+		if err != nil {
+			t.Fatalf("error starting compaction: %s", err)
+		}
+
+		_, err = c.Step()
+		if err != nil {
+			t.Fatalf("error running compaction step: %s", err)
+		}
+
+		err = c.Abort()
+		if err != nil {
+			t.Fatalf("error aborting compaction: %s", err)
+		}
+
+		for _, filePath := range []string{compactionFileName, searchIndexCompactionFileName} {
+			exists, err := internal.PathExists(filePath)
+			assert.Nil(t, err)
+			assert.False(t, exists)
+		}
+
+		assert.Equal(t, initialFileSize, pool.FileSize)
+		got, err := pool.GetValue(getKvAddress(t, pool, header, kv), kv.Key)
+		if err != nil {
+			t.Fatalf("error getting value: %s", err)
+		}
+		assert.Equal(t, kv, got)
+	})
+}
+
+func TestRecoverCompaction(t *testing.T) {
+	fileName := "testdb_pool.scdb"
+	indexFileName := "testdb_pool.iscdb"
+	orderedIndexFileName := "testdb_pool.oscdb"
+	defer func() {
+		for _, filePath := range []string{
+			fileName,
+			indexFileName,
+			orderedIndexFileName,
+			compactionFileName,
+			searchIndexCompactionFileName,
+			orderedIndexCompactionFileName,
+		} {
+			_ = os.Remove(filePath)
+		}
+	}()
+
+	t.Run("RecoverCompactionRemovesTheNewFilesIfTheDatabaseFileWasNotReplaced", func(t *testing.T) {
+		writeTestFiles(t, map[string]string{
+			fileName:                       "old",
+			indexFileName:                  "old index",
+			orderedIndexFileName:           "old ordered index",
+			compactionFileName:             "new",
+			searchIndexCompactionFileName:  "new index",
+			orderedIndexCompactionFileName: "new ordered index",
+		})
+
+		err := RecoverCompaction(fileName, indexFileName, orderedIndexFileName)
+		if err != nil {
+			t.Fatalf("error recovering compaction: %s", err)
+		}
+
+		assertFileContents(t, map[string]string{
+			fileName:             "old",
+			indexFileName:        "old index",
+			orderedIndexFileName: "old ordered index",
+		})
+		assertFilesDontExist(t, compactionFileName, searchIndexCompactionFileName, orderedIndexCompactionFileName)
+	})
+
+	t.Run("RecoverCompactionMovesTheNewSearchIndexIntoPlaceIfTheDatabaseFileWasReplaced", func(t *testing.T) {
+		writeTestFiles(t, map[string]string{
+			fileName:                      "new",
+			indexFileName:                 "old index",
+			searchIndexCompactionFileName: "new index",
+		})
+
+		err := RecoverCompaction(fileName, indexFileName, orderedIndexFileName)
+		if err != nil {
+			t.Fatalf("error recovering compaction: %s", err)
+		}
+
+		assertFileContents(t, map[string]string{fileName: "new", indexFileName: "new index"})
+		assertFilesDontExist(t, compactionFileName, searchIndexCompactionFileName)
+	})
+
+	t.Run("RecoverCompactionMovesTheNewOrderedIndexIntoPlaceIfTheDatabaseFileWasReplaced", func(t *testing.T) {
+		_ = os.Remove(indexFileName)
+		writeTestFiles(t, map[string]string{
+			fileName:                       "new",
+			orderedIndexFileName:           "old ordered index",
+			orderedIndexCompactionFileName: "new ordered index",
+		})
+
+		err := RecoverCompaction(fileName, indexFileName, orderedIndexFileName)
+		if err != nil {
+			t.Fatalf("error recovering compaction: %s", err)
+		}
+
+		assertFileContents(t, map[string]string{fileName: "new", orderedIndexFileName: "new ordered index"})
+		assertFilesDontExist(t, indexFileName, compactionFileName, orderedIndexCompactionFileName)
+	})
+
+	t.Run("RecoverCompactionDoesNothingIfNoCompactionWasCutShort", func(t *testing.T) {
+		writeTestFiles(t, map[string]string{fileName: "old", indexFileName: "old index"})
+
+		err := RecoverCompaction(fileName, indexFileName, orderedIndexFileName)
+		if err != nil {
+			t.Fatalf("error recovering compaction: %s", err)
+		}
+
+		assertFileContents(t, map[string]string{fileName: "old", indexFileName: "old index"})
+	})
+}
+
+func TestIsCompactionInterrupted(t *testing.T) {
+	defer func() {
+		for _, filePath := range []string{compactionFileName, searchIndexCompactionFileName, orderedIndexCompactionFileName} {
+			_ = os.Remove(filePath)
+		}
+	}()
+
+	isInterrupted, err := IsCompactionInterrupted(".")
+	if err != nil {
+		t.Fatalf("error checking for interrupted compaction: %s", err)
+	}
+	assert.False(t, isInterrupted)
+
+	for _, filePath := range []string{compactionFileName, searchIndexCompactionFileName, orderedIndexCompactionFileName} {
+		writeTestFiles(t, map[string]string{filePath: "new"})
+
+		isInterrupted, err = IsCompactionInterrupted(".")
+		if err != nil {
+			t.Fatalf("error checking for interrupted compaction: %s", err)
+		}
+		assert.True(t, isInterrupted, filePath)
+
+		_ = os.Remove(filePath)
+	}
+}
+
+// createPoolAndSearchIndex creates a buffer pool with a small index, and a search index, returning them
+// together with the header of the pool's file
+func createPoolAndSearchIndex(t *testing.T, fileName string, indexFileName string) (*BufferPool, *inverted_index.InvertedIndex, *headers.DbFileHeader) {
+	maxKeys := uint64(10)
+	pool, err := NewBufferPool(nil, fileName, &maxKeys, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating new buffer pool: %s", err)
+	}
+
+	searchIndex, err := inverted_index.NewInvertedIndex(indexFileName, nil, &maxKeys, nil)
+	if err != nil {
+		t.Fatalf("error creating a search index: %s", err)
+	}
+
+	header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+	if err != nil {
+		t.Fatalf("error extracting header from file: %s", err)
+	}
+
+	return pool, searchIndex, header
+}
+
+// writeTestFiles writes the given contents to the given files, removing any compaction files first
+func writeTestFiles(t *testing.T, contents map[string]string) {
+	_ = os.Remove(compactionFileName)
+	_ = os.Remove(searchIndexCompactionFileName)
+
+	for filePath, content := range contents {
+		err := os.WriteFile(filePath, []byte(content), 0666)
+		if err != nil {
+			t.Fatalf("error writing file: %s", err)
+		}
+	}
+}
+
+// assertFileContents asserts that the given files have the given contents
+func assertFileContents(t *testing.T, contents map[string]string) {
+	for filePath, content := range contents {
+		got, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("error reading file: %s", err)
+		}
+		assert.Equal(t, content, string(got))
+	}
+}
+
+// assertFilesDontExist asserts that the given files do not exist
+func assertFilesDontExist(t *testing.T, filePaths ...string) {
+	for _, filePath := range filePaths {
+		exists, err := internal.PathExists(filePath)
+		assert.Nil(t, err)
+		assert.False(t, exists)
+	}
+}
@@ -4,14 +4,17 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	scdbErrs "github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
 	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
 	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
 	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
+	"github.com/sopherapps/go-scdb/scdb/internal/ordered_index"
 	"io"
 	"math"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
 const DefaultPoolCapacity uint64 = 5
@@ -34,6 +37,9 @@ func (kv KeyValuePair) String() string {
 // In order to avoid corruption, we always update the last kv buffer that has a given address
 // since buffers are in FIFO queue. When retrieving a value, we also use the last buffer
 // that has a given address
+//
+// The pool is safe for concurrent use. Many readers can get values and read the index at the same time,
+// sharing the cache of buffers, as long as no writes happen at that time.
 type BufferPool struct {
 	kvCapacity          uint64
 	indexCapacity       uint64
@@ -41,16 +47,45 @@ type BufferPool struct {
 	keyValuesStartPoint uint64
 	maxKeys             uint64
 	redundantBlocks     uint16
+	formatVersion       uint16
 	kvBuffers           []*Buffer // this will act as a FIFO
 	indexBuffers        map[uint64]*Buffer
 	File                *os.File
 	FilePath            string
 	FileSize            uint64
+	// deadBytes is the total size of the entries in the file that are deleted, overwritten or known to be expired
+	deadBytes uint64
+	// expiredAddrs are the addresses of the entries whose expiry has been counted in deadBytes
+	expiredAddrs map[uint64]struct{}
+	// keyCount is the number of keys in the file whose entries are neither deleted nor known to be expired
+	keyCount uint64
+	// generation is the generation in the file's header. See headers.DbFileHeader.Generation.
+	generation uint64
+	// cacheStats counts the lookups in kvBuffers and indexBuffers
+	cacheStats CacheStats
+	// mu guards kvBuffers, indexBuffers, deadBytes, expiredAddrs, keyCount and cacheStats, which even reads update
+	mu sync.Mutex
+	// isReadOnly is true if the file was opened for reading only
+	isReadOnly bool
+	// snapshots are the open snapshots of the file, into which bytes are saved before being overwritten
+	snapshots map[*Snapshot]struct{}
 }
 
 // NewBufferPool creates a new BufferPool with the given `capacity` number of Buffers and
 // for the file at the given path (creating it if necessary)
 func NewBufferPool(capacity *uint64, filePath string, maxKeys *uint64, redundantBlocks *uint16, bufferSize *uint32) (*BufferPool, error) {
+	return newBufferPool(capacity, filePath, maxKeys, redundantBlocks, bufferSize, false)
+}
+
+// NewReadOnlyBufferPool creates a new BufferPool with the given `capacity` number of Buffers
+// for the existing file at the given path, opening it for reading only. The file is never written to, even on Close.
+func NewReadOnlyBufferPool(capacity *uint64, filePath string) (*BufferPool, error) {
+	return newBufferPool(capacity, filePath, nil, nil, nil, true)
+}
+
+// newBufferPool creates a new BufferPool for the file at the given path, which is created if necessary
+// unless `isReadOnly` is true
+func newBufferPool(capacity *uint64, filePath string, maxKeys *uint64, redundantBlocks *uint16, bufferSize *uint32, isReadOnly bool) (*BufferPool, error) {
 	var bufSize uint32
 	if bufferSize != nil {
 		bufSize = *bufferSize
@@ -71,7 +106,9 @@ func NewBufferPool(capacity *uint64, filePath string, maxKeys *uint64, redundant
 	}
 
 	fileOpenFlag := os.O_RDWR
-	if !dbFileExists {
+	if isReadOnly {
+		fileOpenFlag = os.O_RDONLY
+	} else if !dbFileExists {
 		fileOpenFlag = fileOpenFlag | os.O_CREATE
 	}
 
@@ -109,17 +146,51 @@ func NewBufferPool(capacity *uint64, filePath string, maxKeys *uint64, redundant
 		keyValuesStartPoint: header.KeyValuesStartPoint,
 		maxKeys:             header.MaxKeys,
 		redundantBlocks:     header.RedundantBlocks,
+		formatVersion:       header.FormatVersion,
 		kvBuffers:           make([]*Buffer, 0, kvCap),
 		indexBuffers:        make(map[uint64]*Buffer, indexCap),
 		File:                file,
 		FilePath:            filePath,
 		FileSize:            fileSize,
+		expiredAddrs:        make(map[uint64]struct{}),
+		keyCount:            header.KeyCount,
+		generation:          header.Generation,
+		isReadOnly:          isReadOnly,
+		snapshots:           make(map[*Snapshot]struct{}),
+	}
+
+	// files written before the number of keys was kept in the header have a count of 0
+	if header.KeyCount == 0 && fileSize > header.KeyValuesStartPoint {
+		pool.keyCount, err = pool.countLiveKeys(header)
+		if err != nil {
+			return nil, err
+		}
 	}
+
 	return pool, nil
 }
 
 // Close closes the buffer pool, freeing up any resources
 func (bp *BufferPool) Close() error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for sn := range bp.snapshots {
+		err := sn.close()
+		if err != nil {
+			return err
+		}
+	}
+	bp.snapshots = make(map[*Snapshot]struct{})
+
+	// expired keys found by reads since the last write are yet to be counted in the header
+	if !bp.isReadOnly {
+		err := bp.writeKeyCount()
+		if err != nil {
+			return err
+		}
+	}
+
 	bp.indexBuffers = nil
 	bp.kvBuffers = nil
 	return bp.File.Close()
@@ -128,6 +199,9 @@ func (bp *BufferPool) Close() error {
 // Append appends a given data array to the file attached to this buffer pool
 // It returns the address where the data was appended
 func (bp *BufferPool) Append(data []byte) (uint64, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	// loop in reverse, starting at the back
 	// since the latest kv_buffers are the ones updated when new changes occur
 	start := len(bp.kvBuffers) - 1
@@ -172,6 +246,16 @@ func (bp *BufferPool) UpdateIndex(addr uint64, data []byte) error {
 		return err
 	}
 
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	for sn := range bp.snapshots {
+		err = sn.saveIndexEntries(addr, dataLength)
+		if err != nil {
+			return err
+		}
+	}
+
 	blockLeftOffset := bp.getBlockLeftOffset(addr, headers.HeaderSizeInBytes)
 	buf, ok := bp.indexBuffers[blockLeftOffset]
 	if ok {
@@ -187,138 +271,148 @@ func (bp *BufferPool) UpdateIndex(addr uint64, data []byte) error {
 
 // ClearFile clears all data on disk and memory making it like a new store
 func (bp *BufferPool) ClearFile() error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	bufSize := uint32(bp.bufferSize)
 	header := headers.NewDbFileHeader(&bp.maxKeys, &bp.redundantBlocks, &bufSize)
+	header.Generation = bp.generation
+	if len(bp.snapshots) > 0 {
+		// the file is replaced, instead of being emptied, so that the snapshots keep the old one
+		return bp.replaceWithEmptyFile(header)
+	}
+
 	fileSize, err := headers.InitializeFile(bp.File, header)
 	if err != nil {
 		return err
 	}
 	bp.FileSize = uint64(fileSize)
+	bp.formatVersion = header.FormatVersion
 	bp.indexBuffers = make(map[uint64]*Buffer, bp.indexCapacity)
 	bp.kvBuffers = bp.kvBuffers[:0]
+	bp.deadBytes = 0
+	bp.expiredAddrs = make(map[uint64]struct{})
+	bp.keyCount = 0
 	return nil
 }
 
-// CompactFile removes any deleted or expired entries from the file. It must first lock the buffer and the file.
-// In order to be more efficient, it creates a new file, copying only that data which is not deleted or expired
-func (bp *BufferPool) CompactFile(searchIndex *inverted_index.InvertedIndex) error {
+// replaceWithEmptyFile replaces the pool's file with a new one that has the given header and no entries.
+// Like in compaction, the new file is renamed over the old one so that a crash leaves one or the other in place.
+// The caller must hold the pool's lock.
+func (bp *BufferPool) replaceWithEmptyFile(header *headers.DbFileHeader) error {
 	folder := filepath.Dir(bp.FilePath)
-	newFilePath := filepath.Join(folder, "tmp__compact.scdb")
+	newFilePath := filepath.Join(folder, compactionFileName)
 	newFile, err := os.OpenFile(newFilePath, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return err
 	}
 
-	header, err := headers.ExtractDbFileHeaderFromFile(bp.File)
+	fileSize, err := headers.InitializeFile(newFile, header)
+	if err == nil {
+		err = newFile.Sync()
+	}
+	if err == nil {
+		err = os.Rename(newFilePath, bp.FilePath)
+	}
 	if err != nil {
+		_ = newFile.Close()
+		_ = os.Remove(newFilePath)
 		return err
 	}
 
-	// Add headers to new file
-	_, err = newFile.WriteAt(header.AsBytes(), 0)
-	if err != nil && !errors.Is(err, io.EOF) {
+	err = internal.SyncDir(folder)
+	if err != nil {
 		return err
 	}
 
-	idxEntrySize := headers.IndexEntrySizeInBytes
-	idxEntrySizeAsInt64 := int64(idxEntrySize)
-	zero := make([]byte, idxEntrySize)
-	zeroStr := string(zero)
-	idxOffset := int64(headers.HeaderSizeInBytes)
-	newFileOffset := int64(header.KeyValuesStartPoint)
+	err = bp.File.Close()
+	if err != nil {
+		return err
+	}
+
+	// the snapshots keep the old file, which is no longer written to
+	bp.snapshots = make(map[*Snapshot]struct{})
+	bp.File = newFile
+	bp.FileSize = uint64(fileSize)
+	bp.formatVersion = header.FormatVersion
+	bp.indexBuffers = make(map[uint64]*Buffer, bp.indexCapacity)
+	bp.kvBuffers = bp.kvBuffers[:0]
+	bp.deadBytes = 0
+	bp.expiredAddrs = make(map[uint64]struct{})
+	bp.keyCount = 0
+	return nil
+}
+
+// CompactFile removes any deleted or expired entries from the file, in one go.
+// In order to be more efficient, it creates a new file, copying only that data which is not deleted or expired
+//
+// Entries in an older format are rewritten in the current format, thus upgrading the file.
+// If any entry is found to be corrupted, an ErrCorruptedEntry is returned.
+// The search and ordered indices, if any, are rebuilt along with the file.
+// No other reads or writes must happen while it runs. See NewCompaction for a compaction that can be done in steps.
+func (bp *BufferPool) CompactFile(searchIndex *inverted_index.InvertedIndex, orderedIndex *ordered_index.OrderedIndex) error {
+	return bp.compactFile(bp.maxKeys, searchIndex, orderedIndex)
+}
+
+// ResizeFile grows the index of the file to hold `maxKeys` keys, rebuilding the search index, if any,
+// in proportion, and the ordered index, if any.
+//
+// Like CompactFile, it creates a new file with a bigger index, copying into it only that data which is
+// not deleted or expired. An ErrOutOfBounds is returned if `maxKeys` is less than the current maximum number of keys
+// as the keys in the index blocks that would be removed would be lost.
+func (bp *BufferPool) ResizeFile(maxKeys uint64, searchIndex *inverted_index.InvertedIndex, orderedIndex *ordered_index.OrderedIndex) error {
+	if maxKeys < bp.maxKeys {
+		return scdbErrs.NewErrOutOfBounds(fmt.Sprintf("maxKeys %d is less than the current %d", maxKeys, bp.maxKeys))
+	}
+
+	return bp.compactFile(maxKeys, searchIndex, orderedIndex)
+}
 
-	numOfBlocks := int64(header.NumberOfIndexBlocks)
-	blockSize := int64(header.NetBlockSize)
+// CountIndexedKeys returns the number of filled slots in the index of the file.
+//
+// This includes the slots of deleted and expired keys that have not yet been removed by compaction.
+func (bp *BufferPool) CountIndexedKeys() (uint64, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
 
-	if searchIndex != nil {
-		err = searchIndex.Clear()
-		if err != nil {
-			return err
-		}
+	header, err := headers.ExtractDbFileHeaderFromFile(bp.File)
+	if err != nil {
+		return 0, err
 	}
 
-	for i := int64(0); i < numOfBlocks; i++ {
-		indexBlock, err := bp.readIndexBlock(i, blockSize)
+	count := uint64(0)
+	zeroStr := string(make([]byte, headers.IndexEntrySizeInBytes))
+	for i := int64(0); i < int64(header.NumberOfIndexBlocks); i++ {
+		indexBlock, err := bp.readIndexBlock(i, int64(header.NetBlockSize))
 		if err != nil {
-			return err
-		}
-
-		// write index block into new file
-		_, err = newFile.WriteAt(indexBlock, idxOffset)
-		if err != nil && !errors.Is(err, io.EOF) {
-			return err
+			return 0, err
 		}
 
 		idxBlockLength := uint64(len(indexBlock))
-		for lwr := uint64(0); lwr < idxBlockLength; lwr += idxEntrySize {
-			upr := lwr + idxEntrySize
-			idxBytes := indexBlock[lwr:upr]
-
-			if string(idxBytes) != zeroStr {
-				kvByteArray, e := getKvByteArray(bp.File, idxBytes)
-				if e != nil {
-					return e
-				}
-
-				kv, e := values.ExtractKeyValueEntryFromByteArray(kvByteArray, 0)
-				if e != nil {
-					return e
-				}
-
-				if !values.IsExpired(kv) && !kv.IsDeleted {
-					kvSize := int64(len(kvByteArray))
-					// insert key value at the bottom of the new file
-					_, er := newFile.WriteAt(kvByteArray, newFileOffset)
-					if er != nil && !errors.Is(er, io.EOF) {
-						return er
-					}
-
-					// update index to have the index of the newly added key-value entry
-					newKvAddr := uint64(newFileOffset)
-					_, er = newFile.WriteAt(internal.Uint64ToByteArray(newKvAddr), idxOffset)
-					if er != nil && !errors.Is(er, io.EOF) {
-						return er
-					}
-
-					// update search index
-					if searchIndex != nil {
-						err = searchIndex.Add(kv.Key, newKvAddr, kv.Expiry)
-						if err != nil {
-							return err
-						}
-					}
-
-					// increment the new file offset
-					newFileOffset += kvSize
-				} else {
-					// if expired or deleted, update index to zero
-					_, er := newFile.WriteAt(zero, idxOffset)
-					if er != nil && !errors.Is(er, io.EOF) {
-						return er
-					}
-				}
+		for lwr := uint64(0); lwr < idxBlockLength; lwr += headers.IndexEntrySizeInBytes {
+			if string(indexBlock[lwr:lwr+headers.IndexEntrySizeInBytes]) != zeroStr {
+				count++
 			}
-
-			// increment the index offset
-			idxOffset += idxEntrySizeAsInt64
 		}
-
 	}
 
-	// clean up the buffers and update metadata
-	bp.kvBuffers = bp.kvBuffers[:0]
-	bp.indexBuffers = make(map[uint64]*Buffer, bp.indexCapacity)
-	bp.File = newFile
-	bp.FileSize = uint64(newFileOffset)
+	return count, nil
+}
 
-	// Replace old file with new file
-	err = os.Remove(bp.FilePath)
+// compactFile compacts the file, in one go, into a new file whose index holds `maxKeys` keys
+func (bp *BufferPool) compactFile(maxKeys uint64, searchIndex *inverted_index.InvertedIndex, orderedIndex *ordered_index.OrderedIndex) error {
+	c, err := bp.NewCompaction(maxKeys, searchIndex, orderedIndex)
 	if err != nil {
 		return err
 	}
 
-	err = os.Rename(newFilePath, bp.FilePath)
-	return err
+	err = c.Finish()
+	if err != nil {
+		_ = c.Abort()
+		return err
+	}
+
+	return nil
 }
 
 // GetValue returns the *entries.KeyValueEntry at the given address if the key there corresponds to the given key
@@ -330,42 +424,49 @@ func (bp *BufferPool) GetValue(kvAddress uint64, key []byte) (*values.KeyValueEn
 
 	// loop in reverse, starting at the back
 	// since the latest kv_buffers are the ones updated when new changes occur
-	kvBufLen := len(bp.kvBuffers)
-	for i := kvBufLen - 1; i >= 0; i-- {
-		buf := bp.kvBuffers[i]
-		if buf.Contains(kvAddress) {
-			return buf.GetValue(kvAddress, key)
+	// the buffer is only used if it has the whole entry; otherwise the entry is read afresh from file
+	bp.mu.Lock()
+	cachedBuf := bp.getKvBuffer(kvAddress)
+	if cachedBuf != nil && cachedBuf.ContainsEntry(kvAddress) {
+		defer bp.mu.Unlock()
+		bp.cacheStats.KvHits++
+		entry, err := cachedBuf.GetEntry(kvAddress, key, bp.formatVersion)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	if uint64(kvBufLen) >= bp.kvCapacity {
-		// Pop front (the oldest entry)
-		bp.kvBuffers = bp.kvBuffers[1:]
+		return bp.liveEntryForKey(kvAddress, entry, key), nil
 	}
+	bp.cacheStats.KvMisses++
+	bp.mu.Unlock()
 
+	// the file is read without holding the lock so that other readers are not blocked
 	buf := make([]byte, bp.bufferSize)
 	bytesRead, err := bp.File.ReadAt(buf, int64(kvAddress))
 	if err != nil && !errors.Is(err, io.EOF) {
 		return nil, err
 	}
 
+	entry, err := bp.extractKvEntry(kvAddress, buf[:bytesRead], key)
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	// update kv_buffers only upto actual data read (cater for partially filled buffer)
-	bp.kvBuffers = append(bp.kvBuffers, NewBuffer(kvAddress, buf[:bytesRead], bp.bufferSize))
-	entry, err := values.ExtractKeyValueEntryFromByteArray(buf, 0)
+	bp.addKvBuffer(NewBuffer(kvAddress, buf[:bytesRead], bp.bufferSize))
 	if err != nil {
 		return nil, err
 	}
 
-	if bytes.Equal(entry.Key, key) && !values.IsExpired(entry) && !entry.IsDeleted {
-		return entry, nil
-	}
-
-	return nil, nil
+	return bp.liveEntryForKey(kvAddress, entry, key), nil
 }
 
 // TryDeleteKvEntry attempts to delete the key-value entry for the given kv_address as long as the key it holds
 // is the same as the key provided. It returns true if successful
 func (bp *BufferPool) TryDeleteKvEntry(kvAddress uint64, key []byte) (bool, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	keySize := int64(len(key))
 	addrForIsDeleted := int64(kvAddress+values.OffsetForKeyInKVArray) + keySize
 	// loop in reverse, starting at the back
@@ -374,18 +475,35 @@ func (bp *BufferPool) TryDeleteKvEntry(kvAddress uint64, key []byte) (bool, erro
 	for i := kvBufLen - 1; i >= 0; i-- {
 		buf := bp.kvBuffers[i]
 		if buf.Contains(kvAddress) {
+			isForKey, err := buf.AddrBelongsToKey(kvAddress, key)
+			if err != nil {
+				return false, err
+			}
+
+			if isForKey {
+				err = bp.countDead(kvAddress, key)
+				if err != nil {
+					return false, err
+				}
+			}
+
 			success, err := buf.TryDeleteKvEntry(kvAddress, key)
 			if err != nil {
 				return false, err
 			}
 
 			if success {
+				err = bp.saveFlagsInSnapshots(kvAddress, key)
+				if err != nil {
+					return false, err
+				}
+
 				// set isDeleted to true i.e. 1
 				_, err = bp.File.WriteAt([]byte{1}, addrForIsDeleted)
 				if err != nil {
 					return false, err
 				}
-				return true, nil
+				return true, bp.writeKeyCount()
 			}
 		}
 	}
@@ -396,13 +514,23 @@ func (bp *BufferPool) TryDeleteKvEntry(kvAddress uint64, key []byte) (bool, erro
 	}
 
 	if bytes.Equal(keyInData, key) {
+		err = bp.countDead(kvAddress, key)
+		if err != nil {
+			return false, err
+		}
+
+		err = bp.saveFlagsInSnapshots(kvAddress, key)
+		if err != nil {
+			return false, err
+		}
+
 		// set isDeleted to true i.e. 1
 		_, err = bp.File.WriteAt([]byte{1}, addrForIsDeleted)
 		if err != nil {
 			return false, err
 		}
 
-		return true, nil
+		return true, bp.writeKeyCount()
 	}
 
 	return false, nil
@@ -418,19 +546,12 @@ func (bp *BufferPool) AddrBelongsToKey(kvAddress uint64, key []byte) (bool, erro
 		return false, nil
 	}
 
-	// loop in reverse, starting at the back
-	// since the latest kvBuffers are the ones updated when new changes occur
-	kvBufLen := len(bp.kvBuffers)
-	for i := kvBufLen - 1; i >= 0; i-- {
-		buf := bp.kvBuffers[i]
-		if buf.Contains(kvAddress) {
-			return buf.AddrBelongsToKey(kvAddress, key)
-		}
-	}
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
 
-	if uint64(kvBufLen) >= bp.kvCapacity {
-		// Pop front (the oldest entry)
-		bp.kvBuffers = bp.kvBuffers[1:]
+	cachedBuf := bp.getKvBuffer(kvAddress)
+	if cachedBuf != nil {
+		return cachedBuf.AddrBelongsToKey(kvAddress, key)
 	}
 
 	buf := make([]byte, bp.bufferSize)
@@ -440,7 +561,7 @@ func (bp *BufferPool) AddrBelongsToKey(kvAddress uint64, key []byte) (bool, erro
 	}
 
 	// update kv_buffers only upto actual data read (cater for partially filled buffer)
-	bp.kvBuffers = append(bp.kvBuffers, NewBuffer(kvAddress, buf[:bytesRead], bp.bufferSize))
+	bp.addKvBuffer(NewBuffer(kvAddress, buf[:bytesRead], bp.bufferSize))
 
 	keyInFile := buf[values.OffsetForKeyInKVArray : values.OffsetForKeyInKVArray+uint64(len(key))]
 	isForKey := bytes.Contains(keyInFile, key)
@@ -458,10 +579,15 @@ func (bp *BufferPool) ReadIndex(addr uint64) ([]byte, error) {
 	}
 
 	blockLeftOffset := bp.getBlockLeftOffset(addr, headers.HeaderSizeInBytes)
+	bp.mu.Lock()
 	buf, ok := bp.indexBuffers[blockLeftOffset]
 	if ok {
+		defer bp.mu.Unlock()
+		bp.cacheStats.IndexHits++
 		return buf.ReadAt(addr, headers.IndexEntrySizeInBytes)
 	}
+	bp.cacheStats.IndexMisses++
+	bp.mu.Unlock()
 
 	data := make([]byte, bp.bufferSize)
 	// Index buffers should have preset boundaries matching
@@ -473,21 +599,9 @@ func (bp *BufferPool) ReadIndex(addr uint64) ([]byte, error) {
 		return nil, err
 	}
 
-	if uint64(len(bp.indexBuffers)) >= bp.indexCapacity {
-		biggestLeftOffset := uint64(0)
-		for lftOffset := range bp.indexBuffers {
-			if lftOffset >= biggestLeftOffset {
-				biggestLeftOffset = lftOffset
-			}
-		}
-
-		// delete the buffer with the biggest left offset as those with lower left offsets
-		// are expected to have more keys
-		delete(bp.indexBuffers, biggestLeftOffset)
-		bp.indexBuffers[blockLeftOffset] = NewBuffer(blockLeftOffset, data, bp.bufferSize)
-	} else {
-		bp.indexBuffers[blockLeftOffset] = NewBuffer(blockLeftOffset, data, bp.bufferSize)
-	}
+	bp.mu.Lock()
+	bp.addIndexBuffer(NewBuffer(blockLeftOffset, data, bp.bufferSize))
+	bp.mu.Unlock()
 
 	start := addr - blockLeftOffset
 	return data[start : start+headers.IndexEntrySizeInBytes], nil
@@ -498,31 +612,447 @@ func (bp *BufferPool) GetManyKeyValues(addrs []uint64) ([]KeyValuePair, error) {
 	results := make([]KeyValuePair, 0, len(addrs))
 
 	for _, addr := range addrs {
-		addr := int64(addr)
-		size, err := bp.readKvSize(addr)
+		kv, err := bp.GetKeyValue(addr)
 		if err != nil {
 			return nil, err
 		}
 
-		buf, err := bp.readKvBytes(addr, size)
+		if kv != nil {
+			results = append(results, *kv)
+		}
+	}
+
+	return results, nil
+}
+
+// GetKeyValue returns the key-value pair of the entry at the given address, whatever its key.
+// It returns nil if the entry is deleted or expired.
+func (bp *BufferPool) GetKeyValue(addr uint64) (*KeyValuePair, error) {
+	size, err := bp.readKvSize(int64(addr))
+	if err != nil {
+		return nil, err
+	}
+
+	if addr+uint64(size) > bp.FileSize {
+		return nil, scdbErrs.NewErrCorruptedEntry(addr, nil)
+	}
+
+	buf, err := bp.readKvBytes(int64(addr), size)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := bp.extractKvEntry(addr, buf, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.IsDeleted {
+		return nil, nil
+	}
+
+	if values.IsExpired(entry) {
+		bp.mu.Lock()
+		bp.countExpired(addr, entry.Size)
+		bp.mu.Unlock()
+		return nil, nil
+	}
+
+	return &KeyValuePair{K: entry.Key, V: entry.Value}, nil
+}
+
+// GetKey returns the key of the entry at the given address, or nil if the entry is deleted or expired.
+// Only the key, and the flags after it, are read; the value is not.
+func (bp *BufferPool) GetKey(kvAddress uint64) ([]byte, error) {
+	key, _, isLive, err := bp.readKey(kvAddress)
+	if err != nil || !isLive {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// KeyExists checks if the entry at the given address is for the given key and is neither deleted nor expired.
+// Only the key, and the flags after it, are read; the value is not.
+func (bp *BufferPool) KeyExists(kvAddress uint64, key []byte) (bool, error) {
+	if kvAddress == 0 {
+		return false, nil
+	}
+
+	keyInFile, _, isLive, err := bp.readKey(kvAddress)
+	if err != nil {
+		return false, err
+	}
+
+	return isLive && bytes.Equal(keyInFile, key), nil
+}
+
+// GetExpiry returns the expiry of the entry at the given address, and true, if the entry is for the given key
+// and is neither deleted nor expired. Otherwise, it returns false.
+// Only the key, and the flags after it, are read; the value is not.
+func (bp *BufferPool) GetExpiry(kvAddress uint64, key []byte) (uint64, bool, error) {
+	if kvAddress == 0 {
+		return 0, false, nil
+	}
+
+	keyInFile, expiry, isLive, err := bp.readKey(kvAddress)
+	if err != nil || !isLive || !bytes.Equal(keyInFile, key) {
+		return 0, false, err
+	}
+
+	return expiry, true, nil
+}
+
+// TrySetExpiry attempts to set the expiry of the key-value entry for the given kv_address as long as the key it holds
+// is the same as the key provided, and the entry is neither deleted nor expired. It returns true if successful.
+//
+// The expiry is overwritten in place, in the file and in any kv buffer holding it, since it is not part of the
+// entry's checksum.
+func (bp *BufferPool) TrySetExpiry(kvAddress uint64, key []byte, expiry uint64) (bool, error) {
+	isLive, err := bp.KeyExists(kvAddress, key)
+	if err != nil || !isLive {
+		return false, err
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	// the key is followed by the isDeleted flag and then the expiry
+	addrForExpiry := kvAddress + values.OffsetForKeyInKVArray + uint64(len(key)) + 1
+	for _, buf := range bp.kvBuffers {
+		if buf.Contains(kvAddress) && buf.Contains(addrForExpiry+7) {
+			_, err = buf.TrySetExpiry(kvAddress, key, expiry)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	err = bp.saveFlagsInSnapshots(kvAddress, key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = bp.File.WriteAt(internal.Uint64ToByteArray(expiry), int64(addrForExpiry))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// saveFlagsInSnapshots saves the isDeleted flag and expiry of the entry for the given key at the given address
+// into every open snapshot, as they are about to be overwritten. The caller must hold the pool's lock.
+func (bp *BufferPool) saveFlagsInSnapshots(kvAddress uint64, key []byte) error {
+	for sn := range bp.snapshots {
+		err := sn.saveFlags(kvAddress, key)
 		if err != nil {
-			return nil, err
+			return err
 		}
+	}
+
+	return nil
+}
+
+// MarkInserted records that the index now points to a new live key-value entry, updating the number of keys
+// in the file's header. Any older entry for the same key must have been passed to MarkOverwritten first.
+func (bp *BufferPool) MarkInserted() error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
 
-		entry, err := values.ExtractKeyValueEntryFromByteArray(buf, 0)
+	bp.keyCount++
+	return bp.writeKeyCount()
+}
+
+// KeyCount returns the number of keys in the file whose entries are neither deleted nor known to be expired.
+// Keys that expired but have not been read since are still counted.
+func (bp *BufferPool) KeyCount() uint64 {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return bp.keyCount
+}
+
+// MarkOverwritten records the key-value entry for the given key at the given address as dead since a newer entry
+// for that key has replaced it in the index. It does nothing if the entry is deleted or already known to be expired.
+func (bp *BufferPool) MarkOverwritten(kvAddress uint64, key []byte) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return bp.countDead(kvAddress, key)
+}
+
+// DeadBytes returns the total size of the entries in the file that are deleted, overwritten or known to be expired.
+// It is the space that compaction would reclaim, save for expired entries that have not been read since they expired.
+func (bp *BufferPool) DeadBytes() uint64 {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return bp.deadBytes
+}
+
+// DataSize returns the total size of all the key-value entries in the file, dead or alive
+func (bp *BufferPool) DataSize() uint64 {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return bp.FileSize - bp.keyValuesStartPoint
+}
+
+// liveEntryForKey returns the entry at the given address if it is for the given key and is neither deleted
+// nor expired. Otherwise, it returns nil. Expired entries are counted as dead.
+// The caller must hold the pool's lock.
+func (bp *BufferPool) liveEntryForKey(kvAddress uint64, entry *values.KeyValueEntry, key []byte) *values.KeyValueEntry {
+	if !bytes.Equal(entry.Key, key) || entry.IsDeleted {
+		return nil
+	}
+
+	if values.IsExpired(entry) {
+		bp.countExpired(kvAddress, entry.Size)
+		return nil
+	}
+
+	return entry
+}
+
+// countExpired adds the size of the expired entry at the given address to the dead bytes, unless it was counted
+// already. The caller must hold the pool's lock.
+func (bp *BufferPool) countExpired(kvAddress uint64, size uint32) {
+	if _, ok := bp.expiredAddrs[kvAddress]; ok {
+		return
+	}
+
+	bp.expiredAddrs[kvAddress] = struct{}{}
+	bp.deadBytes += uint64(size)
+	bp.uncountKey()
+}
+
+// countDead adds the size of the entry for the given key at the given address to the dead bytes, as it is about to be
+// deleted or has been overwritten. Entries already deleted, or already counted as expired, are not counted again.
+// The caller must hold the pool's lock.
+func (bp *BufferPool) countDead(kvAddress uint64, key []byte) error {
+	if _, ok := bp.expiredAddrs[kvAddress]; ok {
+		// it is no longer needed as the entry becomes unreachable or deleted
+		delete(bp.expiredAddrs, kvAddress)
+		return nil
+	}
+
+	size, err := bp.readKvSize(int64(kvAddress))
+	if err != nil {
+		return err
+	}
+
+	isDeleted := make([]byte, 1)
+	_, err = bp.File.ReadAt(isDeleted, int64(kvAddress+values.OffsetForKeyInKVArray)+int64(len(key)))
+	if err != nil {
+		return err
+	}
+
+	if isDeleted[0] == 0 {
+		bp.deadBytes += uint64(size)
+		bp.uncountKey()
+	}
+
+	return nil
+}
+
+// uncountKey removes a key whose entry has just been found dead from the number of keys.
+// The caller must hold the pool's lock.
+func (bp *BufferPool) uncountKey() {
+	// the count may be off after a crash
+	if bp.keyCount > 0 {
+		bp.keyCount--
+	}
+}
+
+// Generation returns the generation in the header of the file. See headers.DbFileHeader.Generation.
+func (bp *BufferPool) Generation() uint64 {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return bp.generation
+}
+
+// SetGeneration writes the given generation to the header of the file, syncing it to disk
+// so that it is not lost if writes that follow it are not
+func (bp *BufferPool) SetGeneration(generation uint64) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	_, err := bp.File.WriteAt(internal.Uint64ToByteArray(generation), int64(headers.GenerationOffset))
+	if err != nil {
+		return err
+	}
+
+	bp.generation = generation
+	return bp.File.Sync()
+}
+
+// writeKeyCount writes the number of keys to the file's header. The caller must hold the pool's lock.
+func (bp *BufferPool) writeKeyCount() error {
+	for sn := range bp.snapshots {
+		err := sn.saveKeyCount()
 		if err != nil {
-			return nil, err
+			return err
+		}
+	}
+
+	_, err := bp.File.WriteAt(internal.Uint64ToByteArray(bp.keyCount), int64(headers.KeyCountOffset))
+	return err
+}
+
+// readKey reads the key and the expiry of the entry at the given address, and whether the entry is neither deleted
+// nor expired. Expired entries are counted as dead.
+func (bp *BufferPool) readKey(kvAddress uint64) ([]byte, uint64, bool, error) {
+	key, expiry, size, isDeleted, err := bp.readKeyPrefix(kvAddress)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	if isDeleted {
+		return key, expiry, false, nil
+	}
+
+	if values.IsExpiryPast(expiry) {
+		bp.mu.Lock()
+		bp.countExpired(kvAddress, size)
+		bp.mu.Unlock()
+		return key, expiry, false, nil
+	}
+
+	return key, expiry, true, nil
+}
+
+// readKeyPrefix reads the key, the expiry, the size and the isDeleted flag of the entry at the given address,
+// without reading its value
+func (bp *BufferPool) readKeyPrefix(kvAddress uint64) ([]byte, uint64, uint32, bool, error) {
+	sizes := make([]byte, values.OffsetForKeyInKVArray)
+	_, err := bp.File.ReadAt(sizes, int64(kvAddress))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, 0, false, err
+	}
+
+	size, _ := internal.Uint32FromByteArray(sizes[:4])
+	keySize, _ := internal.Uint32FromByteArray(sizes[4:])
+	// the key is followed by the isDeleted flag and the expiry
+	prefixSize := values.OffsetForKeyInKVArray + uint64(keySize) + 9
+	if kvAddress+prefixSize > bp.FileSize || prefixSize > uint64(size) {
+		return nil, 0, 0, false, scdbErrs.NewErrCorruptedEntry(kvAddress, nil)
+	}
+
+	prefix := make([]byte, prefixSize-values.OffsetForKeyInKVArray)
+	_, err = bp.File.ReadAt(prefix, int64(kvAddress+values.OffsetForKeyInKVArray))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, 0, false, err
+	}
+
+	key := prefix[:keySize]
+	isDeleted := prefix[keySize] == 1
+	expiry, _ := internal.Uint64FromByteArray(prefix[keySize+1:])
+	return key, values.ExpiryInMilliseconds(expiry, bp.formatVersion), size, isDeleted, nil
+}
+
+// countLiveKeys counts the keys in the index of the file whose entries are neither deleted nor expired
+func (bp *BufferPool) countLiveKeys(header *headers.DbFileHeader) (uint64, error) {
+	count := uint64(0)
+	zero := make([]byte, headers.IndexEntrySizeInBytes)
+	for i := int64(0); i < int64(header.NumberOfIndexBlocks); i++ {
+		indexBlock, err := bp.readIndexBlock(i, int64(header.NetBlockSize))
+		if err != nil {
+			return 0, err
 		}
 
-		if !entry.IsDeleted && !values.IsExpired(entry) {
-			results = append(results, KeyValuePair{
-				K: entry.Key,
-				V: entry.Value,
-			})
+		idxBlockLength := uint64(len(indexBlock))
+		for lwr := uint64(0); lwr < idxBlockLength; lwr += headers.IndexEntrySizeInBytes {
+			addrBytes := indexBlock[lwr : lwr+headers.IndexEntrySizeInBytes]
+			if bytes.Equal(addrBytes, zero) {
+				continue
+			}
+
+			kvAddress, _ := internal.Uint64FromByteArray(addrBytes)
+			_, _, isLive, err := bp.readKey(kvAddress)
+			if err != nil {
+				return 0, err
+			}
+
+			if isLive {
+				count++
+			}
 		}
 	}
 
-	return results, nil
+	return count, nil
+}
+
+// getKvBuffer returns the latest kv buffer that contains the given address, or nil if there is none.
+// The caller must hold the pool's lock.
+func (bp *BufferPool) getKvBuffer(kvAddress uint64) *Buffer {
+	// loop in reverse, starting at the back
+	// since the latest kv_buffers are the ones updated when new changes occur
+	for i := len(bp.kvBuffers) - 1; i >= 0; i-- {
+		buf := bp.kvBuffers[i]
+		if buf.Contains(kvAddress) {
+			return buf
+		}
+	}
+
+	return nil
+}
+
+// addKvBuffer adds the given buffer to the back of the kv buffers, removing the oldest buffer
+// if the capacity has been reached. The caller must hold the pool's lock.
+func (bp *BufferPool) addKvBuffer(buf *Buffer) {
+	if len(bp.kvBuffers) > 0 && uint64(len(bp.kvBuffers)) >= bp.kvCapacity {
+		// Pop front (the oldest entry)
+		bp.kvBuffers = bp.kvBuffers[1:]
+	}
+
+	bp.kvBuffers = append(bp.kvBuffers, buf)
+}
+
+// addIndexBuffer adds the given buffer to the index buffers, removing the buffer with the biggest left offset
+// if the capacity has been reached. The caller must hold the pool's lock.
+func (bp *BufferPool) addIndexBuffer(buf *Buffer) {
+	if _, ok := bp.indexBuffers[buf.LeftOffset]; !ok && uint64(len(bp.indexBuffers)) >= bp.indexCapacity {
+		biggestLeftOffset := uint64(0)
+		for lftOffset := range bp.indexBuffers {
+			if lftOffset >= biggestLeftOffset {
+				biggestLeftOffset = lftOffset
+			}
+		}
+
+		// delete the buffer with the biggest left offset as those with lower left offsets
+		// are expected to have more keys
+		delete(bp.indexBuffers, biggestLeftOffset)
+	}
+
+	bp.indexBuffers[buf.LeftOffset] = buf
+}
+
+// extractKvEntry extracts the key-value entry at the given address from data, the byte array read from file
+// starting at that address. If the entry is bigger than data, the whole entry is read from the file.
+//
+// It returns an ErrCorruptedEntry if the entry overflows the file, can't be parsed or its checksum does not match
+// its contents. `key` is the key the entry is being read for, and is only used in the error.
+func (bp *BufferPool) extractKvEntry(kvAddress uint64, data []byte, key []byte) (*values.KeyValueEntry, error) {
+	size, err := internal.Uint32FromByteArray(data)
+	if err != nil || kvAddress+uint64(size) > bp.FileSize {
+		return nil, scdbErrs.NewErrCorruptedEntry(kvAddress, key)
+	}
+
+	if uint64(size) > uint64(len(data)) {
+		data, err = bp.readKvBytes(int64(kvAddress), size)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := values.ExtractKeyValueEntryFromByteArray(data, 0, bp.formatVersion)
+	if err != nil || !entry.HasValidChecksum() {
+		return nil, scdbErrs.NewErrCorruptedEntry(kvAddress, key)
+	}
+
+	return entry, nil
 }
 
 // readKvBytes reads the key-value byte array directly from file given address and size
@@ -2,12 +2,15 @@ package buffers
 
 import (
 	"bytes"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
 	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
 	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
 	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"sync"
 	"testing"
 	"time"
 )
@@ -145,6 +148,58 @@ func TestNewBufferPool(t *testing.T) {
 	})
 }
 
+func TestNewReadOnlyBufferPool(t *testing.T) {
+	fileName := "testdb_pool.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("NewReadOnlyBufferPoolForNonExistingFileReturnsErrorWithoutCreatingIt", func(t *testing.T) {
+		_ = os.Remove(fileName)
+
+		_, err := NewReadOnlyBufferPool(nil, fileName)
+		assert.True(t, os.IsNotExist(err))
+
+		exists, err := internal.PathExists(fileName)
+		if err != nil {
+			t.Fatalf("error checking file: %s", err)
+		}
+		assert.False(t, exists)
+	})
+
+	t.Run("NewReadOnlyBufferPoolForExistingFileReadsItWithoutWritingToIt", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		_, err = pool.Append([]byte("foo"))
+		if err != nil {
+			t.Fatalf("error appending data: %s", err)
+		}
+		err = pool.Close()
+		if err != nil {
+			t.Fatalf("error closing pool: %s", err)
+		}
+		initialContents := readFile(t, fileName)
+
+		pool, err = NewReadOnlyBufferPool(nil, fileName)
+		if err != nil {
+			t.Fatalf("error creating read-only buffer pool: %s", err)
+		}
+		assert.Equal(t, uint64(len(initialContents)), pool.FileSize)
+
+		_, err = pool.Append([]byte("bar"))
+		assert.NotNil(t, err)
+
+		err = pool.Close()
+		if err != nil {
+			t.Fatalf("error closing pool: %s", err)
+		}
+		assert.Equal(t, initialContents, readFile(t, fileName))
+	})
+}
+
 func TestBufferPool_Close(t *testing.T) {
 	fileName := "testdb_pool.scdb"
 	defer func() {
@@ -400,7 +455,7 @@ func TestBufferPool_ClearFile(t *testing.T) {
 	}
 
 	kv1 := values.NewKeyValueEntry([]byte("kv"), []byte("bar"), 0)
-	kv2 := values.NewKeyValueEntry([]byte("foo"), []byte("baracuda"), uint64(time.Now().Unix()*2))
+	kv2 := values.NewKeyValueEntry([]byte("foo"), []byte("baracuda"), uint64(time.Now().UnixMilli()*2))
 
 	insertKeyValueEntry(t, pool, headerPreClear, kv1)
 	insertKeyValueEntry(t, pool, headerPreClear, kv2)
@@ -447,7 +502,7 @@ func TestBufferPool_CompactFile(t *testing.T) {
 	_ = os.Remove(fileName)
 	_ = os.Remove(indexFileName)
 
-	futureTimestamp := uint64(time.Now().Unix() * 2)
+	futureTimestamp := uint64(time.Now().UnixMilli() * 2)
 	neverExpires := values.NewKeyValueEntry([]byte("never_expires"), []byte("bar"), 0)
 	deleted := values.NewKeyValueEntry([]byte("deleted"), []byte("bok"), 0)
 	// 1666023836u64 is some past timestamp in October 2022
@@ -484,7 +539,7 @@ func TestBufferPool_CompactFile(t *testing.T) {
 		t.Fatalf("error creating a search index: %s", err)
 	}
 
-	err = pool.CompactFile(searchIndex)
+	err = pool.CompactFile(searchIndex, nil)
 	if err != nil {
 		t.Fatalf("error compacting db file: %s", err)
 	}
@@ -511,6 +566,104 @@ func TestBufferPool_CompactFile(t *testing.T) {
 	assert.False(t, keyValueExists(t, dataInFile, header, deleted))
 }
 
+func TestBufferPool_ResizeFile(t *testing.T) {
+	fileName := "testdb_pool.scdb"
+	indexFileName := "testdb_pool.iscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+		_ = os.Remove(indexFileName)
+	}()
+
+	t.Run("ResizeFileGrowsTheIndexAndKeepsOnlyLiveKeyValues", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		_ = os.Remove(indexFileName)
+
+		neverExpires := values.NewKeyValueEntry([]byte("never_expires"), []byte("bar"), 0)
+		deleted := values.NewKeyValueEntry([]byte("deleted"), []byte("bok"), 0)
+
+		maxKeys := uint64(10)
+		pool, err := NewBufferPool(nil, fileName, &maxKeys, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		defer func() {
+			_ = pool.Close()
+		}()
+
+		header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+		if err != nil {
+			t.Fatalf("error extracting header from file: %s", err)
+		}
+
+		insertKeyValueEntry(t, pool, header, neverExpires)
+		insertKeyValueEntry(t, pool, header, deleted)
+		deleteKeyValue(t, pool, header, deleted)
+
+		searchIndex, err := inverted_index.NewInvertedIndex(indexFileName, nil, &maxKeys, nil)
+		if err != nil {
+			t.Fatalf("error creating a search index: %s", err)
+		}
+		defer func() {
+			_ = searchIndex.Close()
+		}()
+
+		err = pool.ResizeFile(2_000, searchIndex, nil)
+		if err != nil {
+			t.Fatalf("error resizing db file: %s", err)
+		}
+
+		newHeader, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+		if err != nil {
+			t.Fatalf("error extracting header from file: %s", err)
+		}
+
+		assert.Equal(t, uint64(2_000), newHeader.MaxKeys)
+		assert.Greater(t, newHeader.NumberOfIndexBlocks, header.NumberOfIndexBlocks)
+		assert.Equal(t, uint64(2_000), pool.maxKeys)
+		assert.Equal(t, newHeader.KeyValuesStartPoint, pool.keyValuesStartPoint)
+		assert.Equal(t, newHeader.KeyValuesStartPoint+uint64(neverExpires.Size), pool.FileSize)
+		assert.Equal(t, uint64(2_000), searchIndex.MaxKeys())
+
+		kvAddr := getKvAddress(t, pool, newHeader, neverExpires)
+		assert.Equal(t, newHeader.KeyValuesStartPoint, kvAddr)
+		got, err := pool.GetValue(kvAddr, neverExpires.Key)
+		if err != nil {
+			t.Fatalf("error getting value: %s", err)
+		}
+		assert.Equal(t, neverExpires, got)
+		assert.Equal(t, uint64(0), getKvAddress(t, pool, newHeader, deleted))
+
+		addrs, err := searchIndex.Search([]byte("nev"), 0, 0)
+		if err != nil {
+			t.Fatalf("error searching index: %s", err)
+		}
+		assert.Equal(t, []uint64{kvAddr}, addrs)
+
+		count, err := pool.CountIndexedKeys()
+		if err != nil {
+			t.Fatalf("error counting indexed keys: %s", err)
+		}
+		assert.Equal(t, uint64(1), count)
+	})
+
+	t.Run("ResizeFileToFewerMaxKeysReturnsErrOutOfBounds", func(t *testing.T) {
+		_ = os.Remove(fileName)
+
+		maxKeys := uint64(1_000)
+		pool, err := NewBufferPool(nil, fileName, &maxKeys, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		defer func() {
+			_ = pool.Close()
+		}()
+
+		err = pool.ResizeFile(10, nil, nil)
+		assert.IsType(t, &errors.ErrOutOfBounds{}, err)
+		assert.Equal(t, maxKeys, pool.maxKeys)
+	})
+}
+
 func TestBufferPool_GetValue(t *testing.T) {
 	fileName := "testdb_pool.scdb"
 	defer func() {
@@ -637,6 +790,133 @@ func TestBufferPool_GetValue(t *testing.T) {
 			t.Fatalf("error removing database file: %s", fileName)
 		}
 	})
+
+	t.Run("BufferPool_GetValueCanBeCalledConcurrently", func(t *testing.T) {
+		pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+		if err != nil {
+			t.Fatalf("error extracting db file header from file: %s", err)
+		}
+
+		kvs := make([]*values.KeyValueEntry, 0, 20)
+		for i := 0; i < 20; i++ {
+			kv := values.NewKeyValueEntry([]byte(fmt.Sprintf("key-%d", i)), bytes.Repeat([]byte("v"), 500), 0)
+			insertKeyValueEntry(t, pool, header, kv)
+			kvs = append(kvs, kv)
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, kv := range kvs {
+					kvAddress := getKvAddress(t, pool, header, kv)
+					got, err := pool.GetValue(kvAddress, kv.Key)
+					assert.Nil(t, err)
+					assert.Equal(t, kv, got)
+				}
+			}()
+		}
+		wg.Wait()
+
+		err = os.Remove(fileName)
+		if err != nil {
+			t.Fatalf("error removing database file: %s", fileName)
+		}
+	})
+
+	t.Run("BufferPool_GetValueForValueBiggerThanBufferGetsWholeValueFromFile", func(t *testing.T) {
+		bufferSize := uint32(64)
+		kv := values.NewKeyValueEntry([]byte("big"), bytes.Repeat([]byte("bar"), 100), 0)
+
+		pool, err := NewBufferPool(nil, fileName, nil, nil, &bufferSize)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+		if err != nil {
+			t.Fatalf("error extracting db file header from file: %s", err)
+		}
+
+		insertKeyValueEntry(t, pool, header, kv)
+		kvAddress := getKvAddress(t, pool, header, kv)
+
+		// the first get reads from file, the second from the partially filled buffer
+		for i := 0; i < 2; i++ {
+			got, err := pool.GetValue(kvAddress, kv.Key)
+			if err != nil {
+				t.Fatalf("error getting value: %s", err)
+			}
+
+			assert.Equal(t, kv, got)
+		}
+
+		err = os.Remove(fileName)
+		if err != nil {
+			t.Fatalf("error removing database file: %s", fileName)
+		}
+	})
+
+	t.Run("BufferPool_GetValueForCorruptedEntryReturnsErrCorruptedEntry", func(t *testing.T) {
+		kv := values.NewKeyValueEntry([]byte("corrupted"), []byte("bar"), 0)
+
+		pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+		if err != nil {
+			t.Fatalf("error extracting db file header from file: %s", err)
+		}
+
+		insertKeyValueEntry(t, pool, header, kv)
+		kvAddress := getKvAddress(t, pool, header, kv)
+
+		// change the value on file from "bar" to "baz"
+		valueAddr := kvAddress + uint64(values.KeyValueMinSizeInBytes-values.ChecksumSizeInBytes) + uint64(kv.KeySize)
+		writeToFile(t, fileName, int64(valueAddr+2), []byte("z"))
+
+		got, err := pool.GetValue(kvAddress, kv.Key)
+		assert.Equal(t, errors.NewErrCorruptedEntry(kvAddress, kv.Key), err)
+		assert.Nil(t, got)
+
+		err = os.Remove(fileName)
+		if err != nil {
+			t.Fatalf("error removing database file: %s", fileName)
+		}
+	})
+
+	t.Run("BufferPool_GetValueForEntryOverflowingTheFileReturnsErrCorruptedEntry", func(t *testing.T) {
+		kv := values.NewKeyValueEntry([]byte("overflows"), []byte("bar"), 0)
+
+		pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+		if err != nil {
+			t.Fatalf("error extracting db file header from file: %s", err)
+		}
+
+		insertKeyValueEntry(t, pool, header, kv)
+		kvAddress := getKvAddress(t, pool, header, kv)
+
+		// corrupt the size of the entry on file
+		writeToFile(t, fileName, int64(kvAddress), internal.Uint32ToByteArray(kv.Size*1000))
+
+		got, err := pool.GetValue(kvAddress, kv.Key)
+		assert.Equal(t, errors.NewErrCorruptedEntry(kvAddress, kv.Key), err)
+		assert.Nil(t, got)
+
+		err = os.Remove(fileName)
+		if err != nil {
+			t.Fatalf("error removing database file: %s", fileName)
+		}
+	})
 }
 
 func TestBufferPool_GetManyKeyValues(t *testing.T) {
@@ -987,6 +1267,480 @@ func TestBufferPool_TryDeleteKvEntry(t *testing.T) {
 	})
 }
 
+func TestBufferPool_DeadBytes(t *testing.T) {
+	fileName := "testdb_pool.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("DeadBytesCountsOverwrittenAndDeletedEntriesOnlyOnce", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		kv1 := values.NewKeyValueEntry([]byte("never"), []byte("bar"), 0)
+		kv2 := values.NewKeyValueEntry([]byte("foo"), []byte("baracuda"), 0)
+
+		pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		defer func() {
+			_ = pool.Close()
+		}()
+		header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+		if err != nil {
+			t.Fatalf("error extracting db file header from file: %s", err)
+		}
+
+		insertKeyValueEntry(t, pool, header, kv1)
+		insertKeyValueEntry(t, pool, header, kv2)
+		assert.Equal(t, uint64(0), pool.DeadBytes())
+		assert.Equal(t, uint64(kv1.Size+kv2.Size), pool.DataSize())
+
+		kv1Addr := getKvAddress(t, pool, header, kv1)
+		err = pool.MarkOverwritten(kv1Addr, kv1.Key)
+		if err != nil {
+			t.Fatalf("error marking kv1 as overwritten: %s", err)
+		}
+		assert.Equal(t, uint64(kv1.Size), pool.DeadBytes())
+
+		kv2Addr := getKvAddress(t, pool, header, kv2)
+		for i := 0; i < 2; i++ {
+			_, err = pool.TryDeleteKvEntry(kv2Addr, kv2.Key)
+			if err != nil {
+				t.Fatalf("error deleting kv2: %s", err)
+			}
+		}
+		assert.Equal(t, uint64(kv1.Size+kv2.Size), pool.DeadBytes())
+
+		// overwriting a deleted entry adds nothing
+		err = pool.MarkOverwritten(kv2Addr, kv2.Key)
+		if err != nil {
+			t.Fatalf("error marking kv2 as overwritten: %s", err)
+		}
+		assert.Equal(t, uint64(kv1.Size+kv2.Size), pool.DeadBytes())
+
+		err = pool.ClearFile()
+		if err != nil {
+			t.Fatalf("error clearing file: %s", err)
+		}
+		assert.Equal(t, uint64(0), pool.DeadBytes())
+		assert.Equal(t, uint64(0), pool.DataSize())
+	})
+
+	t.Run("DeadBytesCountsExpiredEntriesOnlyOnceAfterTheyAreRead", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		kv := values.NewKeyValueEntry([]byte("expired"), []byte("bar"), uint64(time.Now().UnixMilli())-1)
+
+		pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		defer func() {
+			_ = pool.Close()
+		}()
+		header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+		if err != nil {
+			t.Fatalf("error extracting db file header from file: %s", err)
+		}
+
+		insertKeyValueEntry(t, pool, header, kv)
+		assert.Equal(t, uint64(0), pool.DeadBytes())
+
+		kvAddr := getKvAddress(t, pool, header, kv)
+		for i := 0; i < 2; i++ {
+			got, err := pool.GetValue(kvAddr, kv.Key)
+			if err != nil {
+				t.Fatalf("error getting value: %s", err)
+			}
+			assert.Nil(t, got)
+		}
+
+		_, err = pool.GetManyKeyValues([]uint64{kvAddr})
+		if err != nil {
+			t.Fatalf("error getting many key values: %s", err)
+		}
+		assert.Equal(t, uint64(kv.Size), pool.DeadBytes())
+
+		// deleting an entry already counted as expired adds nothing
+		_, err = pool.TryDeleteKvEntry(kvAddr, kv.Key)
+		if err != nil {
+			t.Fatalf("error deleting kv: %s", err)
+		}
+		assert.Equal(t, uint64(kv.Size), pool.DeadBytes())
+	})
+}
+
+func TestBufferPool_KeyCount(t *testing.T) {
+	fileName := "testdb_pool.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("KeyCountCountsOnlyLiveKeysAndIsKeptInTheHeader", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		kv1 := values.NewKeyValueEntry([]byte("never"), []byte("bar"), 0)
+		kv2 := values.NewKeyValueEntry([]byte("foo"), []byte("baracuda"), 0)
+		expired := values.NewKeyValueEntry([]byte("expired"), []byte("bar"), uint64(time.Now().UnixMilli())-1)
+
+		pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+		if err != nil {
+			t.Fatalf("error extracting db file header from file: %s", err)
+		}
+
+		for _, kv := range []*values.KeyValueEntry{kv1, kv2, expired} {
+			insertKeyValueEntry(t, pool, header, kv)
+			err = pool.MarkInserted()
+			if err != nil {
+				t.Fatalf("error marking kv as inserted: %s", err)
+			}
+		}
+		assert.Equal(t, uint64(3), pool.KeyCount())
+
+		// overwriting a live entry leaves the count as is
+		err = pool.MarkOverwritten(getKvAddress(t, pool, header, kv1), kv1.Key)
+		if err != nil {
+			t.Fatalf("error marking kv1 as overwritten: %s", err)
+		}
+		insertKeyValueEntry(t, pool, header, kv1)
+		err = pool.MarkInserted()
+		if err != nil {
+			t.Fatalf("error marking kv1 as inserted: %s", err)
+		}
+		assert.Equal(t, uint64(3), pool.KeyCount())
+
+		for i := 0; i < 2; i++ {
+			_, err = pool.TryDeleteKvEntry(getKvAddress(t, pool, header, kv2), kv2.Key)
+			if err != nil {
+				t.Fatalf("error deleting kv2: %s", err)
+			}
+		}
+		assert.Equal(t, uint64(2), pool.KeyCount())
+
+		_, err = pool.GetValue(getKvAddress(t, pool, header, expired), expired.Key)
+		if err != nil {
+			t.Fatalf("error getting value: %s", err)
+		}
+		assert.Equal(t, uint64(1), pool.KeyCount())
+
+		err = pool.CompactFile(nil, nil)
+		if err != nil {
+			t.Fatalf("error compacting file: %s", err)
+		}
+		assert.Equal(t, uint64(1), pool.KeyCount())
+
+		err = pool.Close()
+		if err != nil {
+			t.Fatalf("error closing pool: %s", err)
+		}
+
+		pool, err = NewBufferPool(nil, fileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		defer func() {
+			_ = pool.Close()
+		}()
+		assert.Equal(t, uint64(1), pool.KeyCount())
+
+		err = pool.ClearFile()
+		if err != nil {
+			t.Fatalf("error clearing file: %s", err)
+		}
+		assert.Equal(t, uint64(0), pool.KeyCount())
+	})
+
+	t.Run("KeyCountIsWorkedOutOnOpenForFilesWithoutIt", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		kv1 := values.NewKeyValueEntry([]byte("never"), []byte("bar"), 0)
+		kv2 := values.NewKeyValueEntry([]byte("foo"), []byte("baracuda"), 0)
+		expired := values.NewKeyValueEntry([]byte("expired"), []byte("bar"), uint64(time.Now().UnixMilli())-1)
+
+		func() {
+			pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+			if err != nil {
+				t.Fatalf("error creating new buffer pool: %s", err)
+			}
+			defer func() {
+				_ = pool.Close()
+			}()
+			header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+			if err != nil {
+				t.Fatalf("error extracting db file header from file: %s", err)
+			}
+
+			// entries inserted without counting them, as in older files
+			for _, kv := range []*values.KeyValueEntry{kv1, kv2, expired} {
+				insertKeyValueEntry(t, pool, header, kv)
+			}
+		}()
+
+		pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		defer func() {
+			_ = pool.Close()
+		}()
+		assert.Equal(t, uint64(2), pool.KeyCount())
+		assert.Equal(t, uint64(expired.Size), pool.DeadBytes())
+	})
+}
+
+func TestBufferPool_KeyExists(t *testing.T) {
+	fileName := "testdb_pool.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	live := values.NewKeyValueEntry([]byte("never"), []byte("bar"), 0)
+	deleted := values.NewKeyValueEntry([]byte("foo"), []byte("baracuda"), 0)
+	expired := values.NewKeyValueEntry([]byte("expired"), []byte("bar"), uint64(time.Now().UnixMilli())-1)
+
+	pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating new buffer pool: %s", err)
+	}
+	defer func() {
+		_ = pool.Close()
+	}()
+	header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+	if err != nil {
+		t.Fatalf("error extracting db file header from file: %s", err)
+	}
+
+	for _, kv := range []*values.KeyValueEntry{live, deleted, expired} {
+		insertKeyValueEntry(t, pool, header, kv)
+	}
+	_, err = pool.TryDeleteKvEntry(getKvAddress(t, pool, header, deleted), deleted.Key)
+	if err != nil {
+		t.Fatalf("error deleting kv: %s", err)
+	}
+
+	type testRecord struct {
+		addr     uint64
+		key      []byte
+		expected bool
+	}
+	testData := []testRecord{
+		{getKvAddress(t, pool, header, live), live.Key, true},
+		{getKvAddress(t, pool, header, live), deleted.Key, false},
+		{getKvAddress(t, pool, header, deleted), deleted.Key, false},
+		{getKvAddress(t, pool, header, expired), expired.Key, false},
+		{0, live.Key, false},
+	}
+
+	for _, record := range testData {
+		got, err := pool.KeyExists(record.addr, record.key)
+		if err != nil {
+			t.Fatalf("error checking if key exists: %s", err)
+		}
+		assert.Equal(t, record.expected, got)
+	}
+
+	t.Run("KeyExistsForAddressBeyondFileReturnsErrCorruptedEntry", func(t *testing.T) {
+		_, err := pool.KeyExists(pool.FileSize, live.Key)
+		assert.Equal(t, errors.NewErrCorruptedEntry(pool.FileSize, nil), err)
+	})
+}
+
+func TestBufferPool_GetKey(t *testing.T) {
+	fileName := "testdb_pool.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	live := values.NewKeyValueEntry([]byte("never"), []byte("bar"), 0)
+	deleted := values.NewKeyValueEntry([]byte("foo"), []byte("baracuda"), 0)
+	expired := values.NewKeyValueEntry([]byte("expired"), []byte("bar"), uint64(time.Now().UnixMilli())-1)
+
+	pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating new buffer pool: %s", err)
+	}
+	defer func() {
+		_ = pool.Close()
+	}()
+	header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+	if err != nil {
+		t.Fatalf("error extracting db file header from file: %s", err)
+	}
+
+	for _, kv := range []*values.KeyValueEntry{live, deleted, expired} {
+		insertKeyValueEntry(t, pool, header, kv)
+	}
+	_, err = pool.TryDeleteKvEntry(getKvAddress(t, pool, header, deleted), deleted.Key)
+	if err != nil {
+		t.Fatalf("error deleting kv: %s", err)
+	}
+
+	type testRecord struct {
+		kv       *values.KeyValueEntry
+		expected []byte
+	}
+	testData := []testRecord{
+		{live, live.Key},
+		{deleted, nil},
+		{expired, nil},
+	}
+
+	for _, record := range testData {
+		got, err := pool.GetKey(getKvAddress(t, pool, header, record.kv))
+		if err != nil {
+			t.Fatalf("error getting key: %s", err)
+		}
+		assert.Equal(t, record.expected, got)
+	}
+}
+
+func TestBufferPool_GetExpiry(t *testing.T) {
+	fileName := "testdb_pool.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	futureExpiry := uint64(time.Now().UnixMilli()) + 3_600_000
+	live := values.NewKeyValueEntry([]byte("never"), []byte("bar"), 0)
+	expiring := values.NewKeyValueEntry([]byte("later"), []byte("bar"), futureExpiry)
+	deleted := values.NewKeyValueEntry([]byte("foo"), []byte("baracuda"), futureExpiry)
+	expired := values.NewKeyValueEntry([]byte("expired"), []byte("bar"), uint64(time.Now().UnixMilli())-1)
+
+	pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating new buffer pool: %s", err)
+	}
+	defer func() {
+		_ = pool.Close()
+	}()
+	header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+	if err != nil {
+		t.Fatalf("error extracting db file header from file: %s", err)
+	}
+
+	for _, kv := range []*values.KeyValueEntry{live, expiring, deleted, expired} {
+		insertKeyValueEntry(t, pool, header, kv)
+	}
+	_, err = pool.TryDeleteKvEntry(getKvAddress(t, pool, header, deleted), deleted.Key)
+	if err != nil {
+		t.Fatalf("error deleting kv: %s", err)
+	}
+
+	type testRecord struct {
+		addr           uint64
+		key            []byte
+		expectedExpiry uint64
+		expectedIsLive bool
+	}
+	testData := []testRecord{
+		{getKvAddress(t, pool, header, live), live.Key, 0, true},
+		{getKvAddress(t, pool, header, expiring), expiring.Key, futureExpiry, true},
+		{getKvAddress(t, pool, header, expiring), live.Key, 0, false},
+		{getKvAddress(t, pool, header, deleted), deleted.Key, 0, false},
+		{getKvAddress(t, pool, header, expired), expired.Key, 0, false},
+		{0, live.Key, 0, false},
+	}
+
+	for _, record := range testData {
+		expiry, isLive, err := pool.GetExpiry(record.addr, record.key)
+		if err != nil {
+			t.Fatalf("error getting expiry: %s", err)
+		}
+		assert.Equal(t, record.expectedExpiry, expiry)
+		assert.Equal(t, record.expectedIsLive, isLive)
+	}
+}
+
+func TestBufferPool_TrySetExpiry(t *testing.T) {
+	fileName := "testdb_pool.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	futureExpiry := uint64(time.Now().UnixMilli()) + 3_600_000
+	kv1 := values.NewKeyValueEntry([]byte("never"), []byte("bar"), 0)
+	kv2 := values.NewKeyValueEntry([]byte("foo"), []byte("baracuda"), futureExpiry)
+
+	pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating new buffer pool: %s", err)
+	}
+	defer func() {
+		_ = pool.Close()
+	}()
+	header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+	if err != nil {
+		t.Fatalf("error extracting db file header from file: %s", err)
+	}
+
+	t.Run("BufferPool_TrySetExpiryUpdatesTheBuffersAndTheFile", func(t *testing.T) {
+		insertKeyValueEntry(t, pool, header, kv1)
+		insertKeyValueEntry(t, pool, header, kv2)
+		kv1Addr := getKvAddress(t, pool, header, kv1)
+		kv2Addr := getKvAddress(t, pool, header, kv2)
+
+		isSetForKv1AddrAndKv2Key, err := pool.TrySetExpiry(kv1Addr, kv2.Key, futureExpiry)
+		if err != nil {
+			t.Fatalf("error trying to set expiry of kv1 with kv2 key: %s", err)
+		}
+		isSetForKv1, err := pool.TrySetExpiry(kv1Addr, kv1.Key, futureExpiry)
+		if err != nil {
+			t.Fatalf("error trying to set expiry of kv1: %s", err)
+		}
+		isSetForKv2, err := pool.TrySetExpiry(kv2Addr, kv2.Key, 0)
+		if err != nil {
+			t.Fatalf("error trying to set expiry of kv2: %s", err)
+		}
+
+		assert.False(t, isSetForKv1AddrAndKv2Key)
+		assert.True(t, isSetForKv1)
+		assert.True(t, isSetForKv2)
+
+		for _, useBuffers := range []bool{true, false} {
+			if !useBuffers {
+				pool.kvBuffers = pool.kvBuffers[:0]
+			}
+
+			kv1Value, err := pool.GetValue(kv1Addr, kv1.Key)
+			if err != nil {
+				t.Fatalf("error getting value for kv1: %s", err)
+			}
+			kv2Value, err := pool.GetValue(kv2Addr, kv2.Key)
+			if err != nil {
+				t.Fatalf("error getting value for kv2: %s", err)
+			}
+
+			assert.Equal(t, futureExpiry, kv1Value.Expiry)
+			assert.Equal(t, uint64(0), kv2Value.Expiry)
+			assert.Equal(t, kv1.Value, kv1Value.Value)
+		}
+	})
+
+	t.Run("BufferPool_TrySetExpiryForDeletedOrExpiredEntryReturnsFalse", func(t *testing.T) {
+		expired := values.NewKeyValueEntry([]byte("expired"), []byte("bar"), uint64(time.Now().UnixMilli())-1)
+		insertKeyValueEntry(t, pool, header, kv1)
+		insertKeyValueEntry(t, pool, header, expired)
+		kv1Addr := getKvAddress(t, pool, header, kv1)
+		_, err = pool.TryDeleteKvEntry(kv1Addr, kv1.Key)
+		if err != nil {
+			t.Fatalf("error deleting kv: %s", err)
+		}
+
+		isSetForDeleted, err := pool.TrySetExpiry(kv1Addr, kv1.Key, 0)
+		if err != nil {
+			t.Fatalf("error trying to set expiry of deleted kv: %s", err)
+		}
+		isSetForExpired, err := pool.TrySetExpiry(getKvAddress(t, pool, header, expired), expired.Key, 0)
+		if err != nil {
+			t.Fatalf("error trying to set expiry of expired kv: %s", err)
+		}
+
+		assert.False(t, isSetForDeleted)
+		assert.False(t, isSetForExpired)
+	})
+}
+
 func TestBufferPool_ReadIndex(t *testing.T) {
 	fileName := "testdb_pool.scdb"
 	defer func() {
@@ -1170,3 +1924,13 @@ func keyValueExists(t *testing.T, data []byte, header *headers.DbFileHeader, kv
 	}
 	return false
 }
+
+// readFile reads all the contents of the file at the given path
+func readFile(t *testing.T, filePath string) []byte {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("error reading file: %s", err)
+	}
+
+	return data
+}
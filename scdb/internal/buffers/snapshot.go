@@ -0,0 +1,441 @@
+package buffers
+
+import (
+	"bytes"
+	"errors"
+	scdbErrs "github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
+	"github.com/sopherapps/go-scdb/scdb/internal/ordered_index"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// flagsSizeInBytes is the size of the part of a key-value entry that is overwritten in place
+// i.e. the isDeleted flag (1 byte) and the expiry (8 bytes)
+const flagsSizeInBytes = 9
+
+// copyChunkSizeInBytes is the size of the chunks in which the file of a snapshot is copied
+const copyChunkSizeInBytes = 1 << 20
+
+// Snapshot is a read-only view of the file of a BufferPool as it was at the time the snapshot was taken.
+//
+// It reads the file through its own handle, so it goes on seeing the old file even after compaction replaces it.
+// Entries appended since the snapshot was taken lie beyond its FileSize and are never pointed to by its index.
+// The rest of the file is only ever overwritten in place by the pool's UpdateIndex, TryDeleteKvEntry,
+// TrySetExpiry and updates of the key count, which save the bytes they overwrite into every snapshot of the file
+// before overwriting them.
+//
+// Entries are live if they were neither deleted nor expired at the time the snapshot was taken.
+type Snapshot struct {
+	pool          *BufferPool
+	file          *os.File
+	formatVersion uint16
+	Header        *headers.DbFileHeader
+	FileSize      uint64
+	KeyCount      uint64
+	// takenAt is the time the snapshot was taken, in milliseconds from unix epoch
+	takenAt uint64
+	// mu guards the saved bytes and the reads from file, so that no read happens between the saving
+	// of some bytes and their being overwritten
+	mu sync.Mutex
+	// overwritten are the bytes of the file overwritten since the snapshot was taken, by their address
+	overwritten map[uint64][]byte
+	isClosed    bool
+}
+
+// NewSnapshot takes a snapshot of the pool's file as it is now.
+//
+// No writes must happen to the pool while it runs. The snapshot must be closed once it is no longer needed
+// so that the pool stops saving the bytes it overwrites into it.
+func (bp *BufferPool) NewSnapshot() (*Snapshot, error) {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	header, err := headers.ExtractDbFileHeaderFromFile(bp.File)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(bp.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	sn := &Snapshot{
+		pool:          bp,
+		file:          file,
+		formatVersion: bp.formatVersion,
+		Header:        header,
+		FileSize:      bp.FileSize,
+		KeyCount:      bp.keyCount,
+		takenAt:       uint64(time.Now().UnixMilli()),
+		overwritten:   make(map[uint64][]byte),
+	}
+	bp.snapshots[sn] = struct{}{}
+
+	return sn, nil
+}
+
+// ReadIndex reads the index entry at the given address as it was when the snapshot was taken
+func (sn *Snapshot) ReadIndex(addr uint64) ([]byte, error) {
+	return sn.ReadIndexEntries(addr, headers.IndexEntrySizeInBytes)
+}
+
+// ReadIndexEntries reads the index entries in the `size` bytes starting at the given address,
+// as they were when the snapshot was taken
+func (sn *Snapshot) ReadIndexEntries(addr uint64, size uint64) ([]byte, error) {
+	err := internal.ValidateBounds(addr, addr+size, headers.HeaderSizeInBytes, sn.Header.KeyValuesStartPoint, "out of index bounds")
+	if err != nil {
+		return nil, err
+	}
+
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	if sn.isClosed {
+		return nil, scdbErrs.NewErrNotSupported("use of a closed snapshot")
+	}
+
+	data := make([]byte, size)
+	_, err = sn.file.ReadAt(data, int64(addr))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if len(sn.overwritten) > 0 {
+		for offset := uint64(0); offset < size; offset += headers.IndexEntrySizeInBytes {
+			if entry, ok := sn.overwritten[addr+offset]; ok {
+				copy(data[offset:], entry)
+			}
+		}
+	}
+
+	return data, nil
+}
+
+// GetValue returns the key-value entry at the given address if it is for the given key, and was live
+// when the snapshot was taken. Otherwise, it returns nil. A nil key matches the key of any entry.
+//
+// An ErrCorruptedEntry is returned if the entry overflows the file, can't be parsed, or its checksum does not
+// match its contents.
+func (sn *Snapshot) GetValue(kvAddress uint64, key []byte) (*values.KeyValueEntry, error) {
+	if kvAddress == 0 {
+		return nil, nil
+	}
+
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	if sn.isClosed {
+		return nil, scdbErrs.NewErrNotSupported("use of a closed snapshot")
+	}
+
+	sizeInBytes := make([]byte, 4)
+	_, err := sn.file.ReadAt(sizeInBytes, int64(kvAddress))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	size, err := internal.Uint32FromByteArray(sizeInBytes)
+	if err != nil || uint64(size) < values.OffsetForKeyInKVArray || kvAddress+uint64(size) > sn.FileSize {
+		return nil, scdbErrs.NewErrCorruptedEntry(kvAddress, key)
+	}
+
+	data := make([]byte, size)
+	_, err = sn.file.ReadAt(data, int64(kvAddress))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	// the flags are not part of the checksum so the entry stays valid
+	keySize, _ := internal.Uint32FromByteArray(data[4:])
+	flagsOffset := values.OffsetForKeyInKVArray + uint64(keySize)
+	if flags, ok := sn.overwritten[kvAddress+flagsOffset]; ok && flagsOffset+flagsSizeInBytes <= uint64(len(data)) {
+		copy(data[flagsOffset:], flags)
+	}
+
+	entry, err := values.ExtractKeyValueEntryFromByteArray(data, 0, sn.formatVersion)
+	if err != nil || !entry.HasValidChecksum() {
+		return nil, scdbErrs.NewErrCorruptedEntry(kvAddress, key)
+	}
+
+	if (key != nil && !bytes.Equal(entry.Key, key)) || entry.IsDeleted {
+		return nil, nil
+	}
+
+	if entry.Expiry != 0 && entry.Expiry < sn.takenAt {
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+// WriteTo writes the whole file, as it was when the snapshot was taken, to `w`.
+// It returns the number of bytes written.
+func (sn *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for start := uint64(0); start < sn.FileSize; start += copyChunkSizeInBytes {
+		end := start + copyChunkSizeInBytes
+		if end > sn.FileSize {
+			end = sn.FileSize
+		}
+
+		chunk, err := sn.readChunk(start, end)
+		if err != nil {
+			return written, err
+		}
+
+		n, err := w.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// CopyTo copies the file, as it was when the snapshot was taken, to a new file at the given path.
+// Any file already at that path is overwritten.
+//
+// If `isCompacted` is true, only the live entries are copied, in the current format, just like in compaction.
+// Otherwise, the file is copied byte for byte.
+// The live entries are also added to `searchIndex` and `orderedIndex`, if they are not nil. They should be empty.
+// The generation of the copy is given to `orderedIndex` so that it is known to be up to date with the copy.
+func (sn *Snapshot) CopyTo(filePath string, isCompacted bool, searchIndex *inverted_index.InvertedIndex, orderedIndex *ordered_index.OrderedIndex) error {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if orderedIndex != nil {
+		err = orderedIndex.SetGeneration(sn.Header.Generation)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !isCompacted {
+		_, err = sn.WriteTo(file)
+		if err != nil {
+			return err
+		}
+
+		err = sn.walkLiveEntries(func(_ uint64, kvAddr uint64, kv *values.KeyValueEntry) error {
+			return addToIndices(kv, kvAddr, searchIndex, orderedIndex)
+		})
+		if err != nil {
+			return err
+		}
+
+		return file.Sync()
+	}
+
+	header := headers.NewDbFileHeader(&sn.Header.MaxKeys, &sn.Header.RedundantBlocks, &sn.Header.BlockSize)
+	header.Generation = sn.Header.Generation
+	fileSize, err := headers.InitializeFile(file, header)
+	if err != nil {
+		return err
+	}
+
+	// every key keeps its index slot, since the number of items per index block is the same
+	newFileSize := uint64(fileSize)
+	keyCount := uint64(0)
+	err = sn.walkLiveEntries(func(indexAddr uint64, _ uint64, kv *values.KeyValueEntry) error {
+		kvByteArray := values.NewKeyValueEntry(kv.Key, kv.Value, kv.Expiry).AsBytes()
+		newKvAddr := newFileSize
+		_, err := file.WriteAt(kvByteArray, int64(newKvAddr))
+		if err != nil {
+			return err
+		}
+
+		_, err = file.WriteAt(internal.Uint64ToByteArray(newKvAddr), int64(indexAddr))
+		if err != nil {
+			return err
+		}
+
+		newFileSize += uint64(len(kvByteArray))
+		keyCount++
+		return addToIndices(kv, newKvAddr, searchIndex, orderedIndex)
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteAt(internal.Uint64ToByteArray(keyCount), int64(headers.KeyCountOffset))
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// Close frees up the snapshot's resources. It is unusable after this. Calling it more than once does nothing.
+func (sn *Snapshot) Close() error {
+	pool := sn.pool
+	pool.mu.Lock()
+	delete(pool.snapshots, sn)
+	pool.mu.Unlock()
+
+	return sn.close()
+}
+
+// close frees up the snapshot's resources without removing it from the pool's snapshots
+func (sn *Snapshot) close() error {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	if sn.isClosed {
+		return nil
+	}
+
+	sn.isClosed = true
+	sn.overwritten = nil
+	return sn.file.Close()
+}
+
+// walkLiveEntries calls `fn` for each index slot that pointed to a live entry when the snapshot was taken,
+// passing it the address of the slot, the address of the entry, and the entry itself
+func (sn *Snapshot) walkLiveEntries(fn func(indexAddr uint64, kvAddr uint64, kv *values.KeyValueEntry) error) error {
+	blockSize := sn.Header.NetBlockSize
+	for block := uint64(0); block < sn.Header.NumberOfIndexBlocks; block++ {
+		blockAddr := headers.HeaderSizeInBytes + block*blockSize
+		indexBlock, err := sn.ReadIndexEntries(blockAddr, blockSize)
+		if err != nil {
+			return err
+		}
+
+		for lwr := uint64(0); lwr < blockSize; lwr += headers.IndexEntrySizeInBytes {
+			kvAddr, err := internal.Uint64FromByteArray(indexBlock[lwr : lwr+headers.IndexEntrySizeInBytes])
+			if err != nil {
+				return err
+			}
+
+			kv, err := sn.GetValue(kvAddr, nil)
+			if err != nil {
+				return err
+			}
+
+			if kv == nil {
+				continue
+			}
+
+			err = fn(blockAddr+lwr, kvAddr, kv)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readChunk reads the bytes of the file from the address `start` up to `end`, as they were when the snapshot
+// was taken
+func (sn *Snapshot) readChunk(start uint64, end uint64) ([]byte, error) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	if sn.isClosed {
+		return nil, scdbErrs.NewErrNotSupported("use of a closed snapshot")
+	}
+
+	data := make([]byte, end-start)
+	_, err := sn.file.ReadAt(data, int64(start))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	for addr, saved := range sn.overwritten {
+		if addr+uint64(len(saved)) <= start || addr >= end {
+			continue
+		}
+
+		if addr >= start {
+			copy(data[addr-start:], saved)
+		} else {
+			copy(data, saved[start-addr:])
+		}
+	}
+
+	return data, nil
+}
+
+// saveIndexEntries saves the index entries in the given range of addresses, as they are about to be overwritten
+func (sn *Snapshot) saveIndexEntries(addr uint64, size uint64) error {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	for entryAddr := addr; entryAddr < addr+size; entryAddr += headers.IndexEntrySizeInBytes {
+		err := sn.save(entryAddr, headers.IndexEntrySizeInBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveFlags saves the isDeleted flag and expiry of the key-value entry for the given key at the given address,
+// as they are about to be overwritten.
+// Entries appended after the snapshot was taken are not saved since the snapshot never reads them.
+func (sn *Snapshot) saveFlags(kvAddress uint64, key []byte) error {
+	if kvAddress >= sn.FileSize {
+		return nil
+	}
+
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	return sn.save(kvAddress+values.OffsetForKeyInKVArray+uint64(len(key)), flagsSizeInBytes)
+}
+
+// saveKeyCount saves the number of keys in the header of the file, as it is about to be overwritten
+func (sn *Snapshot) saveKeyCount() error {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	return sn.save(headers.KeyCountOffset, 8)
+}
+
+// save saves the `size` bytes at the given address, unless they were saved already.
+// The caller must hold the snapshot's lock.
+func (sn *Snapshot) save(addr uint64, size uint64) error {
+	if _, ok := sn.overwritten[addr]; ok || sn.isClosed {
+		return nil
+	}
+
+	data := make([]byte, size)
+	_, err := sn.file.ReadAt(data, int64(addr))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	sn.overwritten[addr] = data
+
+	return nil
+}
+
+// addToIndices adds the given live key-value entry, found at the given address, to the given search
+// and ordered indices, if they are not nil
+func addToIndices(kv *values.KeyValueEntry, kvAddr uint64, searchIndex *inverted_index.InvertedIndex, orderedIndex *ordered_index.OrderedIndex) error {
+	if orderedIndex != nil {
+		err := orderedIndex.Add(kv.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	if searchIndex != nil {
+		return searchIndex.Add(kv.Key, kvAddr, kv.Expiry)
+	}
+
+	return nil
+}
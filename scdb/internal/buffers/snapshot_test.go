@@ -0,0 +1,329 @@
+package buffers
+
+import (
+	"bytes"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBufferPool_NewSnapshot(t *testing.T) {
+	fileName := "testdb_snapshot.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	kv1 := values.NewKeyValueEntry([]byte("never"), []byte("bar"), 0)
+	kv2 := values.NewKeyValueEntry([]byte("foo"), []byte("baracuda"), 0)
+	newKv2 := values.NewKeyValueEntry([]byte("foo"), []byte("bear"), 0)
+	kv3 := values.NewKeyValueEntry([]byte("hey"), []byte("you"), 0)
+
+	t.Run("SnapshotSeesTheIndexAndEntriesAsTheyWereWhenTaken", func(t *testing.T) {
+		pool, header := createPoolWithEntries(t, fileName, kv1, kv2)
+		defer func() {
+			_ = pool.Close()
+			_ = os.Remove(fileName)
+		}()
+		kv1Addr := getKvAddress(t, pool, header, kv1)
+		kv2Addr := getKvAddress(t, pool, header, kv2)
+
+		sn := takeSnapshot(t, pool)
+		defer func() {
+			_ = sn.Close()
+		}()
+
+		_, err := pool.TryDeleteKvEntry(kv1Addr, kv1.Key)
+		if err != nil {
+			t.Fatalf("error deleting kv1: %s", err)
+		}
+		_, err = pool.TrySetExpiry(kv2Addr, kv2.Key, 1)
+		if err != nil {
+			t.Fatalf("error setting expiry of kv2: %s", err)
+		}
+		insertKeyValueEntry(t, pool, header, newKv2)
+		insertKeyValueEntry(t, pool, header, kv3)
+
+		assertSnapshotHasEntry(t, sn, header, kv1, kv1Addr)
+		assertSnapshotHasEntry(t, sn, header, kv2, kv2Addr)
+		assertSnapshotHasNoEntry(t, sn, header, kv3)
+		assert.Equal(t, uint64(2), sn.KeyCount)
+
+		// the pool itself sees the changes
+		v, err := pool.GetValue(kv1Addr, kv1.Key)
+		if err != nil {
+			t.Fatalf("error getting kv1: %s", err)
+		}
+		assert.Nil(t, v)
+	})
+
+	t.Run("SnapshotKeepsTheOldFileAfterCompaction", func(t *testing.T) {
+		pool, header := createPoolWithEntries(t, fileName, kv1, kv2)
+		defer func() {
+			_ = pool.Close()
+			_ = os.Remove(fileName)
+		}()
+		kv1Addr := getKvAddress(t, pool, header, kv1)
+		kv2Addr := getKvAddress(t, pool, header, kv2)
+
+		sn := takeSnapshot(t, pool)
+		defer func() {
+			_ = sn.Close()
+		}()
+
+		_, err := pool.TryDeleteKvEntry(kv1Addr, kv1.Key)
+		if err != nil {
+			t.Fatalf("error deleting kv1: %s", err)
+		}
+		deleteKeyValue(t, pool, header, kv1)
+		insertKeyValueEntry(t, pool, header, newKv2)
+
+		err = pool.CompactFile(nil, nil)
+		if err != nil {
+			t.Fatalf("error compacting file: %s", err)
+		}
+		assert.Empty(t, pool.snapshots)
+
+		assertSnapshotHasEntry(t, sn, header, kv1, kv1Addr)
+		assertSnapshotHasEntry(t, sn, header, kv2, kv2Addr)
+	})
+
+	t.Run("SnapshotKeepsTheOldFileAfterClearFile", func(t *testing.T) {
+		pool, header := createPoolWithEntries(t, fileName, kv1, kv2)
+		defer func() {
+			_ = pool.Close()
+			_ = os.Remove(fileName)
+		}()
+		kv1Addr := getKvAddress(t, pool, header, kv1)
+		kv2Addr := getKvAddress(t, pool, header, kv2)
+
+		sn := takeSnapshot(t, pool)
+		defer func() {
+			_ = sn.Close()
+		}()
+
+		err := pool.ClearFile()
+		if err != nil {
+			t.Fatalf("error clearing file: %s", err)
+		}
+		assert.Empty(t, pool.snapshots)
+		assert.Equal(t, uint64(0), pool.KeyCount())
+		assert.Equal(t, pool.keyValuesStartPoint, getActualFileSize(t, fileName))
+
+		assertSnapshotHasEntry(t, sn, header, kv1, kv1Addr)
+		assertSnapshotHasEntry(t, sn, header, kv2, kv2Addr)
+
+		// the cleared file can still be written to
+		insertKeyValueEntry(t, pool, header, kv3)
+		kv3Addr := getKvAddress(t, pool, header, kv3)
+		v, err := pool.GetValue(kv3Addr, kv3.Key)
+		if err != nil {
+			t.Fatalf("error getting kv3: %s", err)
+		}
+		assert.Equal(t, kv3, v)
+	})
+
+	t.Run("SnapshotTreatsEntriesExpiredWhenTakenAsMissing", func(t *testing.T) {
+		expiredKv := values.NewKeyValueEntry([]byte("gone"), []byte("soon"), uint64(time.Now().Add(-time.Second).UnixMilli()))
+		pool, header := createPoolWithEntries(t, fileName, kv1, expiredKv)
+		defer func() {
+			_ = pool.Close()
+			_ = os.Remove(fileName)
+		}()
+
+		sn := takeSnapshot(t, pool)
+		defer func() {
+			_ = sn.Close()
+		}()
+
+		v, err := sn.GetValue(getKvAddress(t, pool, header, expiredKv), expiredKv.Key)
+		if err != nil {
+			t.Fatalf("error getting expired entry: %s", err)
+		}
+		assert.Nil(t, v)
+		assertSnapshotHasEntry(t, sn, header, kv1, getKvAddress(t, pool, header, kv1))
+	})
+
+	t.Run("SnapshotWriteToWritesTheFileAsItWasWhenTaken", func(t *testing.T) {
+		pool, header := createPoolWithEntries(t, fileName, kv1, kv2)
+		defer func() {
+			_ = pool.Close()
+			_ = os.Remove(fileName)
+		}()
+		kv1Addr := getKvAddress(t, pool, header, kv1)
+		kv2Addr := getKvAddress(t, pool, header, kv2)
+		initialContents := readFile(t, fileName)
+
+		sn := takeSnapshot(t, pool)
+		defer func() {
+			_ = sn.Close()
+		}()
+
+		_, err := pool.TryDeleteKvEntry(kv1Addr, kv1.Key)
+		if err != nil {
+			t.Fatalf("error deleting kv1: %s", err)
+		}
+		_, err = pool.TrySetExpiry(kv2Addr, kv2.Key, 1)
+		if err != nil {
+			t.Fatalf("error setting expiry of kv2: %s", err)
+		}
+		insertKeyValueEntry(t, pool, header, kv3)
+		err = pool.MarkInserted()
+		if err != nil {
+			t.Fatalf("error marking kv3 as inserted: %s", err)
+		}
+
+		buf := bytes.Buffer{}
+		n, err := sn.WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("error writing snapshot: %s", err)
+		}
+		assert.Equal(t, int64(len(initialContents)), n)
+		assert.Equal(t, initialContents, buf.Bytes())
+	})
+
+	t.Run("SnapshotCopyToWithCompactionCopiesOnlyTheLiveEntries", func(t *testing.T) {
+		copyFileName := "testdb_snapshot_copy.scdb"
+		pool, header := createPoolWithEntries(t, fileName, kv1, kv2)
+		defer func() {
+			_ = pool.Close()
+			_ = os.Remove(fileName)
+			_ = os.Remove(copyFileName)
+		}()
+		kv1Addr := getKvAddress(t, pool, header, kv1)
+		_, err := pool.TryDeleteKvEntry(kv1Addr, kv1.Key)
+		if err != nil {
+			t.Fatalf("error deleting kv1: %s", err)
+		}
+
+		sn := takeSnapshot(t, pool)
+		defer func() {
+			_ = sn.Close()
+		}()
+		insertKeyValueEntry(t, pool, header, kv3)
+
+		err = sn.CopyTo(copyFileName, true, nil, nil)
+		if err != nil {
+			t.Fatalf("error copying snapshot: %s", err)
+		}
+
+		copied, err := NewBufferPool(nil, copyFileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error opening copy: %s", err)
+		}
+		defer func() {
+			_ = copied.Close()
+		}()
+
+		assert.Equal(t, uint64(1), copied.KeyCount())
+		assert.Equal(t, header.KeyValuesStartPoint+uint64(len(kv2.AsBytes())), copied.FileSize)
+		v, err := copied.GetValue(getKvAddress(t, copied, header, kv2), kv2.Key)
+		if err != nil {
+			t.Fatalf("error getting kv2: %s", err)
+		}
+		assert.Equal(t, kv2, v)
+		assert.Equal(t, uint64(0), getKvAddress(t, copied, header, kv1))
+		assert.Equal(t, uint64(0), getKvAddress(t, copied, header, kv3))
+	})
+
+	t.Run("ClosedSnapshotCanNotBeUsedAndIsNoLongerTracked", func(t *testing.T) {
+		pool, header := createPoolWithEntries(t, fileName, kv1)
+		defer func() {
+			_ = pool.Close()
+			_ = os.Remove(fileName)
+		}()
+
+		sn := takeSnapshot(t, pool)
+		err := sn.Close()
+		if err != nil {
+			t.Fatalf("error closing snapshot: %s", err)
+		}
+		// closing again does nothing
+		assert.Nil(t, sn.Close())
+		assert.Empty(t, pool.snapshots)
+
+		_, err = sn.ReadIndex(headers.GetIndexOffset(header, kv1.Key))
+		assert.Equal(t, errors.NewErrNotSupported("use of a closed snapshot"), err)
+		_, err = sn.GetValue(getKvAddress(t, pool, header, kv1), kv1.Key)
+		assert.Equal(t, errors.NewErrNotSupported("use of a closed snapshot"), err)
+	})
+
+	t.Run("ClosingThePoolClosesItsSnapshots", func(t *testing.T) {
+		pool, header := createPoolWithEntries(t, fileName, kv1)
+		defer func() {
+			_ = os.Remove(fileName)
+		}()
+		kv1Addr := getKvAddress(t, pool, header, kv1)
+
+		sn := takeSnapshot(t, pool)
+		err := pool.Close()
+		if err != nil {
+			t.Fatalf("error closing pool: %s", err)
+		}
+
+		_, err = sn.GetValue(kv1Addr, kv1.Key)
+		assert.Equal(t, errors.NewErrNotSupported("use of a closed snapshot"), err)
+		assert.Nil(t, sn.Close())
+	})
+}
+
+// createPoolWithEntries creates a new buffer pool for the given file, with the given key-value entries in it
+func createPoolWithEntries(t *testing.T, filePath string, kvs ...*values.KeyValueEntry) (*BufferPool, *headers.DbFileHeader) {
+	pool, err := NewBufferPool(nil, filePath, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating new buffer pool: %s", err)
+	}
+
+	header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+	if err != nil {
+		t.Fatalf("error extracting db file header from file: %s", err)
+	}
+
+	for _, kv := range kvs {
+		insertKeyValueEntry(t, pool, header, kv)
+		err = pool.MarkInserted()
+		if err != nil {
+			t.Fatalf("error marking kv as inserted: %s", err)
+		}
+	}
+
+	return pool, header
+}
+
+// takeSnapshot takes a snapshot of the given pool, failing the test if it can't
+func takeSnapshot(t *testing.T, pool *BufferPool) *Snapshot {
+	sn, err := pool.NewSnapshot()
+	if err != nil {
+		t.Fatalf("error taking snapshot: %s", err)
+	}
+
+	return sn
+}
+
+// assertSnapshotHasEntry asserts that the index of the snapshot points to the given key-value entry at the given address
+func assertSnapshotHasEntry(t *testing.T, sn *Snapshot, header *headers.DbFileHeader, kv *values.KeyValueEntry, kvAddr uint64) {
+	idx, err := sn.ReadIndex(headers.GetIndexOffset(header, kv.Key))
+	if err != nil {
+		t.Fatalf("error reading index: %s", err)
+	}
+	assert.Equal(t, internal.Uint64ToByteArray(kvAddr), idx)
+
+	v, err := sn.GetValue(kvAddr, kv.Key)
+	if err != nil {
+		t.Fatalf("error getting value: %s", err)
+	}
+	assert.Equal(t, kv, v)
+}
+
+// assertSnapshotHasNoEntry asserts that the index slot of the given key-value entry is empty in the snapshot
+func assertSnapshotHasNoEntry(t *testing.T, sn *Snapshot, header *headers.DbFileHeader, kv *values.KeyValueEntry) {
+	idx, err := sn.ReadIndex(headers.GetIndexOffset(header, kv.Key))
+	if err != nil {
+		t.Fatalf("error reading index: %s", err)
+	}
+	assert.Equal(t, internal.Uint64ToByteArray(0), idx)
+}
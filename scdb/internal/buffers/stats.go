@@ -0,0 +1,86 @@
+package buffers
+
+import (
+	"bytes"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+)
+
+// CacheStats are the numbers of lookups of key-value entries and index entries in the buffers of a BufferPool
+// that found what they looked for (hits) and that had to read the file instead (misses)
+type CacheStats struct {
+	KvHits      uint64
+	KvMisses    uint64
+	IndexHits   uint64
+	IndexMisses uint64
+}
+
+// IndexStats are statistics about the keys in the index of a database file, got by reading every slot of it
+type IndexStats struct {
+	// LiveKeys is the number of keys in the index that are neither deleted nor expired
+	LiveKeys uint64
+	// DeletedKeys is the number of keys in the index that are deleted
+	DeletedKeys uint64
+	// ExpiredKeys is the number of keys in the index that are expired but not deleted
+	ExpiredKeys uint64
+	// LiveBytes is the total size of the key-value entries of the live keys
+	LiveBytes uint64
+	// FilledSlots is the number of filled slots in each block of the index
+	FilledSlots []uint64
+}
+
+// CacheStats returns the numbers of lookups in the buffers of the pool since it was created
+func (bp *BufferPool) CacheStats() CacheStats {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
+	return bp.cacheStats
+}
+
+// IndexStats reads every slot of the index of the file, and the key of every entry that the slots point to,
+// returning statistics about them. Expired entries are counted as dead.
+func (bp *BufferPool) IndexStats(header *headers.DbFileHeader) (*IndexStats, error) {
+	stats := &IndexStats{FilledSlots: make([]uint64, header.NumberOfIndexBlocks)}
+	zero := make([]byte, headers.IndexEntrySizeInBytes)
+	for i := int64(0); i < int64(header.NumberOfIndexBlocks); i++ {
+		indexBlock, err := bp.readIndexBlock(i, int64(header.NetBlockSize))
+		if err != nil {
+			return nil, err
+		}
+
+		idxBlockLength := uint64(len(indexBlock))
+		for lwr := uint64(0); lwr < idxBlockLength; lwr += headers.IndexEntrySizeInBytes {
+			addrBytes := indexBlock[lwr : lwr+headers.IndexEntrySizeInBytes]
+			if bytes.Equal(addrBytes, zero) {
+				continue
+			}
+			stats.FilledSlots[i]++
+
+			kvAddress, err := internal.Uint64FromByteArray(addrBytes)
+			if err != nil {
+				return nil, err
+			}
+
+			_, expiry, size, isDeleted, err := bp.readKeyPrefix(kvAddress)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case isDeleted:
+				stats.DeletedKeys++
+			case values.IsExpiryPast(expiry):
+				bp.mu.Lock()
+				bp.countExpired(kvAddress, size)
+				bp.mu.Unlock()
+				stats.ExpiredKeys++
+			default:
+				stats.LiveKeys++
+				stats.LiveBytes += uint64(size)
+			}
+		}
+	}
+
+	return stats, nil
+}
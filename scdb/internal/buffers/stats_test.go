@@ -0,0 +1,93 @@
+package buffers
+
+import (
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBufferPool_CacheStats(t *testing.T) {
+	fileName := "testdb_pool_stats.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("CacheStatsCountsTheHitsAndMissesOfTheKvAndIndexBuffers", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		kv := values.NewKeyValueEntry([]byte("foo"), []byte("bar"), 0)
+		pool, _ := createPoolWithEntries(t, fileName, kv)
+		_ = pool.Close()
+
+		pool, err := NewBufferPool(nil, fileName, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("error creating new buffer pool: %s", err)
+		}
+		defer func() {
+			_ = pool.Close()
+		}()
+		header, err := headers.ExtractDbFileHeaderFromFile(pool.File)
+		if err != nil {
+			t.Fatalf("error extracting db file header from file: %s", err)
+		}
+		assert.Equal(t, CacheStats{}, pool.CacheStats())
+
+		indexAddr := headers.GetIndexOffset(header, kv.Key)
+		kvAddr := getKvAddress(t, pool, header, kv)
+		for i := 0; i < 3; i++ {
+			_, err = pool.ReadIndex(indexAddr)
+			if err != nil {
+				t.Fatalf("error reading index: %s", err)
+			}
+
+			_, err = pool.GetValue(kvAddr, kv.Key)
+			if err != nil {
+				t.Fatalf("error getting value: %s", err)
+			}
+		}
+
+		assert.Equal(t, CacheStats{KvHits: 2, KvMisses: 1, IndexHits: 2, IndexMisses: 1}, pool.CacheStats())
+	})
+}
+
+func TestBufferPool_IndexStats(t *testing.T) {
+	fileName := "testdb_pool_stats.scdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("IndexStatsCountsTheLiveDeletedAndExpiredKeysAndTheFilledSlotsOfEachBlock", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		live := values.NewKeyValueEntry([]byte("foo"), []byte("bar"), 0)
+		deleted := values.NewKeyValueEntry([]byte("hey"), []byte("English"), 0)
+		expired := values.NewKeyValueEntry([]byte("hi"), []byte("English"), uint64(time.Now().UnixMilli())-1)
+		pool, header := createPoolWithEntries(t, fileName, live, deleted, expired)
+		defer func() {
+			_ = pool.Close()
+		}()
+
+		_, err := pool.TryDeleteKvEntry(getKvAddress(t, pool, header, deleted), deleted.Key)
+		if err != nil {
+			t.Fatalf("error deleting entry: %s", err)
+		}
+		initialDeadBytes := pool.DeadBytes()
+
+		got, err := pool.IndexStats(header)
+		if err != nil {
+			t.Fatalf("error getting index stats: %s", err)
+		}
+
+		expectedFilledSlots := make([]uint64, header.NumberOfIndexBlocks)
+		expectedFilledSlots[0] = 3
+		assert.Equal(t, &IndexStats{
+			LiveKeys:    1,
+			DeletedKeys: 1,
+			ExpiredKeys: 1,
+			LiveBytes:   uint64(live.Size),
+			FilledSlots: expectedFilledSlots,
+		}, got)
+		assert.Equal(t, initialDeadBytes+uint64(expired.Size), pool.DeadBytes())
+	})
+}
@@ -4,9 +4,23 @@ import (
 	"fmt"
 	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
 	"os"
 )
 
+// dbFileTitles are the titles of database files, each at the position of the entries' format version it represents
+var dbFileTitles = []string{
+	"Scdb versn 0.001", // values.LegacyFormat
+	"Scdb versn 0.002", // values.ChecksumFormat
+	"Scdb versn 0.003", // values.MillisecondFormat
+}
+
+// KeyCountOffset is the offset of the number of live keys in the header of a database file
+const KeyCountOffset uint64 = 30
+
+// GenerationOffset is the offset of the generation in the header of a database file
+const GenerationOffset uint64 = 38
+
 type DbFileHeader struct {
 	Title               []byte
 	BlockSize           uint32
@@ -16,12 +30,19 @@ type DbFileHeader struct {
 	NumberOfIndexBlocks uint64
 	KeyValuesStartPoint uint64
 	NetBlockSize        uint64
+	FormatVersion       uint16
+	// KeyCount is the number of keys in the file that are neither deleted nor known to be expired
+	KeyCount uint64
+	// Generation is increased every time the file is opened for writing. The ordered index keeps a copy of it
+	// so that an ordered index that missed the writes of a session, in which it was not enabled, can be found out.
+	Generation uint64
 }
 
 // NewDbFileHeader Creates a new DbFileHeader
 func NewDbFileHeader(maxKeys *uint64, redundantBlocks *uint16, blockSize *uint32) *DbFileHeader {
 	header := DbFileHeader{
-		Title: []byte("Scdb versn 0.001"),
+		Title:         []byte(dbFileTitles[values.CurrentFormat]),
+		FormatVersion: values.CurrentFormat,
 	}
 
 	if maxKeys != nil {
@@ -67,12 +88,28 @@ func ExtractDbFileHeaderFromByteArray(data []byte) (*DbFileHeader, error) {
 	if err != nil {
 		return nil, err
 	}
+	keyCount, err := internal.Uint64FromByteArray(data[KeyCountOffset : KeyCountOffset+8])
+	if err != nil {
+		return nil, err
+	}
+	generation, err := internal.Uint64FromByteArray(data[GenerationOffset : GenerationOffset+8])
+	if err != nil {
+		return nil, err
+	}
+
+	formatVersion, err := getFormatVersion(title, dbFileTitles)
+	if err != nil {
+		return nil, err
+	}
 
 	header := DbFileHeader{
 		Title:           title,
 		BlockSize:       blockSize,
 		MaxKeys:         maxKeys,
 		RedundantBlocks: redundantBlocks,
+		FormatVersion:   formatVersion,
+		KeyCount:        keyCount,
+		Generation:      generation,
 	}
 
 	updateDerivedProps(&header)
@@ -96,7 +133,9 @@ func (h *DbFileHeader) AsBytes() []byte {
 		internal.Uint32ToByteArray(h.BlockSize),
 		internal.Uint64ToByteArray(h.MaxKeys),
 		internal.Uint16ToByteArray(h.RedundantBlocks),
-		make([]byte, 70),
+		internal.Uint64ToByteArray(h.KeyCount),
+		internal.Uint64ToByteArray(h.Generation),
+		make([]byte, 54),
 	)
 }
 
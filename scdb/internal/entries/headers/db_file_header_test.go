@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
 	"github.com/stretchr/testify/assert"
 	"math"
 	"os"
@@ -35,9 +36,9 @@ func TestNewDbFileHeader(t *testing.T) {
 func TestExtractDbFileHeaderFromByteArray(t *testing.T) {
 	blockSize := uint32(os.Getpagesize())
 	blockSizeAsBytes := internal.Uint32ToByteArray(blockSize)
-	// title: Scdb versn 0.001
+	// title: Scdb versn 0.003
 	titleBytes := []byte{
-		83, 99, 100, 98, 32, 118, 101, 114, 115, 110, 32, 48, 46, 48, 48, 49,
+		83, 99, 100, 98, 32, 118, 101, 114, 115, 110, 32, 48, 46, 48, 48, 51,
 	}
 	reserveBytes := make([]byte, 70)
 
@@ -104,6 +105,99 @@ func TestExtractDbFileHeaderFromByteArray(t *testing.T) {
 		}
 	})
 
+	t.Run("ExtractDbFileHeaderFromByteArrayReadsTheKeyCount", func(t *testing.T) {
+		data := internal.ConcatByteArrays(
+			titleBytes,
+			blockSizeAsBytes,
+			[]byte{0, 0, 0, 0, 0, 15, 66, 64},
+			[]byte{0, 1},
+			/* key_count 1_000 */
+			[]byte{0, 0, 0, 0, 0, 0, 3, 232},
+			reserveBytes[8:])
+
+		expected := generateHeader(DefaultMaxKeys, DefaultRedundantBlocks, blockSize)
+		expected.KeyCount = 1_000
+
+		got, err := ExtractDbFileHeaderFromByteArray(data)
+		if err != nil {
+			t.Fatalf("error extracting header from byte array: %s", err)
+		}
+
+		assert.Equal(t, expected, got)
+		assert.Equal(t, data, got.AsBytes())
+	})
+
+	t.Run("ExtractDbFileHeaderFromByteArrayReadsTheGeneration", func(t *testing.T) {
+		data := internal.ConcatByteArrays(
+			titleBytes,
+			blockSizeAsBytes,
+			[]byte{0, 0, 0, 0, 0, 15, 66, 64},
+			[]byte{0, 1},
+			/* key_count 0 */
+			[]byte{0, 0, 0, 0, 0, 0, 0, 0},
+			/* generation 7 */
+			[]byte{0, 0, 0, 0, 0, 0, 0, 7},
+			reserveBytes[16:])
+
+		expected := generateHeader(DefaultMaxKeys, DefaultRedundantBlocks, blockSize)
+		expected.Generation = 7
+
+		got, err := ExtractDbFileHeaderFromByteArray(data)
+		if err != nil {
+			t.Fatalf("error extracting header from byte array: %s", err)
+		}
+
+		assert.Equal(t, expected, got)
+		assert.Equal(t, data, got.AsBytes())
+	})
+
+	t.Run("ExtractDbFileHeaderFromByteArrayOfOldTitleSetsItsFormatVersion", func(t *testing.T) {
+		type testRecord struct {
+			title   []byte
+			version uint16
+		}
+		testData := []testRecord{
+			// title: Scdb versn 0.001
+			{[]byte{83, 99, 100, 98, 32, 118, 101, 114, 115, 110, 32, 48, 46, 48, 48, 49}, values.LegacyFormat},
+			// title: Scdb versn 0.002
+			{[]byte{83, 99, 100, 98, 32, 118, 101, 114, 115, 110, 32, 48, 46, 48, 48, 50}, values.ChecksumFormat},
+		}
+
+		for _, record := range testData {
+			data := internal.ConcatByteArrays(
+				record.title,
+				blockSizeAsBytes,
+				[]byte{0, 0, 0, 0, 0, 15, 66, 64},
+				[]byte{0, 1},
+				reserveBytes)
+
+			expected := generateHeader(DefaultMaxKeys, DefaultRedundantBlocks, blockSize)
+			expected.Title = record.title
+			expected.FormatVersion = record.version
+
+			got, err := ExtractDbFileHeaderFromByteArray(data)
+			if err != nil {
+				t.Fatalf("error extracting header from byte array: %s", err)
+			}
+
+			assert.Equal(t, expected, got)
+		}
+	})
+
+	t.Run("ExtractDbFileHeaderFromByteArrayOfUnknownTitleReturnsErrUnsupportedFormat", func(t *testing.T) {
+		title := []byte("Scdb versn 9.999")
+		data := internal.ConcatByteArrays(
+			title,
+			blockSizeAsBytes,
+			[]byte{0, 0, 0, 0, 0, 15, 66, 64},
+			[]byte{0, 1},
+			reserveBytes)
+
+		got, err := ExtractDbFileHeaderFromByteArray(data)
+		assert.Nil(t, got)
+		assert.Equal(t, errors.NewErrUnsupportedFormat(title), err)
+	})
+
 	t.Run("ExtractDbFileHeaderFromByteArrayRaisesEErrOutOfBoundsWhenArrayIsTooShort", func(t *testing.T) {
 		type testRecord struct {
 			data     []byte
@@ -174,9 +268,9 @@ func TestExtractDbFileHeaderFromFile(t *testing.T) {
 	filePath := "testdb.scdb"
 	blockSize := uint32(os.Getpagesize())
 	blockSizeAsBytes := internal.Uint32ToByteArray(blockSize)
-	// title: Scdb versn 0.001
+	// title: Scdb versn 0.003
 	titleBytes := []byte{
-		83, 99, 100, 98, 32, 118, 101, 114, 115, 110, 32, 48, 46, 48, 48, 49,
+		83, 99, 100, 98, 32, 118, 101, 114, 115, 110, 32, 48, 46, 48, 48, 51,
 	}
 	reserveBytes := make([]byte, 70)
 
@@ -336,9 +430,9 @@ func TestExtractDbFileHeaderFromFile(t *testing.T) {
 func TestDbFileHeader_AsBytes(t *testing.T) {
 	blockSize := uint32(os.Getpagesize())
 	blockSizeAsBytes := internal.Uint32ToByteArray(blockSize)
-	// title: Scdb versn 0.001
+	// title: Scdb versn 0.003
 	titleBytes := []byte{
-		83, 99, 100, 98, 32, 118, 101, 114, 115, 110, 32, 48, 46, 48, 48, 49,
+		83, 99, 100, 98, 32, 118, 101, 114, 115, 110, 32, 48, 46, 48, 48, 51,
 	}
 	reserveBytes := make([]byte, 70)
 	type testRecord struct {
@@ -445,7 +539,7 @@ func generateHeader(maxKeys uint64, redundantBlocks uint16, blockSize uint32) *D
 	keyValuesStartPoint := HeaderSizeInBytes + (netBlockSize * numberOfIndexBlocks)
 
 	return &DbFileHeader{
-		Title:               []byte("Scdb versn 0.001"),
+		Title:               []byte("Scdb versn 0.003"),
 		BlockSize:           blockSize,
 		MaxKeys:             maxKeys,
 		RedundantBlocks:     redundantBlocks,
@@ -453,5 +547,6 @@ func generateHeader(maxKeys uint64, redundantBlocks uint16, blockSize uint32) *D
 		NumberOfIndexBlocks: numberOfIndexBlocks,
 		KeyValuesStartPoint: keyValuesStartPoint,
 		NetBlockSize:        netBlockSize,
+		FormatVersion:       values.CurrentFormat,
 	}
 }
@@ -4,11 +4,20 @@ import (
 	"fmt"
 	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
 	"os"
 )
 
 const DefaultMaxIndexKeyLen uint32 = 3
 
+// invertedIndexTitles are the titles of inverted index files, each at the position of the entries' format version
+// it represents
+var invertedIndexTitles = []string{
+	"ScdbIndex v0.001", // values.LegacyFormat
+	"ScdbIndex v0.002", // values.ChecksumFormat
+	"ScdbIndex v0.003", // values.MillisecondFormat
+}
+
 type InvertedIndexHeader struct {
 	Title               []byte
 	BlockSize           uint32
@@ -19,12 +28,14 @@ type InvertedIndexHeader struct {
 	ValuesStartPoint    uint64
 	NetBlockSize        uint64
 	MaxIndexKeyLen      uint32
+	FormatVersion       uint16
 }
 
 // NewInvertedIndexHeader creates a new InvertedIndexHeader
 func NewInvertedIndexHeader(maxKeys *uint64, redundantBlocks *uint16, blockSize *uint32, maxIndexKeyLen *uint32) *InvertedIndexHeader {
 	header := InvertedIndexHeader{
-		Title: []byte("ScdbIndex v0.001"),
+		Title:         []byte(invertedIndexTitles[values.CurrentFormat]),
+		FormatVersion: values.CurrentFormat,
 	}
 
 	if maxIndexKeyLen != nil {
@@ -81,12 +92,18 @@ func ExtractInvertedIndexHeaderFromByteArray(data []byte) (*InvertedIndexHeader,
 		return nil, err
 	}
 
+	formatVersion, err := getFormatVersion(title, invertedIndexTitles)
+	if err != nil {
+		return nil, err
+	}
+
 	header := InvertedIndexHeader{
 		Title:           title,
 		BlockSize:       blockSize,
 		MaxKeys:         maxKeys,
 		RedundantBlocks: redundantBlocks,
 		MaxIndexKeyLen:  maxIndexKeyLen,
+		FormatVersion:   formatVersion,
 	}
 
 	updateDerivedProps(&header)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
 	"github.com/stretchr/testify/assert"
 	"math"
 	"os"
@@ -39,9 +40,9 @@ func TestNewInvertedIndexHeader(t *testing.T) {
 func TestExtractInvertedIndexHeaderFromByteArray(t *testing.T) {
 	blockSize := uint32(os.Getpagesize())
 	blockSizeAsBytes := internal.Uint32ToByteArray(blockSize)
-	// title: ScdbIndex v0.001
+	// title: ScdbIndex v0.003
 	titleBytes := []byte{
-		83, 99, 100, 98, 73, 110, 100, 101, 120, 32, 118, 48, 46, 48, 48, 49,
+		83, 99, 100, 98, 73, 110, 100, 101, 120, 32, 118, 48, 46, 48, 48, 51,
 	}
 	reserveBytes := make([]byte, 66)
 
@@ -116,6 +117,55 @@ func TestExtractInvertedIndexHeaderFromByteArray(t *testing.T) {
 		}
 	})
 
+	t.Run("ExtractInvertedIndexHeaderFromByteArrayOfOldTitleSetsItsFormatVersion", func(t *testing.T) {
+		type testRecord struct {
+			title   []byte
+			version uint16
+		}
+		testData := []testRecord{
+			// title: ScdbIndex v0.001
+			{[]byte{83, 99, 100, 98, 73, 110, 100, 101, 120, 32, 118, 48, 46, 48, 48, 49}, values.LegacyFormat},
+			// title: ScdbIndex v0.002
+			{[]byte{83, 99, 100, 98, 73, 110, 100, 101, 120, 32, 118, 48, 46, 48, 48, 50}, values.ChecksumFormat},
+		}
+
+		for _, record := range testData {
+			data := internal.ConcatByteArrays(
+				record.title,
+				blockSizeAsBytes,
+				[]byte{0, 0, 0, 0, 0, 15, 66, 64},
+				[]byte{0, 1},
+				[]byte{0, 0, 0, 3},
+				reserveBytes)
+
+			expected := generateInvertedIndexHeader(DefaultMaxKeys, DefaultRedundantBlocks, blockSize, 3)
+			expected.Title = record.title
+			expected.FormatVersion = record.version
+
+			got, err := ExtractInvertedIndexHeaderFromByteArray(data)
+			if err != nil {
+				t.Fatalf("error extracting header from byte array: %s", err)
+			}
+
+			assert.Equal(t, expected, got)
+		}
+	})
+
+	t.Run("ExtractInvertedIndexHeaderFromByteArrayOfUnknownTitleReturnsErrUnsupportedFormat", func(t *testing.T) {
+		title := []byte("ScdbIndex v9.999")
+		data := internal.ConcatByteArrays(
+			title,
+			blockSizeAsBytes,
+			[]byte{0, 0, 0, 0, 0, 15, 66, 64},
+			[]byte{0, 1},
+			[]byte{0, 0, 0, 3},
+			reserveBytes)
+
+		got, err := ExtractInvertedIndexHeaderFromByteArray(data)
+		assert.Nil(t, got)
+		assert.Equal(t, errors.NewErrUnsupportedFormat(title), err)
+	})
+
 	t.Run("ExtractInvertedIndexHeaderFromByteArrayRaisesEErrOutOfBoundsWhenArrayIsTooShort", func(t *testing.T) {
 		type testRecord struct {
 			data     []byte
@@ -202,9 +252,9 @@ func TestExtractInvertedIndexHeaderFromFile(t *testing.T) {
 	filePath := "testdb.scdb"
 	blockSize := uint32(os.Getpagesize())
 	blockSizeAsBytes := internal.Uint32ToByteArray(blockSize)
-	// title: ScdbIndex v0.001
+	// title: ScdbIndex v0.003
 	titleBytes := []byte{
-		83, 99, 100, 98, 73, 110, 100, 101, 120, 32, 118, 48, 46, 48, 48, 49,
+		83, 99, 100, 98, 73, 110, 100, 101, 120, 32, 118, 48, 46, 48, 48, 51,
 	}
 	reserveBytes := make([]byte, 66)
 
@@ -388,9 +438,9 @@ func TestExtractInvertedIndexHeaderFromFile(t *testing.T) {
 func TestInvertedIndexHeader_AsBytes(t *testing.T) {
 	blockSize := uint32(os.Getpagesize())
 	blockSizeAsBytes := internal.Uint32ToByteArray(blockSize)
-	// title: ScdbIndex v0.001
+	// title: ScdbIndex v0.003
 	titleBytes := []byte{
-		83, 99, 100, 98, 73, 110, 100, 101, 120, 32, 118, 48, 46, 48, 48, 49,
+		83, 99, 100, 98, 73, 110, 100, 101, 120, 32, 118, 48, 46, 48, 48, 51,
 	}
 	reserveBytes := make([]byte, 66)
 	type testRecord struct {
@@ -533,7 +583,7 @@ func generateInvertedIndexHeader(maxKeys uint64, redundantBlocks uint16, blockSi
 	valuesStartPoint := HeaderSizeInBytes + (netBlockSize * numberOfIndexBlocks)
 
 	return &InvertedIndexHeader{
-		Title:               []byte("ScdbIndex v0.001"),
+		Title:               []byte("ScdbIndex v0.003"),
 		BlockSize:           blockSize,
 		MaxKeys:             maxKeys,
 		RedundantBlocks:     redundantBlocks,
@@ -542,5 +592,6 @@ func generateInvertedIndexHeader(maxKeys uint64, redundantBlocks uint16, blockSi
 		ValuesStartPoint:    valuesStartPoint,
 		NetBlockSize:        netBlockSize,
 		MaxIndexKeyLen:      maxIndexKeyLen,
+		FormatVersion:       values.CurrentFormat,
 	}
 }
@@ -1,6 +1,7 @@
 package headers
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
@@ -115,6 +116,21 @@ func InitializeFile(file *os.File, header Header) (int64, error) {
 	return finalSize, nil
 }
 
+// getFormatVersion returns the format version of the entries in a file basing on the title in its header.
+// `titles` are the titles of the given kind of file, where the position of each title is its format version.
+//
+// Unknown titles return an ErrUnsupportedFormat, since the file could be of a newer format that
+// this version can't read, and must not be upgraded as if it were of the values.LegacyFormat.
+func getFormatVersion(title []byte, titles []string) (uint16, error) {
+	for version, t := range titles {
+		if bytes.Equal(title, []byte(t)) {
+			return uint16(version), nil
+		}
+	}
+
+	return 0, errors.NewErrUnsupportedFormat(title)
+}
+
 // updateDerivedProps computes the properties that depend on the user-defined/default properties and update them
 // on the header
 func updateDerivedProps(h Header) {
@@ -1,11 +1,15 @@
 package values
 
 import (
+	"fmt"
+	"github.com/cespare/xxhash/v2"
+	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
 	"os"
 )
 
-const InvertedIndexEntryMinSizeInBytes uint32 = 4 + 4 + 1 + 1 + 8 + 8 + 8 + 8
+const InvertedIndexEntryMinSizeInBytes uint32 = 4 + 4 + 1 + 1 + 8 + 8 + 8 + 8 + ChecksumSizeInBytes
+const LegacyInvertedIndexEntryMinSizeInBytes uint32 = 4 + 4 + 1 + 1 + 8 + 8 + 8 + 8
 
 type InvertedIndexEntry struct {
 	Size           uint32
@@ -18,6 +22,7 @@ type InvertedIndexEntry struct {
 	NextOffset     uint64
 	PreviousOffset uint64
 	KvAddress      uint64
+	Checksum       uint64
 }
 
 // NewInvertedIndexEntry creates a new InvertedIndexEntry
@@ -26,7 +31,7 @@ func NewInvertedIndexEntry(indexKey []byte, key []byte, expiry uint64, isRoot bo
 	indexKeySize := uint32(len(indexKey))
 	size := keySize + indexKeySize + InvertedIndexEntryMinSizeInBytes
 
-	return &InvertedIndexEntry{
+	entry := &InvertedIndexEntry{
 		Size:           size,
 		IndexKeySize:   indexKeySize,
 		IndexKey:       indexKey,
@@ -38,10 +43,17 @@ func NewInvertedIndexEntry(indexKey []byte, key []byte, expiry uint64, isRoot bo
 		PreviousOffset: previousOffset,
 		KvAddress:      kvAddr,
 	}
+	entry.Checksum = entry.computeChecksum()
+
+	return entry
 }
 
 // ExtractInvertedIndexEntryFromByteArray extracts the key value entry from the data byte array
-func ExtractInvertedIndexEntryFromByteArray(data []byte, offset uint64) (*InvertedIndexEntry, error) {
+// basing on the given format version of the entry
+//
+// Entries of the LegacyFormat have no checksum stored so it is computed on extraction.
+// The expiry of entries older than the MillisecondFormat is converted to milliseconds.
+func ExtractInvertedIndexEntryFromByteArray(data []byte, offset uint64, version uint16) (*InvertedIndexEntry, error) {
 	dataLength := uint64(len(data))
 	sizeSlice, err := internal.SafeSlice(data, offset, offset+4, dataLength)
 	if err != nil {
@@ -61,13 +73,18 @@ func ExtractInvertedIndexEntryFromByteArray(data []byte, offset uint64) (*Invert
 		return nil, err
 	}
 
+	minSize := getInvertedIndexEntryMinSize(version)
+	if uint64(size) < uint64(indexKeySize)+uint64(minSize) {
+		return nil, errors.NewErrOutOfBounds(fmt.Sprintf("entry size %d is less than the minimum %d for index key size %d", size, indexKeySize+minSize, indexKeySize))
+	}
+
 	indexKeySizeU64 := uint64(indexKeySize)
 	indexKey, err := internal.SafeSlice(data, offset+8, offset+8+indexKeySizeU64, dataLength)
 	if err != nil {
 		return nil, err
 	}
 
-	keySizeU64 := uint64(size - indexKeySize - InvertedIndexEntryMinSizeInBytes)
+	keySizeU64 := uint64(size - indexKeySize - minSize)
 	key, err := internal.SafeSlice(data, offset+8+indexKeySizeU64, offset+8+indexKeySizeU64+keySizeU64, dataLength)
 	if err != nil {
 		return nil, err
@@ -140,6 +157,29 @@ func ExtractInvertedIndexEntryFromByteArray(data []byte, offset uint64) (*Invert
 		KvAddress:      kvAddr,
 	}
 
+	if version == LegacyFormat {
+		entry.Checksum = entry.computeChecksum()
+	} else {
+		checksumStart := offset + indexKeySizeU64 + keySizeU64 + 42
+		checksumSlice, err := internal.SafeSlice(data, checksumStart, checksumStart+uint64(ChecksumSizeInBytes), dataLength)
+		if err != nil {
+			return nil, err
+		}
+		entry.Checksum, err = internal.Uint64FromByteArray(checksumSlice)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if version < MillisecondFormat {
+		// the checksum of older formats was computed over the expiry in seconds
+		isChecksumValid := entry.HasValidChecksum()
+		entry.Expiry = ExpiryInMilliseconds(expiry, version)
+		if isChecksumValid {
+			entry.UpdateChecksum()
+		}
+	}
+
 	return &entry, nil
 }
 
@@ -159,21 +199,61 @@ func (ide *InvertedIndexEntry) AsBytes() []byte {
 		internal.Uint64ToByteArray(ide.NextOffset),
 		internal.Uint64ToByteArray(ide.PreviousOffset),
 		internal.Uint64ToByteArray(ide.KvAddress),
+		internal.Uint64ToByteArray(ide.Checksum),
 	)
 }
 
+// HasValidChecksum checks whether the checksum of the entry matches its contents
+func (ide *InvertedIndexEntry) HasValidChecksum() bool {
+	return ide.Checksum == ide.computeChecksum()
+}
+
 // UpdateNextOffsetOnFile updates the next offset of a given entry on the given file at the given address
+//
+// The whole entry is rewritten since its checksum changes
 func (ide *InvertedIndexEntry) UpdateNextOffsetOnFile(file *os.File, entryAddr uint64, newNextOffset uint64) error {
-	kSize := uint64(ide.Size - ide.IndexKeySize - InvertedIndexEntryMinSizeInBytes)
-	offset := entryAddr + kSize + uint64(ide.IndexKeySize) + 18
-	_, err := file.WriteAt(internal.Uint64ToByteArray(newNextOffset), int64(offset))
+	ide.NextOffset = newNextOffset
+	ide.Checksum = ide.computeChecksum()
+	_, err := file.WriteAt(ide.AsBytes(), int64(entryAddr))
 	return err
 }
 
 // UpdatePreviousOffsetOnFile updates the previous offset of a given entry on the given file at the given address
+//
+// The whole entry is rewritten since its checksum changes
 func (ide *InvertedIndexEntry) UpdatePreviousOffsetOnFile(file *os.File, entryAddr uint64, newPreviousOffset uint64) error {
-	kSize := uint64(ide.Size - ide.IndexKeySize - InvertedIndexEntryMinSizeInBytes)
-	offset := entryAddr + kSize + uint64(ide.IndexKeySize) + 26
-	_, err := file.WriteAt(internal.Uint64ToByteArray(newPreviousOffset), int64(offset))
+	ide.PreviousOffset = newPreviousOffset
+	ide.Checksum = ide.computeChecksum()
+	_, err := file.WriteAt(ide.AsBytes(), int64(entryAddr))
 	return err
 }
+
+// UpdateChecksum recomputes the checksum of the entry after any of its fields has been changed
+func (ide *InvertedIndexEntry) UpdateChecksum() {
+	ide.Checksum = ide.computeChecksum()
+}
+
+// computeChecksum computes the checksum of all the fields of the entry except the checksum itself
+func (ide *InvertedIndexEntry) computeChecksum() uint64 {
+	digest := xxhash.New()
+	_, _ = digest.Write(internal.Uint32ToByteArray(ide.Size))
+	_, _ = digest.Write(internal.Uint32ToByteArray(ide.IndexKeySize))
+	_, _ = digest.Write(ide.IndexKey)
+	_, _ = digest.Write(ide.Key)
+	_, _ = digest.Write(internal.BoolToByteArray(ide.IsDeleted))
+	_, _ = digest.Write(internal.BoolToByteArray(ide.IsRoot))
+	_, _ = digest.Write(internal.Uint64ToByteArray(ide.Expiry))
+	_, _ = digest.Write(internal.Uint64ToByteArray(ide.NextOffset))
+	_, _ = digest.Write(internal.Uint64ToByteArray(ide.PreviousOffset))
+	_, _ = digest.Write(internal.Uint64ToByteArray(ide.KvAddress))
+	return digest.Sum64()
+}
+
+// getInvertedIndexEntryMinSize returns the size of an inverted index entry of the given format,
+// excluding its index key and key
+func getInvertedIndexEntryMinSize(version uint16) uint32 {
+	if version == LegacyFormat {
+		return LegacyInvertedIndexEntryMinSizeInBytes
+	}
+	return InvertedIndexEntryMinSizeInBytes
+}
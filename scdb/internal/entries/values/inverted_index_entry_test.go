@@ -10,6 +10,20 @@ import (
 )
 
 var valuesByteArray = []byte{
+	/* size: 55u32*/ 0, 0, 0, 55,
+	/* index key size: 2u32*/ 0, 0, 0, 2,
+	/* key: fo */ 102, 111,
+	/* key: foo */ 102, 111, 111,
+	/* is_deleted */ 0,
+	/* is_root */ 0,
+	/* expiry 0u64 */ 0, 0, 0, 0, 0, 0, 0, 0,
+	/* next offset 900u64 */ 0, 0, 0, 0, 0, 0, 3, 132,
+	/* previous offset 90u64 */ 0, 0, 0, 0, 0, 0, 0, 90,
+	/* kv_address: 100u64 */ 0, 0, 0, 0, 0, 0, 0, 100,
+	/* checksum */ 226, 79, 115, 71, 211, 137, 209, 50,
+}
+
+var legacyValuesByteArray = []byte{
 	/* size: 47u32*/ 0, 0, 0, 47,
 	/* index key size: 2u32*/ 0, 0, 0, 2,
 	/* key: fo */ 102, 111,
@@ -26,7 +40,7 @@ func TestExtractInvertedIndexEntryFromByteArray(t *testing.T) {
 	entry := NewInvertedIndexEntry([]byte("fo"), []byte("foo"), 0, false, 100, 900, 90)
 
 	t.Run("ExtractInvertedIndexEntryFromByteArrayWorksAsExpected", func(t *testing.T) {
-		got, err := ExtractInvertedIndexEntryFromByteArray(valuesByteArray, 0)
+		got, err := ExtractInvertedIndexEntryFromByteArray(valuesByteArray, 0, CurrentFormat)
 		if err != nil {
 			t.Fatalf("error extracting key value from byte array: %s", err)
 		}
@@ -35,7 +49,7 @@ func TestExtractInvertedIndexEntryFromByteArray(t *testing.T) {
 
 	t.Run("ExtractInvertedIndexEntryFromByteArrayWithOffsetWorksAsExpected", func(t *testing.T) {
 		dataArray := internal.ConcatByteArrays([]byte{89, 78}, valuesByteArray)
-		got, err := ExtractInvertedIndexEntryFromByteArray(dataArray, 2)
+		got, err := ExtractInvertedIndexEntryFromByteArray(dataArray, 2, CurrentFormat)
 		if err != nil {
 			t.Fatalf("error extracting key value from byte array: %s", err)
 		}
@@ -44,10 +58,69 @@ func TestExtractInvertedIndexEntryFromByteArray(t *testing.T) {
 
 	t.Run("ExtractInvertedIndexEntryFromByteArrayWithOutOfBoundsOffsetReturnsErrOutOfBounds", func(t *testing.T) {
 		dataArray := internal.ConcatByteArrays([]byte{89, 78}, valuesByteArray)
-		_, err := ExtractInvertedIndexEntryFromByteArray(dataArray, 4)
+		_, err := ExtractInvertedIndexEntryFromByteArray(dataArray, 4, CurrentFormat)
 		expectedError := errors.NewErrOutOfBounds(fmt.Sprintf("slice %d - %d out of bounds for maxLength %d for data %v", 12, 157307, len(dataArray), dataArray))
 		assert.Equal(t, expectedError, err)
 	})
+
+	t.Run("ExtractInvertedIndexEntryFromByteArrayOfLegacyFormatComputesChecksum", func(t *testing.T) {
+		got, err := ExtractInvertedIndexEntryFromByteArray(legacyValuesByteArray, 0, LegacyFormat)
+		if err != nil {
+			t.Fatalf("error extracting key value from byte array: %s", err)
+		}
+		assert.Equal(t, []byte("foo"), got.Key)
+		assert.Equal(t, uint64(100), got.KvAddress)
+		assert.True(t, got.HasValidChecksum())
+	})
+
+	t.Run("ExtractInvertedIndexEntryFromByteArrayOfOlderFormatsConvertsExpiryToMilliseconds", func(t *testing.T) {
+		// the checksum is computed over the expiry in seconds, as it was in the ChecksumFormat
+		dataArray := NewInvertedIndexEntry([]byte("fo"), []byte("foo"), 1666023836, false, 100, 900, 90).AsBytes()
+		legacyDataArray := make([]byte, len(legacyValuesByteArray))
+		copy(legacyDataArray, legacyValuesByteArray)
+		copy(legacyDataArray[15:23], internal.Uint64ToByteArray(1666023836))
+
+		for version, data := range map[uint16][]byte{ChecksumFormat: dataArray, LegacyFormat: legacyDataArray} {
+			got, err := ExtractInvertedIndexEntryFromByteArray(data, 0, version)
+			if err != nil {
+				t.Fatalf("error extracting key value from byte array: %s", err)
+			}
+			assert.Equal(t, uint64(1666023836000), got.Expiry)
+			assert.True(t, got.HasValidChecksum())
+		}
+
+		// corrupted entries are still reported as such
+		dataArray[10] = 1
+		got, err := ExtractInvertedIndexEntryFromByteArray(dataArray, 0, ChecksumFormat)
+		if err != nil {
+			t.Fatalf("error extracting key value from byte array: %s", err)
+		}
+		assert.False(t, got.HasValidChecksum())
+	})
+}
+
+func TestInvertedIndexEntry_HasValidChecksum(t *testing.T) {
+	t.Run("HasValidChecksumReturnsTrueForUnchangedEntry", func(t *testing.T) {
+		entry, err := ExtractInvertedIndexEntryFromByteArray(valuesByteArray, 0, CurrentFormat)
+		if err != nil {
+			t.Fatalf("error extracting key value from byte array: %s", err)
+		}
+		assert.True(t, entry.HasValidChecksum())
+	})
+
+	t.Run("HasValidChecksumReturnsFalseIfAnyFieldChanged", func(t *testing.T) {
+		for _, idx := range []int{9, 12, 22, 30, 46} {
+			dataArray := make([]byte, len(valuesByteArray))
+			copy(dataArray, valuesByteArray)
+			dataArray[idx] = 1
+
+			entry, err := ExtractInvertedIndexEntryFromByteArray(dataArray, 0, CurrentFormat)
+			if err != nil {
+				t.Fatalf("error extracting key value from byte array: %s", err)
+			}
+			assert.False(t, entry.HasValidChecksum())
+		}
+	})
 }
 
 func TestInvertedIndexEntry_AsBytes(t *testing.T) {
@@ -59,7 +132,7 @@ func TestInvertedIndexEntry_IsExpired(t *testing.T) {
 	neverExpires := NewInvertedIndexEntry([]byte("ne"), []byte("never_expires"), 0, false, 100, 900, 90)
 	// 1666023836 is some past timestamp in October 2022
 	expired := NewInvertedIndexEntry([]byte("exp"), []byte("expires"), 1666023836, false, 100, 900, 90)
-	notExpired := NewInvertedIndexEntry([]byte("no"), []byte("not_expired"), uint64(time.Now().Unix())*2, false, 100, 900, 90)
+	notExpired := NewInvertedIndexEntry([]byte("no"), []byte("not_expired"), uint64(time.Now().UnixMilli())*2, false, 100, 900, 90)
 
 	assert.False(t, IsExpired(neverExpires))
 	assert.False(t, IsExpired(notExpired))
@@ -1,10 +1,14 @@
 package values
 
 import (
+	"fmt"
+	"github.com/cespare/xxhash/v2"
+	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
 )
 
-const KeyValueMinSizeInBytes uint32 = 4 + 4 + 8 + 1
+const KeyValueMinSizeInBytes uint32 = 4 + 4 + 8 + 1 + ChecksumSizeInBytes
+const LegacyKeyValueMinSizeInBytes uint32 = 4 + 4 + 8 + 1
 const OffsetForKeyInKVArray uint64 = 8
 
 type KeyValueEntry struct {
@@ -14,17 +18,18 @@ type KeyValueEntry struct {
 	Expiry    uint64
 	IsDeleted bool
 	Value     []byte
+	Checksum  uint64
 }
 
 // NewKeyValueEntry creates a new KeyValueEntry
 // `key` is the byte array of the key
 // `value` is the byte array of the value
-// `expiry` is the timestamp (in seconds from unix epoch)
+// `expiry` is the timestamp (in milliseconds from unix epoch)
 func NewKeyValueEntry(key []byte, value []byte, expiry uint64) *KeyValueEntry {
 	keySize := uint32(len(key))
 	size := keySize + KeyValueMinSizeInBytes + uint32(len(value))
 
-	return &KeyValueEntry{
+	kv := &KeyValueEntry{
 		Size:      size,
 		KeySize:   keySize,
 		Key:       key,
@@ -32,10 +37,17 @@ func NewKeyValueEntry(key []byte, value []byte, expiry uint64) *KeyValueEntry {
 		IsDeleted: false,
 		Value:     value,
 	}
+	kv.Checksum = kv.computeChecksum()
+
+	return kv
 }
 
 // ExtractKeyValueEntryFromByteArray extracts the key value entry from the data byte array
-func ExtractKeyValueEntryFromByteArray(data []byte, offset uint64) (*KeyValueEntry, error) {
+// basing on the given format version of the entry
+//
+// Entries of the LegacyFormat have no checksum stored so it is computed on extraction.
+// The expiry of entries older than the MillisecondFormat is converted to milliseconds.
+func ExtractKeyValueEntryFromByteArray(data []byte, offset uint64, version uint16) (*KeyValueEntry, error) {
 	dataLength := uint64(len(data))
 	sizeSlice, err := internal.SafeSlice(data, offset, offset+4, dataLength)
 	if err != nil {
@@ -55,6 +67,11 @@ func ExtractKeyValueEntryFromByteArray(data []byte, offset uint64) (*KeyValueEnt
 		return nil, err
 	}
 
+	minSize := getKeyValueMinSize(version)
+	if uint64(size) < uint64(keySize)+uint64(minSize) {
+		return nil, errors.NewErrOutOfBounds(fmt.Sprintf("entry size %d is less than the minimum %d for key size %d", size, keySize+minSize, keySize))
+	}
+
 	kSize := uint64(keySize)
 	key, err := internal.SafeSlice(data, offset+8, offset+8+kSize, dataLength)
 	if err != nil {
@@ -79,7 +96,7 @@ func ExtractKeyValueEntryFromByteArray(data []byte, offset uint64) (*KeyValueEnt
 		return nil, err
 	}
 
-	valueSize := uint64(size - keySize - KeyValueMinSizeInBytes)
+	valueSize := uint64(size - keySize - minSize)
 	value := []byte("")
 	if valueSize > 0 {
 		value, err = internal.SafeSlice(data, offset+kSize+17, offset+kSize+17+valueSize, dataLength)
@@ -92,11 +109,25 @@ func ExtractKeyValueEntryFromByteArray(data []byte, offset uint64) (*KeyValueEnt
 		Size:      size,
 		KeySize:   keySize,
 		Key:       key,
-		Expiry:    expiry,
+		Expiry:    ExpiryInMilliseconds(expiry, version),
 		IsDeleted: isDeleted,
 		Value:     value,
 	}
 
+	if version == LegacyFormat {
+		entry.Checksum = entry.computeChecksum()
+	} else {
+		checksumStart := offset + kSize + 17 + valueSize
+		checksumSlice, err := internal.SafeSlice(data, checksumStart, checksumStart+uint64(ChecksumSizeInBytes), dataLength)
+		if err != nil {
+			return nil, err
+		}
+		entry.Checksum, err = internal.Uint64FromByteArray(checksumSlice)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &entry, nil
 }
 
@@ -109,9 +140,37 @@ func (kv *KeyValueEntry) AsBytes() []byte {
 		internal.BoolToByteArray(kv.IsDeleted),
 		internal.Uint64ToByteArray(kv.Expiry),
 		kv.Value,
+		internal.Uint64ToByteArray(kv.Checksum),
 	)
 }
 
 func (kv *KeyValueEntry) GetExpiry() uint64 {
 	return kv.Expiry
 }
+
+// HasValidChecksum checks whether the checksum of the entry matches its contents.
+//
+// The `IsDeleted` and `Expiry` fields are not part of the checksum since they are updated
+// in place on the file.
+func (kv *KeyValueEntry) HasValidChecksum() bool {
+	return kv.Checksum == kv.computeChecksum()
+}
+
+// computeChecksum computes the checksum of the parts of the entry that never change once it is written
+// i.e. the size, the key size, the key and the value
+func (kv *KeyValueEntry) computeChecksum() uint64 {
+	digest := xxhash.New()
+	_, _ = digest.Write(internal.Uint32ToByteArray(kv.Size))
+	_, _ = digest.Write(internal.Uint32ToByteArray(kv.KeySize))
+	_, _ = digest.Write(kv.Key)
+	_, _ = digest.Write(kv.Value)
+	return digest.Sum64()
+}
+
+// getKeyValueMinSize returns the size of a key-value entry of the given format, excluding its key and value
+func getKeyValueMinSize(version uint16) uint32 {
+	if version == LegacyFormat {
+		return LegacyKeyValueMinSizeInBytes
+	}
+	return KeyValueMinSizeInBytes
+}
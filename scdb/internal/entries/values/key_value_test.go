@@ -10,7 +10,17 @@ import (
 )
 
 var KvDataArray = []byte{
-	/* size: 22u32*/ 0, 0, 0, 23,
+	/* size: 31u32*/ 0, 0, 0, 31,
+	/* key size: 3u32*/ 0, 0, 0, 3,
+	/* key */ 102, 111, 111,
+	/* is_deleted */ 0,
+	/* expiry 0u64 */ 0, 0, 0, 0, 0, 0, 0, 0,
+	/* value */ 98, 97, 114,
+	/* checksum */ 120, 178, 77, 154, 162, 169, 239, 175,
+}
+
+var LegacyKvDataArray = []byte{
+	/* size: 23u32*/ 0, 0, 0, 23,
 	/* key size: 3u32*/ 0, 0, 0, 3,
 	/* key */ 102, 111, 111,
 	/* is_deleted */ 0,
@@ -22,7 +32,7 @@ func TestExtractKeyValueEntryFromByteArray(t *testing.T) {
 	kv := NewKeyValueEntry([]byte("foo"), []byte("bar"), 0)
 
 	t.Run("ExtractKeyValueEntryFromByteArrayWorksAsExpected", func(t *testing.T) {
-		got, err := ExtractKeyValueEntryFromByteArray(KvDataArray, 0)
+		got, err := ExtractKeyValueEntryFromByteArray(KvDataArray, 0, CurrentFormat)
 		if err != nil {
 			t.Fatalf("error extracting key value from byte array: %s", err)
 		}
@@ -31,7 +41,7 @@ func TestExtractKeyValueEntryFromByteArray(t *testing.T) {
 
 	t.Run("ExtractKeyValueEntryFromByteArrayWithOffsetWorksAsExpected", func(t *testing.T) {
 		dataArray := internal.ConcatByteArrays([]byte{89, 78}, KvDataArray)
-		got, err := ExtractKeyValueEntryFromByteArray(dataArray, 2)
+		got, err := ExtractKeyValueEntryFromByteArray(dataArray, 2, CurrentFormat)
 		if err != nil {
 			t.Fatalf("error extracting key value from byte array: %s", err)
 		}
@@ -40,24 +50,105 @@ func TestExtractKeyValueEntryFromByteArray(t *testing.T) {
 
 	t.Run("ExtractKeyValueEntryFromByteArrayWithOutOfBoundsOffsetReturnsErrOutOfBounds", func(t *testing.T) {
 		dataArray := internal.ConcatByteArrays([]byte{89, 78}, KvDataArray)
-		_, err := ExtractKeyValueEntryFromByteArray(dataArray, 4)
+		_, err := ExtractKeyValueEntryFromByteArray(dataArray, 4, CurrentFormat)
 		expectedError := errors.NewErrOutOfBounds(fmt.Sprintf("slice %d - %d out of bounds for maxLength %d for data %v", 12, 222843, len(dataArray), dataArray))
 		assert.Equal(t, expectedError, err)
 	})
 
 	t.Run("ExtractKeyValueEntryFromByteArrayWithValueAsEmptyString", func(t *testing.T) {
 		dataArray := []byte{
-			/* size: 20u32*/ 0, 0, 0, 20 /* key size: 3u32*/, 0, 0, 0, 3,
+			/* size: 28u32*/ 0, 0, 0, 28 /* key size: 3u32*/, 0, 0, 0, 3,
 			/* key */ 102, 111, 111 /* is_deleted */, 0 /* expiry 0u64 */, 0, 0, 0,
 			0, 0, 0, 0, 0, /* value: "" */
+			/* checksum */ 230, 86, 103, 94, 63, 80, 242, 246,
 		}
 		expected := NewKeyValueEntry([]byte("foo"), []byte(""), 0)
-		got, err := ExtractKeyValueEntryFromByteArray(dataArray, 0)
+		got, err := ExtractKeyValueEntryFromByteArray(dataArray, 0, CurrentFormat)
 		if err != nil {
 			t.Fatalf("error extracting key value from byte array: %s", err)
 		}
 		assert.Equal(t, expected, got)
 	})
+
+	t.Run("ExtractKeyValueEntryFromByteArrayOfLegacyFormatComputesChecksum", func(t *testing.T) {
+		got, err := ExtractKeyValueEntryFromByteArray(LegacyKvDataArray, 0, LegacyFormat)
+		if err != nil {
+			t.Fatalf("error extracting key value from byte array: %s", err)
+		}
+		assert.Equal(t, []byte("foo"), got.Key)
+		assert.Equal(t, []byte("bar"), got.Value)
+		assert.True(t, got.HasValidChecksum())
+	})
+
+	t.Run("ExtractKeyValueEntryFromByteArrayOfOlderFormatsConvertsExpiryToMilliseconds", func(t *testing.T) {
+		dataArray := make([]byte, len(KvDataArray))
+		copy(dataArray, KvDataArray)
+		copy(dataArray[12:20], internal.Uint64ToByteArray(1666023836))
+		legacyDataArray := make([]byte, len(LegacyKvDataArray))
+		copy(legacyDataArray, LegacyKvDataArray)
+		copy(legacyDataArray[12:20], internal.Uint64ToByteArray(1666023836))
+
+		for version, data := range map[uint16][]byte{ChecksumFormat: dataArray, LegacyFormat: legacyDataArray} {
+			got, err := ExtractKeyValueEntryFromByteArray(data, 0, version)
+			if err != nil {
+				t.Fatalf("error extracting key value from byte array: %s", err)
+			}
+			assert.Equal(t, uint64(1666023836000), got.Expiry)
+			assert.True(t, got.HasValidChecksum())
+		}
+
+		got, err := ExtractKeyValueEntryFromByteArray(dataArray, 0, MillisecondFormat)
+		if err != nil {
+			t.Fatalf("error extracting key value from byte array: %s", err)
+		}
+		assert.Equal(t, uint64(1666023836), got.Expiry)
+	})
+
+	t.Run("ExtractKeyValueEntryFromByteArrayWithSizeLessThanMinimumReturnsErrOutOfBounds", func(t *testing.T) {
+		dataArray := make([]byte, len(KvDataArray))
+		copy(dataArray, KvDataArray)
+		dataArray[3] = 10
+		_, err := ExtractKeyValueEntryFromByteArray(dataArray, 0, CurrentFormat)
+		expectedError := errors.NewErrOutOfBounds(fmt.Sprintf("entry size %d is less than the minimum %d for key size %d", 10, 28, 3))
+		assert.Equal(t, expectedError, err)
+	})
+}
+
+func TestKeyValueEntry_HasValidChecksum(t *testing.T) {
+	t.Run("HasValidChecksumReturnsTrueForUnchangedEntry", func(t *testing.T) {
+		kv, err := ExtractKeyValueEntryFromByteArray(KvDataArray, 0, CurrentFormat)
+		if err != nil {
+			t.Fatalf("error extracting key value from byte array: %s", err)
+		}
+		assert.True(t, kv.HasValidChecksum())
+	})
+
+	t.Run("HasValidChecksumReturnsFalseIfKeyOrValueChanged", func(t *testing.T) {
+		for _, idx := range []int{9, 22} {
+			dataArray := make([]byte, len(KvDataArray))
+			copy(dataArray, KvDataArray)
+			dataArray[idx] = 0
+
+			kv, err := ExtractKeyValueEntryFromByteArray(dataArray, 0, CurrentFormat)
+			if err != nil {
+				t.Fatalf("error extracting key value from byte array: %s", err)
+			}
+			assert.False(t, kv.HasValidChecksum())
+		}
+	})
+
+	t.Run("HasValidChecksumIgnoresIsDeletedAndExpiry", func(t *testing.T) {
+		dataArray := make([]byte, len(KvDataArray))
+		copy(dataArray, KvDataArray)
+		dataArray[11] = 1
+		dataArray[19] = 56
+
+		kv, err := ExtractKeyValueEntryFromByteArray(dataArray, 0, CurrentFormat)
+		if err != nil {
+			t.Fatalf("error extracting key value from byte array: %s", err)
+		}
+		assert.True(t, kv.HasValidChecksum())
+	})
 }
 
 func TestKeyValueEntry_AsBytes(t *testing.T) {
@@ -69,7 +160,7 @@ func TestKeyValueEntry_IsExpired(t *testing.T) {
 	neverExpires := NewKeyValueEntry([]byte("never_expires"), []byte("bar"), 0)
 	// 1666023836 is some past timestamp in October 2022
 	expired := NewKeyValueEntry([]byte("expires"), []byte("bar"), 1666023836)
-	notExpired := NewKeyValueEntry([]byte("not_expired"), []byte("bar"), uint64(time.Now().Unix())*2)
+	notExpired := NewKeyValueEntry([]byte("not_expired"), []byte("bar"), uint64(time.Now().UnixMilli())*2)
 
 	assert.False(t, IsExpired(neverExpires))
 	assert.False(t, IsExpired(notExpired))
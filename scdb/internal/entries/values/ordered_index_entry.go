@@ -0,0 +1,169 @@
+package values
+
+import (
+	"fmt"
+	"github.com/cespare/xxhash/v2"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+)
+
+// OrderedIndexEntryMinSizeInBytes is the size of an ordered index entry, excluding its key and its next offsets
+const OrderedIndexEntryMinSizeInBytes uint32 = 4 + 4 + 1 + 8 + ChecksumSizeInBytes
+
+// OrderedIndexEntry is a node of the skip list that holds the keys of the ordered index in sorted order.
+//
+// It has a next offset for each level of the skip list that it is part of, and, at the bottom level,
+// a previous offset too so that the keys can be walked through in reverse.
+type OrderedIndexEntry struct {
+	Size           uint32
+	KeySize        uint32
+	Key            []byte
+	Level          uint8
+	PreviousOffset uint64
+	NextOffsets    []uint64
+	Checksum       uint64
+}
+
+// NewOrderedIndexEntry creates a new OrderedIndexEntry that is part of `len(nextOffsets)` levels of the skip list
+func NewOrderedIndexEntry(key []byte, previousOffset uint64, nextOffsets []uint64) *OrderedIndexEntry {
+	keySize := uint32(len(key))
+	level := uint8(len(nextOffsets))
+	size := keySize + uint32(level)*8 + OrderedIndexEntryMinSizeInBytes
+
+	entry := &OrderedIndexEntry{
+		Size:           size,
+		KeySize:        keySize,
+		Key:            key,
+		Level:          level,
+		PreviousOffset: previousOffset,
+		NextOffsets:    nextOffsets,
+	}
+	entry.Checksum = entry.computeChecksum()
+
+	return entry
+}
+
+// ExtractOrderedIndexEntryFromByteArray extracts the ordered index entry from the data byte array
+func ExtractOrderedIndexEntryFromByteArray(data []byte, offset uint64) (*OrderedIndexEntry, error) {
+	dataLength := uint64(len(data))
+	sizeSlice, err := internal.SafeSlice(data, offset, offset+4, dataLength)
+	if err != nil {
+		return nil, err
+	}
+	size, err := internal.Uint32FromByteArray(sizeSlice)
+	if err != nil {
+		return nil, err
+	}
+
+	keySizeSlice, err := internal.SafeSlice(data, offset+4, offset+8, dataLength)
+	if err != nil {
+		return nil, err
+	}
+	keySize, err := internal.Uint32FromByteArray(keySizeSlice)
+	if err != nil {
+		return nil, err
+	}
+
+	keySizeU64 := uint64(keySize)
+	key, err := internal.SafeSlice(data, offset+8, offset+8+keySizeU64, dataLength)
+	if err != nil {
+		return nil, err
+	}
+
+	levelSlice, err := internal.SafeSlice(data, offset+8+keySizeU64, offset+9+keySizeU64, dataLength)
+	if err != nil {
+		return nil, err
+	}
+	level := levelSlice[0]
+
+	expectedSize := uint64(keySize) + uint64(level)*8 + uint64(OrderedIndexEntryMinSizeInBytes)
+	if uint64(size) != expectedSize {
+		return nil, errors.NewErrOutOfBounds(fmt.Sprintf("entry size %d is not the expected %d for key size %d and level %d", size, expectedSize, keySize, level))
+	}
+
+	prevOffsetSlice, err := internal.SafeSlice(data, offset+9+keySizeU64, offset+17+keySizeU64, dataLength)
+	if err != nil {
+		return nil, err
+	}
+	prevOffset, err := internal.Uint64FromByteArray(prevOffsetSlice)
+	if err != nil {
+		return nil, err
+	}
+
+	nextOffsets := make([]uint64, level)
+	nextOffsetsStart := offset + 17 + keySizeU64
+	for i := range nextOffsets {
+		start := nextOffsetsStart + uint64(i)*8
+		nextOffsetSlice, err := internal.SafeSlice(data, start, start+8, dataLength)
+		if err != nil {
+			return nil, err
+		}
+		nextOffsets[i], err = internal.Uint64FromByteArray(nextOffsetSlice)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	checksumStart := nextOffsetsStart + uint64(level)*8
+	checksumSlice, err := internal.SafeSlice(data, checksumStart, checksumStart+uint64(ChecksumSizeInBytes), dataLength)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := internal.Uint64FromByteArray(checksumSlice)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := OrderedIndexEntry{
+		Size:           size,
+		KeySize:        keySize,
+		Key:            key,
+		Level:          level,
+		PreviousOffset: prevOffset,
+		NextOffsets:    nextOffsets,
+		Checksum:       checksum,
+	}
+
+	return &entry, nil
+}
+
+func (oie *OrderedIndexEntry) AsBytes() []byte {
+	nextOffsets := make([][]byte, 0, len(oie.NextOffsets))
+	for _, offset := range oie.NextOffsets {
+		nextOffsets = append(nextOffsets, internal.Uint64ToByteArray(offset))
+	}
+
+	return internal.ConcatByteArrays(
+		internal.Uint32ToByteArray(oie.Size),
+		internal.Uint32ToByteArray(oie.KeySize),
+		oie.Key,
+		[]byte{oie.Level},
+		internal.Uint64ToByteArray(oie.PreviousOffset),
+		internal.ConcatByteArrays(nextOffsets...),
+		internal.Uint64ToByteArray(oie.Checksum),
+	)
+}
+
+// HasValidChecksum checks whether the checksum of the entry matches its contents
+func (oie *OrderedIndexEntry) HasValidChecksum() bool {
+	return oie.Checksum == oie.computeChecksum()
+}
+
+// UpdateChecksum recomputes the checksum of the entry after any of its fields has been changed
+func (oie *OrderedIndexEntry) UpdateChecksum() {
+	oie.Checksum = oie.computeChecksum()
+}
+
+// computeChecksum computes the checksum of all the fields of the entry except the checksum itself
+func (oie *OrderedIndexEntry) computeChecksum() uint64 {
+	digest := xxhash.New()
+	_, _ = digest.Write(internal.Uint32ToByteArray(oie.Size))
+	_, _ = digest.Write(internal.Uint32ToByteArray(oie.KeySize))
+	_, _ = digest.Write(oie.Key)
+	_, _ = digest.Write([]byte{oie.Level})
+	_, _ = digest.Write(internal.Uint64ToByteArray(oie.PreviousOffset))
+	for _, offset := range oie.NextOffsets {
+		_, _ = digest.Write(internal.Uint64ToByteArray(offset))
+	}
+	return digest.Sum64()
+}
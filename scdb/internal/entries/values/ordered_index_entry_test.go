@@ -0,0 +1,78 @@
+package values
+
+import (
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var orderedIndexEntryByteArray = []byte{
+	/* size: 44u32*/ 0, 0, 0, 44,
+	/* key size: 3u32*/ 0, 0, 0, 3,
+	/* key: foo */ 102, 111, 111,
+	/* level: 2u8 */ 2,
+	/* previous offset 90u64 */ 0, 0, 0, 0, 0, 0, 0, 90,
+	/* next offset at level 0: 900u64 */ 0, 0, 0, 0, 0, 0, 3, 132,
+	/* next offset at level 1: 100u64 */ 0, 0, 0, 0, 0, 0, 0, 100,
+	/* checksum */ 167, 57, 214, 224, 133, 76, 189, 221,
+}
+
+func TestExtractOrderedIndexEntryFromByteArray(t *testing.T) {
+	entry := NewOrderedIndexEntry([]byte("foo"), 90, []uint64{900, 100})
+
+	t.Run("ExtractOrderedIndexEntryFromByteArrayWorksAsExpected", func(t *testing.T) {
+		got, err := ExtractOrderedIndexEntryFromByteArray(orderedIndexEntryByteArray, 0)
+		if err != nil {
+			t.Fatalf("error extracting ordered index entry from byte array: %s", err)
+		}
+		assert.Equal(t, entry, got)
+	})
+
+	t.Run("ExtractOrderedIndexEntryFromByteArrayWithOffsetWorksAsExpected", func(t *testing.T) {
+		dataArray := internal.ConcatByteArrays([]byte{89, 78}, orderedIndexEntryByteArray)
+		got, err := ExtractOrderedIndexEntryFromByteArray(dataArray, 2)
+		if err != nil {
+			t.Fatalf("error extracting ordered index entry from byte array: %s", err)
+		}
+		assert.Equal(t, entry, got)
+	})
+
+	t.Run("ExtractOrderedIndexEntryFromByteArrayWithWrongSizeReturnsErrOutOfBounds", func(t *testing.T) {
+		dataArray := make([]byte, len(orderedIndexEntryByteArray))
+		copy(dataArray, orderedIndexEntryByteArray)
+		dataArray[3] = 52
+
+		_, err := ExtractOrderedIndexEntryFromByteArray(dataArray, 0)
+		assert.IsType(t, &errors.ErrOutOfBounds{}, err)
+	})
+}
+
+func TestOrderedIndexEntry_HasValidChecksum(t *testing.T) {
+	t.Run("HasValidChecksumReturnsTrueForUnchangedEntry", func(t *testing.T) {
+		entry, err := ExtractOrderedIndexEntryFromByteArray(orderedIndexEntryByteArray, 0)
+		if err != nil {
+			t.Fatalf("error extracting ordered index entry from byte array: %s", err)
+		}
+		assert.True(t, entry.HasValidChecksum())
+	})
+
+	t.Run("HasValidChecksumReturnsFalseIfAnyFieldChanged", func(t *testing.T) {
+		for _, idx := range []int{9, 19, 27, 35} {
+			dataArray := make([]byte, len(orderedIndexEntryByteArray))
+			copy(dataArray, orderedIndexEntryByteArray)
+			dataArray[idx] = 1
+
+			entry, err := ExtractOrderedIndexEntryFromByteArray(dataArray, 0)
+			if err != nil {
+				t.Fatalf("error extracting ordered index entry from byte array: %s", err)
+			}
+			assert.False(t, entry.HasValidChecksum())
+		}
+	})
+}
+
+func TestOrderedIndexEntry_AsBytes(t *testing.T) {
+	entry := NewOrderedIndexEntry([]byte("foo"), 90, []uint64{900, 100})
+	assert.Equal(t, orderedIndexEntryByteArray, entry.AsBytes())
+}
@@ -2,6 +2,21 @@ package values
 
 import "time"
 
+// LegacyFormat is the format of the entries in files created before entries had checksums
+const LegacyFormat uint16 = 0
+
+// ChecksumFormat is the format of the entries that end with a checksum of their contents
+const ChecksumFormat uint16 = 1
+
+// MillisecondFormat is the format of the entries whose expiry is in milliseconds, instead of seconds, from unix epoch
+const MillisecondFormat uint16 = 2
+
+// CurrentFormat is the format in which all new entries are written
+const CurrentFormat = MillisecondFormat
+
+// ChecksumSizeInBytes is the size of the checksum at the end of each entry
+const ChecksumSizeInBytes uint32 = 8
+
 type ValueEntry interface {
 	// GetExpiry gets the expiry of the value entry
 	GetExpiry() uint64
@@ -13,10 +28,24 @@ type ValueEntry interface {
 // IsExpired returns true if key has lived for longer than its time-to-live
 // It will always return false if time-to-live was never set
 func IsExpired(v ValueEntry) bool {
-	expiry := v.GetExpiry()
+	return IsExpiryPast(v.GetExpiry())
+}
+
+// IsExpiryPast returns true if the given expiry timestamp (in milliseconds from unix epoch) has passed
+// It will always return false if the expiry is 0 i.e. time-to-live was never set
+func IsExpiryPast(expiry uint64) bool {
 	if expiry == 0 {
 		return false
 	} else {
-		return expiry < uint64(time.Now().Unix())
+		return expiry < uint64(time.Now().UnixMilli())
+	}
+}
+
+// ExpiryInMilliseconds converts the expiry timestamp stored in an entry of the given format version
+// to milliseconds from unix epoch. Formats older than MillisecondFormat store it in seconds.
+func ExpiryInMilliseconds(expiry uint64, version uint16) uint64 {
+	if version < MillisecondFormat {
+		return expiry * 1000
 	}
+	return expiry
 }
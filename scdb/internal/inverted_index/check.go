@@ -0,0 +1,179 @@
+package inverted_index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"io"
+	"os"
+)
+
+// CheckFile checks the inverted index file at the given path for corruption, calling `report` with the offset
+// and a description of each problem found. The file is only read.
+//
+// It walks the cyclic doubly-linked list that each index slot points to, looking for a header that can't be read,
+// index slots that point outside the entries, entries that overflow the file or can't be read, entries whose
+// checksum does not match their contents, NextOffset and PreviousOffset fields that don't link up,
+// entries in a list that are not of its index key, and index keys in slots that their hash does not lead to.
+//
+// An error is only returned if the file can't be read at all.
+func CheckFile(filePath string, report func(offset uint64, problem string)) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	fileSize, err := internal.GetFileSize(file)
+	if err != nil {
+		return err
+	}
+
+	header, err := headers.ExtractInvertedIndexHeaderFromFile(file)
+	if err != nil {
+		report(0, fmt.Sprintf("header can't be read: %s", err))
+		return nil
+	}
+
+	if header.BlockSize < uint32(headers.IndexEntrySizeInBytes) || header.MaxKeys == 0 {
+		report(0, fmt.Sprintf("header has a block size of %d and max keys of %d", header.BlockSize, header.MaxKeys))
+		return nil
+	}
+
+	if header.ValuesStartPoint > fileSize {
+		report(0, fmt.Sprintf("file of %d bytes is too small for its index, which ends at %d", fileSize, header.ValuesStartPoint))
+		return nil
+	}
+
+	buf := make([]byte, header.NetBlockSize)
+	for i := uint64(0); i < header.NumberOfIndexBlocks; i++ {
+		blockAddr := headers.HeaderSizeInBytes + i*header.NetBlockSize
+		_, err = file.ReadAt(buf, int64(blockAddr))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		for j := uint64(0); j < header.NetBlockSize; j += headers.IndexEntrySizeInBytes {
+			rootAddr, _ := internal.Uint64FromByteArray(buf[j : j+headers.IndexEntrySizeInBytes])
+			if rootAddr == 0 {
+				continue
+			}
+
+			err = checkList(file, header, fileSize, blockAddr+j, rootAddr, report)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkList checks the cyclic doubly-linked list whose root entry is at `rootAddr`, as pointed to by
+// the index slot at `slotAddr`
+func checkList(file *os.File, header *headers.InvertedIndexHeader, fileSize uint64, slotAddr uint64, rootAddr uint64, report func(offset uint64, problem string)) error {
+	root, problem, err := readEntryToCheck(file, rootAddr, header, fileSize)
+	if err != nil {
+		return err
+	}
+	if problem != "" {
+		report(slotAddr, fmt.Sprintf("index slot points to %d where there is no valid entry: %s", rootAddr, problem))
+		return nil
+	}
+
+	if !root.IsRoot {
+		report(rootAddr, "entry an index slot points to is not marked as the root of its list")
+	}
+
+	initialOffset := headers.GetIndexOffset(header, root.IndexKey)
+	if (slotAddr-headers.HeaderSizeInBytes)%header.NetBlockSize != initialOffset-headers.HeaderSizeInBytes {
+		report(slotAddr, fmt.Sprintf("index key %q is in an index slot its hash does not lead to", root.IndexKey))
+	}
+
+	visited := map[uint64]struct{}{rootAddr: {}}
+	prevAddr := rootAddr
+	prev := root
+	for prev.NextOffset != rootAddr {
+		addr := prev.NextOffset
+		if _, ok := visited[addr]; ok {
+			report(prevAddr, fmt.Sprintf("NextOffset %d loops back into the list for %q before reaching its root", addr, root.IndexKey))
+			return nil
+		}
+		visited[addr] = struct{}{}
+
+		entry, problem, err := readEntryToCheck(file, addr, header, fileSize)
+		if err != nil {
+			return err
+		}
+		if problem != "" {
+			report(prevAddr, fmt.Sprintf("NextOffset points to %d where there is no valid entry: %s", addr, problem))
+			return nil
+		}
+
+		if entry.PreviousOffset != prevAddr {
+			report(addr, fmt.Sprintf("PreviousOffset %d does not point to the previous entry at %d", entry.PreviousOffset, prevAddr))
+		}
+
+		if !bytes.Equal(entry.IndexKey, root.IndexKey) {
+			report(addr, fmt.Sprintf("entry of index key %q is in the list for %q", entry.IndexKey, root.IndexKey))
+		}
+
+		if entry.IsRoot {
+			report(addr, fmt.Sprintf("entry in the middle of the list for %q is marked as its root", root.IndexKey))
+		}
+
+		if entry.IsDeleted {
+			report(addr, fmt.Sprintf("deleted entry of key %q is still in the list for %q", entry.Key, root.IndexKey))
+		}
+
+		prevAddr = addr
+		prev = entry
+	}
+
+	if root.PreviousOffset != prevAddr {
+		report(rootAddr, fmt.Sprintf("PreviousOffset %d of the root does not point to the last entry at %d", root.PreviousOffset, prevAddr))
+	}
+
+	return nil
+}
+
+// readEntryToCheck reads the inverted index entry at the given address, returning a description of the problem
+// with it instead if it is not intact
+func readEntryToCheck(file *os.File, addr uint64, header *headers.InvertedIndexHeader, fileSize uint64) (*values.InvertedIndexEntry, string, error) {
+	if addr < header.ValuesStartPoint || addr+4 > fileSize {
+		return nil, fmt.Sprintf("address is outside the entries, which are from %d to %d", header.ValuesStartPoint, fileSize), nil
+	}
+
+	// the size is checked before reading the entry, as a corrupted one could be huge
+	sizeBuf := make([]byte, 4)
+	_, err := file.ReadAt(sizeBuf, int64(addr))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, "", err
+	}
+
+	size, _ := internal.Uint32FromByteArray(sizeBuf)
+	if addr+uint64(size) > fileSize {
+		return nil, fmt.Sprintf("entry of %d bytes overflows the file of %d bytes", size, fileSize), nil
+	}
+
+	data, err := readEntryBytes(file, addr)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entry, err := values.ExtractInvertedIndexEntryFromByteArray(data, 0, header.FormatVersion)
+	if err != nil {
+		return nil, fmt.Sprintf("entry can't be read: %s", err), nil
+	}
+
+	if !entry.HasValidChecksum() {
+		return nil, fmt.Sprintf("checksum of the entry for key %q does not match its contents", entry.Key), nil
+	}
+
+	return entry, "", nil
+}
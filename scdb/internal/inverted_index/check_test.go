@@ -0,0 +1,162 @@
+package inverted_index
+
+import (
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestCheckFile(t *testing.T) {
+	fileName := "testdb_check.iscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	addParams := []testAddParams{
+		{[]byte("foo"), 20, 0},
+		{[]byte("food"), 60, 0},
+		{[]byte("fore"), 160, 0},
+		{[]byte("bar"), 600, 0},
+	}
+
+	t.Run("CheckFileReportsNoProblemsInAnIntactFile", func(t *testing.T) {
+		idx := createSearchIndex(t, fileName, addParams)
+		removeManyKeys(t, idx, [][]byte{[]byte("foo"), []byte("bar")})
+		_ = idx.Close()
+
+		assert.Empty(t, checkTestFile(t, fileName))
+	})
+
+	t.Run("CheckFileReportsBrokenNextOffsetAndPreviousOffsetChains", func(t *testing.T) {
+		idx := createSearchIndex(t, fileName, addParams)
+		defer func() {
+			_ = idx.Close()
+		}()
+		rootAddr, root := readRootEntry(t, idx, []byte("f"))
+		secondAddr, second := readTestEntry(t, idx, root.NextOffset)
+		thirdAddr, third := readTestEntry(t, idx, second.NextOffset)
+
+		second.PreviousOffset = thirdAddr
+		writeTestEntry(t, idx, secondAddr, second)
+		assert.Equal(t, []uint64{secondAddr}, problemOffsets(checkTestFile(t, fileName)))
+
+		second.PreviousOffset = rootAddr
+		writeTestEntry(t, idx, secondAddr, second)
+		third.NextOffset = secondAddr
+		writeTestEntry(t, idx, thirdAddr, third)
+		problems := checkTestFile(t, fileName)
+		assert.Equal(t, []uint64{thirdAddr}, problemOffsets(problems))
+		assert.Contains(t, problems[0].problem, "loops back")
+	})
+
+	t.Run("CheckFileReportsCorruptedEntriesAndEntriesOfOtherLists", func(t *testing.T) {
+		idx := createSearchIndex(t, fileName, addParams)
+		defer func() {
+			_ = idx.Close()
+		}()
+		rootAddr, root := readRootEntry(t, idx, []byte("fo"))
+		secondAddr, second := readTestEntry(t, idx, root.NextOffset)
+
+		second.IndexKey = []byte("fa")
+		writeTestEntry(t, idx, secondAddr, second)
+		assert.Equal(t, []uint64{secondAddr}, problemOffsets(checkTestFile(t, fileName)))
+
+		_, err := idx.File.WriteAt([]byte("x"), int64(secondAddr+8))
+		if err != nil {
+			t.Fatalf("error writing to file: %s", err)
+		}
+		problems := checkTestFile(t, fileName)
+		assert.Equal(t, []uint64{rootAddr}, problemOffsets(problems))
+		assert.Contains(t, problems[0].problem, "checksum")
+	})
+
+	t.Run("CheckFileReportsIndexKeysInSlotsTheirHashDoesNotLeadTo", func(t *testing.T) {
+		idx := createSearchIndex(t, fileName, addParams)
+		defer func() {
+			_ = idx.Close()
+		}()
+		rootAddr, _ := readRootEntry(t, idx, []byte("b"))
+		slot := headers.GetIndexOffset(idx.header, []byte("b"))
+		otherSlot := slot + idx.header.NetBlockSize
+		_, err := idx.File.WriteAt(internal.Uint64ToByteArray(rootAddr), int64(otherSlot))
+		if err != nil {
+			t.Fatalf("error writing to file: %s", err)
+		}
+		_, err = idx.File.WriteAt(internal.Uint64ToByteArray(rootAddr), int64(otherSlot-headers.IndexEntrySizeInBytes))
+		if err != nil {
+			t.Fatalf("error writing to file: %s", err)
+		}
+
+		assert.Equal(t, []uint64{otherSlot - headers.IndexEntrySizeInBytes}, problemOffsets(checkTestFile(t, fileName)))
+	})
+}
+
+// checkProblem is a problem reported by CheckFile
+type checkProblem struct {
+	offset  uint64
+	problem string
+}
+
+// checkTestFile checks the inverted index file at the given path, returning the problems reported
+func checkTestFile(t *testing.T, filePath string) []checkProblem {
+	problems := make([]checkProblem, 0)
+	err := CheckFile(filePath, func(offset uint64, problem string) {
+		problems = append(problems, checkProblem{offset, problem})
+	})
+	if err != nil {
+		t.Fatalf("error checking file: %s", err)
+	}
+
+	return problems
+}
+
+// problemOffsets returns the offsets of the given problems
+func problemOffsets(problems []checkProblem) []uint64 {
+	offsets := make([]uint64, 0, len(problems))
+	for _, p := range problems {
+		offsets = append(offsets, p.offset)
+	}
+
+	return offsets
+}
+
+// readRootEntry reads the root entry of the list for the given prefix, which must be in the first index block
+func readRootEntry(t *testing.T, idx *InvertedIndex, prefix []byte) (uint64, *values.InvertedIndexEntry) {
+	addr, err := idx.readEntryAddress(headers.GetIndexOffset(idx.header, prefix))
+	if err != nil {
+		t.Fatalf("error reading index: %s", err)
+	}
+
+	rootAddr, err := internal.Uint64FromByteArray(addr)
+	if err != nil {
+		t.Fatalf("error reading index: %s", err)
+	}
+
+	return readTestEntry(t, idx, rootAddr)
+}
+
+// readTestEntry reads the entry at the given address in the inverted index
+func readTestEntry(t *testing.T, idx *InvertedIndex, addr uint64) (uint64, *values.InvertedIndexEntry) {
+	data, err := readEntryBytes(idx.File, addr)
+	if err != nil {
+		t.Fatalf("error reading entry: %s", err)
+	}
+
+	entry, err := idx.extractEntry(data, addr)
+	if err != nil {
+		t.Fatalf("error extracting entry: %s", err)
+	}
+
+	return addr, entry
+}
+
+// writeTestEntry writes the given entry at the given address in the inverted index, with its checksum updated
+func writeTestEntry(t *testing.T, idx *InvertedIndex, addr uint64, entry *values.InvertedIndexEntry) {
+	_, err := writeEntryToFile(idx.File, addr, entry)
+	if err != nil {
+		t.Fatalf("error writing entry: %s", err)
+	}
+}
@@ -29,6 +29,17 @@ type InvertedIndex struct {
 // Since we each db key will be represented in the index a number of `max_index_key_len` times
 // for example the key `food` must have the following index keys: `f`, `fo`, `foo`, `food`.
 func NewInvertedIndex(filePath string, maxIndexKeyLen *uint32, dbMaxKeys *uint64, dbRedundantBlocks *uint16) (*InvertedIndex, error) {
+	return newInvertedIndex(filePath, maxIndexKeyLen, dbMaxKeys, dbRedundantBlocks, false)
+}
+
+// NewReadOnlyInvertedIndex opens the existing Inverted Index at the given path for reading only
+func NewReadOnlyInvertedIndex(filePath string) (*InvertedIndex, error) {
+	return newInvertedIndex(filePath, nil, nil, nil, true)
+}
+
+// newInvertedIndex opens the Inverted Index at the given path, creating it if it does not exist
+// unless `isReadOnly` is true
+func newInvertedIndex(filePath string, maxIndexKeyLen *uint32, dbMaxKeys *uint64, dbRedundantBlocks *uint16, isReadOnly bool) (*InvertedIndex, error) {
 	blockSize := uint32(os.Getpagesize())
 
 	dbFileExists, err := internal.PathExists(filePath)
@@ -37,7 +48,9 @@ func NewInvertedIndex(filePath string, maxIndexKeyLen *uint32, dbMaxKeys *uint64
 	}
 
 	fileOpenFlag := os.O_RDWR
-	if !dbFileExists {
+	if isReadOnly {
+		fileOpenFlag = os.O_RDONLY
+	} else if !dbFileExists {
 		fileOpenFlag = fileOpenFlag | os.O_CREATE
 	}
 
@@ -229,16 +242,85 @@ func (idx *InvertedIndex) Remove(key []byte) error {
 // Clear clears all the data in the search index, except the header, and its original
 // variables
 func (idx *InvertedIndex) Clear() error {
-	header := headers.NewInvertedIndexHeader(&idx.header.MaxKeys, &idx.header.RedundantBlocks, &idx.header.BlockSize, &idx.header.MaxIndexKeyLen)
+	return idx.Resize(idx.header.MaxKeys)
+}
+
+// Resize clears all the data in the search index and re-initializes it to hold `maxKeys` index keys.
+//
+// The entries have to be added afresh as their addresses all depend on the size of the index
+// e.g. by compacting the database file.
+func (idx *InvertedIndex) Resize(maxKeys uint64) error {
+	header := headers.NewInvertedIndexHeader(&maxKeys, &idx.header.RedundantBlocks, &idx.header.BlockSize, &idx.header.MaxIndexKeyLen)
 	fileSize, err := headers.InitializeFile(idx.File, header)
 	if err != nil {
 		return err
 	}
 
 	idx.FileSize = uint64(fileSize)
+	idx.ValuesStartPoint = header.ValuesStartPoint
+	idx.header = header
 	return nil
 }
 
+// NewEmptyCopy creates an empty search index at the given path with the same configuration as this one,
+// except that it holds `maxKeys` index keys. Any file already at that path is overwritten.
+func (idx *InvertedIndex) NewEmptyCopy(filePath string, maxKeys uint64) (*InvertedIndex, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	header := headers.NewInvertedIndexHeader(&maxKeys, &idx.header.RedundantBlocks, &idx.header.BlockSize, &idx.header.MaxIndexKeyLen)
+	fileSize, err := headers.InitializeFile(file, header)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	copied := InvertedIndex{
+		File:             file,
+		FilePath:         filePath,
+		MaxIndexKeyLen:   header.MaxIndexKeyLen,
+		ValuesStartPoint: header.ValuesStartPoint,
+		FileSize:         uint64(fileSize),
+		header:           header,
+	}
+
+	return &copied, nil
+}
+
+// Replace replaces the contents of the search index with those of `other`, moving the file of `other`
+// to the file path of this search index. `other` must not be used after this.
+func (idx *InvertedIndex) Replace(other *InvertedIndex) error {
+	// the rename is atomic so a crash leaves either the old or the new file in place
+	err := os.Rename(other.FilePath, idx.FilePath)
+	if err != nil {
+		return err
+	}
+
+	err = idx.File.Close()
+	if err != nil {
+		return err
+	}
+
+	idx.File = other.File
+	idx.MaxIndexKeyLen = other.MaxIndexKeyLen
+	idx.ValuesStartPoint = other.ValuesStartPoint
+	idx.FileSize = other.FileSize
+	idx.header = other.header
+	return nil
+}
+
+// MaxKeys returns the maximum number of index keys the search index is meant to hold
+func (idx *InvertedIndex) MaxKeys() uint64 {
+	return idx.header.MaxKeys
+}
+
+// FormatVersion returns the format version of the entries in the search index file
+func (idx *InvertedIndex) FormatVersion() uint16 {
+	return idx.header.FormatVersion
+}
+
 // Eq checks if the other InvertedIndex instance equals the current inverted index
 func (idx *InvertedIndex) Eq(other *InvertedIndex) bool {
 	return idx.ValuesStartPoint == other.ValuesStartPoint &&
@@ -270,7 +352,7 @@ func (idx *InvertedIndex) getMatchedKvAddrsForPrefix(term []byte, prefixRootAddr
 			return nil, err
 		}
 
-		entry, err := values.ExtractInvertedIndexEntryFromByteArray(entryBytes, 0)
+		entry, err := idx.extractEntry(entryBytes, addr)
 		if err != nil {
 			return nil, err
 		}
@@ -393,7 +475,7 @@ func (idx *InvertedIndex) upsertEntry(prefix []byte, rootAddr []byte, key []byte
 			return err
 		}
 
-		entry, err := values.ExtractInvertedIndexEntryFromByteArray(entryBytes, 0)
+		entry, err := idx.extractEntry(entryBytes, addr)
 		if err != nil {
 			return err
 		}
@@ -425,7 +507,7 @@ func (idx *InvertedIndex) upsertEntry(prefix []byte, rootAddr []byte, key []byte
 			if err != nil {
 				return err
 			}
-			rootEntry, err := values.ExtractInvertedIndexEntryFromByteArray(rootEntryBytes, 0)
+			rootEntry, err := idx.extractEntry(rootEntryBytes, rootAddrU64)
 			if err != nil {
 				return err
 			}
@@ -465,7 +547,7 @@ func (idx *InvertedIndex) removeKeyForPrefix(indexAddr uint64, rootAddr []byte,
 			return err
 		}
 
-		entry, err := values.ExtractInvertedIndexEntryFromByteArray(entryBytes, 0)
+		entry, err := idx.extractEntry(entryBytes, addr)
 		if err != nil {
 			return err
 		}
@@ -481,7 +563,7 @@ func (idx *InvertedIndex) removeKeyForPrefix(indexAddr uint64, rootAddr []byte,
 					return err
 				}
 
-				nextEntry, err := values.ExtractInvertedIndexEntryFromByteArray(nextEntryBytes, 0)
+				nextEntry, err := idx.extractEntry(nextEntryBytes, nextAddr)
 				if err != nil {
 					return err
 				}
@@ -513,7 +595,7 @@ func (idx *InvertedIndex) removeKeyForPrefix(indexAddr uint64, rootAddr []byte,
 					return err
 				}
 
-				prevEntry, err := values.ExtractInvertedIndexEntryFromByteArray(prevEntryBytes, 0)
+				prevEntry, err := idx.extractEntry(prevEntryBytes, previousAddr)
 				if err != nil {
 					return err
 				}
@@ -561,8 +643,27 @@ func (idx *InvertedIndex) removeKeyForPrefix(indexAddr uint64, rootAddr []byte,
 
 }
 
+// extractEntry extracts the inverted index entry from the byte array read from the file at the given address
+//
+// It returns an ErrCorruptedEntry if the entry can't be parsed or its checksum does not match its contents
+func (idx *InvertedIndex) extractEntry(data []byte, addr uint64) (*values.InvertedIndexEntry, error) {
+	entry, err := values.ExtractInvertedIndexEntryFromByteArray(data, 0, idx.header.FormatVersion)
+	if err != nil {
+		return nil, scdbErrs.NewErrCorruptedEntry(addr, nil)
+	}
+
+	if !entry.HasValidChecksum() {
+		return nil, scdbErrs.NewErrCorruptedEntry(addr, entry.Key)
+	}
+
+	return entry, nil
+}
+
 // writeEntryToFile writes a given entry to the file at the given address, returning the number of bytes written
+//
+// The checksum of the entry is updated first as any of its fields could have changed
 func writeEntryToFile(file *os.File, addr uint64, entry *values.InvertedIndexEntry) (int, error) {
+	entry.UpdateChecksum()
 	entryAsBytes := entry.AsBytes()
 	bytesWritten, err := file.WriteAt(entryAsBytes, int64(addr))
 	if err != nil {
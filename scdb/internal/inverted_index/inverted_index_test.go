@@ -1,6 +1,7 @@
 package inverted_index
 
 import (
+	"github.com/sopherapps/go-scdb/scdb/internal"
 	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
 	"github.com/stretchr/testify/assert"
 	"os"
@@ -131,14 +132,14 @@ func TestNewInvertedIndex(t *testing.T) {
 
 func TestInvertedIndex_Add(t *testing.T) {
 	fileName := "testdb.iscdb"
-	now := uint64(time.Now().Unix())
+	now := uint64(time.Now().UnixMilli())
 
 	addParams := []testAddParams{
 		{[]byte("foo"), 20, 0},
-		{[]byte("food"), 60, now + 3600},
+		{[]byte("food"), 60, now + 3_600_000},
 		{[]byte("fore"), 160, 0},
-		{[]byte("bar"), 600, now - 3600}, // expired
-		{[]byte("bare"), 90, now + 7200},
+		{[]byte("bar"), 600, now - 3_600_000}, // expired
+		{[]byte("bare"), 90, now + 7_200_000},
 		{[]byte("barricade"), 900, 0},
 		{[]byte("pig"), 80, 0},
 	}
@@ -174,9 +175,9 @@ func TestInvertedIndex_Add(t *testing.T) {
 		}()
 
 		updates := []testAddParams{
-			{[]byte("foo"), 20, now - 30},    // expired
-			{[]byte("bare"), 90, now - 7200}, // expired
-			{[]byte("bar"), 500, now + 3600},
+			{[]byte("foo"), 20, now - 30_000},     // expired
+			{[]byte("bare"), 90, now - 7_200_000}, // expired
+			{[]byte("bar"), 500, now + 3_600_000},
 		}
 		table := []testSearchParams{
 			{[]byte("f"), 0, 0, []uint64{60, 160}},
@@ -213,14 +214,14 @@ func TestInvertedIndex_Search(t *testing.T) {
 		_ = os.Remove(fileName)
 	}()
 
-	now := uint64(time.Now().Unix())
+	now := uint64(time.Now().UnixMilli())
 
 	addParams := []testAddParams{
 		{[]byte("foo"), 20, 0},
-		{[]byte("food"), 60, now + 3600},
+		{[]byte("food"), 60, now + 3_600_000},
 		{[]byte("fore"), 160, 0},
-		{[]byte("bar"), 600, now - 3600}, // expired
-		{[]byte("bare"), 90, now + 7200},
+		{[]byte("bar"), 600, now - 3_600_000}, // expired
+		{[]byte("bare"), 90, now + 7_200_000},
 		{[]byte("barricade"), 900, 0},
 		{[]byte("pig"), 80, 0},
 	}
@@ -259,13 +260,13 @@ func TestInvertedIndex_Remove(t *testing.T) {
 		_ = os.Remove(fileName)
 	}()
 
-	now := uint64(time.Now().Unix())
+	now := uint64(time.Now().UnixMilli())
 	addParams := []testAddParams{
 		{[]byte("foo"), 20, 0},
-		{[]byte("food"), 60, now + 3600},
+		{[]byte("food"), 60, now + 3_600_000},
 		{[]byte("fore"), 160, 0},
-		{[]byte("bar"), 600, now - 3500}, // expired
-		{[]byte("bare"), 90, now + 7200},
+		{[]byte("bar"), 600, now - 3_500_000}, // expired
+		{[]byte("bare"), 90, now + 7_200_000},
 		{[]byte("barricade"), 900, 0},
 		{[]byte("pig"), 80, 0},
 	}
@@ -299,13 +300,13 @@ func TestInvertedIndex_Clear(t *testing.T) {
 		_ = os.Remove(fileName)
 	}()
 
-	now := uint64(time.Now().Unix())
+	now := uint64(time.Now().UnixMilli())
 	addParams := []testAddParams{
 		{[]byte("foo"), 20, 0},
-		{[]byte("food"), 60, now + 3600},
+		{[]byte("food"), 60, now + 3_600_000},
 		{[]byte("fore"), 160, 0},
-		{[]byte("bar"), 600, now - 3600}, // expired
-		{[]byte("bare"), 90, now + 7200},
+		{[]byte("bar"), 600, now - 3_600_000}, // expired
+		{[]byte("bare"), 90, now + 7_200_000},
 		{[]byte("barricade"), 900, 0},
 		{[]byte("pig"), 80, 0},
 	}
@@ -336,6 +337,88 @@ func TestInvertedIndex_Clear(t *testing.T) {
 	testSearchResults(t, searchIdx, table)
 }
 
+func TestInvertedIndex_Resize(t *testing.T) {
+	fileName := "testdb.iscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	addParams := []testAddParams{
+		{[]byte("foo"), 20, 0},
+		{[]byte("food"), 60, 0},
+		{[]byte("bar"), 600, 0},
+	}
+
+	searchIdx := createSearchIndex(t, fileName, addParams)
+	maxKeys := searchIdx.MaxKeys() * 2
+	err := searchIdx.Resize(maxKeys)
+	if err != nil {
+		t.Fatalf("error resizing inverted index: %s", err)
+	}
+
+	header, err := headers.ExtractInvertedIndexHeaderFromFile(searchIdx.File)
+	if err != nil {
+		t.Fatalf("error extracting header from file: %s", err)
+	}
+
+	assert.Equal(t, maxKeys, searchIdx.MaxKeys())
+	assert.Equal(t, maxKeys, header.MaxKeys)
+	assert.Equal(t, header.ValuesStartPoint, searchIdx.ValuesStartPoint)
+	assert.Equal(t, header.ValuesStartPoint, searchIdx.FileSize)
+	testSearchResults(t, searchIdx, []testSearchParams{
+		{[]byte("f"), 0, 0, []uint64{}},
+		{[]byte("bar"), 0, 0, []uint64{}},
+	})
+
+	// keys can be added afresh
+	err = searchIdx.Add([]byte("foo"), 20, 0)
+	if err != nil {
+		t.Fatalf("error adding key address: %s", err)
+	}
+	testSearchResults(t, searchIdx, []testSearchParams{{[]byte("fo"), 0, 0, []uint64{20}}})
+}
+
+func TestInvertedIndex_Replace(t *testing.T) {
+	fileName := "testdb.iscdb"
+	copyFileName := "testdb_copy.iscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+		_ = os.Remove(copyFileName)
+	}()
+
+	searchIdx := createSearchIndex(t, fileName, []testAddParams{{[]byte("foo"), 20, 0}})
+	maxKeys := searchIdx.MaxKeys() * 2
+	copied, err := searchIdx.NewEmptyCopy(copyFileName, maxKeys)
+	if err != nil {
+		t.Fatalf("error creating an empty copy of inverted index: %s", err)
+	}
+
+	assert.Equal(t, maxKeys, copied.MaxKeys())
+	assert.Equal(t, searchIdx.MaxIndexKeyLen, copied.MaxIndexKeyLen)
+	testSearchResults(t, copied, []testSearchParams{{[]byte("fo"), 0, 0, []uint64{}}})
+
+	err = copied.Add([]byte("bar"), 60, 0)
+	if err != nil {
+		t.Fatalf("error adding key address: %s", err)
+	}
+
+	err = searchIdx.Replace(copied)
+	if err != nil {
+		t.Fatalf("error replacing inverted index: %s", err)
+	}
+
+	assert.Equal(t, fileName, searchIdx.FilePath)
+	assert.Equal(t, maxKeys, searchIdx.MaxKeys())
+	testSearchResults(t, searchIdx, []testSearchParams{
+		{[]byte("fo"), 0, 0, []uint64{}},
+		{[]byte("ba"), 0, 0, []uint64{60}},
+	})
+
+	exists, err := internal.PathExists(copyFileName)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
 func TestInvertedIndex_Close(t *testing.T) {
 	fileName := "testdb.iscdb"
 	defer func() {
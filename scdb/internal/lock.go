@@ -0,0 +1,65 @@
+package internal
+
+import (
+	goErrors "errors"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"os"
+	"path/filepath"
+)
+
+// errLockHeld is returned by lockFile when a conflicting lock is held on the file
+var errLockHeld = goErrors.New("lock is held")
+
+// FileLock is an advisory lock on a file, held until it is unlocked or the process exits
+//
+// Any number of shared locks can be held on a file at once, but an exclusive lock
+// can only be held when no other lock is. Two locks taken on the same file by one process
+// conflict just like locks taken by two different processes.
+type FileLock struct {
+	file *os.File
+}
+
+// LockFile takes a shared or exclusive lock on the file at the given path.
+// For an exclusive lock, the file is created if it does not exist. For a shared lock, the file is opened
+// for reading only, and so it must exist.
+//
+// It does not wait for other locks to be released. If a conflicting lock is held,
+// an errors.ErrStoreLocked for the folder of the file is returned.
+func LockFile(path string, isShared bool) (*FileLock, error) {
+	fileOpenFlag := os.O_RDWR | os.O_CREATE
+	if isShared {
+		fileOpenFlag = os.O_RDONLY
+	}
+
+	file, err := os.OpenFile(path, fileOpenFlag, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(file, isShared)
+	if err != nil {
+		_ = file.Close()
+		if err == errLockHeld {
+			return nil, errors.NewErrStoreLocked(filepath.Dir(path))
+		}
+		return nil, err
+	}
+
+	return &FileLock{file: file}, nil
+}
+
+// Unlock releases the lock. Calling it more than once, or on a nil FileLock, does nothing.
+func (fl *FileLock) Unlock() error {
+	if fl == nil || fl.file == nil {
+		return nil
+	}
+
+	err := unlockFile(fl.file)
+	if err != nil {
+		return err
+	}
+
+	err = fl.file.Close()
+	fl.file = nil
+	return err
+}
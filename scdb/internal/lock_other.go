@@ -0,0 +1,16 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package internal
+
+import "os"
+
+// lockFile does nothing on platforms without file locks, so the store is not guarded
+// against being opened by more than one process
+func lockFile(_ *os.File, _ bool) error {
+	return nil
+}
+
+// unlockFile does nothing on platforms without file locks
+func unlockFile(_ *os.File) error {
+	return nil
+}
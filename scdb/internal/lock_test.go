@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestLockFile(t *testing.T) {
+	fileName := "testdb.lock"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("ExclusiveLockConflictsWithAnyOtherLock", func(t *testing.T) {
+		for _, isShared := range []bool{false, true} {
+			lock := lockFileOrFail(t, fileName, false)
+
+			_, err := LockFile(fileName, isShared)
+			assert.Equal(t, errors.NewErrStoreLocked("."), err)
+
+			unlockOrFail(t, lock)
+		}
+	})
+
+	t.Run("SharedLocksCanBeHeldTogether", func(t *testing.T) {
+		first := lockFileOrFail(t, fileName, true)
+		second := lockFileOrFail(t, fileName, true)
+
+		_, err := LockFile(fileName, false)
+		assert.Equal(t, errors.NewErrStoreLocked("."), err)
+
+		unlockOrFail(t, first)
+		unlockOrFail(t, second)
+	})
+
+	t.Run("UnlockLetsOtherLocksBeTaken", func(t *testing.T) {
+		lock := lockFileOrFail(t, fileName, false)
+		unlockOrFail(t, lock)
+		// unlocking again does nothing
+		unlockOrFail(t, lock)
+
+		lock = lockFileOrFail(t, fileName, false)
+		unlockOrFail(t, lock)
+	})
+}
+
+// lockFileOrFail locks the file at the given path, failing the test if it can't
+func lockFileOrFail(t *testing.T, path string, isShared bool) *FileLock {
+	lock, err := LockFile(path, isShared)
+	if err != nil {
+		t.Fatalf("error locking file: %s", err)
+	}
+
+	return lock
+}
+
+// unlockOrFail unlocks the given lock, failing the test if it can't
+func unlockOrFail(t *testing.T, lock *FileLock) {
+	err := lock.Unlock()
+	if err != nil {
+		t.Fatalf("error unlocking file: %s", err)
+	}
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package internal
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	// errorLockViolation is the ERROR_LOCK_VIOLATION windows error code
+	errorLockViolation syscall.Errno = 33
+)
+
+// lockFile locks the first byte of the given file, shared or exclusive, without waiting
+func lockFile(file *os.File, isShared bool) error {
+	flags := uint32(lockfileFailImmediately)
+	if !isShared {
+		flags |= lockfileExclusiveLock
+	}
+
+	overlapped := new(syscall.Overlapped)
+	r, _, err := procLockFileEx.Call(file.Fd(), uintptr(flags), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r == 0 {
+		if err == errorLockViolation {
+			return errLockHeld
+		}
+		return err
+	}
+
+	return nil
+}
+
+// unlockFile unlocks the first byte of the given file
+func unlockFile(file *os.File) error {
+	overlapped := new(syscall.Overlapped)
+	r, _, err := procUnlockFileEx.Call(file.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,505 @@
+package ordered_index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	scdbErrs "github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// title is the title in the header of ordered index files
+const title string = "ScdbOrder v0.001"
+
+// maxLevel is the number of levels of the skip list, enough for hundreds of millions of keys
+const maxLevel = 16
+
+// generationOffset is the offset of the generation in the header, just after the title and the maxLevel
+const generationOffset = len(title) + 1
+
+// headAddr is the address of the head entry of the skip list, which holds no key and is part of all levels.
+// The previous offset of the head is the address of the last entry, so that the keys can be walked through
+// in reverse from the end.
+const headAddr = headers.HeaderSizeInBytes
+
+// OrderedIndex is an index of the keys of the store in sorted order, for range scans.
+//
+// The keys are held in a skip list on file, each entry pointing to the next entry at each level it is part of.
+// The skip list holds only the keys, not their values or addresses in the database file, so it does not change
+// when the key-value pairs are updated.
+type OrderedIndex struct {
+	File     *os.File
+	FilePath string
+	FileSize uint64
+	// Generation is the generation of the database file that the index was last kept up to date with.
+	// See headers.DbFileHeader.Generation.
+	Generation uint64
+	rand       *rand.Rand
+}
+
+// node is an entry of the skip list, together with its address in the file
+type node struct {
+	addr  uint64
+	entry *values.OrderedIndexEntry
+}
+
+// NewOrderedIndex opens the ordered index at the given path, creating it if it does not exist
+func NewOrderedIndex(filePath string) (*OrderedIndex, error) {
+	return newOrderedIndex(filePath, false)
+}
+
+// NewReadOnlyOrderedIndex opens the existing ordered index at the given path for reading only
+func NewReadOnlyOrderedIndex(filePath string) (*OrderedIndex, error) {
+	return newOrderedIndex(filePath, true)
+}
+
+// newOrderedIndex opens the ordered index at the given path, creating it if it does not exist
+// unless `isReadOnly` is true
+func newOrderedIndex(filePath string, isReadOnly bool) (*OrderedIndex, error) {
+	fileExists, err := internal.PathExists(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	fileOpenFlag := os.O_RDWR
+	if isReadOnly {
+		fileOpenFlag = os.O_RDONLY
+	} else if !fileExists {
+		fileOpenFlag = fileOpenFlag | os.O_CREATE
+	}
+
+	file, err := os.OpenFile(filePath, fileOpenFlag, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &OrderedIndex{
+		File:     file,
+		FilePath: filePath,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	if !fileExists {
+		err = idx.Clear()
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+
+		return idx, nil
+	}
+
+	idx.Generation, err = readGeneration(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	idx.FileSize, err = internal.GetFileSize(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// Add inserts the given key into the index, in its place in the sort order.
+// It does nothing if the key is already in the index.
+func (idx *OrderedIndex) Add(key []byte) error {
+	head, preds, err := idx.findPredecessors(key)
+	if err != nil {
+		return err
+	}
+
+	var next *values.OrderedIndexEntry
+	nextAddr := preds[0].entry.NextOffsets[0]
+	if nextAddr != 0 {
+		next, err = idx.readEntry(nextAddr)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(next.Key, key) {
+			return nil
+		}
+	}
+
+	level := idx.randomLevel()
+	nextOffsets := make([]uint64, level)
+	for i := range nextOffsets {
+		nextOffsets[i] = preds[i].entry.NextOffsets[i]
+	}
+
+	entry := values.NewOrderedIndexEntry(key, previousOffset(preds[0]), nextOffsets)
+	addr := idx.FileSize
+	_, err = idx.File.WriteAt(entry.AsBytes(), int64(addr))
+	if err != nil {
+		return err
+	}
+	idx.FileSize += uint64(entry.Size)
+
+	// link the new entry in at all its levels, and set it as the previous entry of the one after it
+	changed := make(map[uint64]*values.OrderedIndexEntry, level+1)
+	for i := range nextOffsets {
+		preds[i].entry.NextOffsets[i] = addr
+		changed[preds[i].addr] = preds[i].entry
+	}
+
+	if next != nil {
+		next.PreviousOffset = addr
+		changed[nextAddr] = next
+	} else {
+		head.entry.PreviousOffset = addr
+		changed[head.addr] = head.entry
+	}
+
+	return idx.writeEntries(changed)
+}
+
+// Remove deletes the given key from the index. It does nothing if the key is not in the index.
+func (idx *OrderedIndex) Remove(key []byte) error {
+	head, preds, err := idx.findPredecessors(key)
+	if err != nil {
+		return err
+	}
+
+	addr := preds[0].entry.NextOffsets[0]
+	if addr == 0 {
+		return nil
+	}
+
+	entry, err := idx.readEntry(addr)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(entry.Key, key) {
+		return nil
+	}
+
+	// unlink the entry from all its levels, and set its previous entry as the previous entry of the one after it
+	changed := make(map[uint64]*values.OrderedIndexEntry, len(entry.NextOffsets)+1)
+	for i, nextOffset := range entry.NextOffsets {
+		if preds[i].entry.NextOffsets[i] == addr {
+			preds[i].entry.NextOffsets[i] = nextOffset
+			changed[preds[i].addr] = preds[i].entry
+		}
+	}
+
+	nextAddr := entry.NextOffsets[0]
+	if nextAddr != 0 {
+		next, err := idx.readEntry(nextAddr)
+		if err != nil {
+			return err
+		}
+
+		next.PreviousOffset = entry.PreviousOffset
+		changed[nextAddr] = next
+	} else {
+		head.entry.PreviousOffset = entry.PreviousOffset
+		changed[head.addr] = head.entry
+	}
+
+	return idx.writeEntries(changed)
+}
+
+// Walk calls `fn` for each key from `start` (inclusive) to `end` (exclusive) in sorted order,
+// or in the reverse order if `reverse` is true. It stops as soon as `fn` returns false or an error.
+//
+// If `start` is nil, the walk starts at the first key. If `end` is nil, it goes on up to the last key.
+func (idx *OrderedIndex) Walk(start []byte, end []byte, reverse bool, fn func(key []byte) (bool, error)) error {
+	if reverse {
+		return idx.walkBackwards(start, end, fn)
+	}
+
+	var addr uint64
+	if start == nil {
+		head, err := idx.readEntry(headAddr)
+		if err != nil {
+			return err
+		}
+		addr = head.NextOffsets[0]
+	} else {
+		_, preds, err := idx.findPredecessors(start)
+		if err != nil {
+			return err
+		}
+		addr = preds[0].entry.NextOffsets[0]
+	}
+
+	for addr != 0 {
+		entry, err := idx.readEntry(addr)
+		if err != nil {
+			return err
+		}
+
+		if end != nil && bytes.Compare(entry.Key, end) >= 0 {
+			return nil
+		}
+
+		shouldContinue, err := fn(entry.Key)
+		if err != nil || !shouldContinue {
+			return err
+		}
+
+		addr = entry.NextOffsets[0]
+	}
+
+	return nil
+}
+
+// Clear removes all the keys from the index, leaving only the header and an empty head entry
+func (idx *OrderedIndex) Clear() error {
+	err := idx.File.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, headers.HeaderSizeInBytes)
+	copy(header, title)
+	header[len(title)] = maxLevel
+	copy(header[generationOffset:], internal.Uint64ToByteArray(idx.Generation))
+	_, err = idx.File.WriteAt(header, 0)
+	if err != nil {
+		return err
+	}
+
+	head := values.NewOrderedIndexEntry([]byte{}, 0, make([]uint64, maxLevel))
+	_, err = idx.File.WriteAt(head.AsBytes(), int64(headAddr))
+	if err != nil {
+		return err
+	}
+
+	idx.FileSize = headAddr + uint64(head.Size)
+	return nil
+}
+
+// NewEmptyCopy creates an empty ordered index, of the same generation, at the given path.
+// Any file already at that path is overwritten.
+func (idx *OrderedIndex) NewEmptyCopy(filePath string) (*OrderedIndex, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	copied := &OrderedIndex{
+		File:       file,
+		FilePath:   filePath,
+		Generation: idx.Generation,
+		rand:       idx.rand,
+	}
+
+	err = copied.Clear()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return copied, nil
+}
+
+// Replace replaces the contents of the ordered index with those of `other`, moving the file of `other`
+// to the file path of this ordered index. `other` must not be used after this.
+func (idx *OrderedIndex) Replace(other *OrderedIndex) error {
+	// the rename is atomic so a crash leaves either the old or the new file in place
+	err := os.Rename(other.FilePath, idx.FilePath)
+	if err != nil {
+		return err
+	}
+
+	err = idx.File.Close()
+	if err != nil {
+		return err
+	}
+
+	idx.File = other.File
+	idx.FileSize = other.FileSize
+	idx.Generation = other.Generation
+	return nil
+}
+
+// SetGeneration records that the index is up to date with the given generation of the database file
+func (idx *OrderedIndex) SetGeneration(generation uint64) error {
+	_, err := idx.File.WriteAt(internal.Uint64ToByteArray(generation), int64(generationOffset))
+	if err != nil {
+		return err
+	}
+
+	idx.Generation = generation
+	return nil
+}
+
+// Close closes the ordered index, freeing up any resources
+func (idx *OrderedIndex) Close() error {
+	return idx.File.Close()
+}
+
+// walkBackwards calls `fn` for each key from just before `end` down to `start` (inclusive),
+// stopping as soon as `fn` returns false or an error.
+func (idx *OrderedIndex) walkBackwards(start []byte, end []byte, fn func(key []byte) (bool, error)) error {
+	var addr uint64
+	if end == nil {
+		head, err := idx.readEntry(headAddr)
+		if err != nil {
+			return err
+		}
+		addr = head.PreviousOffset
+	} else {
+		_, preds, err := idx.findPredecessors(end)
+		if err != nil {
+			return err
+		}
+		// the last entry whose key is less than `end`
+		addr = previousOffset(preds[0])
+	}
+
+	for addr != 0 {
+		entry, err := idx.readEntry(addr)
+		if err != nil {
+			return err
+		}
+
+		if start != nil && bytes.Compare(entry.Key, start) < 0 {
+			return nil
+		}
+
+		shouldContinue, err := fn(entry.Key)
+		if err != nil || !shouldContinue {
+			return err
+		}
+
+		addr = entry.PreviousOffset
+	}
+
+	return nil
+}
+
+// findPredecessors returns the head entry of the skip list, and, for each level, the last entry in that level
+// whose key is less than the given key.
+//
+// The entries are shared such that changing an entry that is the predecessor at many levels, or is the head,
+// changes it at all of them.
+func (idx *OrderedIndex) findPredecessors(key []byte) (*node, []*node, error) {
+	headEntry, err := idx.readEntry(headAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	head := &node{addr: headAddr, entry: headEntry}
+	preds := make([]*node, maxLevel)
+	current := head
+	for level := maxLevel - 1; level >= 0; level-- {
+		for {
+			nextAddr := current.entry.NextOffsets[level]
+			if nextAddr == 0 {
+				break
+			}
+
+			next, err := idx.readEntry(nextAddr)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if bytes.Compare(next.Key, key) >= 0 {
+				break
+			}
+
+			current = &node{addr: nextAddr, entry: next}
+		}
+
+		preds[level] = current
+	}
+
+	return head, preds, nil
+}
+
+// readEntry reads the entry at the given address, verifying its checksum
+func (idx *OrderedIndex) readEntry(addr uint64) (*values.OrderedIndexEntry, error) {
+	sizeBuf := make([]byte, 4)
+	_, err := idx.File.ReadAt(sizeBuf, int64(addr))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	size, err := internal.Uint32FromByteArray(sizeBuf)
+	if err != nil {
+		return nil, err
+	}
+
+	if addr+uint64(size) > idx.FileSize {
+		return nil, scdbErrs.NewErrCorruptedEntry(addr, nil)
+	}
+
+	buf := make([]byte, size)
+	_, err = idx.File.ReadAt(buf, int64(addr))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	entry, err := values.ExtractOrderedIndexEntryFromByteArray(buf, 0)
+	if err != nil {
+		return nil, scdbErrs.NewErrCorruptedEntry(addr, nil)
+	}
+
+	if !entry.HasValidChecksum() {
+		return nil, scdbErrs.NewErrCorruptedEntry(addr, entry.Key)
+	}
+
+	return entry, nil
+}
+
+// writeEntries writes the given entries to the file at their addresses, updating their checksums first
+func (idx *OrderedIndex) writeEntries(entries map[uint64]*values.OrderedIndexEntry) error {
+	for addr, entry := range entries {
+		entry.UpdateChecksum()
+		_, err := idx.File.WriteAt(entry.AsBytes(), int64(addr))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// randomLevel returns the number of levels of the skip list that a new entry is to be part of.
+// Each level has about a quarter of the entries of the level below it.
+func (idx *OrderedIndex) randomLevel() int {
+	level := 1
+	for level < maxLevel && idx.rand.Intn(4) == 0 {
+		level++
+	}
+
+	return level
+}
+
+// previousOffset returns the address of the given predecessor to be used as the previous offset of the entry
+// after it. The head is represented by zero.
+func previousOffset(pred *node) uint64 {
+	if pred.addr == headAddr {
+		return 0
+	}
+
+	return pred.addr
+}
+
+// readGeneration checks that the file has the header of an ordered index file, returning the generation in it
+func readGeneration(file *os.File) (uint64, error) {
+	header := make([]byte, headers.HeaderSizeInBytes)
+	_, err := file.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	if !bytes.Equal(header[:len(title)], []byte(title)) || header[len(title)] != maxLevel {
+		return 0, scdbErrs.NewErrOutOfBounds(fmt.Sprintf("%q is not an ordered index file", file.Name()))
+	}
+
+	return internal.Uint64FromByteArray(header[generationOffset : generationOffset+8])
+}
@@ -0,0 +1,382 @@
+package ordered_index
+
+import (
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+)
+
+var testKeys = [][]byte{
+	[]byte("hey"),
+	[]byte("hi"),
+	[]byte("salut"),
+	[]byte("bonjour"),
+	[]byte("hola"),
+	[]byte("oi"),
+	[]byte("mulimuta"),
+}
+
+func TestNewOrderedIndex(t *testing.T) {
+	fileName := "testdb.oscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("NewOrderedIndexForNonExistingFileCreatesAnEmptyIndex", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		idx := createOrderedIndex(t, fileName)
+		defer func() {
+			_ = idx.Close()
+		}()
+
+		assert.Equal(t, [][]byte{}, walk(t, idx, nil, nil, false))
+	})
+
+	t.Run("NewOrderedIndexForExistingFileLoadsTheKeysInIt", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		idx := createOrderedIndex(t, fileName)
+		addKeys(t, idx, testKeys)
+		err := idx.Close()
+		if err != nil {
+			t.Fatalf("error closing ordered index: %s", err)
+		}
+
+		idx = createOrderedIndex(t, fileName)
+		defer func() {
+			_ = idx.Close()
+		}()
+
+		assert.Equal(t, sortedKeys(testKeys), walk(t, idx, nil, nil, false))
+	})
+
+	t.Run("NewOrderedIndexForFileOfAnotherKindReturnsErrOutOfBounds", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		err := os.WriteFile(fileName, make([]byte, 200), 0666)
+		if err != nil {
+			t.Fatalf("error writing file: %s", err)
+		}
+
+		_, err = NewOrderedIndex(fileName)
+		assert.IsType(t, &errors.ErrOutOfBounds{}, err)
+	})
+}
+
+func TestOrderedIndex_Add(t *testing.T) {
+	fileName := "testdb.oscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("AddKeepsTheKeysInSortedOrder", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		keys := make([][]byte, 0, 1000)
+		for _, i := range rand.Perm(1000) {
+			keys = append(keys, []byte(fmt.Sprintf("key-%d", i)))
+		}
+
+		idx := createOrderedIndex(t, fileName)
+		defer func() {
+			_ = idx.Close()
+		}()
+		addKeys(t, idx, keys)
+
+		assert.Equal(t, sortedKeys(keys), walk(t, idx, nil, nil, false))
+	})
+
+	t.Run("AddForAnExistingKeyDoesNothing", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		idx := createOrderedIndex(t, fileName)
+		defer func() {
+			_ = idx.Close()
+		}()
+		addKeys(t, idx, testKeys)
+		initialFileSize := idx.FileSize
+
+		addKeys(t, idx, testKeys[:3])
+
+		assert.Equal(t, initialFileSize, idx.FileSize)
+		assert.Equal(t, sortedKeys(testKeys), walk(t, idx, nil, nil, false))
+	})
+}
+
+func TestOrderedIndex_Remove(t *testing.T) {
+	fileName := "testdb.oscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("RemoveDeletesTheKeyFromTheIndex", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		sorted := sortedKeys(testKeys)
+		idx := createOrderedIndex(t, fileName)
+		defer func() {
+			_ = idx.Close()
+		}()
+		addKeys(t, idx, testKeys)
+
+		// the first, last and a middle key
+		for _, k := range [][]byte{sorted[0], sorted[6], sorted[3]} {
+			err := idx.Remove(k)
+			if err != nil {
+				t.Fatalf("error removing key: %s", err)
+			}
+		}
+
+		expected := [][]byte{sorted[1], sorted[2], sorted[4], sorted[5]}
+		assert.Equal(t, expected, walk(t, idx, nil, nil, false))
+		assert.Equal(t, reversed(expected), walk(t, idx, nil, nil, true))
+	})
+
+	t.Run("RemoveForANonExistingKeyDoesNothing", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		idx := createOrderedIndex(t, fileName)
+		defer func() {
+			_ = idx.Close()
+		}()
+		addKeys(t, idx, testKeys)
+
+		for _, k := range [][]byte{[]byte("aaa"), []byte("hiya"), []byte("zzz")} {
+			err := idx.Remove(k)
+			if err != nil {
+				t.Fatalf("error removing key: %s", err)
+			}
+		}
+
+		assert.Equal(t, sortedKeys(testKeys), walk(t, idx, nil, nil, false))
+	})
+
+	t.Run("RemoveOfAllKeysLeavesAnEmptyIndex", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		idx := createOrderedIndex(t, fileName)
+		defer func() {
+			_ = idx.Close()
+		}()
+		addKeys(t, idx, testKeys)
+
+		for _, k := range testKeys {
+			err := idx.Remove(k)
+			if err != nil {
+				t.Fatalf("error removing key: %s", err)
+			}
+		}
+
+		assert.Equal(t, [][]byte{}, walk(t, idx, nil, nil, false))
+		assert.Equal(t, [][]byte{}, walk(t, idx, nil, nil, true))
+	})
+}
+
+func TestOrderedIndex_Walk(t *testing.T) {
+	fileName := "testdb.oscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	// bonjour, hey, hi, hola, mulimuta, oi, salut
+	sorted := sortedKeys(testKeys)
+	idx := createOrderedIndex(t, fileName)
+	defer func() {
+		_ = idx.Close()
+	}()
+	addKeys(t, idx, testKeys)
+
+	t.Run("WalkGoesFromStartToJustBeforeEnd", func(t *testing.T) {
+		type testRecord struct {
+			start    []byte
+			end      []byte
+			expected [][]byte
+		}
+		testData := []testRecord{
+			{nil, nil, sorted},
+			{[]byte("hi"), []byte("oi"), sorted[2:5]},
+			{[]byte("h"), []byte("i"), sorted[1:4]},
+			{nil, []byte("hola"), sorted[:3]},
+			{[]byte("hola"), nil, sorted[3:]},
+			{[]byte("x"), nil, [][]byte{}},
+			{[]byte("oi"), []byte("hi"), [][]byte{}},
+		}
+
+		for _, record := range testData {
+			assert.Equal(t, record.expected, walk(t, idx, record.start, record.end, false))
+			assert.Equal(t, reversed(record.expected), walk(t, idx, record.start, record.end, true))
+		}
+	})
+
+	t.Run("WalkStopsWhenFnReturnsFalse", func(t *testing.T) {
+		for _, reverse := range []bool{false, true} {
+			got := make([][]byte, 0)
+			err := idx.Walk(nil, nil, reverse, func(key []byte) (bool, error) {
+				got = append(got, key)
+				return len(got) < 2, nil
+			})
+			if err != nil {
+				t.Fatalf("error walking ordered index: %s", err)
+			}
+
+			assert.Equal(t, 2, len(got))
+		}
+	})
+}
+
+func TestOrderedIndex_Clear(t *testing.T) {
+	fileName := "testdb.oscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	idx := createOrderedIndex(t, fileName)
+	defer func() {
+		_ = idx.Close()
+	}()
+	initialFileSize := idx.FileSize
+	addKeys(t, idx, testKeys)
+
+	err := idx.Clear()
+	if err != nil {
+		t.Fatalf("error clearing ordered index: %s", err)
+	}
+
+	assert.Equal(t, initialFileSize, idx.FileSize)
+	assert.Equal(t, [][]byte{}, walk(t, idx, nil, nil, false))
+	assert.Equal(t, [][]byte{}, walk(t, idx, nil, nil, true))
+}
+
+func TestOrderedIndex_Replace(t *testing.T) {
+	fileName := "testdb.oscdb"
+	copyFileName := "testdb_copy.oscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+		_ = os.Remove(copyFileName)
+	}()
+
+	idx := createOrderedIndex(t, fileName)
+	defer func() {
+		_ = idx.Close()
+	}()
+	addKeys(t, idx, testKeys)
+
+	other, err := idx.NewEmptyCopy(copyFileName)
+	if err != nil {
+		t.Fatalf("error creating empty copy: %s", err)
+	}
+	assert.Equal(t, [][]byte{}, walk(t, other, nil, nil, false))
+	addKeys(t, other, testKeys[:2])
+
+	err = idx.Replace(other)
+	if err != nil {
+		t.Fatalf("error replacing ordered index: %s", err)
+	}
+
+	assert.Equal(t, sortedKeys(testKeys[:2]), walk(t, idx, nil, nil, false))
+	_, err = os.Stat(copyFileName)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOrderedIndex_SetGeneration(t *testing.T) {
+	fileName := "testdb.oscdb"
+	copyFileName := "testdb_copy.oscdb"
+	defer func() {
+		_ = os.Remove(fileName)
+		_ = os.Remove(copyFileName)
+	}()
+
+	t.Run("SetGenerationIsKeptInTheFileAndByClearAndNewEmptyCopy", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		idx := createOrderedIndex(t, fileName)
+		assert.Equal(t, uint64(0), idx.Generation)
+		addKeys(t, idx, testKeys)
+
+		err := idx.SetGeneration(5)
+		if err != nil {
+			t.Fatalf("error setting generation: %s", err)
+		}
+		err = idx.Close()
+		if err != nil {
+			t.Fatalf("error closing ordered index: %s", err)
+		}
+
+		idx = createOrderedIndex(t, fileName)
+		defer func() {
+			_ = idx.Close()
+		}()
+		assert.Equal(t, uint64(5), idx.Generation)
+		assert.Equal(t, sortedKeys(testKeys), walk(t, idx, nil, nil, false))
+
+		other, err := idx.NewEmptyCopy(copyFileName)
+		if err != nil {
+			t.Fatalf("error creating empty copy: %s", err)
+		}
+		defer func() {
+			_ = other.Close()
+		}()
+		assert.Equal(t, uint64(5), other.Generation)
+
+		err = idx.Clear()
+		if err != nil {
+			t.Fatalf("error clearing ordered index: %s", err)
+		}
+		reopened := createOrderedIndex(t, fileName)
+		defer func() {
+			_ = reopened.Close()
+		}()
+		assert.Equal(t, uint64(5), reopened.Generation)
+	})
+}
+
+// createOrderedIndex opens the ordered index at the given path
+func createOrderedIndex(t *testing.T, fileName string) *OrderedIndex {
+	idx, err := NewOrderedIndex(fileName)
+	if err != nil {
+		t.Fatalf("error creating ordered index: %s", err)
+	}
+
+	return idx
+}
+
+// addKeys adds the given keys to the ordered index
+func addKeys(t *testing.T, idx *OrderedIndex, keys [][]byte) {
+	for _, k := range keys {
+		err := idx.Add(k)
+		if err != nil {
+			t.Fatalf("error adding key: %s", err)
+		}
+	}
+}
+
+// walk returns all the keys walked through in the ordered index from `start` to `end`
+func walk(t *testing.T, idx *OrderedIndex, start []byte, end []byte, reverse bool) [][]byte {
+	keys := make([][]byte, 0)
+	err := idx.Walk(start, end, reverse, func(key []byte) (bool, error) {
+		keys = append(keys, key)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatalf("error walking ordered index: %s", err)
+	}
+
+	return keys
+}
+
+// sortedKeys returns a sorted copy of the given keys
+func sortedKeys(keys [][]byte) [][]byte {
+	sorted := make([][]byte, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return string(sorted[i]) < string(sorted[j])
+	})
+
+	return sorted
+}
+
+// reversed returns a copy of the given keys in the reverse order
+func reversed(keys [][]byte) [][]byte {
+	result := make([][]byte, 0, len(keys))
+	for i := len(keys) - 1; i >= 0; i-- {
+		result = append(result, keys[i])
+	}
+
+	return result
+}
@@ -153,3 +153,20 @@ func GetFileSize(file *os.File) (uint64, error) {
 	}
 	return uint64(fileStat.Size()), nil
 }
+
+// SyncDir flushes the entries of the directory at the given path to disk
+// so that files created, renamed or removed in it survive a crash
+func SyncDir(dirPath string) error {
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+
+	err = dir.Sync()
+	if err != nil {
+		_ = dir.Close()
+		return err
+	}
+
+	return dir.Close()
+}
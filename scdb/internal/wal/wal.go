@@ -0,0 +1,224 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cespare/xxhash/v2"
+	scdbErrs "github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"io"
+	"os"
+)
+
+// recordHeaderSizeInBytes is the size of the prefix of every record in the log
+// i.e. size (4 bytes), checksum (8 bytes), number of operations (4 bytes)
+const recordHeaderSizeInBytes uint64 = 4 + 8 + 4
+
+// opMinSizeInBytes is the size of an operation in a record, excluding the key and the value
+// i.e. kind (1 byte), key size (4 bytes), value size (4 bytes), expiry (8 bytes)
+const opMinSizeInBytes uint64 = 1 + 4 + 4 + 8
+
+// OpKind is the kind of logical mutation recorded in the log
+type OpKind byte
+
+const (
+	OpSet    OpKind = 1
+	OpDelete OpKind = 2
+	OpClear  OpKind = 3
+	// OpExpire sets the expiry of an existing key. Only the key and the expiry of the Op are used
+	OpExpire OpKind = 4
+)
+
+// Op is a single logical mutation of the store.
+// Its Expiry is a timestamp in milliseconds from unix epoch, or 0 if it never expires.
+type Op struct {
+	Kind   OpKind
+	Key    []byte
+	Value  []byte
+	Expiry uint64
+}
+
+// Log is the write-ahead log of the store.
+//
+// Every logical mutation is appended to it as a record before the database and index files are touched.
+// A record is the unit of atomicity: when the log is read back, a record that was not completely
+// written (e.g. due to a crash) is ignored together with anything after it.
+type Log struct {
+	File     *os.File
+	FilePath string
+	FileSize uint64
+}
+
+// NewLog opens the write-ahead log at the given file path, creating it if it does not exist
+func NewLog(filePath string) (*Log, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	fileSize, err := internal.GetFileSize(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Log{
+		File:     file,
+		FilePath: filePath,
+		FileSize: fileSize,
+	}, nil
+}
+
+// Append appends the given operations to the end of the log as a single record
+func (l *Log) Append(ops ...Op) error {
+	record := encodeRecord(ops)
+	_, err := l.File.WriteAt(record, int64(l.FileSize))
+	if err != nil {
+		return err
+	}
+
+	l.FileSize += uint64(len(record))
+	return nil
+}
+
+// ReadAll reads all the complete records in the log, in the order they were appended.
+//
+// It stops at the first record that is incomplete or whose checksum does not match
+// as that is what a crash in the middle of an Append looks like.
+func (l *Log) ReadAll() ([][]Op, error) {
+	data := make([]byte, l.FileSize)
+	_, err := l.File.ReadAt(data, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	records := make([][]Op, 0)
+	dataLength := uint64(len(data))
+	for offset := uint64(0); offset < dataLength; {
+		ops, size, err := decodeRecord(data, offset)
+		if err != nil {
+			break
+		}
+
+		records = append(records, ops)
+		offset += size
+	}
+
+	return records, nil
+}
+
+// Truncate removes all records from the log
+func (l *Log) Truncate() error {
+	err := l.File.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	l.FileSize = 0
+	return nil
+}
+
+// Sync flushes the records appended to the log to disk
+func (l *Log) Sync() error {
+	return l.File.Sync()
+}
+
+// Close closes the log, freeing up any resources
+func (l *Log) Close() error {
+	return l.File.Close()
+}
+
+// encodeRecord converts the given operations into a record's byte array
+func encodeRecord(ops []Op) []byte {
+	arrays := make([][]byte, 0, len(ops)*6)
+	for _, op := range ops {
+		arrays = append(arrays,
+			[]byte{byte(op.Kind)},
+			internal.Uint32ToByteArray(uint32(len(op.Key))),
+			op.Key,
+			internal.Uint32ToByteArray(uint32(len(op.Value))),
+			op.Value,
+			internal.Uint64ToByteArray(op.Expiry),
+		)
+	}
+	payload := internal.ConcatByteArrays(arrays...)
+
+	size := uint32(recordHeaderSizeInBytes) + uint32(len(payload))
+	return internal.ConcatByteArrays(
+		internal.Uint32ToByteArray(size),
+		internal.Uint64ToByteArray(xxhash.Sum64(payload)),
+		internal.Uint32ToByteArray(uint32(len(ops))),
+		payload,
+	)
+}
+
+// decodeRecord extracts the operations of the record at the given offset in data, returning them
+// together with the size of the record
+func decodeRecord(data []byte, offset uint64) ([]Op, uint64, error) {
+	dataLength := uint64(len(data))
+	sizeSlice, err := internal.SafeSlice(data, offset, offset+4, dataLength)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := internal.Uint32FromByteArray(sizeSlice)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	recordSize := uint64(size)
+	if recordSize < recordHeaderSizeInBytes || offset+recordSize > dataLength {
+		return nil, 0, scdbErrs.NewErrOutOfBounds(fmt.Sprintf("record of size %d at %d is incomplete", recordSize, offset))
+	}
+
+	checksum, err := internal.Uint64FromByteArray(data[offset+4 : offset+12])
+	if err != nil {
+		return nil, 0, err
+	}
+	numOfOps, err := internal.Uint32FromByteArray(data[offset+12 : offset+16])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	payload := data[offset+recordHeaderSizeInBytes : offset+recordSize]
+	if xxhash.Sum64(payload) != checksum {
+		return nil, 0, scdbErrs.NewErrOutOfBounds(fmt.Sprintf("record at %d has a mismatched checksum", offset))
+	}
+
+	ops := make([]Op, 0, numOfOps)
+	payloadLength := uint64(len(payload))
+	cursor := uint64(0)
+	for i := uint32(0); i < numOfOps; i++ {
+		err = internal.ValidateBounds(cursor, cursor+opMinSizeInBytes, 0, payloadLength, "operation is incomplete.")
+		if err != nil {
+			return nil, 0, err
+		}
+
+		kind := OpKind(payload[cursor])
+		keySize, _ := internal.Uint32FromByteArray(payload[cursor+1 : cursor+5])
+		keyStart := cursor + 5
+		keyEnd := keyStart + uint64(keySize)
+		err = internal.ValidateBounds(keyStart, keyEnd+opMinSizeInBytes-5, 0, payloadLength, "operation key is incomplete.")
+		if err != nil {
+			return nil, 0, err
+		}
+
+		valueSize, _ := internal.Uint32FromByteArray(payload[keyEnd : keyEnd+4])
+		valueStart := keyEnd + 4
+		valueEnd := valueStart + uint64(valueSize)
+		err = internal.ValidateBounds(valueStart, valueEnd+8, 0, payloadLength, "operation value is incomplete.")
+		if err != nil {
+			return nil, 0, err
+		}
+
+		expiry, _ := internal.Uint64FromByteArray(payload[valueEnd : valueEnd+8])
+		cursor = valueEnd + 8
+
+		ops = append(ops, Op{
+			Kind:   kind,
+			Key:    payload[keyStart:keyEnd],
+			Value:  payload[valueStart:valueEnd],
+			Expiry: expiry,
+		})
+	}
+
+	return ops, recordSize, nil
+}
@@ -0,0 +1,231 @@
+package wal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+var testOps = []Op{
+	{Kind: OpSet, Key: []byte("foo"), Value: []byte("bar"), Expiry: 0},
+	{Kind: OpSet, Key: []byte("fake"), Value: []byte(""), Expiry: 1666023836},
+	{Kind: OpDelete, Key: []byte("foo"), Value: []byte{}, Expiry: 0},
+	{Kind: OpClear, Key: []byte{}, Value: []byte{}, Expiry: 0},
+}
+
+func TestNewLog(t *testing.T) {
+	fileName := "testdb.wal"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("NewLogForNonExistingFileCreatesAnEmptyLog", func(t *testing.T) {
+		_ = os.Remove(fileName)
+
+		log := createLog(t, fileName)
+		defer func() {
+			_ = log.Close()
+		}()
+
+		assert.Equal(t, uint64(0), log.FileSize)
+		assert.Equal(t, fileName, log.FilePath)
+	})
+
+	t.Run("NewLogForExistingFileLoadsTheRecordsInIt", func(t *testing.T) {
+		_ = os.Remove(fileName)
+
+		func() {
+			log := createLog(t, fileName)
+			defer func() {
+				_ = log.Close()
+			}()
+			appendOps(t, log, testOps...)
+		}()
+
+		log := createLog(t, fileName)
+		defer func() {
+			_ = log.Close()
+		}()
+
+		got, err := log.ReadAll()
+		if err != nil {
+			t.Fatalf("error reading log: %s", err)
+		}
+		assert.Equal(t, [][]Op{testOps}, got)
+	})
+}
+
+func TestLog_Append(t *testing.T) {
+	fileName := "testdb.wal"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+	_ = os.Remove(fileName)
+
+	log := createLog(t, fileName)
+	defer func() {
+		_ = log.Close()
+	}()
+
+	for _, op := range testOps {
+		appendOps(t, log, op)
+	}
+	appendOps(t, log, testOps[:2]...)
+
+	expected := [][]Op{{testOps[0]}, {testOps[1]}, {testOps[2]}, {testOps[3]}, testOps[:2]}
+	got, err := log.ReadAll()
+	if err != nil {
+		t.Fatalf("error reading log: %s", err)
+	}
+
+	assert.Equal(t, expected, got)
+	assert.Equal(t, getFileSize(t, fileName), log.FileSize)
+}
+
+func TestLog_ReadAll(t *testing.T) {
+	fileName := "testdb.wal"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	t.Run("ReadAllIgnoresIncompleteRecordAtTheEnd", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		log := createLog(t, fileName)
+		defer func() {
+			_ = log.Close()
+		}()
+
+		appendOps(t, log, testOps[0])
+		appendOps(t, log, testOps[1:3]...)
+
+		// simulate a crash in the middle of an append
+		err := log.File.Truncate(int64(log.FileSize - 5))
+		if err != nil {
+			t.Fatalf("error truncating log: %s", err)
+		}
+		log.FileSize -= 5
+
+		got, err := log.ReadAll()
+		if err != nil {
+			t.Fatalf("error reading log: %s", err)
+		}
+		assert.Equal(t, [][]Op{{testOps[0]}}, got)
+	})
+
+	t.Run("ReadAllIgnoresCorruptedRecordsAndAllAfterThem", func(t *testing.T) {
+		_ = os.Remove(fileName)
+		log := createLog(t, fileName)
+		defer func() {
+			_ = log.Close()
+		}()
+
+		appendOps(t, log, testOps[0])
+		firstRecordSize := log.FileSize
+		appendOps(t, log, testOps[1])
+		appendOps(t, log, testOps[2])
+
+		// flip a byte in the payload of the second record
+		_, err := log.File.WriteAt([]byte{255}, int64(firstRecordSize+recordHeaderSizeInBytes+2))
+		if err != nil {
+			t.Fatalf("error corrupting log: %s", err)
+		}
+
+		got, err := log.ReadAll()
+		if err != nil {
+			t.Fatalf("error reading log: %s", err)
+		}
+		assert.Equal(t, [][]Op{{testOps[0]}}, got)
+	})
+}
+
+func TestLog_Truncate(t *testing.T) {
+	fileName := "testdb.wal"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+	_ = os.Remove(fileName)
+
+	log := createLog(t, fileName)
+	defer func() {
+		_ = log.Close()
+	}()
+	appendOps(t, log, testOps...)
+
+	err := log.Truncate()
+	if err != nil {
+		t.Fatalf("error truncating log: %s", err)
+	}
+
+	got, err := log.ReadAll()
+	if err != nil {
+		t.Fatalf("error reading log: %s", err)
+	}
+
+	assert.Equal(t, [][]Op{}, got)
+	assert.Equal(t, uint64(0), log.FileSize)
+	assert.Equal(t, uint64(0), getFileSize(t, fileName))
+}
+
+func TestLog_Sync(t *testing.T) {
+	fileName := "testdb.wal"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+	_ = os.Remove(fileName)
+
+	log := createLog(t, fileName)
+	appendOps(t, log, testOps...)
+
+	err := log.Sync()
+	if err != nil {
+		t.Fatalf("error syncing log: %s", err)
+	}
+	assert.Equal(t, getFileSize(t, fileName), log.FileSize)
+
+	_ = log.Close()
+	// a closed log can't be synced
+	assert.NotNil(t, log.Sync())
+}
+
+func TestLog_Close(t *testing.T) {
+	fileName := "testdb.wal"
+	defer func() {
+		_ = os.Remove(fileName)
+	}()
+
+	log := createLog(t, fileName)
+	err := log.Close()
+	if err != nil {
+		t.Fatalf("error closing log: %s", err)
+	}
+
+	// Close has already been called on File
+	assert.NotNil(t, log.File.Close())
+}
+
+// createLog creates a write-ahead log at the given file path for test purposes
+func createLog(t *testing.T, filePath string) *Log {
+	log, err := NewLog(filePath)
+	if err != nil {
+		t.Fatalf("error creating log: %s", err)
+	}
+	return log
+}
+
+// appendOps appends the given operations as one record to the log
+func appendOps(t *testing.T, log *Log, ops ...Op) {
+	err := log.Append(ops...)
+	if err != nil {
+		t.Fatalf("error appending to log: %s", err)
+	}
+}
+
+// getFileSize retrieves the size of the file at the given path
+func getFileSize(t *testing.T, filePath string) uint64 {
+	stats, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("error getting file size: %s", err)
+	}
+
+	return uint64(stats.Size())
+}
@@ -0,0 +1,341 @@
+package scdb
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBounds are the upper bounds of the buckets of the latency histograms
+var latencyBounds = []time.Duration{
+	10 * time.Microsecond,
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	time.Minute,
+}
+
+// expvarMu makes checking for an existing expvar variable and publishing one a single step,
+// since expvar.Publish panics if the name is taken
+var expvarMu sync.Mutex
+
+// latencyOperations are the names of the operations whose latencies are recorded, in the order they are exposed
+var latencyOperations = []string{"get", "set", "delete", "search", "compact"}
+
+// Metrics are the metrics of a Store that are cheap to get, for watching it on dashboards.
+// Unlike Stats, they do not need the index to be read.
+type Metrics struct {
+	// Keys is the number of keys in the store, as returned by Store.Len
+	Keys uint64
+	// Operations are the numbers of operations done on the store since it was opened
+	Operations OperationStats
+	// Latencies are the histograms of the latencies of the "get", "set", "delete", "search" and "compact" operations
+	// since the store was opened, by the name of the operation. It is nil unless the store was opened WithMetrics().
+	Latencies map[string]LatencyHistogram
+	// KvCacheHitRate is the fraction of the key-value entries read since the store was opened
+	// that were found in the buffers of the pool, instead of being read from the file
+	KvCacheHitRate float64
+	// IndexCacheHitRate is the fraction of the index entries read since the store was opened
+	// that were found in the buffers of the pool, instead of being read from the file
+	IndexCacheHitRate float64
+	// Compaction are the statistics about the compactions of the store, including the bytes they reclaimed
+	Compaction CompactionStats
+	// CollisionSaturations is the number of times since the store was opened that all the slots of a key
+	// in the index were taken by other keys, so that the index had to grow
+	CollisionSaturations uint64
+}
+
+// LatencyHistogram is a histogram of the latencies of an operation
+type LatencyHistogram struct {
+	// Bounds are the upper bounds, inclusive, of the buckets of the histogram, in increasing order
+	Bounds []time.Duration
+	// Counts holds, at index n, the number of latencies that were greater than Bounds[n-1] and not greater than
+	// Bounds[n]. Its last element is the number of latencies that were greater than all the Bounds.
+	Counts []uint64
+	// Count is the total number of latencies recorded
+	Count uint64
+	// Sum is the sum of all the latencies recorded
+	Sum time.Duration
+}
+
+// latencyHistogram records latencies into buckets atomically, since reads run in parallel with each other
+type latencyHistogram struct {
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Int64
+}
+
+// operationLatencies are the latency histograms of the operations of a Store
+type operationLatencies struct {
+	get     *latencyHistogram
+	set     *latencyHistogram
+	delete  *latencyHistogram
+	search  *latencyHistogram
+	compact *latencyHistogram
+}
+
+// newOperationLatencies creates the latency histograms of a Store, or returns nil if `isEnabled` is false
+func newOperationLatencies(isEnabled bool) *operationLatencies {
+	if !isEnabled {
+		return nil
+	}
+
+	return &operationLatencies{
+		get:     newLatencyHistogram(),
+		set:     newLatencyHistogram(),
+		delete:  newLatencyHistogram(),
+		search:  newLatencyHistogram(),
+		compact: newLatencyHistogram(),
+	}
+}
+
+// snapshot returns copies of the latency histograms, by the name of the operation
+func (l *operationLatencies) snapshot() map[string]LatencyHistogram {
+	return map[string]LatencyHistogram{
+		"get":     l.get.snapshot(),
+		"set":     l.set.snapshot(),
+		"delete":  l.delete.snapshot(),
+		"search":  l.search.snapshot(),
+		"compact": l.compact.snapshot(),
+	}
+}
+
+// newLatencyHistogram creates an empty histogram with the buckets of latencyBounds
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: make([]atomic.Uint64, len(latencyBounds)+1)}
+}
+
+// observe records the given latency
+func (h *latencyHistogram) observe(latency time.Duration) {
+	i := sort.Search(len(latencyBounds), func(i int) bool { return latency <= latencyBounds[i] })
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(latency))
+}
+
+// observeSince records the time elapsed since `start`. It is meant to be deferred at the start of an operation.
+func (h *latencyHistogram) observeSince(start time.Time) {
+	h.observe(time.Since(start))
+}
+
+// snapshot returns a copy of the histogram. Since the buckets are read one after another,
+// latencies recorded while it runs may be in Count but not in Counts, or vice versa.
+func (h *latencyHistogram) snapshot() LatencyHistogram {
+	counts := make([]uint64, len(h.counts))
+	for i := range h.counts {
+		counts[i] = h.counts[i].Load()
+	}
+
+	return LatencyHistogram{
+		Bounds: latencyBounds,
+		Counts: counts,
+		Count:  h.count.Load(),
+		Sum:    time.Duration(h.sum.Load()),
+	}
+}
+
+// Metrics returns the metrics of the store. Unlike Stats, it does not read the index, so it is cheap enough
+// to call every time a dashboard scrapes it, and it works on closed stores too.
+func (s *Store) Metrics() *Metrics {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	metrics := &Metrics{
+		Keys: s.bufferPool.KeyCount(),
+		Operations: OperationStats{
+			Gets:     s.ops.gets.Load(),
+			Sets:     s.ops.sets.Load(),
+			Deletes:  s.ops.deletes.Load(),
+			Searches: s.ops.searches.Load(),
+			Ranges:   s.ops.ranges.Load(),
+			Batches:  s.ops.batches.Load(),
+		},
+		Compaction:           s.compactionStats,
+		CollisionSaturations: s.ops.collisionSaturations.Load(),
+	}
+
+	if !s.isClosed {
+		metrics.Compaction = s.currentCompactionStats()
+	}
+
+	if s.latencies != nil {
+		metrics.Latencies = s.latencies.snapshot()
+	}
+
+	cacheStats := s.bufferPool.CacheStats()
+	metrics.KvCacheHitRate = hitRate(cacheStats.KvHits, cacheStats.KvMisses)
+	metrics.IndexCacheHitRate = hitRate(cacheStats.IndexHits, cacheStats.IndexMisses)
+
+	return metrics
+}
+
+// PublishExpvar publishes the metrics of the store as the expvar variable of the given name,
+// so that they are served as JSON at /debug/vars along with the other expvar variables.
+// The metrics are got afresh each time the variable is read.
+//
+// It returns an ErrNotSupported error if there is already an expvar variable of that name,
+// since expvar variables can't be removed or replaced.
+func (s *Store) PublishExpvar(name string) error {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	if expvar.Get(name) != nil {
+		return errors.NewErrNotSupported(fmt.Sprintf("publishing to the existing expvar variable %q", name))
+	}
+
+	expvar.Publish(name, expvar.Func(func() any {
+		return s.Metrics()
+	}))
+	return nil
+}
+
+// metricsHandler serves the metrics of stores in the Prometheus text exposition format
+type metricsHandler struct {
+	names  []string
+	stores map[string]*Store
+}
+
+// NewMetricsHandler returns an http.Handler that serves the metrics of the given stores in the Prometheus
+// text exposition format, with the name of each store as the value of the `store` label.
+// The metrics are got afresh on every request by calling Store.Metrics.
+//
+// The metrics it serves are:
+//
+//	scdb_keys                              gauge      the number of keys in the store
+//	scdb_operations_total                  counter    the operations done, by `operation`
+//	scdb_operation_duration_seconds        histogram  the latencies of operations, by `operation`, if WithMetrics()
+//	scdb_cache_hit_ratio                   gauge      the cache hit rate of the buffer pool, by `cache` i.e. kv or index
+//	scdb_compactions_total                 counter    the compactions done
+//	scdb_compaction_reclaimed_bytes_total  counter    the bytes by which compactions shrank the database file
+//	scdb_last_compaction_duration_seconds  gauge      how long the last compaction took
+//	scdb_collision_saturations_total       counter    the times the index grew because a key had no free slot
+//
+// The map is copied, so stores added to it later are not served.
+func NewMetricsHandler(stores map[string]*Store) http.Handler {
+	h := &metricsHandler{
+		names:  make([]string, 0, len(stores)),
+		stores: make(map[string]*Store, len(stores)),
+	}
+	for name, store := range stores {
+		h.names = append(h.names, name)
+		h.stores[name] = store
+	}
+	sort.Strings(h.names)
+
+	return h
+}
+
+// ServeHTTP writes the metrics of the stores of the handler to `w`
+func (h *metricsHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	metrics := make([]*Metrics, len(h.names))
+	labels := make([]string, len(h.names))
+	for i, name := range h.names {
+		metrics[i] = h.stores[name].Metrics()
+		labels[i] = `store="` + escapeLabelValue(name) + `"`
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buf := bufio.NewWriter(w)
+
+	writeMetricHeader(buf, "scdb_keys", "gauge", "The number of keys in the store.")
+	for i, m := range metrics {
+		writeSample(buf, "scdb_keys", labels[i], float64(m.Keys))
+	}
+
+	writeMetricHeader(buf, "scdb_operations_total", "counter", "The number of operations done since the store was opened.")
+	for i, m := range metrics {
+		counts := []uint64{m.Operations.Gets, m.Operations.Sets, m.Operations.Deletes,
+			m.Operations.Searches, m.Operations.Ranges, m.Operations.Batches}
+		for j, op := range []string{"get", "set", "delete", "search", "range", "batch"} {
+			writeSample(buf, "scdb_operations_total", labels[i]+`,operation="`+op+`"`, float64(counts[j]))
+		}
+	}
+
+	writeMetricHeader(buf, "scdb_operation_duration_seconds", "histogram", "The latencies of operations.")
+	for i, m := range metrics {
+		if m.Latencies == nil {
+			continue
+		}
+
+		for _, op := range latencyOperations {
+			writeHistogram(buf, "scdb_operation_duration_seconds", labels[i]+`,operation="`+op+`"`, m.Latencies[op])
+		}
+	}
+
+	writeMetricHeader(buf, "scdb_cache_hit_ratio", "gauge", "The fraction of the lookups in the buffer pool that were hits.")
+	for i, m := range metrics {
+		writeSample(buf, "scdb_cache_hit_ratio", labels[i]+`,cache="kv"`, m.KvCacheHitRate)
+		writeSample(buf, "scdb_cache_hit_ratio", labels[i]+`,cache="index"`, m.IndexCacheHitRate)
+	}
+
+	writeMetricHeader(buf, "scdb_compactions_total", "counter", "The number of compactions done since the store was opened.")
+	for i, m := range metrics {
+		writeSample(buf, "scdb_compactions_total", labels[i], float64(m.Compaction.Compactions))
+	}
+
+	writeMetricHeader(buf, "scdb_compaction_reclaimed_bytes_total", "counter", "The number of bytes by which compactions shrank the database file.")
+	for i, m := range metrics {
+		writeSample(buf, "scdb_compaction_reclaimed_bytes_total", labels[i], float64(m.Compaction.ReclaimedBytes))
+	}
+
+	writeMetricHeader(buf, "scdb_last_compaction_duration_seconds", "gauge", "How long the last compaction took.")
+	for i, m := range metrics {
+		writeSample(buf, "scdb_last_compaction_duration_seconds", labels[i], m.Compaction.LastDuration.Seconds())
+	}
+
+	writeMetricHeader(buf, "scdb_collision_saturations_total", "counter", "The number of times the index grew because all the slots of a key were taken.")
+	for i, m := range metrics {
+		writeSample(buf, "scdb_collision_saturations_total", labels[i], float64(m.CollisionSaturations))
+	}
+
+	_ = buf.Flush()
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric
+func writeMetricHeader(buf *bufio.Writer, name string, kind string, help string) {
+	_, _ = fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes a line with the value of a metric for the given labels
+func writeSample(buf *bufio.Writer, name string, labels string, value float64) {
+	_, _ = fmt.Fprintf(buf, "%s{%s} %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// writeHistogram writes the cumulative buckets, the sum and the count of a histogram for the given labels
+func writeHistogram(buf *bufio.Writer, name string, labels string, h LatencyHistogram) {
+	var cumulative uint64
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+		writeSample(buf, name+"_bucket", labels+`,le="`+le+`"`, float64(cumulative))
+	}
+	// the count is got from the buckets so that it can't disagree with them when latencies are recorded
+	// while the histogram is copied
+	cumulative += h.Counts[len(h.Bounds)]
+	writeSample(buf, name+"_bucket", labels+`,le="+Inf"`, float64(cumulative))
+	writeSample(buf, name+"_sum", labels, h.Sum.Seconds())
+	writeSample(buf, name+"_count", labels, float64(cumulative))
+}
+
+// escapeLabelValue escapes the backslashes, double quotes and line feeds in a label value,
+// as the Prometheus text exposition format requires
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
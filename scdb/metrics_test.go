@@ -0,0 +1,311 @@
+package scdb
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStore_Metrics(t *testing.T) {
+	dbPath := "testdb_metrics"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("MetricsHasNoLatenciesUnlessMetricsAreEnabled", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		metrics := store.Metrics()
+		assert.Nil(t, metrics.Latencies)
+		assert.Equal(t, uint64(len(Records)), metrics.Keys)
+		assert.Equal(t, uint64(len(Records)), metrics.Operations.Sets)
+	})
+
+	t.Run("MetricsHasTheLatenciesOfOperationsIfMetricsAreEnabled", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true, WithMetrics())
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		for i := 0; i < 3; i++ {
+			assertStoreContains(t, store, Records[:2])
+		}
+		deleteRecords(t, store, [][]byte{Records[0].k})
+		assertSearchResults(t, store, []byte("h"), []testRecord{Records[1], Records[4]})
+		err := store.Compact()
+		if err != nil {
+			t.Fatalf("error compacting store: %s", err)
+		}
+
+		metrics := store.Metrics()
+		expectedCounts := map[string]uint64{
+			"get":     6,
+			"set":     uint64(len(Records)),
+			"delete":  1,
+			"search":  1,
+			"compact": 1,
+		}
+		assert.Len(t, metrics.Latencies, len(expectedCounts))
+		for op, count := range expectedCounts {
+			histogram := metrics.Latencies[op]
+			assert.Equal(t, count, histogram.Count, op)
+			assert.Equal(t, count, sumOf(histogram.Counts), op)
+			assert.Len(t, histogram.Counts, len(histogram.Bounds)+1, op)
+			assert.Greater(t, histogram.Sum, time.Duration(0), op)
+		}
+	})
+
+	t.Run("MetricsHasTheBytesReclaimedByAllCompactions", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		for _, record := range Records[:2] {
+			deleteRecords(t, store, [][]byte{record.k})
+			err := store.Compact()
+			if err != nil {
+				t.Fatalf("error compacting store: %s", err)
+			}
+		}
+
+		metrics := store.Metrics()
+		assert.Equal(t, uint64(2), metrics.Compaction.Compactions)
+		assert.Equal(t, getEntrySize(Records[1]), metrics.Compaction.LastReclaimedBytes)
+		assert.Equal(t, getEntrySize(Records[0])+getEntrySize(Records[1]), metrics.Compaction.ReclaimedBytes)
+	})
+
+	t.Run("MetricsCountsTheCollisionSaturationsThatGrewTheIndex", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStoreWithMaxKeys(t, dbPath, 10, false, WithMaxLoadFactor(1))
+		defer func() {
+			_ = store.Close()
+		}()
+		assert.Equal(t, uint64(0), store.Metrics().CollisionSaturations)
+
+		keys := getCollidingKeys(store.header, int(store.header.NumberOfIndexBlocks)+1)
+		records := make([]testRecord, 0, len(keys))
+		for _, k := range keys {
+			records = append(records, testRecord{k, k})
+		}
+		insertRecords(t, store, records, nil)
+
+		assert.Equal(t, uint64(1), store.Metrics().CollisionSaturations)
+	})
+
+	t.Run("MetricsOfAClosedStoreAreThoseBeforeItWasClosed", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		insertRecords(t, store, Records, nil)
+		_ = store.Close()
+
+		metrics := store.Metrics()
+		assert.Equal(t, uint64(len(Records)), metrics.Operations.Sets)
+	})
+}
+
+func TestStore_PublishExpvar(t *testing.T) {
+	dbPath := "testdb_metrics_expvar"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("PublishExpvarPublishesTheCurrentMetricsOfTheStore", func(t *testing.T) {
+		store := createStore(t, dbPath, nil, false, WithMetrics())
+		defer func() {
+			_ = store.Close()
+		}()
+		err := store.PublishExpvar("scdb_test_store")
+		if err != nil {
+			t.Fatalf("error publishing expvar: %s", err)
+		}
+		insertRecords(t, store, Records, nil)
+
+		got := Metrics{}
+		err = json.Unmarshal([]byte(expvar.Get("scdb_test_store").String()), &got)
+		if err != nil {
+			t.Fatalf("error unmarshalling expvar: %s", err)
+		}
+		assert.Equal(t, uint64(len(Records)), got.Keys)
+		assert.Equal(t, uint64(len(Records)), got.Operations.Sets)
+		assert.Equal(t, uint64(len(Records)), got.Latencies["set"].Count)
+
+		err = store.PublishExpvar("scdb_test_store")
+		expectedErr := errors.NewErrNotSupported(`publishing to the existing expvar variable "scdb_test_store"`)
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("PublishExpvarConcurrentlyToTheSameNamePublishesOnceAndErrsTheRest", func(t *testing.T) {
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		errs := make(chan error, 10)
+		var wg sync.WaitGroup
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- store.PublishExpvar("scdb_test_concurrent_store")
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		published := 0
+		expectedErr := errors.NewErrNotSupported(`publishing to the existing expvar variable "scdb_test_concurrent_store"`)
+		for err := range errs {
+			if err == nil {
+				published++
+			} else {
+				assert.Equal(t, expectedErr, err)
+			}
+		}
+		assert.Equal(t, 1, published)
+	})
+}
+
+func TestNewMetricsHandler(t *testing.T) {
+	dbPaths := []string{"testdb_metrics_handler_1", "testdb_metrics_handler_2"}
+	for _, dbPath := range dbPaths {
+		removeStore(t, dbPath)
+	}
+	defer func() {
+		for _, dbPath := range dbPaths {
+			removeStore(t, dbPath)
+		}
+	}()
+
+	t.Run("MetricsHandlerServesTheMetricsOfEachStoreInThePrometheusTextFormat", func(t *testing.T) {
+		withLatencies := createStore(t, dbPaths[0], nil, false, WithMetrics())
+		defer func() {
+			_ = withLatencies.Close()
+		}()
+		withoutLatencies := createStore(t, dbPaths[1], nil, false)
+		defer func() {
+			_ = withoutLatencies.Close()
+		}()
+		for _, store := range []*Store{withLatencies, withoutLatencies} {
+			insertRecords(t, store, Records, nil)
+			deleteRecords(t, store, [][]byte{Records[0].k})
+			err := store.Compact()
+			if err != nil {
+				t.Fatalf("error compacting store: %s", err)
+			}
+		}
+
+		handler := NewMetricsHandler(map[string]*Store{"users": withLatencies, `a "b"`: withoutLatencies})
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+		body := readBody(t, recorder.Result().Body)
+
+		assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+		reclaimed := fmt.Sprintf("%d", getEntrySize(Records[0]))
+		expectedLines := []string{
+			"# TYPE scdb_keys gauge",
+			`scdb_keys{store="users"} 6`,
+			`scdb_keys{store="a \"b\""} 6`,
+			"# TYPE scdb_operations_total counter",
+			`scdb_operations_total{store="users",operation="set"} 7`,
+			`scdb_operations_total{store="a \"b\"",operation="delete"} 1`,
+			"# TYPE scdb_operation_duration_seconds histogram",
+			`scdb_operation_duration_seconds_bucket{store="users",operation="set",le="+Inf"} 7`,
+			`scdb_operation_duration_seconds_count{store="users",operation="set"} 7`,
+			`scdb_operation_duration_seconds_count{store="users",operation="compact"} 1`,
+			"# TYPE scdb_cache_hit_ratio gauge",
+			"# TYPE scdb_compactions_total counter",
+			`scdb_compactions_total{store="users"} 1`,
+			`scdb_compaction_reclaimed_bytes_total{store="a \"b\""} ` + reclaimed,
+			"# TYPE scdb_last_compaction_duration_seconds gauge",
+			`scdb_collision_saturations_total{store="users"} 0`,
+		}
+		for _, line := range expectedLines {
+			assert.Contains(t, body, line+"\n")
+		}
+		assert.Contains(t, body, `scdb_cache_hit_ratio{store="users",cache="kv"} `)
+		assert.Contains(t, body, `scdb_cache_hit_ratio{store="users",cache="index"} `)
+		assert.NotContains(t, body, `scdb_operation_duration_seconds_count{store="a \"b\""`)
+		// the stores are in the order of their names
+		assert.Less(t, strings.Index(body, `scdb_keys{store="a \"b\""}`), strings.Index(body, `scdb_keys{store="users"}`))
+	})
+}
+
+func ExampleStore_Metrics() {
+	store, err := New("testdb_metrics_example", nil, nil, nil, nil, false, WithMetrics())
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+		_ = os.RemoveAll("testdb_metrics_example")
+	}()
+
+	err = store.Set([]byte("foo"), []byte("bar"), nil)
+	if err != nil {
+		log.Fatalf("error setting key value: %s", err)
+	}
+
+	_, err = store.Get([]byte("foo"))
+	if err != nil {
+		log.Fatalf("error getting key: %s", err)
+	}
+
+	metrics := store.Metrics()
+	fmt.Printf("keys: %d, gets: %d, timed gets: %d", metrics.Keys, metrics.Operations.Gets, metrics.Latencies["get"].Count)
+	// Output: keys: 1, gets: 1, timed gets: 1
+}
+
+// sumOf returns the sum of the given numbers
+func sumOf(numbers []uint64) uint64 {
+	var sum uint64
+	for _, n := range numbers {
+		sum += n
+	}
+
+	return sum
+}
+
+// readBody reads the whole of the body of an HTTP response, failing the test if it can't
+func readBody(t *testing.T, body io.ReadCloser) string {
+	defer func() {
+		_ = body.Close()
+	}()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("error reading body: %s", err)
+	}
+
+	return string(data)
+}
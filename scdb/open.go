@@ -0,0 +1,131 @@
+package scdb
+
+import (
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/buffers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
+	"github.com/sopherapps/go-scdb/scdb/internal/ordered_index"
+	"os"
+	"path/filepath"
+)
+
+// OpenMode is the way in which Open opens a store
+type OpenMode uint8
+
+const (
+	// ReadWrite opens the store for reading and writing, creating it if it does not exist, just like New does.
+	ReadWrite OpenMode = iota
+
+	// ReadOnly opens an existing store for reading only.
+	//
+	// No file is created or written to, and the store is never compacted. Any write e.g. Set, Delete, Clear
+	// or Compact returns an errors.ErrReadOnly. Any number of read-only Stores, in this or other processes,
+	// can have the store open at the same time, but not while a Store that can write has it open.
+	//
+	// Since nothing can be written, a store left with operations in its write-ahead log, or with an
+	// unfinished compaction, by a crash can't be opened read-only until it is opened for writing once.
+	// The same goes for an ordered index that is out of date, after the store was opened without it.
+	ReadOnly
+)
+
+// Open opens the store at the given path in the given mode, with the default configurations of New.
+//
+// The optional configurations `opts` e.g. WithSearch() or WithOrderedIndex() work just like they do in New.
+// Those that are only about writing e.g. WithWAL() or WithSyncPolicy() are ignored in ReadOnly mode.
+func Open(path string, mode OpenMode, opts ...Option) (*Store, error) {
+	if mode == ReadOnly {
+		return openReadOnly(path, newOptions(opts))
+	}
+
+	return New(path, nil, nil, nil, nil, false, opts...)
+}
+
+// openReadOnly opens the existing store at the given path for reading only
+func openReadOnly(path string, o *options) (*Store, error) {
+	// stores created before the lock file was added have none, and it can't be created here
+	fileLock, err := internal.LockFile(filepath.Join(path, LockFileName), true)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	isOpened := false
+	defer func() {
+		if !isOpened {
+			_ = fileLock.Unlock()
+		}
+	}()
+
+	isCompactionInterrupted, err := buffers.IsCompactionInterrupted(path)
+	if err != nil {
+		return nil, err
+	}
+	if isCompactionInterrupted {
+		return nil, errors.NewErrReadOnly("recovery of an interrupted compaction")
+	}
+
+	walFilePath := filepath.Join(path, WalFileName)
+	walFileInfo, err := os.Stat(walFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil && walFileInfo.Size() > 0 {
+		return nil, errors.NewErrReadOnly("replay of the write-ahead log")
+	}
+
+	bufferPool, err := buffers.NewReadOnlyBufferPool(nil, filepath.Join(path, DbFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := headers.ExtractDbFileHeaderFromFile(bufferPool.File)
+	if err != nil {
+		return nil, err
+	}
+
+	// files in an older format are read as they are, since they can't be upgraded
+	var searchIndex *inverted_index.InvertedIndex
+	if o.isSearchEnabled {
+		searchIndex, err = inverted_index.NewReadOnlyInvertedIndex(filepath.Join(path, SearchIndexFileName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var orderedIndex *ordered_index.OrderedIndex
+	if o.isOrderedIndexEnabled {
+		orderedIndex, err = ordered_index.NewReadOnlyOrderedIndex(filepath.Join(path, OrderedIndexFileName))
+		if err != nil {
+			return nil, err
+		}
+
+		if orderedIndex.Generation != header.Generation {
+			return nil, errors.NewErrReadOnly("rebuild of an out-of-date ordered index")
+		}
+	}
+
+	indexedKeys, err := bufferPool.CountIndexedKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	isOpened = true
+	return &Store{
+		bufferPool:    bufferPool,
+		header:        header,
+		searchIndex:   searchIndex,
+		orderedIndex:  orderedIndex,
+		fileLock:      fileLock,
+		walFilePath:   walFilePath,
+		isReadOnly:    true,
+		maxLoadFactor: o.maxLoadFactor,
+		indexedKeys:   indexedKeys,
+		closeCh:       make(chan bool),
+		compactCh:     make(chan struct{}, 1),
+		// expired keys could be in the file, unknown till they are read
+		hasExpiringEntries: true,
+		maxGarbageRatio:    o.maxGarbageRatio,
+		maxGarbageBytes:    o.maxGarbageBytes,
+		latencies:          newOperationLatencies(o.isMetricsEnabled),
+	}, nil
+}
@@ -0,0 +1,347 @@
+package scdb
+
+import (
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/wal"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpen(t *testing.T) {
+	dbPath := "testdb_open"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("OpenInReadWriteModeCreatesTheStoreLikeNew", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := openStore(t, dbPath, ReadWrite, WithSearch())
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		assertStoreContains(t, store, Records)
+		assertSearchResults(t, store, []byte("h"), []testRecord{Records[0], Records[1], Records[4]})
+	})
+
+	t.Run("OpenInReadOnlyModeReadsTheStoreWithoutChangingItsFiles", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		ttl := 500 * time.Millisecond
+		func() {
+			store := createStore(t, dbPath, nil, true, WithOrderedIndex())
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records[:5], nil)
+			insertRecords(t, store, Records[5:], &ttl)
+			deleteRecords(t, store, [][]byte{Records[0].k})
+		}()
+		// the last records are expired, but the files still have them
+		time.Sleep(time.Second)
+		initialContents := readStoreFiles(t, dbPath)
+
+		store := openStore(t, dbPath, ReadOnly, WithSearch(), WithOrderedIndex())
+		assertStoreContains(t, store, Records[1:5])
+		assertKeysDontExist(t, store, [][]byte{Records[0].k, Records[5].k, Records[6].k})
+		assertSearchResults(t, store, []byte("h"), []testRecord{Records[1], Records[4]})
+		assertRangeResults(t, store, nil, nil, 0, false, []testRecord{Records[3], Records[1], Records[4], Records[2]})
+		assert.Equal(t, uint64(4), store.Len())
+
+		err := store.Close()
+		if err != nil {
+			t.Fatalf("error closing store: %s", err)
+		}
+		assert.Equal(t, initialContents, readStoreFiles(t, dbPath))
+	})
+
+	t.Run("OpenInReadOnlyModeReturnsErrReadOnlyForWrites", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
+		}()
+
+		store := openStore(t, dbPath, ReadOnly)
+		defer func() {
+			_ = store.Close()
+		}()
+		batch := NewWriteBatch()
+		batch.Delete(Records[0].k)
+
+		writes := map[string]func() error{
+			"Set":     func() error { return store.Set(Records[0].k, []byte("foo"), nil) },
+			"Delete":  func() error { return store.Delete(Records[0].k) },
+			"Clear":   func() error { return store.Clear() },
+			"Compact": func() error { return store.Compact() },
+			"Resize":  func() error { return store.Resize(2_000_000) },
+			"Batch":   func() error { return store.Batch(batch) },
+			"Update": func() error {
+				return store.Update(func(tx *Tx) error { return nil })
+			},
+			"Expire": func() error {
+				_, err := store.Expire(Records[0].k, time.Hour)
+				return err
+			},
+			"Persist": func() error {
+				_, err := store.Persist(Records[0].k)
+				return err
+			},
+			"CompareAndSwap": func() error {
+				_, err := store.CompareAndSwap(Records[0].k, Records[0].v, []byte("foo"), nil)
+				return err
+			},
+			"SetIfNotExists": func() error {
+				_, err := store.SetIfNotExists([]byte("foo"), []byte("bar"), nil)
+				return err
+			},
+			"GetAndSet": func() error {
+				_, err := store.GetAndSet(Records[0].k, []byte("foo"), nil)
+				return err
+			},
+			"GetAndDelete": func() error {
+				_, err := store.GetAndDelete(Records[0].k)
+				return err
+			},
+			"Increment": func() error {
+				_, err := store.Increment([]byte("count"), 1)
+				return err
+			},
+		}
+
+		for name, write := range writes {
+			assert.IsType(t, &errors.ErrReadOnly{}, write(), name)
+		}
+
+		assertStoreContains(t, store, Records)
+		assert.Nil(t, store.Sync())
+	})
+
+	t.Run("OpenInReadOnlyModeOfNonExistingStoreCreatesNothing", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+
+		_, err := Open(dbPath, ReadOnly)
+		assert.True(t, os.IsNotExist(err))
+
+		exists, err := internal.PathExists(dbPath)
+		if err != nil {
+			t.Fatalf("error checking store directory: %s", err)
+		}
+		assert.False(t, exists)
+	})
+
+	t.Run("ReadOnlyStoresCanBeOpenTogetherButNotWithAStoreThatWrites", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
+		}()
+
+		first := openStore(t, dbPath, ReadOnly)
+		second := openStore(t, dbPath, ReadOnly)
+		assertStoreContains(t, first, Records)
+		assertStoreContains(t, second, Records)
+
+		_, err := New(dbPath, nil, nil, nil, nil, false)
+		assert.Equal(t, errors.NewErrStoreLocked(dbPath), err)
+
+		for _, store := range []*Store{first, second} {
+			err = store.Close()
+			if err != nil {
+				t.Fatalf("error closing store: %s", err)
+			}
+		}
+
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		_, err = Open(dbPath, ReadOnly)
+		assert.Equal(t, errors.NewErrStoreLocked(dbPath), err)
+	})
+
+	t.Run("OpenInReadOnlyModeOfStoreWithLogLeftByACrashReturnsErrReadOnly", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
+		}()
+
+		// simulate a crash just after the operation was logged
+		writeToWal(t, filepath.Join(dbPath, "dump.wal"), wal.Op{Kind: wal.OpDelete, Key: Records[0].k})
+
+		_, err := Open(dbPath, ReadOnly)
+		assert.IsType(t, &errors.ErrReadOnly{}, err)
+
+		// opening it for writing replays the log, after which it can be opened read-only
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+		}()
+
+		store := openStore(t, dbPath, ReadOnly)
+		defer func() {
+			_ = store.Close()
+		}()
+		assertStoreContains(t, store, Records[1:])
+		assertKeysDontExist(t, store, [][]byte{Records[0].k})
+	})
+
+	t.Run("OpenInReadOnlyModeOfStoreWithOutOfDateOrderedIndexReturnsErrReadOnly", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false, WithOrderedIndex())
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records[:3], nil)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records[3:], nil)
+		}()
+
+		_, err := Open(dbPath, ReadOnly, WithOrderedIndex())
+		assert.IsType(t, &errors.ErrReadOnly{}, err)
+
+		// opening it for writing with the ordered index rebuilds it, after which it can be opened read-only
+		func() {
+			store := createStore(t, dbPath, nil, false, WithOrderedIndex())
+			defer func() {
+				_ = store.Close()
+			}()
+		}()
+
+		store := openStore(t, dbPath, ReadOnly, WithOrderedIndex())
+		defer func() {
+			_ = store.Close()
+		}()
+		assertRangeResults(t, store, nil, nil, 0, false, []testRecord{Records[3], Records[0], Records[1], Records[4], Records[6], Records[5], Records[2]})
+	})
+
+	t.Run("OpenInReadOnlyModeOfStoreInOlderFormatReadsItAsItIs", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		expiries := make([]uint64, len(Records))
+		expiries[1] = uint64(time.Now().Add(time.Hour).Unix())
+		expiries[2] = uint64(time.Now().Add(-time.Hour).Unix())
+		writeSecondsFormatStore(t, dbPath, Records, expiries)
+		initialContents := readStoreFiles(t, dbPath)
+
+		store := openStore(t, dbPath, ReadOnly)
+		assertStoreContains(t, store, append([]testRecord{Records[0], Records[1]}, Records[3:]...))
+		assertKeysDontExist(t, store, [][]byte{Records[2].k})
+
+		ttl := getTTL(t, store, Records[1].k)
+		if assert.NotNil(t, ttl) {
+			assert.InDelta(t, time.Hour, *ttl, float64(2*time.Second))
+		}
+
+		err := store.Close()
+		if err != nil {
+			t.Fatalf("error closing store: %s", err)
+		}
+		assert.Equal(t, initialContents, readStoreFiles(t, dbPath))
+	})
+}
+
+func ExampleOpen() {
+	func() {
+		store, err := New("testdb", nil, nil, nil, nil, false)
+		if err != nil {
+			log.Fatalf("error opening store: %s", err)
+		}
+		defer func() {
+			_ = store.Close()
+		}()
+
+		err = store.Set([]byte("foo"), []byte("bar"), nil)
+		if err != nil {
+			log.Fatalf("error setting key value: %s", err)
+		}
+	}()
+
+	store, err := Open("testdb", ReadOnly)
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	value, err := store.Get([]byte("foo"))
+	if err != nil {
+		log.Fatalf("error getting key: %s", err)
+	}
+
+	err = store.Delete([]byte("foo"))
+	fmt.Printf("%s\n%s", value, err)
+	// Output:
+	// bar
+	// Read Only Error: delete not allowed on a read-only store
+}
+
+// openStore opens the store at the given path in the given mode
+func openStore(t *testing.T, path string, mode OpenMode, opts ...Option) *Store {
+	store, err := Open(path, mode, opts...)
+	if err != nil {
+		t.Fatalf("error opening store: %s", err)
+	}
+
+	return store
+}
+
+// readStoreFiles reads the contents of all the files of the store at the given path, mapped to their names
+func readStoreFiles(t *testing.T, path string) map[string][]byte {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		t.Fatalf("error reading store directory: %s", err)
+	}
+
+	contents := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(path, entry.Name()))
+		if err != nil {
+			t.Fatalf("error reading file: %s", err)
+		}
+		contents[entry.Name()] = data
+	}
+
+	return contents
+}
@@ -0,0 +1,176 @@
+package scdb
+
+import "time"
+
+// defaultSyncInterval is the default interval at which writes are synced to disk when the policy is SyncInterval
+const defaultSyncInterval = time.Second
+
+// defaultMaxLoadFactor is the default fraction of the index that can be filled before the index is grown
+const defaultMaxLoadFactor = 0.9
+
+// defaultMaxGarbageRatio is the default fraction of the database file's key-value entries that can be dead
+// before the store is compacted
+const defaultMaxGarbageRatio = 0.5
+
+// minGarbageBytesForRatio is the least number of dead bytes for which the garbage ratio triggers compaction.
+// This avoids compacting small stores over and over again for a few bytes.
+const minGarbageBytesForRatio uint64 = 1024 * 1024
+
+// SyncPolicy is the policy that determines when writes to the store are flushed (i.e. fsync'ed) to disk
+type SyncPolicy uint8
+
+const (
+	// SyncNever leaves the flushing of writes to disk to the operating system.
+	// It is the fastest but writes that were successful may be lost on power failure.
+	SyncNever SyncPolicy = iota
+
+	// SyncAlways flushes every write to disk before it returns.
+	// It is the slowest but every write that was successful survives power failure.
+	SyncAlways
+
+	// SyncInterval flushes all writes made in a given interval to disk at the end of that interval.
+	// At most, only the writes in the last interval may be lost on power failure.
+	SyncInterval
+)
+
+// Option is an optional configuration of the Store, passed to New after its required configurations
+type Option func(*options)
+
+// options are the optional configurations of the Store
+type options struct {
+	isWalEnabled    bool
+	syncPolicy      SyncPolicy
+	syncInterval    time.Duration
+	maxLoadFactor   float64
+	maxGarbageRatio float64
+	maxGarbageBytes uint64
+	// isOrderedIndexEnabled is true if the keys are also kept in sorted order for Store.Range
+	isOrderedIndexEnabled bool
+	// isSearchEnabled is true if the keys are also kept in the search index for Store.Search
+	isSearchEnabled bool
+	// isMetricsEnabled is true if the latencies of operations are recorded for Store.Metrics
+	isMetricsEnabled bool
+}
+
+// WithWAL enables the write-ahead log of the store.
+//
+// When enabled, every `set`, `delete` and `clear` operation is first recorded in a log file
+// in the store's directory before the database and index files are touched.
+// If the process crashes in the middle of an operation, the log is replayed the next time the store
+// is opened, so that the store is either in the state before or after that operation, never in between.
+// Note that this makes `set`, `delete` and `clear` a little slower.
+func WithWAL() Option {
+	return func(o *options) {
+		o.isWalEnabled = true
+	}
+}
+
+// WithSyncPolicy sets the policy that determines when writes to the store are flushed to disk.
+// The default is SyncNever.
+//
+// When the write-ahead log is enabled, it is the log that is flushed on every write under SyncAlways,
+// since the database files are flushed before the log is emptied.
+func WithSyncPolicy(policy SyncPolicy) Option {
+	return func(o *options) {
+		o.syncPolicy = policy
+	}
+}
+
+// WithSyncInterval sets the interval at which writes are flushed to disk under the SyncInterval policy.
+// The default is 1 second.
+func WithSyncInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.syncInterval = interval
+	}
+}
+
+// WithMaxLoadFactor sets the fraction of the store's `maxKeys` that can be filled before the index is grown
+// automatically. It must be greater than 0 and not more than 1. The default is 0.9.
+//
+// The index is grown by the background compaction task, which copies the database file into one with a bigger index
+// one index block at a time, just like Store.Compact, so other reads and writes go on while it grows.
+//
+// The index is also grown whenever a new key finds all its slots in the index taken, whatever the load factor.
+// As the key can't be written until then, that growth happens at once, holding up all other reads and writes
+// while the whole database file is rewritten, which takes time in proportion to the size of the file.
+// A lower load factor makes this rarer.
+func WithMaxLoadFactor(factor float64) Option {
+	return func(o *options) {
+		o.maxLoadFactor = factor
+	}
+}
+
+// WithMaxGarbageRatio sets the fraction of the database file's key-value entries that can be dead i.e. deleted,
+// overwritten or expired, before the store is compacted in the background. It must be greater than 0 and
+// not more than 1. The default is 0.5.
+//
+// The ratio only applies once the dead entries add up to at least 1 MiB.
+func WithMaxGarbageRatio(ratio float64) Option {
+	return func(o *options) {
+		o.maxGarbageRatio = ratio
+	}
+}
+
+// WithMaxGarbageBytes sets the total size, in bytes, of the dead key-value entries beyond which the store is compacted
+// in the background, whatever the garbage ratio. The default is 0 i.e. only the garbage ratio applies.
+func WithMaxGarbageBytes(size uint64) Option {
+	return func(o *options) {
+		o.maxGarbageBytes = size
+	}
+}
+
+// WithOrderedIndex enables the ordered index of the store, which keeps its keys in sorted order
+// in a file in the store's directory so that Store.Range can scan them.
+//
+// The ordered index is kept up to date by `set`, `delete`, `clear` and `compact` operations, making them a little slower.
+// It is built from the keys in the store when it is enabled for the first time. If it is left out when opening
+// the store later on, it misses the writes made till the store is closed, so it is rebuilt when next enabled.
+// A read-only store with such an out-of-date ordered index returns an errors.ErrReadOnly when opened.
+func WithOrderedIndex() Option {
+	return func(o *options) {
+		o.isOrderedIndexEnabled = true
+	}
+}
+
+// WithSearch enables the search capability of the store, just like passing `isSearchEnabled` as true to New does.
+// It is mostly for Open, which has no `isSearchEnabled` argument.
+func WithSearch() Option {
+	return func(o *options) {
+		o.isSearchEnabled = true
+	}
+}
+
+// WithMetrics enables the recording of the latencies of Get, Set, Delete, Search and Compact operations,
+// which Store.Metrics returns as histograms. The other metrics are recorded whether it is enabled or not.
+//
+// Note that this makes those operations a little slower, as the time is read before and after each of them.
+func WithMetrics() Option {
+	return func(o *options) {
+		o.isMetricsEnabled = true
+	}
+}
+
+// newOptions creates the options of the store from the given list of Option's
+func newOptions(opts []Option) *options {
+	o := &options{
+		syncInterval:    defaultSyncInterval,
+		maxLoadFactor:   defaultMaxLoadFactor,
+		maxGarbageRatio: defaultMaxGarbageRatio,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.syncInterval <= 0 {
+		o.syncInterval = defaultSyncInterval
+	}
+
+	if o.maxLoadFactor <= 0 || o.maxLoadFactor > 1 {
+		o.maxLoadFactor = defaultMaxLoadFactor
+	}
+
+	if o.maxGarbageRatio <= 0 || o.maxGarbageRatio > 1 {
+		o.maxGarbageRatio = defaultMaxGarbageRatio
+	}
+	return o
+}
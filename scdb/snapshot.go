@@ -0,0 +1,154 @@
+package scdb
+
+import (
+	"bytes"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
+	"github.com/sopherapps/go-scdb/scdb/internal/buffers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+)
+
+// Snapshot is a read-only view of a Store as it was at the time the snapshot was taken.
+//
+// It keeps seeing the same data even as keys are set, deleted or expired, and as the store is compacted,
+// resized or cleared. Keys whose expiry passes after the snapshot was taken are still seen by it.
+// This makes it useful for consistent backups, and for reading several keys as of a single point in time.
+//
+// A snapshot holds onto the old database file, and onto copies of the parts of it that get overwritten,
+// until it is closed. It must thus be closed once it is no longer needed, and should not be used after the store is closed.
+type Snapshot struct {
+	snapshot *buffers.Snapshot
+}
+
+// Snapshot takes a snapshot of the store as it is now.
+func (s *Store) Snapshot() (*Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.isClosed {
+		return nil, errors.NewErrNotSupported("use of a closed store")
+	}
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	snapshot, err := s.bufferPool.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{snapshot: snapshot}, nil
+}
+
+// Get returns the value corresponding to the given key as it was when the snapshot was taken,
+// or nil if the key was not in the store then
+func (sn *Snapshot) Get(k []byte) ([]byte, error) {
+	initialIdxOffset := headers.GetIndexOffset(sn.snapshot.Header, k)
+
+	for idxBlock := uint64(0); idxBlock < sn.snapshot.Header.NumberOfIndexBlocks; idxBlock++ {
+		indexOffset, err := headers.GetIndexOffsetInNthBlock(sn.snapshot.Header, initialIdxOffset, idxBlock)
+		if err != nil {
+			return nil, err
+		}
+
+		kvOffset, err := sn.readIndex(indexOffset)
+		if err != nil {
+			return nil, err
+		}
+
+		if kvOffset == 0 {
+			continue
+		}
+
+		entry, err := sn.snapshot.GetValue(kvOffset, k)
+		if err != nil {
+			return nil, err
+		}
+
+		if entry != nil {
+			return entry.Value, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Len returns the number of keys the store had when the snapshot was taken.
+// Just like in Store.Len, keys that had expired but had not been read by then are counted.
+func (sn *Snapshot) Len() uint64 {
+	return sn.snapshot.KeyCount
+}
+
+// Iterate calls `fn` for each key-value pair the store had when the snapshot was taken,
+// in the order of the pairs' slots in the index.
+//
+// It stops at the first error returned by `fn`, returning that error. The store is not locked,
+// so `fn` may itself read from, and write to, the store.
+func (sn *Snapshot) Iterate(fn func(k []byte, v []byte) error) error {
+	return sn.iterateEntries(func(entry *values.KeyValueEntry) error {
+		return fn(entry.Key, entry.Value)
+	})
+}
+
+// iterateEntries calls `fn` for each key-value entry that was live when the snapshot was taken,
+// in the order of the entries' slots in the index. It stops at the first error returned by `fn`, returning that error.
+func (sn *Snapshot) iterateEntries(fn func(entry *values.KeyValueEntry) error) error {
+	blockSize := sn.snapshot.Header.NetBlockSize
+	indexEnd := headers.HeaderSizeInBytes + sn.snapshot.Header.NumberOfIndexBlocks*blockSize
+	for blockAddr := headers.HeaderSizeInBytes; blockAddr < indexEnd; blockAddr += blockSize {
+		block, err := sn.snapshot.ReadIndexEntries(blockAddr, blockSize)
+		if err != nil {
+			return err
+		}
+
+		for i := uint64(0); i < blockSize; i += headers.IndexEntrySizeInBytes {
+			kvOffsetInBytes := block[i : i+headers.IndexEntrySizeInBytes]
+			if bytes.Equal(kvOffsetInBytes, zeroU64) {
+				continue
+			}
+
+			kvOffset, err := internal.Uint64FromByteArray(kvOffsetInBytes)
+			if err != nil {
+				return err
+			}
+
+			entry, err := sn.snapshot.GetValue(kvOffset, nil)
+			if err != nil {
+				return err
+			}
+
+			if entry == nil {
+				continue
+			}
+
+			err = fn(entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close frees up the snapshot's resources. It is unusable after this.
+func (sn *Snapshot) Close() error {
+	return sn.snapshot.Close()
+}
+
+// readIndex returns the address of the key-value entry in the index slot at the given address,
+// or 0 if the slot was empty when the snapshot was taken
+func (sn *Snapshot) readIndex(indexAddr uint64) (uint64, error) {
+	kvOffsetInBytes, err := sn.snapshot.ReadIndex(indexAddr)
+	if err != nil {
+		return 0, err
+	}
+
+	if bytes.Equal(kvOffsetInBytes, zeroU64) {
+		return 0, nil
+	}
+
+	return internal.Uint64FromByteArray(kvOffsetInBytes)
+}
@@ -0,0 +1,290 @@
+package scdb
+
+import (
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStore_Snapshot(t *testing.T) {
+	dbPath := "testdb_snapshot"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	newRecords := []testRecord{
+		{Records[0].k, []byte("Anglais")},
+		{Records[2].k, []byte("Francais")},
+	}
+
+	t.Run("SnapshotSeesTheStoreAsItWasWhenTaken", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:5], nil)
+
+		snapshot := takeSnapshot(t, store)
+		defer func() {
+			_ = snapshot.Close()
+		}()
+
+		insertRecords(t, store, newRecords, nil)
+		deleteRecords(t, store, [][]byte{Records[1].k})
+		_, err := store.Expire(Records[3].k, time.Millisecond)
+		if err != nil {
+			t.Fatalf("error expiring key: %s", err)
+		}
+		insertRecords(t, store, Records[5:], nil)
+		time.Sleep(10 * time.Millisecond)
+
+		assertSnapshotContains(t, snapshot, Records[:5])
+		assertSnapshotKeysDontExist(t, snapshot, extractKeysFromRecords(Records[5:]))
+		assert.Equal(t, uint64(5), snapshot.Len())
+
+		assertStoreContains(t, store, newRecords)
+		assertKeysDontExist(t, store, [][]byte{Records[1].k, Records[3].k})
+		assert.Equal(t, uint64(5), store.Len())
+	})
+
+	t.Run("SnapshotIsUnchangedByCompactionResizeAndClear", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		ops := map[string]func() error{
+			"Compact": store.Compact,
+			"Resize":  func() error { return store.Resize(2_000_000) },
+			"Clear":   store.Clear,
+		}
+
+		for name, op := range ops {
+			insertRecords(t, store, Records, nil)
+			snapshot := takeSnapshot(t, store)
+
+			insertRecords(t, store, newRecords, nil)
+			deleteRecords(t, store, [][]byte{Records[1].k})
+			err := op()
+			if err != nil {
+				t.Fatalf("error running %s: %s", name, err)
+			}
+
+			assertSnapshotContains(t, snapshot, Records)
+			assert.Equal(t, uint64(len(Records)), snapshot.Len(), name)
+			assert.ElementsMatch(t, Records, collectFromSnapshot(t, snapshot), name)
+
+			err = snapshot.Close()
+			if err != nil {
+				t.Fatalf("error closing snapshot: %s", err)
+			}
+		}
+	})
+
+	t.Run("SnapshotKeepsKeysThatExpireAfterItIsTaken", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		ttl := 500 * time.Millisecond
+		insertRecords(t, store, Records[:3], &ttl)
+		insertRecords(t, store, Records[3:], nil)
+
+		snapshot := takeSnapshot(t, store)
+		defer func() {
+			_ = snapshot.Close()
+		}()
+		time.Sleep(time.Second)
+
+		assertKeysDontExist(t, store, extractKeysFromRecords(Records[:3]))
+		assertSnapshotContains(t, snapshot, Records)
+	})
+
+	t.Run("SnapshotIterateCallsFnForEachKeyValuePairTheStoreHadWhenTaken", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		ttl := time.Millisecond
+		insertRecords(t, store, Records[:5], nil)
+		insertRecords(t, store, Records[5:], &ttl)
+		time.Sleep(10 * time.Millisecond)
+
+		snapshot := takeSnapshot(t, store)
+		defer func() {
+			_ = snapshot.Close()
+		}()
+		deleteRecords(t, store, extractKeysFromRecords(Records[:2]))
+		insertRecords(t, store, newRecords, nil)
+
+		assert.ElementsMatch(t, Records[:5], collectFromSnapshot(t, snapshot))
+	})
+
+	t.Run("SnapshotCanBeReadWhileTheStoreIsWrittenTo", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		snapshot := takeSnapshot(t, store)
+		defer func() {
+			_ = snapshot.Close()
+		}()
+
+		wg := sync.WaitGroup{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 5; i++ {
+				for _, record := range Records {
+					err := store.Set(record.k, []byte(fmt.Sprintf("%s%d", record.v, i)), nil)
+					if err != nil {
+						t.Errorf("error setting key: %s", err)
+						return
+					}
+				}
+
+				err := store.Compact()
+				if err != nil {
+					t.Errorf("error compacting store: %s", err)
+					return
+				}
+			}
+		}()
+
+		for i := 0; i < 5; i++ {
+			assertSnapshotContains(t, snapshot, Records)
+		}
+		wg.Wait()
+		assertSnapshotContains(t, snapshot, Records)
+	})
+
+	t.Run("ClosedSnapshotOrSnapshotOfClosedStoreReturnsErrNotSupported", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		insertRecords(t, store, Records, nil)
+
+		snapshot := takeSnapshot(t, store)
+		err := snapshot.Close()
+		if err != nil {
+			t.Fatalf("error closing snapshot: %s", err)
+		}
+		_, err = snapshot.Get(Records[0].k)
+		assert.Equal(t, errors.NewErrNotSupported("use of a closed snapshot"), err)
+
+		err = store.Close()
+		if err != nil {
+			t.Fatalf("error closing store: %s", err)
+		}
+		_, err = store.Snapshot()
+		assert.Equal(t, errors.NewErrNotSupported("use of a closed store"), err)
+	})
+}
+
+func ExampleStore_Snapshot() {
+	store, err := New("testdb", nil, nil, nil, nil, false)
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	err = store.Set([]byte("foo"), []byte("bar"), nil)
+	if err != nil {
+		log.Fatalf("error setting key value: %s", err)
+	}
+
+	snapshot, err := store.Snapshot()
+	if err != nil {
+		log.Fatalf("error taking snapshot: %s", err)
+	}
+	defer func() {
+		_ = snapshot.Close()
+	}()
+
+	err = store.Set([]byte("foo"), []byte("baz"), nil)
+	if err != nil {
+		log.Fatalf("error setting key value: %s", err)
+	}
+
+	old, err := snapshot.Get([]byte("foo"))
+	if err != nil {
+		log.Fatalf("error getting key from snapshot: %s", err)
+	}
+
+	current, err := store.Get([]byte("foo"))
+	if err != nil {
+		log.Fatalf("error getting key: %s", err)
+	}
+
+	fmt.Printf("%s\n%s", old, current)
+	// Output:
+	// bar
+	// baz
+}
+
+// takeSnapshot takes a snapshot of the given store, failing the test if it can't
+func takeSnapshot(t *testing.T, store *Store) *Snapshot {
+	snapshot, err := store.Snapshot()
+	if err != nil {
+		t.Fatalf("error taking snapshot: %s", err)
+	}
+
+	return snapshot
+}
+
+// assertSnapshotContains asserts that the snapshot has the given records
+func assertSnapshotContains(t *testing.T, snapshot *Snapshot, records []testRecord) {
+	for _, record := range records {
+		got, err := snapshot.Get(record.k)
+		assert.Nil(t, err)
+		assert.Equal(t, record.v, got)
+	}
+}
+
+// assertSnapshotKeysDontExist asserts that the given keys are not in the snapshot
+func assertSnapshotKeysDontExist(t *testing.T, snapshot *Snapshot, keys [][]byte) {
+	for _, k := range keys {
+		got, err := snapshot.Get(k)
+		assert.Nil(t, err)
+		assert.Nil(t, got)
+	}
+}
+
+// collectFromSnapshot returns all the key-value pairs in the snapshot
+func collectFromSnapshot(t *testing.T, snapshot *Snapshot) []testRecord {
+	records := make([]testRecord, 0)
+	err := snapshot.Iterate(func(k []byte, v []byte) error {
+		records = append(records, testRecord{k, v})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error iterating over snapshot: %s", err)
+	}
+
+	return records
+}
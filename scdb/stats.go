@@ -0,0 +1,147 @@
+package scdb
+
+import (
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"sync/atomic"
+)
+
+// Stats are statistics about a Store, for sizing its `maxKeys`, `redundantBlocks` and `poolCapacity`,
+// and for watching how it is used
+type Stats struct {
+	// DbFileSize is the size, in bytes, of the database file i.e. dump.scdb
+	DbFileSize uint64
+	// SearchIndexFileSize is the size, in bytes, of the search index file i.e. index.iscdb,
+	// or 0 if search is not enabled
+	SearchIndexFileSize uint64
+	// OrderedIndexFileSize is the size, in bytes, of the ordered index file i.e. index.oscdb,
+	// or 0 if the ordered index is not enabled
+	OrderedIndexFileSize uint64
+	// LiveKeys is the number of keys in the index that are neither deleted nor expired
+	LiveKeys uint64
+	// DeletedKeys is the number of keys in the index that are deleted, and are yet to be removed by compaction
+	DeletedKeys uint64
+	// ExpiredKeys is the number of keys in the index that are expired, and are yet to be removed by compaction
+	ExpiredKeys uint64
+	// DeadBytes is the total size of the key-value entries in the database file that are not live
+	// i.e. deleted, overwritten or expired. Unlike CompactionStats.DeadBytes, it is got by reading the index,
+	// so it includes the entries that died before the store was opened.
+	DeadBytes uint64
+	// BlockLoadFactors is the fraction of the slots of each block of the index that are filled,
+	// including those of deleted and expired keys
+	BlockLoadFactors []float64
+	// ProbeHistogram holds, at index n, the number of keys that are in the (n+1)th slot probed for them.
+	// Since the slots of a key are probed one block after another, it is the number of filled slots in each block.
+	ProbeHistogram []uint64
+	// KvCacheHitRate is the fraction of the key-value entries read since the store was opened
+	// that were found in the buffers of the pool, instead of being read from the file
+	KvCacheHitRate float64
+	// IndexCacheHitRate is the fraction of the index entries read since the store was opened
+	// that were found in the buffers of the pool, instead of being read from the file
+	IndexCacheHitRate float64
+	// Compaction are the statistics about the compactions of the store, including the last one
+	Compaction CompactionStats
+	// Operations are the numbers of operations done on the store since it was opened
+	Operations OperationStats
+}
+
+// OperationStats are the numbers of operations done on a Store since it was opened.
+// Failed operations are counted too.
+type OperationStats struct {
+	// Gets is the number of calls to Store.Get
+	Gets uint64
+	// Sets is the number of calls to Store.Set
+	Sets uint64
+	// Deletes is the number of calls to Store.Delete
+	Deletes uint64
+	// Searches is the number of calls to Store.Search
+	Searches uint64
+	// Ranges is the number of calls to Store.Range
+	Ranges uint64
+	// Batches is the number of calls to Store.Batch
+	Batches uint64
+}
+
+// operationCounters count the operations done on a Store. They are updated atomically since reads
+// run in parallel with each other.
+type operationCounters struct {
+	gets     atomic.Uint64
+	sets     atomic.Uint64
+	deletes  atomic.Uint64
+	searches atomic.Uint64
+	ranges   atomic.Uint64
+	batches  atomic.Uint64
+	// collisionSaturations counts the times a key found all its slots in the index taken by other keys
+	collisionSaturations atomic.Uint64
+}
+
+// Stats returns statistics about the store.
+//
+// The number of keys, the dead bytes and the load factors are got by reading the whole index, and the key of every
+// entry in it, so this takes about as long as Store.Keys does without the ordered index. Reads go on while it runs
+// but writes wait for it.
+func (s *Store) Stats() (*Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.isClosed {
+		return nil, errors.NewErrNotSupported("use of a closed store")
+	}
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	indexStats, err := s.bufferPool.IndexStats(s.header)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{
+		DbFileSize:       s.bufferPool.FileSize,
+		LiveKeys:         indexStats.LiveKeys,
+		DeletedKeys:      indexStats.DeletedKeys,
+		ExpiredKeys:      indexStats.ExpiredKeys,
+		BlockLoadFactors: make([]float64, len(indexStats.FilledSlots)),
+		ProbeHistogram:   indexStats.FilledSlots,
+		Operations: OperationStats{
+			Gets:     s.ops.gets.Load(),
+			Sets:     s.ops.sets.Load(),
+			Deletes:  s.ops.deletes.Load(),
+			Searches: s.ops.searches.Load(),
+			Ranges:   s.ops.ranges.Load(),
+			Batches:  s.ops.batches.Load(),
+		},
+	}
+
+	if s.searchIndex != nil {
+		stats.SearchIndexFileSize = s.searchIndex.FileSize
+	}
+
+	if s.orderedIndex != nil {
+		stats.OrderedIndexFileSize = s.orderedIndex.FileSize
+	}
+
+	stats.Compaction = s.currentCompactionStats()
+	if stats.Compaction.DataSize > indexStats.LiveBytes {
+		stats.DeadBytes = stats.Compaction.DataSize - indexStats.LiveBytes
+	}
+
+	for i, filledSlots := range indexStats.FilledSlots {
+		stats.BlockLoadFactors[i] = float64(filledSlots) / float64(s.header.ItemsPerIndexBlock)
+	}
+
+	cacheStats := s.bufferPool.CacheStats()
+	stats.KvCacheHitRate = hitRate(cacheStats.KvHits, cacheStats.KvMisses)
+	stats.IndexCacheHitRate = hitRate(cacheStats.IndexHits, cacheStats.IndexMisses)
+
+	return stats, nil
+}
+
+// hitRate returns the fraction of lookups that were hits, or 0 if there were no lookups
+func hitRate(hits uint64, misses uint64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+
+	return float64(hits) / float64(hits+misses)
+}
@@ -0,0 +1,163 @@
+package scdb
+
+import (
+	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStore_Stats(t *testing.T) {
+	dbPath := "testdb_stats"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("StatsCountsTheKeysAndDeadBytesEvenAfterTheStoreIsReopened", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true, WithOrderedIndex())
+		insertRecords(t, store, Records[:6], nil)
+		ttl := time.Millisecond
+		insertRecords(t, store, Records[6:], &ttl)
+		deleteRecords(t, store, [][]byte{Records[0].k})
+		insertRecords(t, store, Records[1:2], nil)
+		_ = store.Close()
+		time.Sleep(10 * time.Millisecond)
+
+		store = createStore(t, dbPath, nil, true, WithOrderedIndex())
+		defer func() {
+			_ = store.Close()
+		}()
+		stats := getStats(t, store)
+
+		assert.Equal(t, uint64(getFileSize(t, dbPath)), stats.DbFileSize)
+		assert.NotZero(t, stats.SearchIndexFileSize)
+		assert.NotZero(t, stats.OrderedIndexFileSize)
+		assert.Equal(t, uint64(5), stats.LiveKeys)
+		assert.Equal(t, uint64(1), stats.DeletedKeys)
+		assert.Equal(t, uint64(1), stats.ExpiredKeys)
+		assert.Equal(t, getEntrySize(Records[0])+getEntrySize(Records[1])+getEntrySize(Records[6]), stats.DeadBytes)
+
+		header := store.header
+		assert.Len(t, stats.BlockLoadFactors, int(header.NumberOfIndexBlocks))
+		assert.Len(t, stats.ProbeHistogram, int(header.NumberOfIndexBlocks))
+		assert.Equal(t, uint64(len(Records)), stats.ProbeHistogram[0])
+		assert.Equal(t, float64(len(Records))/float64(header.ItemsPerIndexBlock), stats.BlockLoadFactors[0])
+	})
+
+	t.Run("StatsCountsTheOperationsAndCacheLookupsSinceTheStoreWasOpened", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		insertRecords(t, store, Records, nil)
+		for i := 0; i < 3; i++ {
+			assertStoreContains(t, store, Records[:2])
+		}
+		deleteRecords(t, store, [][]byte{Records[0].k})
+		assertSearchResults(t, store, []byte("h"), []testRecord{Records[1], Records[4]})
+		err := store.Batch(NewWriteBatch())
+		if err != nil {
+			t.Fatalf("error applying batch: %s", err)
+		}
+
+		stats := getStats(t, store)
+		assert.Equal(t, OperationStats{
+			Gets:     6,
+			Sets:     uint64(len(Records)),
+			Deletes:  1,
+			Searches: 1,
+			Batches:  1,
+		}, stats.Operations)
+		assert.Greater(t, stats.KvCacheHitRate, 0.0)
+		assert.LessOrEqual(t, stats.KvCacheHitRate, 1.0)
+		assert.Greater(t, stats.IndexCacheHitRate, 0.0)
+		assert.LessOrEqual(t, stats.IndexCacheHitRate, 1.0)
+	})
+
+	t.Run("StatsHasTheTimeAndDurationOfTheLastCompaction", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		deleteRecords(t, store, [][]byte{Records[0].k})
+		assert.Equal(t, getEntrySize(Records[0]), getStats(t, store).DeadBytes)
+
+		startedAt := time.Now()
+		err := store.Compact()
+		if err != nil {
+			t.Fatalf("error compacting store: %s", err)
+		}
+
+		stats := getStats(t, store)
+		assert.Equal(t, uint64(0), stats.DeadBytes)
+		assert.Equal(t, uint64(1), stats.Compaction.Compactions)
+		assert.False(t, stats.Compaction.LastCompactedAt.Before(startedAt))
+		assert.Greater(t, stats.Compaction.LastDuration, time.Duration(0))
+		assert.Equal(t, uint64(0), stats.DeletedKeys)
+	})
+
+	t.Run("StatsOfAClosedStoreReturnsErrNotSupported", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		_ = store.Close()
+
+		_, err := store.Stats()
+		assert.Equal(t, errors.NewErrNotSupported("use of a closed store"), err)
+	})
+}
+
+func ExampleStore_Stats() {
+	store, err := New("testdb_stats_example", nil, nil, nil, nil, false)
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+		_ = os.RemoveAll("testdb_stats_example")
+	}()
+
+	err = store.Set([]byte("foo"), []byte("bar"), nil)
+	if err != nil {
+		log.Fatalf("error setting key value: %s", err)
+	}
+
+	err = store.Delete([]byte("foo"))
+	if err != nil {
+		log.Fatalf("error deleting key: %s", err)
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		log.Fatalf("error getting stats: %s", err)
+	}
+
+	fmt.Printf("live: %d, deleted: %d, sets: %d", stats.LiveKeys, stats.DeletedKeys, stats.Operations.Sets)
+	// Output: live: 0, deleted: 1, sets: 1
+}
+
+// getStats gets the statistics of the store, failing the test if it can't
+func getStats(t *testing.T, store *Store) *Stats {
+	stats, err := store.Stats()
+	if err != nil {
+		t.Fatalf("error getting stats: %s", err)
+	}
+
+	return stats
+}
@@ -2,23 +2,39 @@ package scdb
 
 import (
 	"bytes"
+	goErrors "errors"
+	"fmt"
 	"github.com/sopherapps/go-scdb/scdb/errors"
 	"github.com/sopherapps/go-scdb/scdb/internal"
 	"github.com/sopherapps/go-scdb/scdb/internal/buffers"
 	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
 	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
 	"github.com/sopherapps/go-scdb/scdb/internal/inverted_index"
+	"github.com/sopherapps/go-scdb/scdb/internal/ordered_index"
+	"github.com/sopherapps/go-scdb/scdb/internal/wal"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
 )
 
-// defaultDbFile is the default name of the database file that contains all the key-value pairs
-const defaultDbFile string = "dump.scdb"
+// The names of the files of a store, in its folder
+const (
+	// DbFileName is the name of the database file that contains all the key-value pairs
+	DbFileName string = "dump.scdb"
+	// SearchIndexFileName is the name of the inverted index file that is for doing full-text search
+	SearchIndexFileName string = "index.iscdb"
+	// OrderedIndexFileName is the name of the ordered index file that is for doing range scans
+	OrderedIndexFileName string = "index.oscdb"
+	// WalFileName is the name of the write-ahead log file
+	WalFileName string = "dump.wal"
+	// LockFileName is the name of the file that is locked to keep other Stores from opening the store
+	LockFileName string = "dump.lock"
+)
 
-// defaultSearchIndexFile is the default name of the inverted index file that is for doing full-text search
-const defaultSearchIndexFile string = "index.iscdb"
+// walCheckpointSize is the size (in bytes) beyond which the write-ahead log is checkpointed
+// i.e. the database files are synced to disk and the log is emptied
+const walCheckpointSize uint64 = 4 * 1024 * 1024
 
 var zeroU64 = internal.Uint64ToByteArray(0)
 
@@ -26,14 +42,69 @@ var zeroU64 = internal.Uint64ToByteArray(0)
 //
 // Store behaves like a HashMap that saves keys and value as byte arrays
 // on disk. It allows for specifying how long each key-value pair should be
-// kept for i.e. the time-to-live in seconds. If None is provided, they last indefinitely.
+// kept for i.e. the time-to-live, to the nearest millisecond. If None is provided, they last indefinitely.
+//
+// Store is safe for concurrent use. Reads i.e. Get, Search and View run in parallel with each other
+// while writes wait for all running reads to finish, and run one at a time.
 type Store struct {
-	bufferPool  *buffers.BufferPool
-	header      *headers.DbFileHeader
-	searchIndex *inverted_index.InvertedIndex
-	closeCh     chan bool
-	mu          sync.Mutex
-	isClosed    bool
+	bufferPool        *buffers.BufferPool
+	header            *headers.DbFileHeader
+	searchIndex       *inverted_index.InvertedIndex
+	orderedIndex      *ordered_index.OrderedIndex
+	fileLock          *internal.FileLock
+	wal               *wal.Log
+	walFilePath       string
+	syncPolicy        SyncPolicy
+	hasUnsyncedWrites bool
+	closeCh           chan bool
+	mu                sync.RWMutex
+	isClosed          bool
+	isReadOnly        bool
+	maxLoadFactor     float64
+	// indexedKeys is the number of filled slots in the index, including those of deleted and expired keys
+	indexedKeys uint64
+	// compaction is the compaction currently running, if any
+	compaction *buffers.Compaction
+	// compactCh is signalled when the dead key-value entries pass the limits of the compaction policy
+	compactCh       chan struct{}
+	maxGarbageRatio float64
+	maxGarbageBytes uint64
+	// hasExpiringEntries is true if any key-value entry may expire before the next compaction
+	hasExpiringEntries bool
+	compactionStats    CompactionStats
+	// compactionStartedAt is the time at which the running compaction, if any, started
+	compactionStartedAt time.Time
+	// ops count the operations done on the store since it was opened
+	ops operationCounters
+	// latencies are the histograms of the latencies of operations, or nil if metrics are not enabled
+	latencies *operationLatencies
+	// failure is the errors.ErrStoreFailed of an atomic unit of writes that failed partway, if any.
+	// All operations but Close return it, so that the part applied is never seen, until the store is reopened.
+	failure error
+}
+
+// CompactionStats are statistics about the garbage in the database file of a Store, and its compactions
+type CompactionStats struct {
+	// DeadBytes is the total size of the key-value entries that are deleted, overwritten or known to be expired.
+	// Entries that expired but have not been read since are not known to be dead until the next compaction.
+	DeadBytes uint64
+	// DataSize is the total size of all the key-value entries in the database file, dead or alive
+	DataSize uint64
+	// GarbageRatio is the fraction of DataSize that is dead
+	GarbageRatio float64
+	// Compactions is the number of compactions completed since the store was opened
+	Compactions uint64
+	// IsRunning is true if a compaction is running at the moment
+	IsRunning bool
+	// LastCompactedAt is the time at which the last compaction completed, or the zero time if none has
+	LastCompactedAt time.Time
+	// LastDuration is how long the last compaction took
+	LastDuration time.Duration
+	// LastReclaimedBytes is the number of bytes by which the last compaction shrank the database file
+	LastReclaimedBytes uint64
+	// ReclaimedBytes is the total number of bytes by which the compactions since the store was opened
+	// shrank the database file
+	ReclaimedBytes uint64
 }
 
 // New creates a new Store at the given path
@@ -43,7 +114,8 @@ type Store struct {
 //     The path to a directory where scdb should store its data
 //
 //   - `maxKeys` - default: 1 million:
-//     The maximum number of key-value pairs to store in store
+//     The maximum number of key-value pairs to store in store at first.
+//     The index grows automatically when it gets too full. See WithMaxLoadFactor() and Store.Resize()
 //
 //   - `redundantBlocks` - default: 1:
 //     The store has an index to hold all the keys. This index is split
@@ -63,7 +135,7 @@ type Store struct {
 //     suddenly degrades, and keeps getting worse from there on.
 //
 //   - `compactionInterval` - default 3600s (1 hour):
-//     The interval at which the store is compacted to remove dangling
+//     The longest interval between compactions of the store, which remove dangling
 //     keys. Dangling keys result from either getting expired or being deleted.
 //     When a `delete` operation is done, the actual key-value pair
 //     is just marked as `deleted` but is not removed.
@@ -71,17 +143,49 @@ type Store struct {
 //     A new key-value pair is created and the old one is left unindexed.
 //     Compaction is important because it reclaims this space and reduces the size
 //     of the database file.
+//     The store is compacted as soon as the dangling keys pass the limits set by WithMaxGarbageRatio()
+//     and WithMaxGarbageBytes(). At the interval, it is compacted only if it has dangling or expiring keys.
+//     An interval of 0 turns off the compaction at intervals.
 //
 //   - `isSearchEnabled` - default false:
 //     Whether the search capability of the store is enabled.
 //     Note that when search is enabled, `set`, `delete`, `clear`, `compact` operations become slower.
-func New(path string, maxKeys *uint64, redundantBlocks *uint16, poolCapacity *uint64, compactionInterval *uint32, isSearchEnabled bool) (*Store, error) {
+//
+//   - `opts` - optional:
+//     Any other optional configurations of the store e.g. WithWAL(), WithSyncPolicy(), WithOrderedIndex()
+//
+// Only one Store, in this or any other process, can have the store at a given path open at a time.
+// Opening it while another Store has it open returns an errors.ErrStoreLocked.
+func New(path string, maxKeys *uint64, redundantBlocks *uint16, poolCapacity *uint64, compactionInterval *uint32, isSearchEnabled bool, opts ...Option) (*Store, error) {
+	o := newOptions(opts)
+	isSearchEnabled = isSearchEnabled || o.isSearchEnabled
+
 	err := os.MkdirAll(path, 0755)
 	if err != nil {
 		return nil, err
 	}
 
-	dbFilePath := filepath.Join(path, defaultDbFile)
+	// the lock is taken before any file is touched, and is kept till the store is closed
+	fileLock, err := internal.LockFile(filepath.Join(path, LockFileName), false)
+	if err != nil {
+		return nil, err
+	}
+	isOpened := false
+	defer func() {
+		if !isOpened {
+			_ = fileLock.Unlock()
+		}
+	}()
+
+	dbFilePath := filepath.Join(path, DbFileName)
+	searchIndexFilePath := filepath.Join(path, SearchIndexFileName)
+	orderedIndexFilePath := filepath.Join(path, OrderedIndexFileName)
+	// finish or undo any compaction cut short by a crash
+	err = buffers.RecoverCompaction(dbFilePath, searchIndexFilePath, orderedIndexFilePath)
+	if err != nil {
+		return nil, err
+	}
+
 	bufferPool, err := buffers.NewBufferPool(poolCapacity, dbFilePath, maxKeys, redundantBlocks, nil)
 	if err != nil {
 		return nil, err
@@ -92,7 +196,6 @@ func New(path string, maxKeys *uint64, redundantBlocks *uint16, poolCapacity *ui
 		return nil, err
 	}
 
-	searchIndexFilePath := filepath.Join(path, defaultSearchIndexFile)
 	var searchIndex *inverted_index.InvertedIndex
 	if isSearchEnabled {
 		searchIndex, err = inverted_index.NewInvertedIndex(searchIndexFilePath, nil, maxKeys, redundantBlocks)
@@ -101,93 +204,292 @@ func New(path string, maxKeys *uint64, redundantBlocks *uint16, poolCapacity *ui
 		}
 	}
 
+	var orderedIndex *ordered_index.OrderedIndex
+	isOrderedIndexNew := false
+	if o.isOrderedIndexEnabled {
+		orderedIndexExists, err := internal.PathExists(orderedIndexFilePath)
+		if err != nil {
+			return nil, err
+		}
+		isOrderedIndexNew = !orderedIndexExists
+
+		orderedIndex, err = ordered_index.NewOrderedIndex(orderedIndexFilePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// files written in an older format are upgraded by compaction, which rewrites every entry
+	// in the current format and rebuilds the search and ordered indices.
+	// A new ordered index for a store that already has keys is built in the same way, and so is an ordered index
+	// of another generation than the database file, as it missed the writes made while it was not enabled.
+	isSearchIndexOutdated := searchIndex != nil && searchIndex.FormatVersion() != values.CurrentFormat
+	isOrderedIndexStale := orderedIndex != nil && !isOrderedIndexNew && orderedIndex.Generation != header.Generation
+	isOrderedIndexOutdated := isOrderedIndexStale || (isOrderedIndexNew && bufferPool.FileSize > header.KeyValuesStartPoint)
+	if header.FormatVersion != values.CurrentFormat || isSearchIndexOutdated || isOrderedIndexOutdated {
+		err = bufferPool.CompactFile(searchIndex, orderedIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		header, err = headers.ExtractDbFileHeaderFromFile(bufferPool.File)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// every time the store is opened for writing, it starts a new generation, which the ordered index
+	// is kept up to date with if it is enabled
+	header.Generation++
+	err = bufferPool.SetGeneration(header.Generation)
+	if err != nil {
+		return nil, err
+	}
+
+	if orderedIndex != nil {
+		err = orderedIndex.SetGeneration(header.Generation)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	indexedKeys, err := bufferPool.CountIndexedKeys()
+	if err != nil {
+		return nil, err
+	}
+
 	interval := 3_600 * time.Second
 	if compactionInterval != nil {
 		interval = time.Duration(*compactionInterval) * time.Second
 	}
 
 	store := &Store{
-		bufferPool:  bufferPool,
-		header:      header,
-		searchIndex: searchIndex,
-		closeCh:     make(chan bool),
+		bufferPool:    bufferPool,
+		header:        header,
+		searchIndex:   searchIndex,
+		orderedIndex:  orderedIndex,
+		fileLock:      fileLock,
+		walFilePath:   filepath.Join(path, WalFileName),
+		syncPolicy:    o.syncPolicy,
+		maxLoadFactor: o.maxLoadFactor,
+		indexedKeys:   indexedKeys,
+		closeCh:       make(chan bool),
+		compactCh:     make(chan struct{}, 1),
+		// expired keys could be in the file, unknown till they are read or compacted
+		hasExpiringEntries: true,
+		maxGarbageRatio:    o.maxGarbageRatio,
+		maxGarbageBytes:    o.maxGarbageBytes,
+		latencies:          newOperationLatencies(o.isMetricsEnabled),
+	}
+
+	err = store.recoverFromWal(store.walFilePath, o.isWalEnabled)
+	if err != nil {
+		return nil, err
 	}
 
 	go store.startBackgroundCompaction(interval)
+	if o.syncPolicy == SyncInterval {
+		go store.startBackgroundSync(o.syncInterval)
+	}
 
+	isOpened = true
 	return store, nil
 }
 
 // Set sets the given key value in the store
 // This is used to insert or update any key-value pair in the store
-func (s *Store) Set(k []byte, v []byte, ttl *uint64) error {
+//
+// `ttl` is the time-to-live, to the nearest millisecond. If it is nil, the key-value pair never expires.
+func (s *Store) Set(k []byte, v []byte, ttl *time.Duration) error {
+	s.ops.sets.Add(1)
+	if s.latencies != nil {
+		defer s.latencies.set.observeSince(time.Now())
+	}
+
+	if s.isReadOnly {
+		return errors.NewErrReadOnly("set")
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	expiry := uint64(0)
-	if ttl != nil {
-		expiry = uint64(time.Now().Unix()) + *ttl
+	if s.failure != nil {
+		return s.failure
+	}
+
+	expiry := expiryFromTTL(uint64(time.Now().UnixMilli()), ttl)
+	return s.logAndSet(k, v, expiry)
+}
+
+// logAndSet records the setting of the given key-value pair in the write-ahead log, then sets it
+// with the given expiry timestamp and persists it, without acquiring the store's lock
+func (s *Store) logAndSet(k []byte, v []byte, expiry uint64) error {
+	err := s.log(wal.Op{Kind: wal.OpSet, Key: k, Value: v, Expiry: expiry})
+	if err != nil {
+		return err
+	}
+
+	err = s.set(k, v, expiry)
+	if err != nil {
+		return err
+	}
+
+	return s.persist()
+}
+
+// set inserts or updates the given key-value pair with the given expiry timestamp
+// without recording it in the write-ahead log
+//
+// The index is grown at once if the key can't find a free slot in it. If it only gets too full,
+// the background compaction task is signalled to grow it.
+func (s *Store) set(k []byte, v []byte, expiry uint64) error {
+	kvAddr, isNewKey, err := s.insert(k, v, expiry)
+	for isCollisionSaturation(err) {
+		s.ops.collisionSaturations.Add(1)
+		err = s.grow()
+		if err != nil {
+			return err
+		}
+
+		kvAddr, isNewKey, err = s.insert(k, v, expiry)
+	}
+	if err != nil {
+		return err
+	}
+
+	if isNewKey {
+		s.indexedKeys++
+	}
+
+	if s.orderedIndex != nil {
+		err = s.orderedIndex.Add(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	if expiry != 0 {
+		s.hasExpiringEntries = true
 	}
+	s.triggerCompactionIfNeeded()
+
+	// Update the search index
+	if s.searchIndex != nil {
+		err = s.searchIndex.Add(k, kvAddr, expiry)
+		if isCollisionSaturation(err) {
+			s.ops.collisionSaturations.Add(1)
+			// growing rebuilds the search index, including this key
+			return s.grow()
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// insert appends the given key-value pair to the database file and points the key's slot in the index to it.
+//
+// It returns the address of the key-value entry and whether the key took up a new slot in the index.
+// If all the slots for the key are taken by other keys, an ErrCollisionSaturation is returned.
+func (s *Store) insert(k []byte, v []byte, expiry uint64) (uint64, bool, error) {
 	initialIdxOffset := headers.GetIndexOffset(s.header, k)
 
 	for idxBlock := uint64(0); idxBlock < s.header.NumberOfIndexBlocks; idxBlock++ {
 		indexOffset, err := headers.GetIndexOffsetInNthBlock(s.header, initialIdxOffset, idxBlock)
 		if err != nil {
-			return err
+			return 0, false, err
 		}
 
 		kvOffsetInBytes, err := s.bufferPool.ReadIndex(indexOffset)
 		if err != nil {
-			return err
+			return 0, false, err
 		}
 
 		kvOffset, err := internal.Uint64FromByteArray(kvOffsetInBytes)
 		if err != nil {
-			return err
+			return 0, false, err
 		}
 
 		// the offset is for the key if the key is not filled - thus new insert
-		isOffsetForKey := kvOffset == 0
+		isNewKey := kvOffset == 0
+		isOffsetForKey := isNewKey
 
 		// the offset could also be for this key if the key in file matches the key supplied - thus update
 		if !isOffsetForKey {
 			isOffsetForKey, err = s.bufferPool.AddrBelongsToKey(kvOffset, k)
 			if err != nil {
-				return err
+				return 0, false, err
 			}
 		}
 
 		if isOffsetForKey {
+			// the old entry for the key becomes unreachable
+			if !isNewKey {
+				err = s.bufferPool.MarkOverwritten(kvOffset, k)
+				if err != nil {
+					return 0, false, err
+				}
+			}
+
 			kv := values.NewKeyValueEntry(k, v, expiry)
 			prevLastOffset, err := s.bufferPool.Append(kv.AsBytes())
 			if err != nil {
-				return err
+				return 0, false, err
 			}
 
 			err = s.bufferPool.UpdateIndex(indexOffset, internal.Uint64ToByteArray(prevLastOffset))
 			if err != nil {
-				return err
+				return 0, false, err
 			}
 
-			// Update the search index
-			if s.searchIndex != nil {
-				return s.searchIndex.Add(k, prevLastOffset, expiry)
+			err = s.bufferPool.MarkInserted()
+			if err != nil {
+				return 0, false, err
 			}
 
-			return nil
+			s.markDirty(indexOffset)
+			return prevLastOffset, isNewKey, nil
 		}
 
 	}
 
-	return errors.NewErrCollisionSaturation(k)
+	return 0, false, errors.NewErrCollisionSaturation(k)
 }
 
 // Get returns the value corresponding to the given key
 func (s *Store) Get(k []byte) ([]byte, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.ops.gets.Add(1)
+	if s.latencies != nil {
+		defer s.latencies.get.observeSince(time.Now())
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	// reading expired keys counts them as dead
+	defer s.triggerCompactionIfNeeded()
+	return s.get(k)
+}
+
+// get returns the value corresponding to the given key without acquiring the store's lock
+func (s *Store) get(k []byte) ([]byte, error) {
+	entry, err := s.getEntry(k)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	return entry.Value, nil
+}
 
+// getEntry returns the live key-value entry for the given key, or nil if there is none,
+// without acquiring the store's lock
+func (s *Store) getEntry(k []byte) (*values.KeyValueEntry, error) {
 	initialIdxOffset := headers.GetIndexOffset(s.header, k)
 
 	for idxBlock := uint64(0); idxBlock < s.header.NumberOfIndexBlocks; idxBlock++ {
@@ -210,61 +512,47 @@ func (s *Store) Get(k []byte) ([]byte, error) {
 			return nil, err
 		}
 
-		value, err := s.bufferPool.GetValue(kvOffset, k)
+		entry, err := s.bufferPool.GetValue(kvOffset, k)
 		if err != nil {
 			return nil, err
 		}
 
-		if value != nil {
-			return value.Value, nil
+		if entry != nil {
+			return entry, nil
 		}
 	}
 
 	return nil, nil
 }
 
-// Search searches for unexpired keys that start with the given search term
-//
-// It skips the first `skip` (default: 0) number of results and returns not more than
-// `limit` (default: 0) number of items. This is to avoid using up more memory than can be handled by the
-// host machine.
-//
-// If `limit` is 0, all items are returned since it would make no sense for someone to search
-// for zero items.
-//
-// returns a list of pairs of key-value i.e. `buffers.KeyValuePair`
-func (s *Store) Search(term []byte, skip uint64, limit uint64) ([]buffers.KeyValuePair, error) {
-	if s.searchIndex == nil {
-		return nil, errors.NewErrNotSupported("search")
-	}
-
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Exists checks if the given key is in the store, and is neither deleted nor expired.
+// It reads only the key and its flags from the database file, not the value.
+func (s *Store) Exists(k []byte) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	addrs, err := s.searchIndex.Search(term, skip, limit)
-	if err != nil {
-		return nil, err
+	if s.failure != nil {
+		return false, s.failure
 	}
 
-	return s.bufferPool.GetManyKeyValues(addrs)
+	// reading expired keys counts them as dead
+	defer s.triggerCompactionIfNeeded()
+	return s.exists(k)
 }
 
-// Delete removes the key-value for the given key
-func (s *Store) Delete(k []byte) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
+// exists checks if the given key is in the store without acquiring the store's lock
+func (s *Store) exists(k []byte) (bool, error) {
 	initialIdxOffset := headers.GetIndexOffset(s.header, k)
 
 	for idxBlock := uint64(0); idxBlock < s.header.NumberOfIndexBlocks; idxBlock++ {
 		indexOffset, err := headers.GetIndexOffsetInNthBlock(s.header, initialIdxOffset, idxBlock)
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		kvOffsetInBytes, err := s.bufferPool.ReadIndex(indexOffset)
 		if err != nil {
-			return err
+			return false, err
 		}
 
 		if bytes.Equal(kvOffsetInBytes, zeroU64) {
@@ -273,111 +561,1225 @@ func (s *Store) Delete(k []byte) error {
 
 		kvOffset, err := internal.Uint64FromByteArray(kvOffsetInBytes)
 		if err != nil {
-			return err
+			return false, err
 		}
 
-		isOffsetForKey, err := s.bufferPool.TryDeleteKvEntry(kvOffset, k)
+		isFound, err := s.bufferPool.KeyExists(kvOffset, k)
 		if err != nil {
-			return err
+			return false, err
 		}
 
-		if isOffsetForKey {
-			return nil
-		} // else continue looping
+		if isFound {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// TTL returns the time left, to the nearest millisecond, before the given key expires.
+// It returns nil if the key has no expiry or is not in the store. Use Store.Exists to tell the two apart.
+func (s *Store) TTL(k []byte) (*time.Duration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
+	if s.failure != nil {
+		return nil, s.failure
 	}
 
-	// if it is not found, no error is thrown
+	// reading expired keys counts them as dead
+	defer s.triggerCompactionIfNeeded()
+	expiry, isFound, err := s.getExpiry(k)
+	if err != nil || !isFound || expiry == 0 {
+		return nil, err
+	}
 
-	if s.searchIndex != nil {
-		return s.searchIndex.Remove(k)
+	ttl := time.Duration(0)
+	now := uint64(time.Now().UnixMilli())
+	if expiry > now {
+		ttl = time.Duration(expiry-now) * time.Millisecond
 	}
 
-	return nil
+	return &ttl, nil
 }
 
-// Clear removes all data in the store
-func (s *Store) Clear() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// getExpiry returns the expiry timestamp (in milliseconds from unix epoch) of the given key, and whether
+// the key was found, without acquiring the store's lock
+func (s *Store) getExpiry(k []byte) (uint64, bool, error) {
+	initialIdxOffset := headers.GetIndexOffset(s.header, k)
 
-	err := s.bufferPool.ClearFile()
-	if err != nil {
-		return err
-	}
+	for idxBlock := uint64(0); idxBlock < s.header.NumberOfIndexBlocks; idxBlock++ {
+		indexOffset, err := headers.GetIndexOffsetInNthBlock(s.header, initialIdxOffset, idxBlock)
+		if err != nil {
+			return 0, false, err
+		}
 
-	if s.searchIndex != nil {
-		return s.searchIndex.Clear()
+		kvOffsetInBytes, err := s.bufferPool.ReadIndex(indexOffset)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if bytes.Equal(kvOffsetInBytes, zeroU64) {
+			continue
+		}
+
+		kvOffset, err := internal.Uint64FromByteArray(kvOffsetInBytes)
+		if err != nil {
+			return 0, false, err
+		}
+
+		expiry, isFound, err := s.bufferPool.GetExpiry(kvOffset, k)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if isFound {
+			return expiry, true, nil
+		}
 	}
 
-	return nil
+	return 0, false, nil
 }
 
-// Compact manually removes dangling key-value pairs in the database file
-//
-// Dangling keys result from either getting expired or being deleted.
-// When a Store.Delete operation is done, the actual key-value pair
-// is just marked as `deleted` but is not removed.
-//
-// Something similar happens when a key-value is updated.
-// A new key-value pair is created and the old one is left un-indexed.
-// Compaction is important because it reclaims this space and reduces the size
-// of the database file.
-//
-// This is done automatically for you at the set `compactionInterval` but you
-// may wish to do it manually for some reason.
-//
-// This is a very expensive operation so use it sparingly.
-func (s *Store) Compact() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Expire sets the given key to expire after `ttl`, to the nearest millisecond, without rewriting its value.
+// It returns false if the key is not in the store.
+func (s *Store) Expire(k []byte, ttl time.Duration) (bool, error) {
+	return s.setExpiry(k, expiryFromTTL(uint64(time.Now().UnixMilli()), &ttl))
+}
 
-	return s.bufferPool.CompactFile(s.searchIndex)
+// ExpireAt sets the given key to expire at the given time, without rewriting its value.
+// A time in the past deletes the key. It returns false if the key is not in the store.
+func (s *Store) ExpireAt(k []byte, t time.Time) (bool, error) {
+	expiry := t.UnixMilli()
+	if expiry < 1 {
+		// 0 would mean that the key never expires
+		expiry = 1
+	}
+
+	return s.setExpiry(k, uint64(expiry))
 }
 
-// Close frees up any resources occupied by store.
-// After this, the store is unusable. You have to re-instantiate it or just run into
-// some crazy errors
-func (s *Store) Close() error {
+// Persist removes the expiry of the given key so that it never expires.
+// It returns false if the key is not in the store.
+func (s *Store) Persist(k []byte) (bool, error) {
+	return s.setExpiry(k, 0)
+}
+
+// setExpiry sets the expiry timestamp (in milliseconds from unix epoch) of the given key,
+// recording it in the write-ahead log
+func (s *Store) setExpiry(k []byte, expiry uint64) (bool, error) {
+	if s.isReadOnly {
+		return false, errors.NewErrReadOnly("change of expiry")
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.isClosed {
-		return nil
+	if s.failure != nil {
+		return false, s.failure
 	}
 
-	s.closeCh <- true
-	close(s.closeCh)
-	s.isClosed = true
-
-	err := s.bufferPool.Close()
+	err := s.log(wal.Op{Kind: wal.OpExpire, Key: k, Expiry: expiry})
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if s.searchIndex != nil {
-		err = s.searchIndex.Close()
-		if err != nil {
-			return err
-		}
-		s.searchIndex = nil
+	isFound, err := s.expire(k, expiry)
+	if err != nil {
+		return false, err
 	}
 
-	s.header = nil
-
-	return nil
+	return isFound, s.persist()
 }
 
-// startBackgroundCompaction starts the background compaction task that runs every `interval`
-func (s *Store) startBackgroundCompaction(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	for {
-		select {
-		case <-ticker.C:
-			_ = s.Compact()
-		case <-s.closeCh:
-			ticker.Stop()
-			return
+// expire sets the expiry timestamp of the given key without recording it in the write-ahead log.
+// It returns false if the key is not in the store.
+//
+// The expiry is updated in place in the key's entry. An expiry in the past deletes the key instead.
+func (s *Store) expire(k []byte, expiry uint64) (bool, error) {
+	if values.IsExpiryPast(expiry) {
+		isFound, err := s.exists(k)
+		if err != nil || !isFound {
+			return false, err
 		}
+
+		return true, s.delete(k)
 	}
+
+	initialIdxOffset := headers.GetIndexOffset(s.header, k)
+
+	for idxBlock := uint64(0); idxBlock < s.header.NumberOfIndexBlocks; idxBlock++ {
+		indexOffset, err := headers.GetIndexOffsetInNthBlock(s.header, initialIdxOffset, idxBlock)
+		if err != nil {
+			return false, err
+		}
+
+		kvOffsetInBytes, err := s.bufferPool.ReadIndex(indexOffset)
+		if err != nil {
+			return false, err
+		}
+
+		if bytes.Equal(kvOffsetInBytes, zeroU64) {
+			continue
+		}
+
+		kvOffset, err := internal.Uint64FromByteArray(kvOffsetInBytes)
+		if err != nil {
+			return false, err
+		}
+
+		isOffsetForKey, err := s.bufferPool.TrySetExpiry(kvOffset, k, expiry)
+		if err != nil {
+			return false, err
+		}
+
+		if isOffsetForKey {
+			// a running compaction has to copy the entry afresh
+			s.markDirty(indexOffset)
+			if expiry != 0 {
+				s.hasExpiringEntries = true
+			}
+
+			if s.searchIndex != nil {
+				err = s.searchIndex.Add(k, kvOffset, expiry)
+				if isCollisionSaturation(err) {
+					s.ops.collisionSaturations.Add(1)
+					// growing rebuilds the search index, including this key
+					return true, s.grow()
+				}
+				if err != nil {
+					return false, err
+				}
+			}
+
+			return true, nil
+		} // else continue looping
+	}
+
+	return false, nil
+}
+
+// Search searches for unexpired keys that start with the given search term
+//
+// It skips the first `skip` (default: 0) number of results and returns not more than
+// `limit` (default: 0) number of items. This is to avoid using up more memory than can be handled by the
+// host machine.
+//
+// If `limit` is 0, all items are returned since it would make no sense for someone to search
+// for zero items.
+//
+// returns a list of pairs of key-value i.e. `buffers.KeyValuePair`
+func (s *Store) Search(term []byte, skip uint64, limit uint64) ([]buffers.KeyValuePair, error) {
+	s.ops.searches.Add(1)
+	if s.latencies != nil {
+		defer s.latencies.search.observeSince(time.Now())
+	}
+
+	if s.searchIndex == nil {
+		return nil, errors.NewErrNotSupported("search")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	// reading expired keys counts them as dead
+	defer s.triggerCompactionIfNeeded()
+	return s.search(term, skip, limit)
+}
+
+// search searches for unexpired keys that start with the given search term without acquiring the store's lock
+func (s *Store) search(term []byte, skip uint64, limit uint64) ([]buffers.KeyValuePair, error) {
+	addrs, err := s.searchIndex.Search(term, skip, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bufferPool.GetManyKeyValues(addrs)
+}
+
+// Range returns the unexpired key-value pairs whose keys are from `start` up to, but not including, `end`,
+// in the sorted order of their keys, or in the reverse order if `reverse` is true.
+//
+// A nil `start` or `end` leaves that end of the range open. Not more than `limit` items are returned.
+// If `limit` is 0, all items in the range are returned.
+//
+// It needs the ordered index of the store to be enabled via WithOrderedIndex(), otherwise
+// an ErrNotSupported is returned.
+func (s *Store) Range(start []byte, end []byte, limit uint64, reverse bool) ([]buffers.KeyValuePair, error) {
+	s.ops.ranges.Add(1)
+
+	if s.orderedIndex == nil {
+		return nil, errors.NewErrNotSupported("range")
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	// reading expired keys counts them as dead
+	defer s.triggerCompactionIfNeeded()
+	return s.scanRange(start, end, limit, reverse)
+}
+
+// scanRange returns the unexpired key-value pairs whose keys are in the given range without acquiring
+// the store's lock
+func (s *Store) scanRange(start []byte, end []byte, limit uint64, reverse bool) ([]buffers.KeyValuePair, error) {
+	results := make([]buffers.KeyValuePair, 0)
+	err := s.orderedIndex.Walk(start, end, reverse, func(k []byte) (bool, error) {
+		v, err := s.get(k)
+		if err != nil {
+			return false, err
+		}
+
+		if v != nil {
+			results = append(results, buffers.KeyValuePair{K: k, V: v})
+		}
+
+		return limit == 0 || uint64(len(results)) < limit, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Len returns the number of key-value pairs in the store.
+//
+// It is kept up to date by every write, and saved in the database file, so it is got without reading the store.
+// Key-value pairs that expired but have not been read since are counted until they are read or compacted away.
+func (s *Store) Len() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.bufferPool.KeyCount()
+}
+
+// Keys returns the unexpired keys that start with the given prefix, without reading their values.
+// A nil or empty prefix returns all keys.
+//
+// The keys are in sorted order if the ordered index of the store is enabled via WithOrderedIndex().
+// Otherwise, they are in the order of their slots in the index, which means the whole index is read.
+func (s *Store) Keys(prefix []byte) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	// reading expired keys counts them as dead
+	defer s.triggerCompactionIfNeeded()
+	if s.orderedIndex != nil {
+		return s.sortedKeys(prefix)
+	}
+
+	return s.indexKeys(prefix)
+}
+
+// sortedKeys returns the unexpired keys that start with the given prefix, in sorted order, from the ordered index
+// without acquiring the store's lock
+func (s *Store) sortedKeys(prefix []byte) ([][]byte, error) {
+	keys := make([][]byte, 0)
+	err := s.orderedIndex.Walk(prefix, nil, false, func(k []byte) (bool, error) {
+		if !bytes.HasPrefix(k, prefix) {
+			return false, nil
+		}
+
+		isFound, err := s.exists(k)
+		if err != nil {
+			return false, err
+		}
+
+		if isFound {
+			keys = append(keys, k)
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// indexKeys returns the unexpired keys that start with the given prefix, in the order of their slots in the index,
+// without acquiring the store's lock
+func (s *Store) indexKeys(prefix []byte) ([][]byte, error) {
+	keys := make([][]byte, 0)
+	indexEnd := headers.HeaderSizeInBytes + s.header.NumberOfIndexBlocks*s.header.NetBlockSize
+	for indexAddr := headers.HeaderSizeInBytes; indexAddr < indexEnd; indexAddr += headers.IndexEntrySizeInBytes {
+		kvOffsetInBytes, err := s.bufferPool.ReadIndex(indexAddr)
+		if err != nil {
+			return nil, err
+		}
+
+		if bytes.Equal(kvOffsetInBytes, zeroU64) {
+			continue
+		}
+
+		kvOffset, err := internal.Uint64FromByteArray(kvOffsetInBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		k, err := s.bufferPool.GetKey(kvOffset)
+		if err != nil {
+			return nil, err
+		}
+
+		if k != nil && bytes.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys, nil
+}
+
+// Delete removes the key-value for the given key
+func (s *Store) Delete(k []byte) error {
+	s.ops.deletes.Add(1)
+	if s.latencies != nil {
+		defer s.latencies.delete.observeSince(time.Now())
+	}
+
+	if s.isReadOnly {
+		return errors.NewErrReadOnly("delete")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failure != nil {
+		return s.failure
+	}
+
+	return s.logAndDelete(k)
+}
+
+// logAndDelete records the removal of the given key in the write-ahead log, then removes it and persists
+// the change, without acquiring the store's lock
+func (s *Store) logAndDelete(k []byte) error {
+	err := s.log(wal.Op{Kind: wal.OpDelete, Key: k})
+	if err != nil {
+		return err
+	}
+
+	err = s.delete(k)
+	if err != nil {
+		return err
+	}
+
+	return s.persist()
+}
+
+// delete removes the key-value for the given key without recording it in the write-ahead log
+func (s *Store) delete(k []byte) error {
+	initialIdxOffset := headers.GetIndexOffset(s.header, k)
+
+	for idxBlock := uint64(0); idxBlock < s.header.NumberOfIndexBlocks; idxBlock++ {
+		indexOffset, err := headers.GetIndexOffsetInNthBlock(s.header, initialIdxOffset, idxBlock)
+		if err != nil {
+			return err
+		}
+
+		kvOffsetInBytes, err := s.bufferPool.ReadIndex(indexOffset)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(kvOffsetInBytes, zeroU64) {
+			continue
+		}
+
+		kvOffset, err := internal.Uint64FromByteArray(kvOffsetInBytes)
+		if err != nil {
+			return err
+		}
+
+		isOffsetForKey, err := s.bufferPool.TryDeleteKvEntry(kvOffset, k)
+		if err != nil {
+			return err
+		}
+
+		if isOffsetForKey {
+			s.markDirty(indexOffset)
+			s.triggerCompactionIfNeeded()
+
+			if s.orderedIndex != nil {
+				return s.orderedIndex.Remove(k)
+			}
+			return nil
+		} // else continue looping
+
+	}
+
+	// if it is not found, no error is thrown
+
+	if s.searchIndex != nil {
+		return s.searchIndex.Remove(k)
+	}
+
+	return nil
+}
+
+// Clear removes all data in the store
+func (s *Store) Clear() error {
+	if s.isReadOnly {
+		return errors.NewErrReadOnly("clear")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failure != nil {
+		return s.failure
+	}
+
+	err := s.log(wal.Op{Kind: wal.OpClear})
+	if err != nil {
+		return err
+	}
+
+	err = s.clear()
+	if err != nil {
+		return err
+	}
+
+	return s.persist()
+}
+
+// clear removes all data in the store without recording it in the write-ahead log
+func (s *Store) clear() error {
+	err := s.abortCompaction()
+	if err != nil {
+		return err
+	}
+
+	err = s.bufferPool.ClearFile()
+	if err != nil {
+		return err
+	}
+	s.indexedKeys = 0
+	s.hasExpiringEntries = false
+
+	if s.orderedIndex != nil {
+		err = s.orderedIndex.Clear()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.searchIndex != nil {
+		return s.searchIndex.Clear()
+	}
+
+	return nil
+}
+
+// Compact manually removes dangling key-value pairs in the database file
+//
+// Dangling keys result from either getting expired or being deleted.
+// When a Store.Delete operation is done, the actual key-value pair
+// is just marked as `deleted` but is not removed.
+//
+// Something similar happens when a key-value is updated.
+// A new key-value pair is created and the old one is left un-indexed.
+// Compaction is important because it reclaims this space and reduces the size
+// of the database file.
+//
+// This is done automatically for you when the dangling key-value pairs pass the limits set by WithMaxGarbageRatio()
+// and WithMaxGarbageBytes(), or at the set `compactionInterval`, but you may wish to do it manually for some reason.
+//
+// The live key-value pairs are copied into a new file one index block at a time, letting other reads and writes
+// go on in between. Only the final catch-up with the writes made during the copy, and the swap of the files,
+// hold up the store. If a compaction is already running, this returns immediately.
+// If the index is filled beyond the load factor set by WithMaxLoadFactor(), it is grown in the same go.
+//
+// This is a very expensive operation so use it sparingly.
+func (s *Store) Compact() error {
+	if s.isReadOnly {
+		return errors.NewErrReadOnly("compact")
+	}
+
+	c, err := s.startCompaction()
+	if err != nil || c == nil {
+		return err
+	}
+
+	return s.runCompaction(c)
+}
+
+// runCompaction runs the steps of the given compaction, and then finishes it
+func (s *Store) runCompaction(c *buffers.Compaction) error {
+	for {
+		isDone, err := s.stepCompaction(c)
+		if err != nil {
+			s.cancelCompaction(c)
+			return err
+		}
+
+		if isDone {
+			break
+		}
+	}
+
+	return s.finishCompaction(c)
+}
+
+// startCompaction starts a new compaction, returning nil if the store is closed or a compaction is already running.
+// The compaction grows the index too if the index is too full.
+func (s *Store) startCompaction() (*buffers.Compaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the background compaction may run just after the store is closed
+	if s.isClosed || s.compaction != nil {
+		return nil, nil
+	}
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	maxKeys := s.header.MaxKeys
+	if s.isGrowthDue() {
+		maxKeys = s.grownMaxKeys()
+	}
+
+	return s.newCompaction(maxKeys)
+}
+
+// newCompaction starts a new compaction into a file whose index holds `maxKeys` keys, without acquiring
+// the store's lock
+func (s *Store) newCompaction(maxKeys uint64) (*buffers.Compaction, error) {
+	c, err := s.bufferPool.NewCompaction(maxKeys, s.searchIndex, s.orderedIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	s.compaction = c
+	s.compactionStartedAt = time.Now()
+	return c, nil
+}
+
+// stepCompaction runs the next step of the given compaction, letting other reads go on at the same time.
+// It returns true if the compaction has no more steps or it was aborted.
+func (s *Store) stepCompaction(c *buffers.Compaction) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.compaction != c {
+		return true, nil
+	}
+
+	return c.Step()
+}
+
+// finishCompaction catches up with the writes made while the given compaction was running,
+// and swaps the compacted files in
+func (s *Store) finishCompaction(c *buffers.Compaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the compaction was aborted e.g. by a Clear or Close
+	if s.compaction != c {
+		return nil
+	}
+
+	s.compaction = nil
+	initialFileSize := s.bufferPool.FileSize
+	err := c.Finish()
+	if err != nil {
+		_ = c.Abort()
+		return err
+	}
+
+	s.header, err = headers.ExtractDbFileHeaderFromFile(s.bufferPool.File)
+	if err != nil {
+		return err
+	}
+
+	// the slots of deleted and expired keys are freed
+	s.indexedKeys, err = s.bufferPool.CountIndexedKeys()
+	if err != nil {
+		return err
+	}
+
+	s.hasExpiringEntries = c.HasExpiringEntries()
+	s.recordCompaction(initialFileSize)
+
+	// the compacted file has all the operations in the log so far
+	return s.checkpoint()
+}
+
+// cancelCompaction stops the given compaction if it is still the one running
+func (s *Store) cancelCompaction(c *buffers.Compaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.compaction == c {
+		_ = s.abortCompaction()
+	}
+}
+
+// abortCompaction stops the compaction that is running, if any, without acquiring the store's lock
+func (s *Store) abortCompaction() error {
+	if s.compaction == nil {
+		return nil
+	}
+
+	c := s.compaction
+	s.compaction = nil
+	return c.Abort()
+}
+
+// CompactionStats returns statistics about the garbage in the database file, and the compactions of the store
+func (s *Store) CompactionStats() CompactionStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.isClosed {
+		return s.compactionStats
+	}
+
+	return s.currentCompactionStats()
+}
+
+// currentCompactionStats returns statistics about the garbage in the database file, and the compactions of the store,
+// without acquiring the store's lock
+func (s *Store) currentCompactionStats() CompactionStats {
+	stats := s.compactionStats
+	stats.DeadBytes = s.bufferPool.DeadBytes()
+	stats.DataSize = s.bufferPool.DataSize()
+	if stats.DataSize > 0 {
+		stats.GarbageRatio = float64(stats.DeadBytes) / float64(stats.DataSize)
+	}
+	stats.IsRunning = s.compaction != nil
+	return stats
+}
+
+// recordCompaction updates the compaction statistics after a compaction that started
+// when the database file was `initialFileSize` bytes big
+func (s *Store) recordCompaction(initialFileSize uint64) {
+	now := time.Now()
+	s.compactionStats.Compactions++
+	s.compactionStats.LastCompactedAt = now
+	s.compactionStats.LastDuration = now.Sub(s.compactionStartedAt)
+	s.compactionStats.LastReclaimedBytes = 0
+	if initialFileSize > s.bufferPool.FileSize {
+		s.compactionStats.LastReclaimedBytes = initialFileSize - s.bufferPool.FileSize
+	}
+	s.compactionStats.ReclaimedBytes += s.compactionStats.LastReclaimedBytes
+
+	if s.latencies != nil {
+		s.latencies.compact.observe(s.compactionStats.LastDuration)
+	}
+}
+
+// isCompactionDue returns true if the dead key-value entries have passed the limits of the store's compaction policy,
+// or if the index is too full
+func (s *Store) isCompactionDue() bool {
+	if s.isGrowthDue() {
+		return true
+	}
+
+	deadBytes := s.bufferPool.DeadBytes()
+	if s.maxGarbageBytes > 0 && deadBytes >= s.maxGarbageBytes {
+		return true
+	}
+
+	if deadBytes < minGarbageBytesForRatio {
+		return false
+	}
+
+	return float64(deadBytes) >= s.maxGarbageRatio*float64(s.bufferPool.DataSize())
+}
+
+// isGrowthDue returns true if the filled slots of the index are more than the store's maximum load factor allows
+func (s *Store) isGrowthDue() bool {
+	return float64(s.indexedKeys) > s.maxLoadFactor*float64(s.header.MaxKeys)
+}
+
+// triggerCompactionIfNeeded signals the background compaction task to compact the store if the compaction is due.
+// It does not block, and needs only the store's read lock.
+func (s *Store) triggerCompactionIfNeeded() {
+	if s.isClosed || s.compaction != nil || !s.isCompactionDue() {
+		return
+	}
+
+	select {
+	case s.compactCh <- struct{}{}:
+	default:
+		// a compaction is already signalled
+	}
+}
+
+// shouldCompact returns true if the store is open and the compaction is due
+func (s *Store) shouldCompact() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return !s.isClosed && s.isCompactionDue()
+}
+
+// hasGarbage returns true if the store has any dead key-value entries, or any that may have expired
+func (s *Store) hasGarbage() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.isClosed {
+		return false
+	}
+
+	return s.hasExpiringEntries || s.bufferPool.DeadBytes() > 0
+}
+
+// markDirty reports the index slot at the given address as written to, to the compaction that is running, if any
+func (s *Store) markDirty(indexOffset uint64) {
+	if s.compaction != nil {
+		s.compaction.MarkDirty(indexOffset)
+	}
+}
+
+// Resize grows the index of the store to hold `maxKeys` key-value pairs, growing the search index
+// in proportion, if search is enabled.
+//
+// The index is grown automatically when it gets too full, or when a key can't find a free slot in it,
+// but one may wish to grow it ahead of time e.g. before inserting very many keys.
+//
+// Like Store.Compact, this rewrites the whole database file, removing any dangling key-value pairs,
+// one index block at a time, letting other reads and writes go on in between. Any compaction that is running
+// is stopped in favour of the resize. If `maxKeys` is less than the current maximum number of keys,
+// an errors.ErrOutOfBounds is returned.
+func (s *Store) Resize(maxKeys uint64) error {
+	if s.isReadOnly {
+		return errors.NewErrReadOnly("resize")
+	}
+
+	for {
+		c, err := s.startResize(maxKeys)
+		if err != nil || c == nil {
+			return err
+		}
+
+		err = s.runCompaction(c)
+		// the resize is started afresh if it was aborted before the index got to `maxKeys` e.g. by a Clear
+		if err != nil || s.hasMaxKeys(maxKeys) {
+			return err
+		}
+	}
+}
+
+// startResize starts a compaction into a file whose index holds `maxKeys` keys, in place of any compaction
+// that is running. It returns nil if the store is closed.
+func (s *Store) startResize(maxKeys uint64) (*buffers.Compaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isClosed {
+		return nil, nil
+	}
+
+	if s.failure != nil {
+		return nil, s.failure
+	}
+
+	if maxKeys < s.header.MaxKeys {
+		return nil, errors.NewErrOutOfBounds(fmt.Sprintf("maxKeys %d is less than the current %d", maxKeys, s.header.MaxKeys))
+	}
+
+	err := s.abortCompaction()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.newCompaction(maxKeys)
+}
+
+// hasMaxKeys returns true if the index of the store holds at least `maxKeys` keys, or if the store can't be resized
+// any more as it is closed or failed
+func (s *Store) hasMaxKeys(maxKeys uint64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.isClosed || s.failure != nil || s.header.MaxKeys >= maxKeys
+}
+
+// Sync flushes all writes made to the store so far to disk.
+//
+// This is useful when the store's SyncPolicy is SyncNever or SyncInterval, and some writes
+// need to be durable before moving on. It does nothing on a read-only store.
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isClosed || s.isReadOnly {
+		return nil
+	}
+
+	if s.failure != nil {
+		return s.failure
+	}
+
+	return s.syncFiles()
+}
+
+// Close frees up any resources occupied by store.
+// After this, the store is unusable. You have to re-instantiate it or just run into
+// some crazy errors
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isClosed {
+		return nil
+	}
+
+	// closing the channel stops all background tasks
+	close(s.closeCh)
+	s.isClosed = true
+	// the store can't be closed again, so its lock is let go even if closing fails
+	defer func() {
+		_ = s.fileLock.Unlock()
+	}()
+
+	err := s.abortCompaction()
+	if err != nil {
+		return err
+	}
+
+	if s.syncPolicy != SyncNever && s.hasUnsyncedWrites {
+		err := s.syncFiles()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.wal != nil {
+		// the log is kept whole if the store failed, so that the failed writes are completed when it is reopened
+		if s.failure == nil {
+			err := s.checkpoint()
+			if err != nil {
+				return err
+			}
+		}
+
+		err := s.wal.Close()
+		if err != nil {
+			return err
+		}
+		s.wal = nil
+	}
+
+	err = s.bufferPool.Close()
+	if err != nil {
+		return err
+	}
+
+	if s.searchIndex != nil {
+		err = s.searchIndex.Close()
+		if err != nil {
+			return err
+		}
+		s.searchIndex = nil
+	}
+
+	if s.orderedIndex != nil {
+		err = s.orderedIndex.Close()
+		if err != nil {
+			return err
+		}
+		s.orderedIndex = nil
+	}
+
+	s.header = nil
+
+	return nil
+}
+
+// resize grows the index of the store to hold `maxKeys` key-value pairs without acquiring the store's lock
+func (s *Store) resize(maxKeys uint64) error {
+	// the resize compacts the file itself
+	err := s.abortCompaction()
+	if err != nil {
+		return err
+	}
+
+	err = s.bufferPool.ResizeFile(maxKeys, s.searchIndex, s.orderedIndex)
+	if err != nil {
+		return err
+	}
+
+	s.header, err = headers.ExtractDbFileHeaderFromFile(s.bufferPool.File)
+	if err != nil {
+		return err
+	}
+
+	s.indexedKeys, err = s.bufferPool.CountIndexedKeys()
+	return err
+}
+
+// grow doubles the size of the index of the store at once, adding at least one index block
+func (s *Store) grow() error {
+	return s.resize(s.grownMaxKeys())
+}
+
+// grownMaxKeys returns the maximum number of keys of the index when it is grown
+// i.e. double the current one, with at least one more index block
+func (s *Store) grownMaxKeys() uint64 {
+	maxKeys := s.header.MaxKeys * 2
+	if minMaxKeys := s.header.MaxKeys + s.header.ItemsPerIndexBlock; maxKeys < minMaxKeys {
+		maxKeys = minMaxKeys
+	}
+
+	return maxKeys
+}
+
+// startBackgroundCompaction starts the background compaction task that compacts the store whenever the compaction
+// is due, and every `interval` if there is anything to reclaim. An `interval` of 0 turns off the latter.
+func (s *Store) startBackgroundCompaction(interval time.Duration) {
+	var tickCh <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tickCh = ticker.C
+	}
+
+	for {
+		select {
+		case <-tickCh:
+			if s.hasGarbage() {
+				_ = s.Compact()
+			}
+		case <-s.compactCh:
+			// the garbage may have been reclaimed since the signal e.g. by a manual compaction
+			if s.shouldCompact() {
+				_ = s.Compact()
+			}
+		case <-s.closeCh:
+			return
+		}
+	}
+}
+
+// startBackgroundSync starts the background task that flushes any unsynced writes to disk every `interval`
+func (s *Store) startBackgroundSync(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.syncUnsyncedWrites()
+		case <-s.closeCh:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// syncUnsyncedWrites flushes the writes made since the last sync to disk, if there are any
+func (s *Store) syncUnsyncedWrites() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isClosed || !s.hasUnsyncedWrites {
+		return nil
+	}
+
+	return s.syncFiles()
+}
+
+// persist makes the latest write durable according to the store's sync policy
+func (s *Store) persist() error {
+	switch s.syncPolicy {
+	case SyncAlways:
+		// the log has all the writes that have not been checkpointed yet
+		if s.wal != nil {
+			return s.wal.Sync()
+		}
+		return s.syncFiles()
+	case SyncInterval:
+		s.hasUnsyncedWrites = true
+	}
+
+	return nil
+}
+
+// syncFiles flushes the database, search index, ordered index and write-ahead log files to disk
+func (s *Store) syncFiles() error {
+	err := s.bufferPool.File.Sync()
+	if err != nil {
+		return err
+	}
+
+	if s.searchIndex != nil {
+		err = s.searchIndex.File.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.orderedIndex != nil {
+		err = s.orderedIndex.File.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.wal != nil {
+		err = s.wal.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	s.hasUnsyncedWrites = false
+	return nil
+}
+
+// log records the given operations in the write-ahead log, if it is enabled,
+// checkpointing the log first if it has grown too big
+func (s *Store) log(ops ...wal.Op) error {
+	if s.wal == nil {
+		return nil
+	}
+
+	if s.wal.FileSize >= walCheckpointSize {
+		err := s.checkpoint()
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.wal.Append(ops...)
+}
+
+// checkpoint syncs the database, search index and ordered index files to disk and then empties the write-ahead log
+// since all operations recorded in it are now safely persisted
+func (s *Store) checkpoint() error {
+	if s.wal == nil || s.wal.FileSize == 0 {
+		return nil
+	}
+
+	err := s.bufferPool.File.Sync()
+	if err != nil {
+		return err
+	}
+
+	if s.searchIndex != nil {
+		err = s.searchIndex.File.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.orderedIndex != nil {
+		err = s.orderedIndex.File.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.wal.Truncate()
+}
+
+// recoverFromWal replays any operations left in the write-ahead log at the given path by a crash.
+//
+// If `isWalEnabled` is true, the log is kept open for recording subsequent operations
+// otherwise it is removed once it has been replayed.
+func (s *Store) recoverFromWal(filePath string, isWalEnabled bool) error {
+	walExists, err := internal.PathExists(filePath)
+	if err != nil {
+		return err
+	}
+
+	if !walExists && !isWalEnabled {
+		return nil
+	}
+
+	s.wal, err = wal.NewLog(filePath)
+	if err != nil {
+		return err
+	}
+
+	records, err := s.wal.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	for _, ops := range records {
+		err = s.replay(ops)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.checkpoint()
+	if err != nil {
+		return err
+	}
+
+	if !isWalEnabled {
+		err = s.wal.Close()
+		if err != nil {
+			return err
+		}
+		s.wal = nil
+
+		return os.Remove(filePath)
+	}
+
+	return nil
+}
+
+// replay re-applies the given operations got from the write-ahead log.
+// All operations are idempotent so it does not matter if they had already been applied before a crash
+func (s *Store) replay(ops []wal.Op) error {
+	for _, op := range ops {
+		var err error
+		switch op.Kind {
+		case wal.OpSet:
+			err = s.set(op.Key, op.Value, op.Expiry)
+		case wal.OpDelete:
+			err = s.delete(op.Key)
+		case wal.OpExpire:
+			_, err = s.expire(op.Key, op.Expiry)
+		case wal.OpClear:
+			err = s.clear()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expiryFromTTL returns the expiry timestamp (in milliseconds from unix epoch) of a key-value pair set at `now`
+// (in milliseconds from unix epoch) with the given time-to-live. A nil `ttl` gives 0 i.e. it never expires.
+func expiryFromTTL(now uint64, ttl *time.Duration) uint64 {
+	if ttl == nil {
+		return 0
+	}
+
+	if *ttl < 0 {
+		return now
+	}
+
+	return now + uint64(ttl.Milliseconds())
+}
+
+// isCollisionSaturation returns true if the given error is an errors.ErrCollisionSaturation
+func isCollisionSaturation(err error) bool {
+	var collisionErr *errors.ErrCollisionSaturation
+	return goErrors.As(err, &collisionErr)
 }
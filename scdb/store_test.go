@@ -1,13 +1,20 @@
 package scdb
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal"
 	"github.com/sopherapps/go-scdb/scdb/internal/buffers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/headers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/sopherapps/go-scdb/scdb/internal/wal"
 	"github.com/stretchr/testify/assert"
 	"log"
 	"os"
 	"path"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 )
@@ -202,12 +209,12 @@ func TestStore_Search(t *testing.T) {
 			{[]byte("bare"), 0, 0, []buffers.KeyValuePair{}},
 		}
 		recordsToExpire := []testRecord{SearchRecords[0], SearchRecords[2], SearchRecords[3]}
-		ttl := uint64(1)
+		ttl := 500 * time.Millisecond
 		insertRecords(t, store, SearchRecords, nil)
 		insertRecords(t, store, recordsToExpire, &ttl)
 
 		// wait for some items to expire
-		time.Sleep(2 * time.Second)
+		time.Sleep(time.Second)
 		for _, rec := range table {
 			got, err := store.Search(rec.term, rec.skip, rec.limit)
 			if err != nil {
@@ -272,168 +279,1584 @@ func TestStore_Search(t *testing.T) {
 
 }
 
+func TestStore_RangeDisabled(t *testing.T) {
+	dbPath := "testdb_range"
+	removeStore(t, dbPath)
+	store := createStore(t, dbPath, nil, false)
+	defer func() {
+		_ = store.Close()
+		removeStore(t, dbPath)
+	}()
+
+	insertRecords(t, store, Records, nil)
+	_, err := store.Range(nil, nil, 0, false)
+	assert.Equal(t, errors.NewErrNotSupported("range"), err)
+}
+
+func TestStore_Range(t *testing.T) {
+	dbPath := "testdb_range"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	// bonjour, hey, hi, hola, mulimuta, oi, salut
+	sorted := []testRecord{Records[3], Records[0], Records[1], Records[4], Records[6], Records[5], Records[2]}
+
+	t.Run("RangeIsUpToDateAfterTheStoreWasOpenedWithoutTheOrderedIndex", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false, WithOrderedIndex())
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records[:3], nil)
+		}()
+
+		// writes, and a compaction, that the ordered index misses
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records[3:], nil)
+			deleteRecords(t, store, [][]byte{Records[0].k})
+			err := store.Compact()
+			if err != nil {
+				t.Fatalf("error compacting store: %s", err)
+			}
+		}()
+
+		store := createStore(t, dbPath, nil, false, WithOrderedIndex())
+		defer func() {
+			_ = store.Close()
+		}()
+		assertRangeResults(t, store, nil, nil, 0, false, []testRecord{sorted[0], sorted[2], sorted[3], sorted[4], sorted[5], sorted[6]})
+	})
+
+	t.Run("RangeReturnsTheKeyValuesWithinTheBoundsInSortedOrder", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false, WithOrderedIndex())
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		type testParams struct {
+			start    []byte
+			end      []byte
+			limit    uint64
+			reverse  bool
+			expected []testRecord
+		}
+		table := []testParams{
+			{nil, nil, 0, false, sorted},
+			{nil, nil, 0, true, reverseRecords(sorted)},
+			{[]byte("hi"), []byte("oi"), 0, false, sorted[2:5]},
+			{[]byte("hi"), []byte("oi"), 0, true, reverseRecords(sorted[2:5])},
+			{[]byte("h"), nil, 3, false, sorted[1:4]},
+			{nil, []byte("m"), 2, true, reverseRecords(sorted[2:4])},
+			{[]byte("z"), nil, 0, false, []testRecord{}},
+		}
+
+		for _, rec := range table {
+			assertRangeResults(t, store, rec.start, rec.end, rec.limit, rec.reverse, rec.expected)
+		}
+	})
+
+	t.Run("RangeReturnsNoDeletedKeyValues", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false, WithOrderedIndex())
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		deleteRecords(t, store, [][]byte{sorted[1].k, sorted[4].k})
+
+		expected := []testRecord{sorted[0], sorted[2], sorted[3], sorted[5], sorted[6]}
+		assertRangeResults(t, store, nil, nil, 0, false, expected)
+		assertRangeResults(t, store, nil, nil, 2, false, expected[:2])
+	})
+
+	t.Run("RangeAfterCompactAndResizeReturnsTheSameKeyValues", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStoreWithMaxKeys(t, dbPath, 10, false, WithOrderedIndex())
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		deleteRecords(t, store, [][]byte{sorted[0].k, sorted[6].k})
+
+		err := store.Compact()
+		if err != nil {
+			t.Fatalf("error compacting store: %s", err)
+		}
+		assertRangeResults(t, store, nil, nil, 0, false, sorted[1:6])
+
+		err = store.Resize(2_000)
+		if err != nil {
+			t.Fatalf("error resizing store: %s", err)
+		}
+		assertRangeResults(t, store, nil, nil, 0, false, sorted[1:6])
+		assertCompactionFilesDontExist(t, dbPath)
+	})
+
+	t.Run("RangeAfterClearReturnsAnEmptyList", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false, WithOrderedIndex())
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		err := store.Clear()
+		if err != nil {
+			t.Fatalf("error clearing store: %s", err)
+		}
+
+		assertRangeResults(t, store, nil, nil, 0, false, []testRecord{})
+	})
+
+	t.Run("OrderedIndexIsKeptWhenTheStoreIsReopened", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false, WithOrderedIndex())
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
+		}()
+
+		store := createStore(t, dbPath, nil, false, WithOrderedIndex())
+		defer func() {
+			_ = store.Close()
+		}()
+		assertRangeResults(t, store, nil, nil, 0, false, sorted)
+	})
+
+	t.Run("OrderedIndexIsBuiltOnOpenForAStoreThatAlreadyHasKeys", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
+		}()
+
+		store := createStore(t, dbPath, nil, false, WithOrderedIndex())
+		defer func() {
+			_ = store.Close()
+		}()
+		assertRangeResults(t, store, nil, nil, 0, false, sorted)
+	})
+}
+
+func TestStore_Len(t *testing.T) {
+	dbPath := "testdb_len"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("LenIsKeptUpToDateBySetDeleteCompactAndClear", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		assert.Equal(t, uint64(0), store.Len())
+
+		insertRecords(t, store, Records, nil)
+		assert.Equal(t, uint64(len(Records)), store.Len())
+
+		// updates add no new keys
+		insertRecords(t, store, Records[:3], nil)
+		assert.Equal(t, uint64(len(Records)), store.Len())
+
+		// deleting missing or already deleted keys changes nothing
+		deleteRecords(t, store, [][]byte{Records[0].k, Records[1].k, Records[0].k, []byte("non-existent")})
+		assert.Equal(t, uint64(len(Records)-2), store.Len())
+
+		// setting a deleted key brings it back
+		insertRecords(t, store, Records[:1], nil)
+		assert.Equal(t, uint64(len(Records)-1), store.Len())
+
+		err := store.Compact()
+		if err != nil {
+			t.Fatalf("error compacting store: %s", err)
+		}
+		assert.Equal(t, uint64(len(Records)-1), store.Len())
+
+		err = store.Clear()
+		if err != nil {
+			t.Fatalf("error clearing store: %s", err)
+		}
+		assert.Equal(t, uint64(0), store.Len())
+	})
+
+	t.Run("LenIsSavedInTheDatabaseFile", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
+			deleteRecords(t, store, [][]byte{Records[0].k})
+		}()
+
+		header := readDbFileHeader(t, dbPath)
+		assert.Equal(t, uint64(len(Records)-1), header.KeyCount)
+
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		assert.Equal(t, uint64(len(Records)-1), store.Len())
+	})
+
+	t.Run("LenIsWorkedOutForStoresOfTheLegacyFormat", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		writeLegacyStore(t, dbPath, SearchRecords)
+
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		assert.Equal(t, uint64(len(SearchRecords)), store.Len())
+	})
+}
+
+func TestStore_Keys(t *testing.T) {
+	dbPath := "testdb_keys"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	for _, isOrderedIndexEnabled := range []bool{false, true} {
+		opts := make([]Option, 0)
+		if isOrderedIndexEnabled {
+			opts = append(opts, WithOrderedIndex())
+		}
+
+		t.Run(fmt.Sprintf("KeysReturnsTheLiveKeysWithTheGivenPrefix/OrderedIndex=%v", isOrderedIndexEnabled), func(t *testing.T) {
+			defer func() {
+				removeStore(t, dbPath)
+			}()
+			store := createStore(t, dbPath, nil, false, opts...)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, SearchRecords, nil)
+			deleteRecords(t, store, [][]byte{[]byte("food")})
+
+			type testParams struct {
+				prefix   []byte
+				expected [][]byte
+			}
+			table := []testParams{
+				{nil, [][]byte{[]byte("band"), []byte("bar"), []byte("foo"), []byte("fore"), []byte("pig")}},
+				{[]byte("fo"), [][]byte{[]byte("foo"), []byte("fore")}},
+				{[]byte("food"), [][]byte{}},
+				{[]byte("ba"), [][]byte{[]byte("band"), []byte("bar")}},
+				{[]byte("x"), [][]byte{}},
+			}
+
+			for _, rec := range table {
+				got, err := store.Keys(rec.prefix)
+				if err != nil {
+					t.Fatalf("error getting keys: %s", err)
+				}
+
+				if isOrderedIndexEnabled {
+					assert.Equal(t, rec.expected, got)
+				} else {
+					assert.ElementsMatch(t, rec.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestStore_Exists(t *testing.T) {
+	dbPath := "testdb_exists"
+	removeStore(t, dbPath)
+	store := createStore(t, dbPath, nil, false)
+	defer func() {
+		_ = store.Close()
+		removeStore(t, dbPath)
+	}()
+
+	insertRecords(t, store, Records, nil)
+	deleteRecords(t, store, [][]byte{Records[0].k})
+
+	type testParams struct {
+		key      []byte
+		expected bool
+	}
+	table := []testParams{
+		{Records[0].k, false},
+		{Records[1].k, true},
+		{Records[6].k, true},
+		{[]byte("non-existent"), false},
+	}
+
+	for _, rec := range table {
+		got, err := store.Exists(rec.key)
+		if err != nil {
+			t.Fatalf("error checking if key exists: %s", err)
+		}
+		assert.Equal(t, rec.expected, got, "%s", rec.key)
+	}
+}
+
+func TestStore_TTL(t *testing.T) {
+	dbPath := "testdb_ttl"
+	removeStore(t, dbPath)
+	store := createStore(t, dbPath, nil, false)
+	defer func() {
+		_ = store.Close()
+		removeStore(t, dbPath)
+	}()
+
+	ttl := time.Hour
+	insertRecords(t, store, Records[:3], nil)
+	insertRecords(t, store, Records[3:], &ttl)
+	deleteRecords(t, store, [][]byte{Records[4].k})
+
+	for _, key := range [][]byte{Records[0].k, Records[4].k, []byte("non-existent")} {
+		assert.Nil(t, getTTL(t, store, key), "%s", key)
+	}
+
+	for _, record := range []testRecord{Records[3], Records[5]} {
+		got := getTTL(t, store, record.k)
+		if assert.NotNil(t, got, "%s", record.k) {
+			assert.InDelta(t, ttl, *got, float64(time.Second), "%s", record.k)
+		}
+	}
+}
+
+func TestStore_Expire(t *testing.T) {
+	dbPath := "testdb_expire"
+	walPath := path.Join(dbPath, "dump.wal")
+	removeStore(t, dbPath)
+
+	t.Run("ExpireSetsTheTTLOfExistingKeysOnly", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		deleteRecords(t, store, [][]byte{Records[0].k})
+
+		for _, record := range Records[1:3] {
+			isFound, err := store.Expire(record.k, time.Hour)
+			if err != nil {
+				t.Fatalf("error setting expiry: %s", err)
+			}
+			assert.True(t, isFound)
+		}
+
+		for _, key := range [][]byte{Records[0].k, []byte("non-existent")} {
+			isFound, err := store.Expire(key, time.Hour)
+			if err != nil {
+				t.Fatalf("error setting expiry: %s", err)
+			}
+			assert.False(t, isFound)
+		}
+
+		for _, record := range Records[1:3] {
+			got := getTTL(t, store, record.k)
+			if assert.NotNil(t, got, "%s", record.k) {
+				assert.InDelta(t, time.Hour, *got, float64(time.Second), "%s", record.k)
+			}
+		}
+		assert.Nil(t, getTTL(t, store, Records[3].k))
+		assertStoreContains(t, store, Records[1:])
+		assertKeysDontExist(t, store, [][]byte{Records[0].k})
+	})
+
+	t.Run("ExpireAtSetsTheExpiryToTheGivenTime", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		isFound, err := store.ExpireAt(Records[0].k, time.Now().Add(2*time.Hour))
+		if err != nil {
+			t.Fatalf("error setting expiry: %s", err)
+		}
+		assert.True(t, isFound)
+
+		got := getTTL(t, store, Records[0].k)
+		if assert.NotNil(t, got) {
+			assert.InDelta(t, 2*time.Hour, *got, float64(time.Second))
+		}
+	})
+
+	t.Run("ExpireAtInThePastDeletesTheKey", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		for _, at := range []time.Time{time.Now().Add(-time.Hour), {}} {
+			for _, record := range Records[:2] {
+				_, err := store.ExpireAt(record.k, at)
+				if err != nil {
+					t.Fatalf("error setting expiry: %s", err)
+				}
+			}
+		}
+
+		assertKeysDontExist(t, store, [][]byte{Records[0].k, Records[1].k})
+		assertStoreContains(t, store, Records[2:])
+		assert.Equal(t, uint64(len(Records)-2), store.Len())
+	})
+
+	t.Run("PersistRemovesTheExpiry", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		ttl := time.Hour
+		store := createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, &ttl)
+
+		isFound, err := store.Persist(Records[0].k)
+		if err != nil {
+			t.Fatalf("error persisting key: %s", err)
+		}
+		assert.True(t, isFound)
+
+		isFound, err = store.Persist([]byte("non-existent"))
+		if err != nil {
+			t.Fatalf("error persisting key: %s", err)
+		}
+		assert.False(t, isFound)
+
+		assert.Nil(t, getTTL(t, store, Records[0].k))
+		assert.NotNil(t, getTTL(t, store, Records[1].k))
+		assertStoreContains(t, store, Records)
+		assertSearchResults(t, store, []byte("hey"), Records[:1])
+
+		// compaction keeps the new expiry
+		err = store.Compact()
+		if err != nil {
+			t.Fatalf("error compacting store: %s", err)
+		}
+		assert.Nil(t, getTTL(t, store, Records[0].k))
+		assert.NotNil(t, getTTL(t, store, Records[1].k))
+	})
+
+	t.Run("ExpiryChangesArePersistedAndReplayedFromTheLog", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		ttl := time.Hour
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, &ttl)
+
+			_, err := store.Persist(Records[0].k)
+			if err != nil {
+				t.Fatalf("error persisting key: %s", err)
+			}
+		}()
+
+		// simulate a crash just after the operations were logged
+		writeToWal(
+			t,
+			walPath,
+			wal.Op{Kind: wal.OpExpire, Key: Records[1].k, Expiry: 0},
+			wal.Op{Kind: wal.OpExpire, Key: Records[2].k, Expiry: 1},
+		)
+
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		assert.Nil(t, getTTL(t, store, Records[0].k))
+		assert.Nil(t, getTTL(t, store, Records[1].k))
+		assert.NotNil(t, getTTL(t, store, Records[3].k))
+		assertKeysDontExist(t, store, [][]byte{Records[2].k})
+	})
+}
+
 func TestStore_Set(t *testing.T) {
 	dbPath := "testdb_set"
 	removeStore(t, dbPath)
 
-	t.Run("SetWithoutTTLInsertsKeyValuesThatNeverExpire", func(t *testing.T) {
+	t.Run("SetWithoutTTLInsertsKeyValuesThatNeverExpire", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		assertStoreContains(t, store, Records)
+	})
+
+	t.Run("SetWithTTLInsertsKeyValuesThatExpireAfterTTLSeconds", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		ttl := 500 * time.Millisecond
+
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:3], nil)
+		insertRecords(t, store, Records[3:], &ttl)
+
+		time.Sleep(time.Second)
+
+		nonExistentKeys := extractKeysFromRecords(Records[3:])
+		assertStoreContains(t, store, Records[:3])
+		assertKeysDontExist(t, store, nonExistentKeys)
+	})
+
+	t.Run("SetWithSubSecondTTLExpiresToTheNearestMillisecond", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		ttl := 300 * time.Millisecond
+
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:1], &ttl)
+
+		got := getTTL(t, store, Records[0].k)
+		if assert.NotNil(t, got) {
+			assert.LessOrEqual(t, *got, ttl)
+			assert.Greater(t, *got, 200*time.Millisecond)
+		}
+
+		time.Sleep(400 * time.Millisecond)
+		assertKeysDontExist(t, store, [][]byte{Records[0].k})
+	})
+
+	t.Run("SetAnExistingKeyUpdatesIt", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		updates := []testRecord{
+			{[]byte("hey"), []byte("Jane")},
+			{[]byte("hi"), []byte("John")},
+			{[]byte("hola"), []byte("Santos")},
+			{[]byte("oi"), []byte("Ronaldo")},
+			{[]byte("mulimuta"), []byte("Aliguma")},
+		}
+		expected := []testRecord{
+			{[]byte("hey"), []byte("Jane")},
+			{[]byte("hi"), []byte("John")},
+			{[]byte("salut"), []byte("French")},
+			{[]byte("bonjour"), []byte("French")},
+			{[]byte("hola"), []byte("Santos")},
+			{[]byte("oi"), []byte("Ronaldo")},
+			{[]byte("mulimuta"), []byte("Aliguma")},
+		}
+
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		insertRecords(t, store, updates, nil)
+		assertStoreContains(t, store, expected)
+	})
+
+	t.Run("FileIsPersistedToAfterSet", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
+		}()
+
+		// the old store is expected to be garbage collected around here.
+		runtime.GC()
+
+		// Open another store
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		assertStoreContains(t, store, Records)
+	})
+}
+
+func TestStore_Delete(t *testing.T) {
+	dbPath := "testdb_delete"
+	removeStore(t, dbPath)
+
+	t.Run("DeleteRemovesKeyValuePair", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		keysToDelete := extractKeysFromRecords(Records[3:])
+
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		deleteRecords(t, store, keysToDelete)
+		assertStoreContains(t, store, Records[:3])
+		assertKeysDontExist(t, store, keysToDelete)
+	})
+
+	t.Run("FileIsPersistedToAfterDelete", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		keysToDelete := extractKeysFromRecords(Records[3:])
+
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
+			deleteRecords(t, store, keysToDelete)
+		}()
+
+		// the old store is expected to be garbage collected around here.
+		runtime.GC()
+
+		// open another store
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		assertStoreContains(t, store, Records[:3])
+		assertKeysDontExist(t, store, keysToDelete)
+	})
+}
+
+func TestStore_Clear(t *testing.T) {
+	dbPath := "testdb_clear"
+	removeStore(t, dbPath)
+
+	t.Run("ClearDeletesAllDataInStore", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		err := store.Clear()
+		if err != nil {
+			t.Fatalf("error clearing store: %s", err)
+		}
+
+		allKeys := extractKeysFromRecords(Records)
+		assertKeysDontExist(t, store, allKeys)
+	})
+
+	t.Run("FileIsPersistedToAfterClear", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
+			err := store.Clear()
+			if err != nil {
+				t.Fatalf("error clearing store: %s", err)
+			}
+		}()
+
+		// the old store is expected to be garbage collected around here.
+		runtime.GC()
+
+		// Create new store
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		allKeys := extractKeysFromRecords(Records)
+		assertKeysDontExist(t, store, allKeys)
+	})
+}
+
+func TestStore_Compact(t *testing.T) {
+	dbPath := "testdb_compact"
+	removeStore(t, dbPath)
+
+	t.Run("CompactRemovesDanglingExpiredAndDeletedKeyValuePairsFromFile", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		ttl := 500 * time.Millisecond
+
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:3], nil)
+		insertRecords(t, store, Records[3:], &ttl)
+		deleteRecords(t, store, [][]byte{Records[2].k})
+
+		initialFileSize := getFileSize(t, dbPath)
+
+		time.Sleep(time.Second)
+		err := store.Compact()
+		if err != nil {
+			t.Fatalf("error compacting store: %s", err)
+		}
+
+		finalFileSize := getFileSize(t, dbPath)
+
+		assert.Less(t, finalFileSize, initialFileSize)
+		nonExistentKeys := extractKeysFromRecords(Records[2:])
+		assertStoreContains(t, store, Records[:2])
+		assertKeysDontExist(t, store, nonExistentKeys)
+	})
+
+	t.Run("BackgroundTaskCompactsAtCompactionInterval", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		ttl := 500 * time.Millisecond
+		var compactionInterval uint32 = 2
+
+		store := createStore(t, dbPath, &compactionInterval, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:3], nil)
+		insertRecords(t, store, Records[3:], &ttl)
+		deleteRecords(t, store, [][]byte{Records[2].k})
+
+		initialFileSize := getFileSize(t, dbPath)
+
+		time.Sleep(3 * time.Second)
+
+		finalFileSize := getFileSize(t, dbPath)
+
+		assert.Less(t, finalFileSize, initialFileSize)
+		nonExistentKeys := extractKeysFromRecords(Records[2:])
+		assertStoreContains(t, store, Records[:2])
+		assertKeysDontExist(t, store, nonExistentKeys)
+	})
+
+	t.Run("ReadsAndWritesGoOnWhileCompactionIsRunning", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, SearchRecords, nil)
+		deleteRecords(t, store, [][]byte{SearchRecords[5].k})
+
+		c, err := store.startCompaction()
+		if err != nil {
+			t.Fatalf("error starting compaction: %s", err)
+		}
+		_, err = store.stepCompaction(c)
+		if err != nil {
+			t.Fatalf("error running compaction step: %s", err)
+		}
+
+		// the store's lock is not held in between the steps
+		assertStoreContains(t, store, SearchRecords[:5])
+		insertRecords(t, store, Records[:2], nil)
+		insertRecords(t, store, []testRecord{{SearchRecords[0].k, []byte("new")}}, nil)
+		deleteRecords(t, store, [][]byte{SearchRecords[1].k})
+
+		err = store.finishCompaction(c)
+		if err != nil {
+			t.Fatalf("error finishing compaction: %s", err)
+		}
+
+		assert.Nil(t, store.compaction)
+		assertStoreContains(t, store, Records[:2])
+		assertStoreContains(t, store, []testRecord{{SearchRecords[0].k, []byte("new")}})
+		assertStoreContains(t, store, SearchRecords[2:5])
+		assertKeysDontExist(t, store, [][]byte{SearchRecords[1].k, SearchRecords[5].k})
+		assertSearchResults(t, store, []byte("fo"), []testRecord{{SearchRecords[0].k, []byte("new")}, SearchRecords[2]})
+		assertCompactionFilesDontExist(t, dbPath)
+	})
+
+	t.Run("ClearWhileCompactionIsRunningAbortsTheCompaction", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, SearchRecords, nil)
+
+		c, err := store.startCompaction()
+		if err != nil {
+			t.Fatalf("error starting compaction: %s", err)
+		}
+		_, err = store.stepCompaction(c)
+		if err != nil {
+			t.Fatalf("error running compaction step: %s", err)
+		}
+
+		err = store.Clear()
+		if err != nil {
+			t.Fatalf("error clearing store: %s", err)
+		}
+		assertCompactionFilesDontExist(t, dbPath)
+
+		isDone, err := store.stepCompaction(c)
+		assert.Nil(t, err)
+		assert.True(t, isDone)
+
+		err = store.finishCompaction(c)
+		assert.Nil(t, err)
+		assertKeysDontExist(t, store, extractKeysFromRecords(SearchRecords))
+		assertSearchResults(t, store, []byte("f"), []testRecord{})
+	})
+
+	t.Run("CompactionFilesLeftByACrashBeforeTheSwapAreRemovedOnOpen", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true)
+		insertRecords(t, store, SearchRecords, nil)
+		err := store.Close()
+		if err != nil {
+			t.Fatalf("error closing store: %s", err)
+		}
+
+		for _, fileName := range []string{"tmp__compact.scdb", "tmp__compact.iscdb"} {
+			err = os.WriteFile(path.Join(dbPath, fileName), []byte("half-copied"), 0666)
+			if err != nil {
+				t.Fatalf("error writing file: %s", err)
+			}
+		}
+
+		store = createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		assertCompactionFilesDontExist(t, dbPath)
+		assertStoreContains(t, store, SearchRecords)
+		assertSearchResults(t, store, []byte("fo"), SearchRecords[:3])
+	})
+
+	t.Run("SearchIndexLeftByACrashMidSwapIsMovedIntoPlaceOnOpen", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		searchIndexPath := path.Join(dbPath, "index.iscdb")
+		store := createStore(t, dbPath, nil, true)
+		insertRecords(t, store, SearchRecords, nil)
+		deleteRecords(t, store, [][]byte{SearchRecords[0].k})
+		err := store.Close()
+		if err != nil {
+			t.Fatalf("error closing store: %s", err)
+		}
+
+		oldSearchIndex, err := os.ReadFile(searchIndexPath)
+		if err != nil {
+			t.Fatalf("error reading search index: %s", err)
+		}
+
+		store = createStore(t, dbPath, nil, true)
+		err = store.Compact()
+		if err != nil {
+			t.Fatalf("error compacting store: %s", err)
+		}
+		err = store.Close()
+		if err != nil {
+			t.Fatalf("error closing store: %s", err)
+		}
+
+		// the crash came after the database file was replaced, but before the search index was
+		err = os.Rename(searchIndexPath, path.Join(dbPath, "tmp__compact.iscdb"))
+		if err != nil {
+			t.Fatalf("error renaming search index: %s", err)
+		}
+		err = os.WriteFile(searchIndexPath, oldSearchIndex, 0666)
+		if err != nil {
+			t.Fatalf("error writing search index: %s", err)
+		}
+
+		store = createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		assertCompactionFilesDontExist(t, dbPath)
+		assertStoreContains(t, store, SearchRecords[1:])
+		assertSearchResults(t, store, []byte("f"), SearchRecords[1:3])
+	})
+}
+
+func TestStore_CompactionPolicy(t *testing.T) {
+	dbPath := "testdb_compaction_policy"
+	removeStore(t, dbPath)
+	var noInterval uint32 = 0
+
+	t.Run("DeadBytesCountOverwrittenDeletedAndReadExpiredKeyValues", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		ttl := 500 * time.Millisecond
+
+		store := createStore(t, dbPath, &noInterval, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:3], nil)
+		insertRecords(t, store, Records[3:4], &ttl)
+		assert.Equal(t, uint64(0), store.CompactionStats().DeadBytes)
+
+		insertRecords(t, store, []testRecord{{Records[0].k, []byte("new")}}, nil)
+		deleteRecords(t, store, [][]byte{Records[1].k, Records[1].k})
+		expectedDeadBytes := getEntrySize(Records[0]) + getEntrySize(Records[1])
+		assert.Equal(t, expectedDeadBytes, store.CompactionStats().DeadBytes)
+
+		time.Sleep(time.Second)
+		assertKeysDontExist(t, store, [][]byte{Records[3].k, Records[3].k})
+		deleteRecords(t, store, [][]byte{Records[3].k})
+		expectedDeadBytes += getEntrySize(Records[3])
+
+		stats := store.CompactionStats()
+		assert.Equal(t, expectedDeadBytes, stats.DeadBytes)
+		assert.Equal(t, float64(stats.DeadBytes)/float64(stats.DataSize), stats.GarbageRatio)
+		assert.Equal(t, uint64(0), stats.Compactions)
+	})
+
+	t.Run("StoreIsCompactedWhenDeadBytesPassMaxGarbageBytes", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+
+		store := createStore(t, dbPath, &noInterval, false, WithMaxGarbageBytes(getEntrySize(Records[0])+1))
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		deleteRecords(t, store, [][]byte{Records[0].k})
+		time.Sleep(500 * time.Millisecond)
+		assert.Equal(t, uint64(0), store.CompactionStats().Compactions)
+
+		deleteRecords(t, store, [][]byte{Records[1].k})
+		assert.Eventually(t, func() bool {
+			return store.CompactionStats().Compactions == 1
+		}, 3*time.Second, 50*time.Millisecond)
+
+		assert.Equal(t, uint64(0), store.CompactionStats().DeadBytes)
+		assertStoreContains(t, store, Records[2:])
+		assertKeysDontExist(t, store, extractKeysFromRecords(Records[:2]))
+	})
+
+	t.Run("StoreIsCompactedWhenGarbageRatioPassesMaxGarbageRatio", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		largeValue := bytes.Repeat([]byte("v"), 600*1024)
+		records := []testRecord{
+			{[]byte("foo"), largeValue},
+			{[]byte("bar"), largeValue},
+			{[]byte("baz"), largeValue},
+		}
+
+		store := createStore(t, dbPath, &noInterval, false, WithMaxGarbageRatio(0.4))
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, records, nil)
+
+		// the garbage ratio is passed but the dead bytes are still too few to bother
+		insertRecords(t, store, []testRecord{{records[0].k, []byte("small")}}, nil)
+		time.Sleep(500 * time.Millisecond)
+		assert.Equal(t, uint64(0), store.CompactionStats().Compactions)
+
+		insertRecords(t, store, []testRecord{{records[1].k, []byte("small")}}, nil)
+		assert.Eventually(t, func() bool {
+			return store.CompactionStats().Compactions == 1
+		}, 3*time.Second, 50*time.Millisecond)
+
+		stats := store.CompactionStats()
+		assert.Equal(t, uint64(0), stats.DeadBytes)
+		assert.Greater(t, stats.LastReclaimedBytes, uint64(2*len(largeValue)))
+		assertStoreContains(t, store, []testRecord{
+			{records[0].k, []byte("small")},
+			{records[1].k, []byte("small")},
+			records[2],
+		})
+	})
+
+	t.Run("BackgroundTaskSkipsCompactionAtIntervalIfThereIsNothingToReclaim", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		var compactionInterval uint32 = 1
+
+		store := createStore(t, dbPath, &compactionInterval, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+
+		// the first compaction finds out that no key-value pairs can expire
+		time.Sleep(3500 * time.Millisecond)
+		assert.Equal(t, uint64(1), store.CompactionStats().Compactions)
+	})
+
+	t.Run("CompactionStatsDescribeTheLastCompaction", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+
+		store := createStore(t, dbPath, &noInterval, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records, nil)
+		deleteRecords(t, store, extractKeysFromRecords(Records[:3]))
+		initialFileSize := getFileSize(t, dbPath)
+		startTime := time.Now()
+
+		err := store.Compact()
+		if err != nil {
+			t.Fatalf("error compacting store: %s", err)
+		}
+
+		stats := store.CompactionStats()
+		assert.Equal(t, uint64(1), stats.Compactions)
+		assert.False(t, stats.IsRunning)
+		assert.Equal(t, uint64(initialFileSize-getFileSize(t, dbPath)), stats.LastReclaimedBytes)
+		assert.False(t, stats.LastCompactedAt.Before(startTime))
+		assert.Greater(t, stats.LastDuration, time.Duration(0))
+		assert.Equal(t, uint64(0), stats.DeadBytes)
+		assert.Equal(t, 0.0, stats.GarbageRatio)
+	})
+}
+
+func TestStore_Resize(t *testing.T) {
+	dbPath := "testdb_resize"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("ResizeGrowsTheIndexKeepingAllKeyValues", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStoreWithMaxKeys(t, dbPath, 10, true)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, SearchRecords, nil)
+			initialSearchIndexMaxKeys := store.searchIndex.MaxKeys()
+
+			err := store.Resize(2_000)
+			if err != nil {
+				t.Fatalf("error resizing store: %s", err)
+			}
+
+			assert.Equal(t, uint64(2_000), store.header.MaxKeys)
+			assert.Greater(t, store.searchIndex.MaxKeys(), initialSearchIndexMaxKeys)
+			assertStoreContains(t, store, SearchRecords)
+			assertSearchResults(t, store, []byte("fo"), SearchRecords[:3])
+		}()
+
+		// the new size is persisted
+		store := createStoreWithMaxKeys(t, dbPath, 10, true)
+		defer func() {
+			_ = store.Close()
+		}()
+		assert.Equal(t, uint64(2_000), store.header.MaxKeys)
+		assertStoreContains(t, store, SearchRecords)
+		assertSearchResults(t, store, []byte("fo"), SearchRecords[:3])
+	})
+
+	t.Run("ResizeToLessThanTheCurrentMaxKeysReturnsErrOutOfBounds", func(t *testing.T) {
 		defer func() {
 			removeStore(t, dbPath)
 		}()
-		store := createStore(t, dbPath, nil, false)
+		store := createStoreWithMaxKeys(t, dbPath, 1_000, false)
 		defer func() {
 			_ = store.Close()
 		}()
 		insertRecords(t, store, Records, nil)
+
+		err := store.Resize(10)
+		assert.IsType(t, &errors.ErrOutOfBounds{}, err)
+		assert.Equal(t, uint64(1_000), store.header.MaxKeys)
 		assertStoreContains(t, store, Records)
 	})
 
-	t.Run("SetWithTTLInsertsKeyValuesThatExpireAfterTTLSeconds", func(t *testing.T) {
+	t.Run("ResizeWhileACompactionIsRunningReplacesTheCompaction", func(t *testing.T) {
 		defer func() {
 			removeStore(t, dbPath)
 		}()
-		var ttl uint64 = 1
-
-		store := createStore(t, dbPath, nil, false)
+		store := createStoreWithMaxKeys(t, dbPath, 10, false, WithOrderedIndex())
 		defer func() {
 			_ = store.Close()
 		}()
-		insertRecords(t, store, Records[:3], nil)
-		insertRecords(t, store, Records[3:], &ttl)
+		insertRecords(t, store, Records, nil)
+		c, err := store.startCompaction()
+		if err != nil {
+			t.Fatalf("error starting compaction: %s", err)
+		}
 
-		time.Sleep(2 * time.Second)
+		err = store.Resize(2_000)
+		if err != nil {
+			t.Fatalf("error resizing store: %s", err)
+		}
 
-		nonExistentKeys := extractKeysFromRecords(Records[3:])
-		assertStoreContains(t, store, Records[:3])
-		assertKeysDontExist(t, store, nonExistentKeys)
+		assert.Equal(t, uint64(2_000), store.header.MaxKeys)
+		isDone, err := store.stepCompaction(c)
+		assert.Nil(t, err)
+		assert.True(t, isDone)
+		assertStoreContains(t, store, Records)
+		assertCompactionFilesDontExist(t, dbPath)
 	})
 
-	t.Run("SetAnExistingKeyUpdatesIt", func(t *testing.T) {
+	t.Run("IndexGrowsAutomaticallyWhenItGetsTooFull", func(t *testing.T) {
 		defer func() {
 			removeStore(t, dbPath)
 		}()
-		updates := []testRecord{
-			{[]byte("hey"), []byte("Jane")},
-			{[]byte("hi"), []byte("John")},
-			{[]byte("hola"), []byte("Santos")},
-			{[]byte("oi"), []byte("Ronaldo")},
-			{[]byte("mulimuta"), []byte("Aliguma")},
-		}
-		expected := []testRecord{
-			{[]byte("hey"), []byte("Jane")},
-			{[]byte("hi"), []byte("John")},
-			{[]byte("salut"), []byte("French")},
-			{[]byte("bonjour"), []byte("French")},
-			{[]byte("hola"), []byte("Santos")},
-			{[]byte("oi"), []byte("Ronaldo")},
-			{[]byte("mulimuta"), []byte("Aliguma")},
+		store := createStoreWithMaxKeys(t, dbPath, 10, true, WithMaxLoadFactor(0.5))
+		defer func() {
+			_ = store.Close()
+		}()
+
+		records := make([]testRecord, 0, 30)
+		for i := 0; i < 30; i++ {
+			records = append(records, testRecord{[]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))})
 		}
+		insertRecords(t, store, records, nil)
+
+		// the index is grown by the background compaction task
+		assert.Eventually(t, func() bool {
+			return store.CompactionStats().Compactions == 1
+		}, 3*time.Second, 50*time.Millisecond)
+
+		assert.Greater(t, store.header.MaxKeys, uint64(10))
+		assertStoreContains(t, store, records)
+		expected := []testRecord{records[2]}
+		expected = append(expected, records[20:30]...)
+		assertSearchResults(t, store, []byte("key-2"), expected)
+	})
 
-		store := createStore(t, dbPath, nil, false)
+	t.Run("IndexGrowsAutomaticallyWhenAKeyFindsAllItsSlotsTaken", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStoreWithMaxKeys(t, dbPath, 10, false, WithMaxLoadFactor(1))
 		defer func() {
 			_ = store.Close()
 		}()
-		insertRecords(t, store, Records, nil)
-		insertRecords(t, store, updates, nil)
-		assertStoreContains(t, store, expected)
+		initialNumberOfIndexBlocks := store.header.NumberOfIndexBlocks
+
+		// one more key than the number of slots each key can take in the index
+		keys := getCollidingKeys(store.header, int(initialNumberOfIndexBlocks)+1)
+		records := make([]testRecord, 0, len(keys))
+		for _, k := range keys {
+			records = append(records, testRecord{k, k})
+		}
+		insertRecords(t, store, records, nil)
+
+		assert.Greater(t, store.header.NumberOfIndexBlocks, initialNumberOfIndexBlocks)
+		assertStoreContains(t, store, records)
 	})
+}
 
-	t.Run("FileIsPersistedToAfterSet", func(t *testing.T) {
+func TestStore_Sync(t *testing.T) {
+	dbPath := "testdb_sync"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("SyncFlushesAllWritesToDisk", func(t *testing.T) {
+		for _, opts := range [][]Option{{}, {WithWAL()}} {
+			store := createStore(t, dbPath, nil, true, opts...)
+			insertRecords(t, store, Records, nil)
+
+			err := store.Sync()
+			assert.Nil(t, err)
+			assert.False(t, store.hasUnsyncedWrites)
+
+			_ = store.Close()
+			removeStore(t, dbPath)
+		}
+	})
+
+	t.Run("SyncAfterCloseDoesNothing", func(t *testing.T) {
 		defer func() {
 			removeStore(t, dbPath)
 		}()
-		func() {
-			store := createStore(t, dbPath, nil, false)
-			defer func() {
-				_ = store.Close()
+		store := createStore(t, dbPath, nil, false)
+		_ = store.Close()
+		assert.Nil(t, store.Sync())
+	})
+}
+
+func TestStore_WithSyncPolicy(t *testing.T) {
+	dbPath := "testdb_sync_policy"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("SyncAlwaysLeavesNoUnsyncedWrites", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		for _, opts := range [][]Option{{WithSyncPolicy(SyncAlways)}, {WithSyncPolicy(SyncAlways), WithWAL()}} {
+			func() {
+				store := createStore(t, dbPath, nil, true, opts...)
+				defer func() {
+					_ = store.Close()
+				}()
+
+				insertRecords(t, store, Records, nil)
+				assert.False(t, store.hasUnsyncedWrites)
+				deleteRecords(t, store, [][]byte{Records[0].k})
+				assert.False(t, store.hasUnsyncedWrites)
+				assertStoreContains(t, store, Records[1:])
 			}()
-			insertRecords(t, store, Records, nil)
+		}
+	})
+
+	t.Run("SyncIntervalSyncsWritesInTheBackground", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false, WithSyncPolicy(SyncInterval), WithSyncInterval(100*time.Millisecond))
+		defer func() {
+			_ = store.Close()
 		}()
 
-		// the old store is expected to be garbage collected around here.
-		runtime.GC()
+		insertRecords(t, store, Records, nil)
+		store.mu.Lock()
+		assert.True(t, store.hasUnsyncedWrites)
+		store.mu.Unlock()
 
-		// Open another store
+		time.Sleep(300 * time.Millisecond)
+
+		store.mu.Lock()
+		assert.False(t, store.hasUnsyncedWrites)
+		store.mu.Unlock()
+		assertStoreContains(t, store, Records)
+	})
+
+	t.Run("SyncNeverLeavesSyncingToTheOS", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
 		store := createStore(t, dbPath, nil, false)
 		defer func() {
 			_ = store.Close()
 		}()
+
+		insertRecords(t, store, Records, nil)
+		assert.Equal(t, SyncNever, store.syncPolicy)
+		assert.False(t, store.hasUnsyncedWrites)
 		assertStoreContains(t, store, Records)
 	})
 }
 
-func TestStore_Delete(t *testing.T) {
-	dbPath := "testdb_delete"
+func TestStore_Concurrency(t *testing.T) {
+	dbPath := "testdb_concurrency"
 	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
 
-	t.Run("DeleteRemovesKeyValuePair", func(t *testing.T) {
+	store := createStore(t, dbPath, nil, true)
+	defer func() {
+		_ = store.Close()
+	}()
+	insertRecords(t, store, SearchRecords, nil)
+
+	t.Run("ReadsRunInParallelWithEachOther", func(t *testing.T) {
+		// hold a read lock; other reads must still go through
+		store.mu.RLock()
+		defer store.mu.RUnlock()
+
+		done := make(chan bool)
+		go func() {
+			assertStoreContains(t, store, SearchRecords)
+			_, err := store.Search([]byte("fo"), 0, 0)
+			assert.Nil(t, err)
+			done <- true
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("reads were blocked by another read")
+		}
+	})
+
+	t.Run("ConcurrentReadsAndWritesAreConsistent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					assertStoreContains(t, store, SearchRecords)
+					_, err := store.Search([]byte("ba"), 0, 0)
+					assert.Nil(t, err)
+				}
+			}()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				insertRecords(t, store, Records, nil)
+			}
+		}()
+
+		wg.Wait()
+		assertStoreContains(t, store, Records)
+		assertStoreContains(t, store, SearchRecords)
+	})
+}
+
+func TestStore_Locking(t *testing.T) {
+	dbPath := "testdb_locking"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("NewForStoreOpenElsewhereReturnsErrStoreLocked", func(t *testing.T) {
 		defer func() {
 			removeStore(t, dbPath)
 		}()
-		keysToDelete := extractKeysFromRecords(Records[3:])
-
 		store := createStore(t, dbPath, nil, false)
 		defer func() {
 			_ = store.Close()
 		}()
 		insertRecords(t, store, Records, nil)
-		deleteRecords(t, store, keysToDelete)
-		assertStoreContains(t, store, Records[:3])
-		assertKeysDontExist(t, store, keysToDelete)
+
+		_, err := New(dbPath, nil, nil, nil, nil, false)
+		assert.Equal(t, errors.NewErrStoreLocked(dbPath), err)
+
+		// the store that holds the lock goes on working
+		assertStoreContains(t, store, Records)
 	})
 
-	t.Run("FileIsPersistedToAfterDelete", func(t *testing.T) {
+	t.Run("NewAfterStoreIsClosedOpensIt", func(t *testing.T) {
 		defer func() {
 			removeStore(t, dbPath)
 		}()
-		keysToDelete := extractKeysFromRecords(Records[3:])
-
 		func() {
 			store := createStore(t, dbPath, nil, false)
 			defer func() {
 				_ = store.Close()
 			}()
 			insertRecords(t, store, Records, nil)
-			deleteRecords(t, store, keysToDelete)
 		}()
 
-		// the old store is expected to be garbage collected around here.
-		runtime.GC()
-
-		// open another store
 		store := createStore(t, dbPath, nil, false)
 		defer func() {
 			_ = store.Close()
 		}()
-		assertStoreContains(t, store, Records[:3])
-		assertKeysDontExist(t, store, keysToDelete)
+		assertStoreContains(t, store, Records)
 	})
 }
 
-func TestStore_Clear(t *testing.T) {
-	dbPath := "testdb_clear"
+func TestStore_Close(t *testing.T) {
+	dbPath := "testdb_close"
 	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
 
-	t.Run("ClearDeletesAllDataInStore", func(t *testing.T) {
+	ttl := 500 * time.Millisecond
+	var compactionInterval uint32 = 2
+
+	store := createStore(t, dbPath, &compactionInterval, false)
+	defer func() {
+		_ = store.Close()
+	}()
+	insertRecords(t, store, Records[:3], nil)
+	insertRecords(t, store, Records[3:], &ttl)
+	deleteRecords(t, store, [][]byte{Records[2].k})
+
+	err := store.Close()
+	if err != nil {
+		t.Fatalf("error closing store: %s", err)
+	}
+
+	initialFileSize := getFileSize(t, dbPath)
+
+	time.Sleep(2 * time.Second)
+
+	finalFileSize := getFileSize(t, dbPath)
+
+	// no compaction done because background tasks have been stopped
+	assert.Equal(t, initialFileSize, finalFileSize)
+
+	assert.Nil(t, store.header)
+	assert.True(t, store.isClosed)
+	// already closed buffer pool will throw error
+	assert.Error(t, store.bufferPool.Close())
+}
+
+func TestStore_WithWAL(t *testing.T) {
+	dbPath := "testdb_wal"
+	walPath := path.Join(dbPath, "dump.wal")
+	removeStore(t, dbPath)
+
+	t.Run("OperationsLeftInLogByACrashAreReplayedOnOpen", func(t *testing.T) {
 		defer func() {
 			removeStore(t, dbPath)
 		}()
-		store := createStore(t, dbPath, nil, false)
+		func() {
+			store := createStore(t, dbPath, nil, true)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records[:3], nil)
+		}()
+
+		// simulate a crash just after the operations were logged
+		ops := []wal.Op{{Kind: wal.OpDelete, Key: Records[0].k}}
+		for _, record := range Records[3:] {
+			ops = append(ops, wal.Op{Kind: wal.OpSet, Key: record.k, Value: record.v})
+		}
+		writeToWal(t, walPath, ops...)
+
+		store := createStore(t, dbPath, nil, true)
 		defer func() {
 			_ = store.Close()
 		}()
-		insertRecords(t, store, Records, nil)
+		assertStoreContains(t, store, Records[1:])
+		assertKeysDontExist(t, store, [][]byte{Records[0].k})
 
-		err := store.Clear()
+		got, err := store.Search([]byte("mul"), 0, 0)
 		if err != nil {
-			t.Fatalf("error clearing store: %s", err)
+			t.Fatalf("error searching: %s", err)
 		}
+		assert.Equal(t, []buffers.KeyValuePair{{K: Records[6].k, V: Records[6].v}}, got)
 
-		allKeys := extractKeysFromRecords(Records)
-		assertKeysDontExist(t, store, allKeys)
+		// the log is removed as the store was not opened with WithWAL
+		exists, _ := internal.PathExists(walPath)
+		assert.False(t, exists)
 	})
 
-	t.Run("FileIsPersistedToAfterClear", func(t *testing.T) {
+	t.Run("IncompleteRecordInLogIsIgnoredOnOpen", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false, WithWAL())
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records[:3], nil)
+		}()
+
+		writeToWal(t, walPath, wal.Op{Kind: wal.OpSet, Key: Records[3].k, Value: Records[3].v})
+		writeToWal(t, walPath, wal.Op{Kind: wal.OpClear})
+		// simulate a crash in the middle of logging the clear operation
+		truncateFile(t, walPath, 3)
+
+		store := createStore(t, dbPath, nil, false, WithWAL())
+		defer func() {
+			_ = store.Close()
+		}()
+		assertStoreContains(t, store, Records[:4])
+	})
+
+	t.Run("LogIsEmptiedOnceOperationsArePersisted", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		func() {
+			store := createStore(t, dbPath, nil, false, WithWAL())
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
+			deleteRecords(t, store, [][]byte{Records[0].k})
+			assert.Greater(t, getWalSize(t, walPath), int64(0))
+		}()
+
+		assert.Equal(t, int64(0), getWalSize(t, walPath))
+
+		store := createStore(t, dbPath, nil, false, WithWAL())
+		defer func() {
+			_ = store.Close()
+		}()
+		assertStoreContains(t, store, Records[1:])
+		assertKeysDontExist(t, store, [][]byte{Records[0].k})
+	})
+}
+
+func TestStore_Checksums(t *testing.T) {
+	dbPath := "testdb_checksums"
+	removeStore(t, dbPath)
+
+	t.Run("GetForCorruptedEntryReturnsErrCorruptedEntry", func(t *testing.T) {
 		defer func() {
 			removeStore(t, dbPath)
 		}()
@@ -443,123 +1866,113 @@ func TestStore_Clear(t *testing.T) {
 				_ = store.Close()
 			}()
 			insertRecords(t, store, Records, nil)
-			err := store.Clear()
-			if err != nil {
-				t.Fatalf("error clearing store: %s", err)
-			}
 		}()
 
-		// the old store is expected to be garbage collected around here.
-		runtime.GC()
+		// flip the last byte of the value of the last record, i.e. "Runyoro"
+		lastRecord := Records[len(Records)-1]
+		corruptFile(t, path.Join(dbPath, "dump.scdb"), lastRecord.v)
 
-		// Create new store
 		store := createStore(t, dbPath, nil, false)
 		defer func() {
 			_ = store.Close()
 		}()
-		allKeys := extractKeysFromRecords(Records)
-		assertKeysDontExist(t, store, allKeys)
-	})
-}
+		assertStoreContains(t, store, Records[:len(Records)-1])
 
-func TestStore_Compact(t *testing.T) {
-	dbPath := "testdb_compact"
-	removeStore(t, dbPath)
+		got, err := store.Get(lastRecord.k)
+		var corruptedErr *errors.ErrCorruptedEntry
+		assert.ErrorAs(t, err, &corruptedErr)
+		assert.Equal(t, lastRecord.k, corruptedErr.Key)
+		assert.Nil(t, got)
+	})
 
-	t.Run("CompactRemovesDanglingExpiredAndDeletedKeyValuePairsFromFile", func(t *testing.T) {
+	t.Run("StoreOfLegacyFormatIsUpgradedOnOpen", func(t *testing.T) {
 		defer func() {
 			removeStore(t, dbPath)
 		}()
-		var ttl uint64 = 1
+		writeLegacyStore(t, dbPath, SearchRecords)
 
-		store := createStore(t, dbPath, nil, false)
+		store := createStore(t, dbPath, nil, true)
 		defer func() {
 			_ = store.Close()
 		}()
-		insertRecords(t, store, Records[:3], nil)
-		insertRecords(t, store, Records[3:], &ttl)
-		deleteRecords(t, store, [][]byte{Records[2].k})
-
-		initialFileSize := getFileSize(t, dbPath)
+		assertStoreContains(t, store, SearchRecords)
+		assert.Equal(t, []byte("Scdb versn 0.003"), store.header.Title)
 
-		time.Sleep(3 * time.Second)
-		err := store.Compact()
+		got, err := store.Search([]byte("fo"), 0, 0)
 		if err != nil {
-			t.Fatalf("error compacting store: %s", err)
+			t.Fatalf("error searching: %s", err)
 		}
+		assert.ElementsMatch(t, []buffers.KeyValuePair{
+			{K: SearchRecords[0].k, V: SearchRecords[0].v},
+			{K: SearchRecords[1].k, V: SearchRecords[1].v},
+			{K: SearchRecords[2].k, V: SearchRecords[2].v},
+		}, got)
 
-		finalFileSize := getFileSize(t, dbPath)
-
-		assert.Less(t, finalFileSize, initialFileSize)
-		nonExistentKeys := extractKeysFromRecords(Records[2:])
-		assertStoreContains(t, store, Records[:2])
-		assertKeysDontExist(t, store, nonExistentKeys)
+		insertRecords(t, store, Records, nil)
+		assertStoreContains(t, store, Records)
 	})
 
-	t.Run("BackgroundTaskCompactsAtCompactionInterval", func(t *testing.T) {
+	t.Run("StoreOfUnknownFormatIsNotOpenedNorChanged", func(t *testing.T) {
 		defer func() {
 			removeStore(t, dbPath)
 		}()
-		var ttl uint64 = 1
-		var compactionInterval uint32 = 2
-
-		store := createStore(t, dbPath, &compactionInterval, false)
-		defer func() {
-			_ = store.Close()
+		func() {
+			store := createStore(t, dbPath, nil, false)
+			defer func() {
+				_ = store.Close()
+			}()
+			insertRecords(t, store, Records, nil)
 		}()
-		insertRecords(t, store, Records[:3], nil)
-		insertRecords(t, store, Records[3:], &ttl)
-		deleteRecords(t, store, [][]byte{Records[2].k})
-
-		initialFileSize := getFileSize(t, dbPath)
 
-		time.Sleep(3 * time.Second)
+		// as if written by a newer version of scdb
+		dbFilePath := path.Join(dbPath, "dump.scdb")
+		title := []byte("Scdb versn 9.999")
+		initialContents, err := os.ReadFile(dbFilePath)
+		if err != nil {
+			t.Fatalf("error reading file: %s", err)
+		}
+		copy(initialContents, title)
+		err = os.WriteFile(dbFilePath, initialContents, 0666)
+		if err != nil {
+			t.Fatalf("error writing file: %s", err)
+		}
 
-		finalFileSize := getFileSize(t, dbPath)
+		store, err := New(dbPath, nil, nil, nil, nil, false)
+		assert.Nil(t, store)
+		assert.Equal(t, errors.NewErrUnsupportedFormat(title), err)
 
-		assert.Less(t, finalFileSize, initialFileSize)
-		nonExistentKeys := extractKeysFromRecords(Records[2:])
-		assertStoreContains(t, store, Records[:2])
-		assertKeysDontExist(t, store, nonExistentKeys)
+		contents, err := os.ReadFile(dbFilePath)
+		if err != nil {
+			t.Fatalf("error reading file: %s", err)
+		}
+		assert.Equal(t, initialContents, contents)
 	})
-}
-
-func TestStore_Close(t *testing.T) {
-	dbPath := "testdb_close"
-	removeStore(t, dbPath)
-	defer func() {
-		removeStore(t, dbPath)
-	}()
-
-	var ttl uint64 = 1
-	var compactionInterval uint32 = 2
-
-	store := createStore(t, dbPath, &compactionInterval, false)
-	defer func() {
-		_ = store.Close()
-	}()
-	insertRecords(t, store, Records[:3], nil)
-	insertRecords(t, store, Records[3:], &ttl)
-	deleteRecords(t, store, [][]byte{Records[2].k})
-
-	err := store.Close()
-	if err != nil {
-		t.Fatalf("error closing store: %s", err)
-	}
 
-	initialFileSize := getFileSize(t, dbPath)
-
-	time.Sleep(2 * time.Second)
-
-	finalFileSize := getFileSize(t, dbPath)
-
-	// no compaction done because background tasks have been stopped
-	assert.Equal(t, initialFileSize, finalFileSize)
+	t.Run("StoreWithExpiryInSecondsIsUpgradedOnOpen", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		now := uint64(time.Now().Unix())
+		expiries := []uint64{0, 0, now + 3_600, now + 3_600, now + 3_600, now - 60, now - 60}
+		writeSecondsFormatStore(t, dbPath, Records, expiries)
 
-	assert.Nil(t, store.header)
-	assert.True(t, store.isClosed)
-	// already closed buffer pool will throw error
-	assert.Error(t, store.bufferPool.Close())
+		store := createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+		assert.Equal(t, []byte("Scdb versn 0.003"), store.header.Title)
+		assertStoreContains(t, store, Records[:5])
+		assertKeysDontExist(t, store, extractKeysFromRecords(Records[5:]))
+		assertSearchResults(t, store, []byte("h"), []testRecord{Records[0], Records[1], Records[4]})
+		assert.Equal(t, uint64(5), store.Len())
+
+		assert.Nil(t, getTTL(t, store, Records[0].k))
+		got := getTTL(t, store, Records[2].k)
+		if assert.NotNil(t, got) {
+			// the expiry was in whole seconds
+			assert.InDelta(t, time.Hour, *got, float64(2*time.Second))
+		}
+	})
 }
 
 func BenchmarkStore_Clear(b *testing.B) {
@@ -601,7 +2014,7 @@ func BenchmarkStore_ClearWithSearch(b *testing.B) {
 
 func BenchmarkStore_ClearWithTTL(b *testing.B) {
 	dbPath := "testdb_clear"
-	ttl := uint64(3_600)
+	ttl := time.Hour
 	defer removeStoreForBenchmarks(b, dbPath)
 
 	store := createStoreForBenchmarks(b, dbPath, nil, false)
@@ -609,7 +2022,7 @@ func BenchmarkStore_ClearWithTTL(b *testing.B) {
 		_ = store.Close()
 	}()
 
-	b.Run(fmt.Sprintf("Clear with ttl: %d", ttl), func(b *testing.B) {
+	b.Run(fmt.Sprintf("Clear with ttl: %d", int(ttl.Seconds())), func(b *testing.B) {
 		insertRecordsForBenchmarks(b, store, Records, &ttl)
 
 		for i := 0; i < b.N; i++ {
@@ -620,7 +2033,7 @@ func BenchmarkStore_ClearWithTTL(b *testing.B) {
 
 func BenchmarkStore_ClearWithTTLAndSearch(b *testing.B) {
 	dbPath := "testdb_clear"
-	ttl := uint64(3_600)
+	ttl := time.Hour
 	defer removeStoreForBenchmarks(b, dbPath)
 
 	store := createStoreForBenchmarks(b, dbPath, nil, true)
@@ -628,7 +2041,7 @@ func BenchmarkStore_ClearWithTTLAndSearch(b *testing.B) {
 		_ = store.Close()
 	}()
 
-	b.Run(fmt.Sprintf("ClearWithTTLAndSearch: %d", ttl), func(b *testing.B) {
+	b.Run(fmt.Sprintf("ClearWithTTLAndSearch: %d", int(ttl.Seconds())), func(b *testing.B) {
 		insertRecordsForBenchmarks(b, store, Records, &ttl)
 
 		for i := 0; i < b.N; i++ {
@@ -641,7 +2054,7 @@ func BenchmarkStore_Compact(b *testing.B) {
 	dbPath := "testdb_compact"
 	defer removeStoreForBenchmarks(b, dbPath)
 
-	store := prepCompactBenchmark(b, dbPath, uint64(1), false)
+	store := prepCompactBenchmark(b, dbPath, 500*time.Millisecond, false)
 	defer func() {
 		_ = store.Close()
 	}()
@@ -657,7 +2070,7 @@ func BenchmarkStore_CompactWithSearch(b *testing.B) {
 	dbPath := "testdb_compact"
 	defer removeStoreForBenchmarks(b, dbPath)
 
-	store := prepCompactBenchmark(b, dbPath, uint64(1), true)
+	store := prepCompactBenchmark(b, dbPath, 500*time.Millisecond, true)
 	defer func() {
 		_ = store.Close()
 	}()
@@ -689,7 +2102,7 @@ func BenchmarkStore_Delete(b *testing.B) {
 
 func BenchmarkStore_DeleteWithTTL(b *testing.B) {
 	dbPath := "testdb_delete"
-	ttl := uint64(3_600)
+	ttl := time.Hour
 	defer removeStoreForBenchmarks(b, dbPath)
 
 	store := prepDeleteBenchmark(b, dbPath, &ttl, false)
@@ -727,7 +2140,7 @@ func BenchmarkStore_DeleteWithSearch(b *testing.B) {
 
 func BenchmarkStore_DeleteWithTTLAndSearch(b *testing.B) {
 	dbPath := "testdb_delete"
-	ttl := uint64(3_600)
+	ttl := time.Hour
 	defer removeStoreForBenchmarks(b, dbPath)
 
 	store := prepDeleteBenchmark(b, dbPath, &ttl, true)
@@ -765,7 +2178,7 @@ func BenchmarkStore_Get(b *testing.B) {
 
 func BenchmarkStore_GetWithTtl(b *testing.B) {
 	dbPath := "testdb_get"
-	ttl := uint64(3_600)
+	ttl := time.Hour
 	defer removeStoreForBenchmarks(b, dbPath)
 
 	store := prepGetBenchmark(b, dbPath, &ttl, false)
@@ -802,7 +2215,7 @@ func BenchmarkStore_GetWithSearch(b *testing.B) {
 
 func BenchmarkStore_GetWithTTLAndSearch(b *testing.B) {
 	dbPath := "testdb_get"
-	ttl := uint64(3_600)
+	ttl := time.Hour
 	defer removeStoreForBenchmarks(b, dbPath)
 
 	store := prepGetBenchmark(b, dbPath, &ttl, true)
@@ -880,7 +2293,7 @@ func BenchmarkStore_Set(b *testing.B) {
 
 func BenchmarkStore_SetWithTTL(b *testing.B) {
 	dbPath := "testdb_set"
-	ttl := uint64(3_600)
+	ttl := time.Hour
 	defer removeStoreForBenchmarks(b, dbPath)
 
 	store := prepSetBenchmark(b, dbPath, false)
@@ -916,7 +2329,7 @@ func BenchmarkStore_SetWithSearch(b *testing.B) {
 
 func BenchmarkStore_SetWithTTLAndSearch(b *testing.B) {
 	dbPath := "testdb_set"
-	ttl := uint64(3_600)
+	ttl := time.Hour
 	defer removeStoreForBenchmarks(b, dbPath)
 
 	store := prepSetBenchmark(b, dbPath, true)
@@ -967,7 +2380,7 @@ func ExampleStore_Set() {
 		log.Fatalf("error setting key value without ttl: %s", err)
 	}
 
-	ttl := uint64(3_600)
+	ttl := time.Hour
 	err = store.Set([]byte("fake"), []byte("bear"), &ttl)
 	if err != nil {
 		log.Fatalf("error setting key value with ttl: %s", err)
@@ -1042,6 +2455,50 @@ func ExampleStore_Search() {
 	// skip 2, limit 3: [hind: enyuma hill: akasozi him: ogwo]
 }
 
+func ExampleStore_Range() {
+	store, err := New("testdb", nil, nil, nil, nil, false, WithOrderedIndex())
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	data := []buffers.KeyValuePair{
+		{K: []byte("fruit:mango"), V: []byte("emiyembe")},
+		{K: []byte("fruit:banana"), V: []byte("ebitooke")},
+		{K: []byte("fruit:orange"), V: []byte("omuchunga")},
+		{K: []byte("fruit:guava"), V: []byte("empera")},
+	}
+
+	for _, rec := range data {
+		err = store.Set(rec.K, rec.V, nil)
+		if err != nil {
+			log.Fatalf("error setting key value: %s", err)
+		}
+	}
+
+	// all keys starting with "fruit:" since ';' comes just after ':'
+	kvs, err := store.Range([]byte("fruit:"), []byte("fruit;"), 0, false)
+	if err != nil {
+		log.Fatalf("error scanning range: %s", err)
+	}
+
+	fmt.Printf("\nall: %v", kvs)
+
+	// the last two, in reverse
+	kvs, err = store.Range([]byte("fruit:"), []byte("fruit;"), 2, true)
+	if err != nil {
+		log.Fatalf("error scanning range in reverse: %s", err)
+	}
+
+	fmt.Printf("\nlast two, reversed: %v", kvs)
+
+	// Output:
+	// all: [fruit:banana: ebitooke fruit:guava: empera fruit:mango: emiyembe fruit:orange: omuchunga]
+	// last two, reversed: [fruit:orange: omuchunga fruit:mango: emiyembe]
+}
+
 func ExampleStore_Delete() {
 	store, err := New("testdb", nil, nil, nil, nil, false)
 	if err != nil {
@@ -1074,8 +2531,17 @@ func removeStoreForBenchmarks(b *testing.B, path string) {
 }
 
 // createStore is a utility to create a store at the given path
-func createStore(t *testing.T, path string, compactionInterval *uint32, isSearchEnabled bool) *Store {
-	store, err := New(path, nil, nil, nil, compactionInterval, isSearchEnabled)
+func createStore(t *testing.T, path string, compactionInterval *uint32, isSearchEnabled bool, opts ...Option) *Store {
+	store, err := New(path, nil, nil, nil, compactionInterval, isSearchEnabled, opts...)
+	if err != nil {
+		t.Fatalf("error opening store: %s", err)
+	}
+	return store
+}
+
+// createStoreWithMaxKeys is a utility to create a store at the given path, whose index initially holds `maxKeys` keys
+func createStoreWithMaxKeys(t *testing.T, path string, maxKeys uint64, isSearchEnabled bool, opts ...Option) *Store {
+	store, err := New(path, &maxKeys, nil, nil, nil, isSearchEnabled, opts...)
 	if err != nil {
 		t.Fatalf("error opening store: %s", err)
 	}
@@ -1092,7 +2558,7 @@ func createStoreForBenchmarks(b *testing.B, path string, compactionInterval *uin
 }
 
 // insertRecords inserts the data into the store
-func insertRecords(t *testing.T, store *Store, data []testRecord, ttl *uint64) {
+func insertRecords(t *testing.T, store *Store, data []testRecord, ttl *time.Duration) {
 	for _, record := range data {
 		err := store.Set(record.k, record.v, ttl)
 		if err != nil {
@@ -1102,7 +2568,7 @@ func insertRecords(t *testing.T, store *Store, data []testRecord, ttl *uint64) {
 }
 
 // insertRecordsForBenchmarks inserts the data into the store
-func insertRecordsForBenchmarks(b *testing.B, store *Store, data []testRecord, ttl *uint64) {
+func insertRecordsForBenchmarks(b *testing.B, store *Store, data []testRecord, ttl *time.Duration) {
 	for _, record := range data {
 		err := store.Set(record.k, record.v, ttl)
 		if err != nil {
@@ -1141,6 +2607,35 @@ func extractKeysFromRecords(records []testRecord) [][]byte {
 	return keys
 }
 
+// getCollidingKeys generates `n` keys that all hash to the same offset in the index of the given header
+func getCollidingKeys(header *headers.DbFileHeader, n int) [][]byte {
+	keys := make([][]byte, 0, n)
+	target := headers.GetIndexOffset(header, []byte("key-0"))
+	for i := 0; len(keys) < n; i++ {
+		k := []byte(fmt.Sprintf("key-%d", i))
+		if headers.GetIndexOffset(header, k) == target {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+// reverseRecords returns a copy of the given records in the reverse order
+func reverseRecords(records []testRecord) []testRecord {
+	reversed := make([]testRecord, 0, len(records))
+	for i := len(records) - 1; i >= 0; i-- {
+		reversed = append(reversed, records[i])
+	}
+
+	return reversed
+}
+
+// getEntrySize returns the size of the key-value entry of the given record in the database file
+func getEntrySize(record testRecord) uint64 {
+	return uint64(len(values.NewKeyValueEntry(record.k, record.v, 0).AsBytes()))
+}
+
 // getFileSize retrieves the size of a given file
 func getFileSize(t *testing.T, dbPath string) int64 {
 	filePath := path.Join(dbPath, "dump.scdb")
@@ -1152,6 +2647,181 @@ func getFileSize(t *testing.T, dbPath string) int64 {
 	return stats.Size()
 }
 
+// getWalSize retrieves the size of the write-ahead log file at the given path
+func getWalSize(t *testing.T, walPath string) int64 {
+	stats, err := os.Stat(walPath)
+	if err != nil {
+		t.Fatalf("error getting file size: %s", err)
+	}
+
+	return stats.Size()
+}
+
+// writeToWal appends the given operations as one record to the write-ahead log at the given path
+func writeToWal(t *testing.T, walPath string, ops ...wal.Op) {
+	log, err := wal.NewLog(walPath)
+	if err != nil {
+		t.Fatalf("error opening write-ahead log: %s", err)
+	}
+	defer func() {
+		_ = log.Close()
+	}()
+
+	err = log.Append(ops...)
+	if err != nil {
+		t.Fatalf("error appending to write-ahead log: %s", err)
+	}
+}
+
+// truncateFile removes the given number of bytes from the end of the file at the given path
+func truncateFile(t *testing.T, filePath string, numOfBytes int64) {
+	stats, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("error getting file size: %s", err)
+	}
+
+	err = os.Truncate(filePath, stats.Size()-numOfBytes)
+	if err != nil {
+		t.Fatalf("error truncating file: %s", err)
+	}
+}
+
+// corruptFile flips the last byte of the first occurrence of the given data in the file at the given path
+func corruptFile(t *testing.T, filePath string, data []byte) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("error reading file: %s", err)
+	}
+
+	idx := bytes.Index(content, data)
+	if idx < 0 {
+		t.Fatalf("%s not found in file", data)
+	}
+
+	addr := idx + len(data) - 1
+	content[addr] = ^content[addr]
+	err = os.WriteFile(filePath, content, 0666)
+	if err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+}
+
+// writeLegacyStore creates a store at the given path, whose database file is in the format used
+// before entries had checksums, and has the given records
+func writeLegacyStore(t *testing.T, dbPath string, records []testRecord) {
+	err := os.MkdirAll(dbPath, 0755)
+	if err != nil {
+		t.Fatalf("error creating store directory: %s", err)
+	}
+
+	file, err := os.OpenFile(path.Join(dbPath, "dump.scdb"), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("error creating database file: %s", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	header := headers.NewDbFileHeader(nil, nil, nil)
+	header.Title = []byte("Scdb versn 0.001")
+	fileSize, err := headers.InitializeFile(file, header)
+	if err != nil {
+		t.Fatalf("error initializing database file: %s", err)
+	}
+
+	for _, record := range records {
+		kvBytes := internal.ConcatByteArrays(
+			internal.Uint32ToByteArray(uint32(17+len(record.k)+len(record.v))),
+			internal.Uint32ToByteArray(uint32(len(record.k))),
+			record.k,
+			[]byte{0},
+			internal.Uint64ToByteArray(0),
+			record.v,
+		)
+		_, err = file.WriteAt(kvBytes, fileSize)
+		if err != nil {
+			t.Fatalf("error writing key-value entry: %s", err)
+		}
+
+		idxAddr := headers.GetIndexOffset(header, record.k)
+		_, err = file.WriteAt(internal.Uint64ToByteArray(uint64(fileSize)), int64(idxAddr))
+		if err != nil {
+			t.Fatalf("error writing index entry: %s", err)
+		}
+
+		fileSize += int64(len(kvBytes))
+	}
+}
+
+// writeSecondsFormatStore creates a database file at the given path in the format whose entries have their expiry
+// in seconds i.e. values.ChecksumFormat, with the given records, each with the corresponding expiry in `expiries`
+func writeSecondsFormatStore(t *testing.T, dbPath string, records []testRecord, expiries []uint64) {
+	err := os.MkdirAll(dbPath, 0755)
+	if err != nil {
+		t.Fatalf("error creating store directory: %s", err)
+	}
+
+	file, err := os.OpenFile(path.Join(dbPath, "dump.scdb"), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("error creating database file: %s", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	header := headers.NewDbFileHeader(nil, nil, nil)
+	header.Title = []byte("Scdb versn 0.002")
+	fileSize, err := headers.InitializeFile(file, header)
+	if err != nil {
+		t.Fatalf("error initializing database file: %s", err)
+	}
+
+	for i, record := range records {
+		// the layout of the entries is the same as that of the current format
+		kvBytes := values.NewKeyValueEntry(record.k, record.v, expiries[i]).AsBytes()
+		_, err = file.WriteAt(kvBytes, fileSize)
+		if err != nil {
+			t.Fatalf("error writing key-value entry: %s", err)
+		}
+
+		idxAddr := headers.GetIndexOffset(header, record.k)
+		_, err = file.WriteAt(internal.Uint64ToByteArray(uint64(fileSize)), int64(idxAddr))
+		if err != nil {
+			t.Fatalf("error writing index entry: %s", err)
+		}
+
+		fileSize += int64(len(kvBytes))
+	}
+}
+
+// readDbFileHeader reads the header of the database file of the store at the given path
+func readDbFileHeader(t *testing.T, dbPath string) *headers.DbFileHeader {
+	file, err := os.Open(path.Join(dbPath, "dump.scdb"))
+	if err != nil {
+		t.Fatalf("error opening database file: %s", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	header, err := headers.ExtractDbFileHeaderFromFile(file)
+	if err != nil {
+		t.Fatalf("error extracting header from file: %s", err)
+	}
+
+	return header
+}
+
+// getTTL returns the time-to-live of the given key in the store
+func getTTL(t *testing.T, store *Store, key []byte) *time.Duration {
+	ttl, err := store.TTL(key)
+	if err != nil {
+		t.Fatalf("error getting ttl of %s: %s", key, err)
+	}
+
+	return ttl
+}
+
 // assertStoreContains asserts that the store contains these given records
 func assertStoreContains(t *testing.T, store *Store, records []testRecord) {
 	for _, record := range records {
@@ -1161,6 +2831,43 @@ func assertStoreContains(t *testing.T, store *Store, records []testRecord) {
 	}
 }
 
+// assertSearchResults asserts that searching the store for the given term returns the given records, in any order
+func assertSearchResults(t *testing.T, store *Store, term []byte, records []testRecord) {
+	got, err := store.Search(term, 0, 0)
+	if err != nil {
+		t.Fatalf("error searching store: %s", err)
+	}
+
+	expected := make([]buffers.KeyValuePair, 0, len(records))
+	for _, record := range records {
+		expected = append(expected, buffers.KeyValuePair{K: record.k, V: record.v})
+	}
+	assert.ElementsMatch(t, expected, got)
+}
+
+// assertRangeResults asserts that scanning the store over the given range returns the given records, in that order
+func assertRangeResults(t *testing.T, store *Store, start []byte, end []byte, limit uint64, reverse bool, records []testRecord) {
+	got, err := store.Range(start, end, limit, reverse)
+	if err != nil {
+		t.Fatalf("error scanning range: %s", err)
+	}
+
+	expected := make([]buffers.KeyValuePair, 0, len(records))
+	for _, record := range records {
+		expected = append(expected, buffers.KeyValuePair{K: record.k, V: record.v})
+	}
+	assert.Equal(t, expected, got)
+}
+
+// assertCompactionFilesDontExist asserts that the temporary files of compaction are not in the store's folder
+func assertCompactionFilesDontExist(t *testing.T, dbPath string) {
+	for _, fileName := range []string{"tmp__compact.scdb", "tmp__compact.iscdb", "tmp__compact.oscdb"} {
+		exists, err := internal.PathExists(path.Join(dbPath, fileName))
+		assert.Nil(t, err)
+		assert.False(t, exists)
+	}
+}
+
 // assertKeysDontExist asserts that the keys don't exist in the store
 func assertKeysDontExist(t *testing.T, store *Store, keys [][]byte) {
 	for _, k := range keys {
@@ -1171,18 +2878,18 @@ func assertKeysDontExist(t *testing.T, store *Store, keys [][]byte) {
 }
 
 // prepCompactBenchmark prepares a store for the benchmarks for the `compact` operations, returning it
-func prepCompactBenchmark(b *testing.B, dbPath string, ttl uint64, isSearchEnabled bool) *Store {
+func prepCompactBenchmark(b *testing.B, dbPath string, ttl time.Duration, isSearchEnabled bool) *Store {
 	removeStoreForBenchmarks(b, dbPath)
 	store := createStoreForBenchmarks(b, dbPath, nil, isSearchEnabled)
 	insertRecordsForBenchmarks(b, store, Records[:3], nil)
 	insertRecordsForBenchmarks(b, store, Records[3:], &ttl)
 	deleteRecordsForBenchmarks(b, store, [][]byte{Records[3].k})
-	time.Sleep(2 * time.Second)
+	time.Sleep(time.Second)
 	return store
 }
 
 // prepDeleteBenchmark prepares a store for the benchmarks for the `delete` operations, returning it
-func prepDeleteBenchmark(b *testing.B, dbPath string, ttl *uint64, isSearchEnabled bool) *Store {
+func prepDeleteBenchmark(b *testing.B, dbPath string, ttl *time.Duration, isSearchEnabled bool) *Store {
 	removeStoreForBenchmarks(b, dbPath)
 	store := createStoreForBenchmarks(b, dbPath, nil, isSearchEnabled)
 	insertRecordsForBenchmarks(b, store, Records, ttl)
@@ -1190,7 +2897,7 @@ func prepDeleteBenchmark(b *testing.B, dbPath string, ttl *uint64, isSearchEnabl
 }
 
 // prepGetBenchmark prepares a store for the benchmarks for the `get` operations, returning it
-func prepGetBenchmark(b *testing.B, dbPath string, ttl *uint64, isSearchEnabled bool) *Store {
+func prepGetBenchmark(b *testing.B, dbPath string, ttl *time.Duration, isSearchEnabled bool) *Store {
 	removeStoreForBenchmarks(b, dbPath)
 	store := createStoreForBenchmarks(b, dbPath, nil, isSearchEnabled)
 	insertRecordsForBenchmarks(b, store, Records, ttl)
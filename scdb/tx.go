@@ -0,0 +1,214 @@
+package scdb
+
+import (
+	"bytes"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal/buffers"
+	"github.com/sopherapps/go-scdb/scdb/internal/entries/values"
+	"github.com/sopherapps/go-scdb/scdb/internal/wal"
+	"time"
+)
+
+// Tx is a transaction on the store, passed to the closures given to Store.Update and Store.View.
+//
+// The writes of a transaction are kept in memory until the closure returns, and are only visible
+// to the transaction itself i.e. read-your-writes. They are then applied to the store as a single atomic unit
+// if the closure returns nil, or discarded if it returns an error.
+//
+// A Tx must not be used after its closure returns, and the store's own methods must not be called
+// inside the closure as the store is locked for the whole transaction.
+type Tx struct {
+	store      *Store
+	isWritable bool
+	isClosed   bool
+	ops        []wal.Op
+	// pending is the position in `ops` of the latest write for each key
+	pending map[string]int
+}
+
+// Update runs the given function in a read-write transaction.
+//
+// All the sets and deletes done in the transaction are applied to the store as a single atomic unit
+// when `fn` returns nil. If `fn` returns an error, they are all rolled back and that error is returned.
+// Like with Store.Batch, if applying them fails partway, the store returns an errors.ErrStoreFailed
+// from all operations but Close until it is reopened, which applies the rest of them.
+func (s *Store) Update(fn func(tx *Tx) error) error {
+	if s.isReadOnly {
+		return errors.NewErrReadOnly("update")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failure != nil {
+		return s.failure
+	}
+
+	tx := newTx(s, true)
+	defer tx.close()
+
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+
+	if len(tx.ops) == 0 {
+		return nil
+	}
+
+	return s.applyAtomically(tx.ops)
+}
+
+// View runs the given function in a read-only transaction.
+//
+// Any attempt to set or delete a key in the transaction returns an errors.ErrNotSupported.
+// The error returned by `fn`, if any, is returned.
+func (s *Store) View(fn func(tx *Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.failure != nil {
+		return s.failure
+	}
+
+	tx := newTx(s, false)
+	defer tx.close()
+
+	return fn(tx)
+}
+
+// newTx creates a new transaction on the given store
+func newTx(store *Store, isWritable bool) *Tx {
+	return &Tx{
+		store:      store,
+		isWritable: isWritable,
+		ops:        make([]wal.Op, 0),
+		pending:    make(map[string]int),
+	}
+}
+
+// Get returns the value corresponding to the given key, taking into account the writes
+// already done in the transaction
+func (tx *Tx) Get(k []byte) ([]byte, error) {
+	if tx.isClosed {
+		return nil, errors.NewErrNotSupported("use of a closed transaction")
+	}
+
+	if idx, ok := tx.pending[string(k)]; ok {
+		op := tx.ops[idx]
+		if op.Kind == wal.OpDelete || values.IsExpiryPast(op.Expiry) {
+			return nil, nil
+		}
+		return op.Value, nil
+	}
+
+	return tx.store.get(k)
+}
+
+// Set sets the given key value in the transaction.
+// `ttl` is the time-to-live, to the nearest millisecond. If it is nil, the key-value pair never expires.
+func (tx *Tx) Set(k []byte, v []byte, ttl *time.Duration) error {
+	err := tx.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	expiry := expiryFromTTL(uint64(time.Now().UnixMilli()), ttl)
+
+	tx.addOp(wal.Op{Kind: wal.OpSet, Key: k, Value: v, Expiry: expiry})
+	return nil
+}
+
+// Delete removes the key-value for the given key in the transaction
+func (tx *Tx) Delete(k []byte) error {
+	err := tx.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	tx.addOp(wal.Op{Kind: wal.OpDelete, Key: k})
+	return nil
+}
+
+// Search searches for unexpired keys that start with the given search term, taking into account
+// the writes already done in the transaction.
+//
+// It skips the first `skip` number of results and returns not more than `limit` number of items.
+// If `limit` is 0, all items are returned.
+func (tx *Tx) Search(term []byte, skip uint64, limit uint64) ([]buffers.KeyValuePair, error) {
+	if tx.isClosed {
+		return nil, errors.NewErrNotSupported("use of a closed transaction")
+	}
+
+	if tx.store.searchIndex == nil {
+		return nil, errors.NewErrNotSupported("search")
+	}
+
+	if len(tx.ops) == 0 {
+		return tx.store.search(term, skip, limit)
+	}
+
+	// pagination can only be done after the writes of the transaction are merged in
+	saved, err := tx.store.search(term, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]buffers.KeyValuePair, 0, len(saved))
+	for _, kv := range saved {
+		if _, ok := tx.pending[string(kv.K)]; !ok {
+			results = append(results, kv)
+		}
+	}
+
+	for i, op := range tx.ops {
+		isLatest := tx.pending[string(op.Key)] == i
+		if isLatest && op.Kind == wal.OpSet && !values.IsExpiryPast(op.Expiry) && bytes.HasPrefix(op.Key, term) {
+			results = append(results, buffers.KeyValuePair{K: op.Key, V: op.Value})
+		}
+	}
+
+	return paginate(results, skip, limit), nil
+}
+
+// addOp records the given write in the transaction
+func (tx *Tx) addOp(op wal.Op) {
+	tx.pending[string(op.Key)] = len(tx.ops)
+	tx.ops = append(tx.ops, op)
+}
+
+// checkWritable returns an error if the transaction can't be written to
+func (tx *Tx) checkWritable() error {
+	if tx.isClosed {
+		return errors.NewErrNotSupported("use of a closed transaction")
+	}
+
+	if !tx.isWritable {
+		return errors.NewErrNotSupported("write in a read-only transaction")
+	}
+
+	return nil
+}
+
+// close marks the transaction as no longer usable, discarding any writes in it
+func (tx *Tx) close() {
+	tx.isClosed = true
+	tx.ops = nil
+	tx.pending = nil
+}
+
+// paginate skips the first `skip` items and returns not more than `limit` of the rest.
+// If `limit` is 0, all the rest are returned.
+func paginate(items []buffers.KeyValuePair, skip uint64, limit uint64) []buffers.KeyValuePair {
+	length := uint64(len(items))
+	if skip >= length {
+		return []buffers.KeyValuePair{}
+	}
+
+	end := length
+	if limit > 0 && skip+limit < length {
+		end = skip + limit
+	}
+
+	return items[skip:end]
+}
@@ -0,0 +1,312 @@
+package scdb
+
+import (
+	goErrors "errors"
+	"github.com/sopherapps/go-scdb/scdb/errors"
+	"github.com/sopherapps/go-scdb/scdb/internal/buffers"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestStore_Update(t *testing.T) {
+	dbPath := "testdb_update"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	t.Run("UpdateCommitsAllWritesIfFnReturnsNil", func(t *testing.T) {
+		for _, opts := range [][]Option{{}, {WithWAL()}} {
+			func() {
+				defer func() {
+					removeStore(t, dbPath)
+				}()
+				store := createStore(t, dbPath, nil, true, opts...)
+				defer func() {
+					_ = store.Close()
+				}()
+				insertRecords(t, store, Records[:2], nil)
+
+				err := store.Update(func(tx *Tx) error {
+					for _, record := range Records[2:] {
+						err := tx.Set(record.k, record.v, nil)
+						if err != nil {
+							return err
+						}
+					}
+					return tx.Delete(Records[0].k)
+				})
+				if err != nil {
+					t.Fatalf("error updating store: %s", err)
+				}
+
+				assertStoreContains(t, store, Records[1:])
+				assertKeysDontExist(t, store, [][]byte{Records[0].k})
+			}()
+		}
+	})
+
+	t.Run("UpdateRollsBackAllWritesIfFnReturnsError", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:2], nil)
+		initialFileSize := getFileSize(t, dbPath)
+
+		expectedErr := goErrors.New("some error")
+		err := store.Update(func(tx *Tx) error {
+			for _, record := range Records[2:] {
+				err := tx.Set(record.k, record.v, nil)
+				if err != nil {
+					return err
+				}
+			}
+			err := tx.Delete(Records[0].k)
+			if err != nil {
+				return err
+			}
+			return expectedErr
+		})
+
+		assert.Equal(t, expectedErr, err)
+		assertStoreContains(t, store, Records[:2])
+		assertKeysDontExist(t, store, extractKeysFromRecords(Records[2:]))
+		assert.Equal(t, initialFileSize, getFileSize(t, dbPath))
+	})
+
+	t.Run("GetInTransactionReadsTheTransactionsOwnWrites", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, Records[:2], nil)
+
+		err := store.Update(func(tx *Tx) error {
+			err := tx.Set(Records[0].k, []byte("new value"), nil)
+			if err != nil {
+				return err
+			}
+			err = tx.Delete(Records[1].k)
+			if err != nil {
+				return err
+			}
+			err = tx.Set(Records[2].k, Records[2].v, nil)
+			if err != nil {
+				return err
+			}
+
+			assertTxContains(t, tx, []testRecord{{Records[0].k, []byte("new value")}, Records[2]})
+			assertTxKeysDontExist(t, tx, [][]byte{Records[1].k})
+
+			// the store itself is not yet changed
+			got, err := store.get(Records[1].k)
+			assert.Nil(t, err)
+			assert.Equal(t, Records[1].v, got)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("error updating store: %s", err)
+		}
+
+		assertStoreContains(t, store, []testRecord{{Records[0].k, []byte("new value")}, Records[2]})
+		assertKeysDontExist(t, store, [][]byte{Records[1].k})
+	})
+
+	t.Run("SetInTransactionWithTTLExpiresAfterTTLSeconds", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		ttl := 500 * time.Millisecond
+		err := store.Update(func(tx *Tx) error {
+			return tx.Set(Records[0].k, Records[0].v, &ttl)
+		})
+		if err != nil {
+			t.Fatalf("error updating store: %s", err)
+		}
+
+		assertStoreContains(t, store, Records[:1])
+		time.Sleep(time.Second)
+		assertKeysDontExist(t, store, [][]byte{Records[0].k})
+	})
+
+	t.Run("SearchInTransactionIncludesTheTransactionsOwnWrites", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, true)
+		defer func() {
+			_ = store.Close()
+		}()
+		insertRecords(t, store, SearchRecords[:3], nil)
+
+		err := store.Update(func(tx *Tx) error {
+			err := tx.Delete(SearchRecords[0].k)
+			if err != nil {
+				return err
+			}
+			err = tx.Set(SearchRecords[1].k, []byte("new value"), nil)
+			if err != nil {
+				return err
+			}
+			err = tx.Set([]byte("fort"), []byte("new"), nil)
+			if err != nil {
+				return err
+			}
+
+			got, err := tx.Search([]byte("fo"), 0, 0)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, []buffers.KeyValuePair{
+				{K: SearchRecords[2].k, V: SearchRecords[2].v},
+				{K: SearchRecords[1].k, V: []byte("new value")},
+				{K: []byte("fort"), V: []byte("new")},
+			}, got)
+
+			got, err = tx.Search([]byte("fo"), 1, 1)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, []buffers.KeyValuePair{{K: SearchRecords[1].k, V: []byte("new value")}}, got)
+
+			got, err = tx.Search([]byte("fo"), 4, 0)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, []buffers.KeyValuePair{}, got)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("error updating store: %s", err)
+		}
+	})
+
+	t.Run("TransactionCannotBeUsedAfterFnReturns", func(t *testing.T) {
+		defer func() {
+			removeStore(t, dbPath)
+		}()
+		store := createStore(t, dbPath, nil, false)
+		defer func() {
+			_ = store.Close()
+		}()
+
+		var leakedTx *Tx
+		err := store.Update(func(tx *Tx) error {
+			leakedTx = tx
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("error updating store: %s", err)
+		}
+
+		_, err = leakedTx.Get(Records[0].k)
+		assert.IsType(t, &errors.ErrNotSupported{}, err)
+		err = leakedTx.Set(Records[0].k, Records[0].v, nil)
+		assert.IsType(t, &errors.ErrNotSupported{}, err)
+	})
+}
+
+func TestStore_View(t *testing.T) {
+	dbPath := "testdb_view"
+	removeStore(t, dbPath)
+	defer func() {
+		removeStore(t, dbPath)
+	}()
+
+	store := createStore(t, dbPath, nil, true)
+	defer func() {
+		_ = store.Close()
+	}()
+	insertRecords(t, store, SearchRecords, nil)
+
+	t.Run("ViewCanReadTheStore", func(t *testing.T) {
+		err := store.View(func(tx *Tx) error {
+			assertTxContains(t, tx, SearchRecords)
+
+			got, err := tx.Search([]byte("ba"), 0, 0)
+			if err != nil {
+				return err
+			}
+			assert.Equal(t, []buffers.KeyValuePair{
+				{K: SearchRecords[3].k, V: SearchRecords[3].v},
+				{K: SearchRecords[4].k, V: SearchRecords[4].v},
+			}, got)
+			return nil
+		})
+		assert.Nil(t, err)
+	})
+
+	t.Run("ViewCannotWriteToTheStore", func(t *testing.T) {
+		err := store.View(func(tx *Tx) error {
+			err := tx.Set(Records[0].k, Records[0].v, nil)
+			assert.IsType(t, &errors.ErrNotSupported{}, err)
+			err = tx.Delete(SearchRecords[0].k)
+			assert.IsType(t, &errors.ErrNotSupported{}, err)
+			return nil
+		})
+		assert.Nil(t, err)
+		assertStoreContains(t, store, SearchRecords)
+		assertKeysDontExist(t, store, [][]byte{Records[0].k})
+	})
+
+	t.Run("ViewReturnsTheErrorOfFn", func(t *testing.T) {
+		expectedErr := goErrors.New("some error")
+		err := store.View(func(tx *Tx) error {
+			return expectedErr
+		})
+		assert.Equal(t, expectedErr, err)
+	})
+}
+
+func ExampleStore_Update() {
+	store, err := New("testdb", nil, nil, nil, nil, false)
+	if err != nil {
+		log.Fatalf("error opening store: %s", err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	err = store.Update(func(tx *Tx) error {
+		err := tx.Set([]byte("foo"), []byte("bar"), nil)
+		if err != nil {
+			return err
+		}
+		return tx.Delete([]byte("hey"))
+	})
+	if err != nil {
+		log.Fatalf("error updating store: %s", err)
+	}
+}
+
+// assertTxContains asserts that the transaction sees the given records
+func assertTxContains(t *testing.T, tx *Tx, records []testRecord) {
+	for _, record := range records {
+		got, err := tx.Get(record.k)
+		assert.Nil(t, err)
+		assert.Equal(t, record.v, got)
+	}
+}
+
+// assertTxKeysDontExist asserts that the keys don't exist as far as the transaction can see
+func assertTxKeysDontExist(t *testing.T, tx *Tx, keys [][]byte) {
+	for _, k := range keys {
+		got, err := tx.Get(k)
+		assert.Nil(t, err)
+		assert.Nil(t, got)
+	}
+}